@@ -25,6 +25,7 @@ import (
 	"errors"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -47,6 +48,20 @@ type WorkerPool struct {
 
 	workerChanPool sync.Pool
 	startOnce      sync.Once
+	// running number of functions being executed
+	running int64
+}
+
+// WorkerPoolStats is a snapshot of the worker pool state.
+type WorkerPoolStats struct {
+	// MaxWorkers is the maximum number of workers
+	MaxWorkers int
+	// Workers is the number of started workers
+	Workers int
+	// IdleWorkers is the number of workers waiting for a function
+	IdleWorkers int
+	// Running is the number of functions being executed
+	Running int64
 }
 
 type workerChan struct {
@@ -104,6 +119,19 @@ func (wp *WorkerPool) Stop() {
 func (wp *WorkerPool) Release() {
 	wp.Stop()
 }
+
+// Stats returns a snapshot of the worker pool state.
+func (wp *WorkerPool) Stats() WorkerPoolStats {
+	wp.lock.Lock()
+	defer wp.lock.Unlock()
+	return WorkerPoolStats{
+		MaxWorkers:  wp.MaxWorkersCount,
+		Workers:     wp.workersCount,
+		IdleWorkers: len(wp.ready),
+		Running:     atomic.LoadInt64(&wp.running),
+	}
+}
+
 func (wp *WorkerPool) getMaxIdleWorkerDuration() time.Duration {
 	if wp.MaxIdleWorkerDuration <= 0 {
 		return 10 * time.Second
@@ -233,7 +261,9 @@ func (wp *WorkerPool) workerFunc(ch *workerChan) {
 		if fn == nil {
 			break
 		}
+		atomic.AddInt64(&wp.running, 1)
 		fn()
+		atomic.AddInt64(&wp.running, -1)
 		fn = nil
 
 		if !wp.release(ch) {
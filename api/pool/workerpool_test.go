@@ -86,3 +86,28 @@ func TestWorkerPoolWithDoubleStart(*testing.T) {
 		wp.Stop()
 	}()
 }
+
+func TestWorkerPoolStats(t *testing.T) {
+	wp := &WorkerPool{MaxWorkersCount: 10}
+	wp.Start()
+	defer wp.Stop()
+	release := make(chan struct{})
+	for i := 0; i < 3; i++ {
+		if wp.Submit(func() {
+			<-release
+		}) != nil {
+			t.Fatalf("cannot submit function #%d", i)
+		}
+	}
+	time.Sleep(time.Millisecond * 50)
+	stats := wp.Stats()
+	if stats.MaxWorkers != 10 || stats.Workers != 3 || stats.Running != 3 || stats.IdleWorkers != 0 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	close(release)
+	time.Sleep(time.Millisecond * 50)
+	stats = wp.Stats()
+	if stats.Running != 0 || stats.IdleWorkers != 3 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
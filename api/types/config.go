@@ -65,6 +65,12 @@ type Config struct {
 	// EndpointEnabled indicates whether the endpoint module in the rule chain DSL is enabled.
 	EndpointEnabled bool
 	NetPool         NodePool
+	// MessageStore is used to checkpoint in-flight messages so that unfinished executions can be resumed
+	// by `RuleEngine.Recover` after a restart. If not configured, messages are only kept in memory.
+	MessageStore MessageStore
+	// DeadLetterQueue captures messages that failed at a node without a `Failure` connection,
+	// so they can be listed, inspected and replayed. If not configured, such messages are dropped.
+	DeadLetterQueue DeadLetterQueue
 }
 
 // RegisterUdf registers a custom function. Function names can be repeated for different script types.
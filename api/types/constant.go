@@ -43,4 +43,9 @@ const (
 var (
 	// ErrConcurrencyLimitReached is the error returned when the concurrency limit has been reached
 	ErrConcurrencyLimitReached = errors.New("concurrency limit reached")
+	// ErrRateLimitExceeded is the error returned when the rate limit has been exceeded
+	ErrRateLimitExceeded = errors.New("rate limit exceeded")
+	// ErrMsgDropped is the error returned by a start aspect to discard the message silently.
+	// The rule chain ends with the Dropped relation type and without error.
+	ErrMsgDropped = errors.New("message dropped")
 )
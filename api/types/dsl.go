@@ -156,6 +156,8 @@ type RuleNodeRunLog struct {
 	StartTs int64 `json:"startTs"`
 	// EndTs is the end time of execution.
 	EndTs int64 `json:"endTs"`
+	// Attempts is the number of times the node was executed. It is only set when the node was retried.
+	Attempts int `json:"attempts,omitempty"`
 }
 
 // EndpointDsl defines the DSL for an endpoint.
@@ -179,10 +181,40 @@ type RouterDsl struct {
 	From FromDsl `json:"from"`
 	// To is the destination for the router.
 	To ToDsl `json:"to"`
+	// Ack defines which outcomes of the 'To' executor count as success when acknowledging
+	// messages of transports that support acknowledgement. If nil, the default policy is used.
+	Ack *AckPolicy `json:"ack,omitempty"`
 	// AdditionalInfo is an extension field.
 	AdditionalInfo map[string]interface{} `json:"additionalInfo,omitempty"`
 }
 
+// AckPolicy defines which outcomes of the rule chain count as success for a router.
+// Endpoints whose messages implement endpoint.AckableMessage, such as mqtt, kafka and net,
+// acknowledge the message when all branches of the rule chain have ended with success,
+// otherwise negatively acknowledge it, and the transport decides whether to redeliver it.
+type AckPolicy struct {
+	// SuccessRelationTypes is the list of relation types of the branch ends that count as success.
+	// If empty, any branch end without error and with a relation type other than Failure counts as success.
+	SuccessRelationTypes []string `json:"successRelationTypes,omitempty"`
+}
+
+// IsSuccess checks whether a branch end of the rule chain counts as success.
+// A nil policy is the default policy.
+func (p *AckPolicy) IsSuccess(relationType string, err error) bool {
+	if err != nil {
+		return false
+	}
+	if p == nil || len(p.SuccessRelationTypes) == 0 {
+		return relationType != Failure
+	}
+	for _, item := range p.SuccessRelationTypes {
+		if item == relationType {
+			return true
+		}
+	}
+	return false
+}
+
 // FromDsl defines the source for an endpoint router.
 type FromDsl struct {
 	// Path is the path of the source.
@@ -20,6 +20,7 @@ package endpoint
 import (
 	"context"
 	"net/textproto"
+	"sync/atomic"
 
 	"github.com/rulego/rulego/api/types"
 )
@@ -110,6 +111,18 @@ type Message interface {
 	GetError() error
 }
 
+// AckableMessage is an incoming message whose transport supports acknowledgement.
+// The executor of the router calls Ack when all branches of the rule chain have ended
+// with success according to the router's AckPolicy, otherwise it calls Nack.
+// What Nack does depends on the transport, for example, redelivering the message.
+type AckableMessage interface {
+	Message
+	// Ack acknowledges that the message has been processed successfully.
+	Ack() error
+	// Nack negatively acknowledges the message with the error that caused the failure.
+	Nack(err error) error
+}
+
 // Exchange is a structure containing both inbound and outbound messages.
 type Exchange struct {
 	// In represents the incoming message.
@@ -118,6 +131,32 @@ type Exchange struct {
 	Out Message
 	// Context provides a context for the exchange.
 	Context context.Context
+	// acked indicates whether Ack or Nack has been called.
+	acked int32
+}
+
+// IsAckable checks if the incoming message supports acknowledgement.
+func (e *Exchange) IsAckable() bool {
+	_, ok := e.In.(AckableMessage)
+	return ok
+}
+
+// Ack acknowledges the incoming message if it implements AckableMessage.
+// Only the first call of Ack or Nack takes effect.
+func (e *Exchange) Ack() error {
+	if m, ok := e.In.(AckableMessage); ok && atomic.CompareAndSwapInt32(&e.acked, 0, 1) {
+		return m.Ack()
+	}
+	return nil
+}
+
+// Nack negatively acknowledges the incoming message if it implements AckableMessage.
+// Only the first call of Ack or Nack takes effect.
+func (e *Exchange) Nack(err error) error {
+	if m, ok := e.In.(AckableMessage); ok && atomic.CompareAndSwapInt32(&e.acked, 0, 1) {
+		return m.Nack(err)
+	}
+	return nil
 }
 
 // From is an interface representing the source of data in a routing operation.
@@ -191,6 +230,10 @@ type Router interface {
 	IsDisable() bool
 	// Definition returns the DSL definition of the router.If not set, it will be nil
 	Definition() *types.RouterDsl
+	// SetAckPolicy sets which outcomes of the rule chain count as success when acknowledging AckableMessage.
+	SetAckPolicy(policy *types.AckPolicy) Router
+	// GetAckPolicy returns the acknowledgement policy of the router. If not set, it will be nil, which is the default policy.
+	GetAckPolicy() *types.AckPolicy
 	SetParams(args ...interface{})
 	GetParams() []interface{}
 	// Err returns the error associated with the router initialization.
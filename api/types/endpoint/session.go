@@ -0,0 +1,78 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package endpoint
+
+import (
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrSessionNotFound is returned when pushing to a session that is not connected.
+	ErrSessionNotFound = errors.New("session not found")
+	// ErrSlowConsumer is returned when a session's send buffer is full. The session is evicted.
+	ErrSlowConsumer = errors.New("slow consumer")
+)
+
+// PushMessage is a message pushed by the server to connected clients.
+type PushMessage struct {
+	// Data is the message payload.
+	Data []byte
+	// Binary sends the payload as a binary frame instead of a text frame.
+	Binary bool
+}
+
+// SessionManager pushes messages to clients of an endpoint that keeps long-lived connections, such as WebSocket.
+// Sessions can join rooms, so that a message can be pushed to all sessions in a room.
+type SessionManager interface {
+	// PushToSession pushes a message to the session with the given id.
+	PushToSession(sessionId string, msg PushMessage) error
+	// PushToRoom pushes a message to all sessions in the room and returns the number of sessions it was queued for.
+	PushToRoom(room string, msg PushMessage) (int, error)
+	// Broadcast pushes a message to all sessions and returns the number of sessions it was queued for.
+	Broadcast(msg PushMessage) (int, error)
+}
+
+var sessionManagers = struct {
+	sync.RWMutex
+	m map[string]SessionManager
+}{m: make(map[string]SessionManager)}
+
+// RegisterSessionManager registers the session manager of an endpoint, usually keyed by the server address.
+// Components such as the wsPush node look it up with GetSessionManager.
+func RegisterSessionManager(id string, manager SessionManager) {
+	sessionManagers.Lock()
+	defer sessionManagers.Unlock()
+	sessionManagers.m[id] = manager
+}
+
+// UnregisterSessionManager removes the session manager, if it is still the one registered with id.
+func UnregisterSessionManager(id string, manager SessionManager) {
+	sessionManagers.Lock()
+	defer sessionManagers.Unlock()
+	if sessionManagers.m[id] == manager {
+		delete(sessionManagers.m, id)
+	}
+}
+
+// GetSessionManager returns the session manager registered with id.
+func GetSessionManager(id string) (SessionManager, bool) {
+	sessionManagers.RLock()
+	defer sessionManagers.RUnlock()
+	manager, ok := sessionManagers.m[id]
+	return manager, ok
+}
@@ -0,0 +1,58 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package endpoint
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrStreamClosed is returned when writing to a stream whose client has disconnected or whose response has ended.
+var ErrStreamClosed = errors.New("stream closed")
+
+// StreamEvent is a partial output pushed to the client of a streaming response.
+type StreamEvent struct {
+	// Event is the event name. Empty means the default event, e.g. SSE "message".
+	// Line breaks are removed before it is written.
+	Event string
+	// Data is the event payload.
+	Data []byte
+}
+
+// StreamWriter pushes partial outputs to the client of a streaming response.
+// Endpoints that support streaming, such as the HTTP endpoint in SSE or chunked mode,
+// put it into the context.Context passed to the rule chain, so nodes can get it with StreamWriterFromContext.
+type StreamWriter interface {
+	// Write sends an event to the client and flushes it immediately.
+	Write(event StreamEvent) error
+}
+
+type streamWriterKey struct{}
+
+// WithStreamWriter returns a copy of ctx carrying the stream writer.
+func WithStreamWriter(ctx context.Context, writer StreamWriter) context.Context {
+	return context.WithValue(ctx, streamWriterKey{}, writer)
+}
+
+// StreamWriterFromContext returns the stream writer carried by ctx, if any.
+func StreamWriterFromContext(ctx context.Context) (StreamWriter, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	writer, ok := ctx.Value(streamWriterKey{}).(StreamWriter)
+	return writer, ok
+}
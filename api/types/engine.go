@@ -80,6 +80,14 @@ type RuleEngine interface {
 	RootRuleContext() RuleContext
 	// GetMetrics returns the metrics of the RuleEngine.
 	GetMetrics() *metrics.EngineMetrics
+	// Recover resumes the unfinished executions persisted in the configured MessageStore.
+	Recover(opts ...RuleContextOption) error
+	// DeadLetters returns the dead letters of the rule chain captured in the configured DeadLetterQueue.
+	DeadLetters() ([]DeadLetter, error)
+	// GetDeadLetter returns a dead letter of the rule chain by its ID.
+	GetDeadLetter(id string) (DeadLetter, error)
+	// ReplayDeadLetter executes a dead letter again starting from the failing node and removes it from the queue once the execution completes.
+	ReplayDeadLetter(id string, opts ...RuleContextOption) error
 }
 
 // RuleEnginePool is an interface for a pool of rule engines.
@@ -0,0 +1,95 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuckets is the default upper bounds of latency histogram buckets, in seconds.
+var DefaultBuckets = []float64{0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram is a lock-free latency histogram with fixed buckets, compatible with the Prometheus histogram type.
+type Histogram struct {
+	// buckets upper bounds in seconds, sorted ascending
+	buckets []float64
+	// counts non-cumulative count of each bucket, the last one is +Inf
+	counts []uint64
+	// sum total observed duration in nanoseconds
+	sum int64
+}
+
+// HistogramSnapshot is a copy of the histogram state.
+type HistogramSnapshot struct {
+	// Buckets upper bounds in seconds
+	Buckets []float64
+	// Counts cumulative count of each bucket, the last one is +Inf and equals Count
+	Counts []uint64
+	// Sum total observed duration in seconds
+	Sum float64
+	// Count number of observations
+	Count uint64
+}
+
+// NewHistogram creates a histogram with the specified bucket upper bounds in seconds.
+// If buckets is empty, DefaultBuckets is used.
+func NewHistogram(buckets []float64) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := make([]float64, len(buckets))
+	copy(sorted, buckets)
+	sort.Float64s(sorted)
+	return &Histogram{
+		buckets: sorted,
+		counts:  make([]uint64, len(sorted)+1),
+	}
+}
+
+// Observe records a duration.
+func (h *Histogram) Observe(d time.Duration) {
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(h.buckets, seconds)
+	atomic.AddUint64(&h.counts[i], 1)
+	atomic.AddInt64(&h.sum, int64(d))
+}
+
+// Get returns a snapshot of the histogram with cumulative bucket counts.
+func (h *Histogram) Get() HistogramSnapshot {
+	snapshot := HistogramSnapshot{
+		Buckets: h.buckets,
+		Counts:  make([]uint64, len(h.counts)),
+	}
+	var cumulative uint64
+	for i := range h.counts {
+		cumulative += atomic.LoadUint64(&h.counts[i])
+		snapshot.Counts[i] = cumulative
+	}
+	snapshot.Count = cumulative
+	snapshot.Sum = time.Duration(atomic.LoadInt64(&h.sum)).Seconds()
+	return snapshot
+}
+
+// Reset resets the histogram to zero.
+func (h *Histogram) Reset() {
+	for i := range h.counts {
+		atomic.StoreUint64(&h.counts[i], 0)
+	}
+	atomic.StoreInt64(&h.sum, 0)
+}
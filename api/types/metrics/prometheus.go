@@ -0,0 +1,170 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// PrometheusContentType is the content type of the Prometheus text exposition format.
+const PrometheusContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Handler returns a http.Handler that exposes the metrics in Prometheus text format.
+// It can be mounted on the rest endpoint, for example: restEndpoint.Handle(http.MethodGet, "/metrics", registry.Handler())
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", PrometheusContentType)
+		_ = r.WritePrometheus(w)
+	})
+}
+
+// WritePrometheus writes the metrics in Prometheus text format.
+func (r *Registry) WritePrometheus(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	chains := r.Chains()
+	nodes := r.Nodes()
+
+	writeHeader(bw, "rulego_chain_current", "gauge", "Number of rule chain executions in progress.")
+	for _, m := range chains {
+		writeSample(bw, "rulego_chain_current", chainLabels(m), float64(atomic.LoadInt64(&m.Current)))
+	}
+	writeHeader(bw, "rulego_chain_total", "counter", "Total number of rule chain executions.")
+	for _, m := range chains {
+		writeSample(bw, "rulego_chain_total", chainLabels(m), float64(atomic.LoadInt64(&m.Total)))
+	}
+	writeHeader(bw, "rulego_chain_branch_total", "counter", "Number of ended rule chain branches by result.")
+	for _, m := range chains {
+		writeSample(bw, "rulego_chain_branch_total", append(chainLabels(m), "result", "success"), float64(atomic.LoadInt64(&m.Success)))
+		writeSample(bw, "rulego_chain_branch_total", append(chainLabels(m), "result", "failure"), float64(atomic.LoadInt64(&m.Failed)))
+	}
+	writeHeader(bw, "rulego_chain_duration_seconds", "histogram", "Duration of rule chain executions in seconds.")
+	for _, m := range chains {
+		writeHistogram(bw, "rulego_chain_duration_seconds", chainLabels(m), m.Latency.Get())
+	}
+
+	writeHeader(bw, "rulego_node_executions_total", "counter", "Total number of rule node executions.")
+	for _, m := range nodes {
+		writeSample(bw, "rulego_node_executions_total", nodeLabels(m), float64(atomic.LoadInt64(&m.Total)))
+	}
+	writeHeader(bw, "rulego_node_relations_total", "counter", "Number of rule node outputs by relation type.")
+	for _, m := range nodes {
+		relations := m.Relations()
+		var keys []string
+		for k := range relations {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			writeSample(bw, "rulego_node_relations_total", append(nodeLabels(m), "relation_type", k), float64(relations[k]))
+		}
+	}
+	writeHeader(bw, "rulego_node_errors_total", "counter", "Number of rule node outputs with an error.")
+	for _, m := range nodes {
+		writeSample(bw, "rulego_node_errors_total", nodeLabels(m), float64(atomic.LoadInt64(&m.Errors)))
+	}
+	writeHeader(bw, "rulego_node_duration_seconds", "histogram", "Duration from the start of a rule node to its first output in seconds.")
+	for _, m := range nodes {
+		writeHistogram(bw, "rulego_node_duration_seconds", nodeLabels(m), m.Latency.Get())
+	}
+
+	pools := r.Pools()
+	var poolNames []string
+	for name := range pools {
+		poolNames = append(poolNames, name)
+	}
+	sort.Strings(poolNames)
+	writeHeader(bw, "rulego_pool_max_workers", "gauge", "Maximum number of workers of the pool.")
+	for _, name := range poolNames {
+		writeSample(bw, "rulego_pool_max_workers", []string{"pool", name}, float64(pools[name].MaxWorkers))
+	}
+	writeHeader(bw, "rulego_pool_workers", "gauge", "Number of started workers of the pool.")
+	for _, name := range poolNames {
+		writeSample(bw, "rulego_pool_workers", []string{"pool", name}, float64(pools[name].Workers))
+	}
+	writeHeader(bw, "rulego_pool_idle_workers", "gauge", "Number of idle workers of the pool.")
+	for _, name := range poolNames {
+		writeSample(bw, "rulego_pool_idle_workers", []string{"pool", name}, float64(pools[name].IdleWorkers))
+	}
+	writeHeader(bw, "rulego_pool_running", "gauge", "Number of tasks being executed by the pool.")
+	for _, name := range poolNames {
+		writeSample(bw, "rulego_pool_running", []string{"pool", name}, float64(pools[name].Running))
+	}
+	return bw.Flush()
+}
+
+func chainLabels(m *ChainMetrics) []string {
+	return []string{"chain_id", m.ChainId}
+}
+
+func nodeLabels(m *NodeMetrics) []string {
+	return []string{"chain_id", m.ChainId, "node_id", m.NodeId, "node_type", m.NodeType}
+}
+
+func writeHeader(w *bufio.Writer, name, metricType, help string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+func writeHistogram(w *bufio.Writer, name string, labels []string, h HistogramSnapshot) {
+	for i, upper := range h.Buckets {
+		writeSample(w, name+"_bucket", append(labels, "le", formatFloat(upper)), float64(h.Counts[i]))
+	}
+	writeSample(w, name+"_bucket", append(labels, "le", "+Inf"), float64(h.Count))
+	writeSample(w, name+"_sum", labels, h.Sum)
+	writeSample(w, name+"_count", labels, float64(h.Count))
+}
+
+// writeSample labels are key value pairs
+func writeSample(w *bufio.Writer, name string, labels []string, value float64) {
+	_, _ = w.WriteString(name)
+	if len(labels) > 0 {
+		_ = w.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				_ = w.WriteByte(',')
+			}
+			_, _ = w.WriteString(labels[i])
+			_, _ = w.WriteString(`="`)
+			_, _ = w.WriteString(escapeLabelValue(labels[i+1]))
+			_ = w.WriteByte('"')
+		}
+		_ = w.WriteByte('}')
+	}
+	_ = w.WriteByte(' ')
+	_, _ = w.WriteString(formatFloat(value))
+	_ = w.WriteByte('\n')
+}
+
+func formatFloat(v float64) string {
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return strconv.FormatInt(int64(v), 10)
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeLabelValue(v string) string {
+	return labelValueReplacer.Replace(v)
+}
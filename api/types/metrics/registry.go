@@ -0,0 +1,210 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rulego/rulego/api/pool"
+)
+
+// ChainMetrics holds the metrics of a rule chain.
+type ChainMetrics struct {
+	ChainId string
+	EngineMetrics
+	// Latency the duration from the start of the rule chain to the completion of all branches
+	Latency *Histogram
+}
+
+// NodeMetrics holds the metrics of a rule node.
+type NodeMetrics struct {
+	ChainId  string
+	NodeId   string
+	NodeType string
+	// Total number of node executions
+	Total int64
+	// Errors number of node outputs with an error
+	Errors int64
+	// Latency the duration from the start of the node to its first output
+	Latency *Histogram
+	// relations number of node outputs by relation type
+	relations sync.Map
+}
+
+// ObserveRelation records an output of the node.
+func (m *NodeMetrics) ObserveRelation(relationType string, err error) {
+	if v, ok := m.relations.Load(relationType); ok {
+		atomic.AddInt64(v.(*int64), 1)
+	} else {
+		var count int64
+		v, _ = m.relations.LoadOrStore(relationType, &count)
+		atomic.AddInt64(v.(*int64), 1)
+	}
+	if err != nil {
+		atomic.AddInt64(&m.Errors, 1)
+	}
+}
+
+// Relations returns the number of node outputs by relation type.
+func (m *NodeMetrics) Relations() map[string]int64 {
+	var result = make(map[string]int64)
+	m.relations.Range(func(key, value any) bool {
+		result[key.(string)] = atomic.LoadInt64(value.(*int64))
+		return true
+	})
+	return result
+}
+
+// PoolStatsProvider is implemented by coroutine pools that expose their state, such as pool.WorkerPool.
+type PoolStatsProvider interface {
+	Stats() pool.WorkerPoolStats
+}
+
+type nodeKey struct {
+	chainId string
+	nodeId  string
+}
+
+// Registry is a registry of per-chain and per-node metrics, used by aspect.MetricsAspect.
+// It can be exposed in Prometheus text format through Handler.
+type Registry struct {
+	buckets []float64
+	lock    sync.RWMutex
+	chains  map[string]*ChainMetrics
+	nodes   map[nodeKey]*NodeMetrics
+	pools   map[string]PoolStatsProvider
+}
+
+// NewRegistry creates a metrics registry. buckets are the upper bounds of the latency histograms in seconds,
+// if empty, DefaultBuckets is used.
+func NewRegistry(buckets ...float64) *Registry {
+	return &Registry{
+		buckets: buckets,
+		chains:  make(map[string]*ChainMetrics),
+		nodes:   make(map[nodeKey]*NodeMetrics),
+		pools:   make(map[string]PoolStatsProvider),
+	}
+}
+
+// Chain returns the metrics of the rule chain, creating it if it does not exist.
+func (r *Registry) Chain(chainId string) *ChainMetrics {
+	r.lock.RLock()
+	m, ok := r.chains[chainId]
+	r.lock.RUnlock()
+	if ok {
+		return m
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if m, ok = r.chains[chainId]; !ok {
+		m = &ChainMetrics{ChainId: chainId, Latency: NewHistogram(r.buckets)}
+		r.chains[chainId] = m
+	}
+	return m
+}
+
+// Node returns the metrics of the rule node, creating it if it does not exist.
+func (r *Registry) Node(chainId, nodeId, nodeType string) *NodeMetrics {
+	key := nodeKey{chainId: chainId, nodeId: nodeId}
+	r.lock.RLock()
+	m, ok := r.nodes[key]
+	r.lock.RUnlock()
+	if ok {
+		return m
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if m, ok = r.nodes[key]; !ok {
+		m = &NodeMetrics{ChainId: chainId, NodeId: nodeId, NodeType: nodeType, Latency: NewHistogram(r.buckets)}
+		r.nodes[key] = m
+	}
+	return m
+}
+
+// ObserveNode records a node execution.
+func (r *Registry) ObserveNode(chainId, nodeId, nodeType string, d time.Duration) {
+	m := r.Node(chainId, nodeId, nodeType)
+	atomic.AddInt64(&m.Total, 1)
+	m.Latency.Observe(d)
+}
+
+// RegisterPool registers a coroutine pool whose state is exposed as metrics, such as types.Config.Pool.
+// Pools that do not implement PoolStatsProvider are ignored.
+func (r *Registry) RegisterPool(name string, p interface{}) {
+	if provider, ok := p.(PoolStatsProvider); ok {
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		r.pools[name] = provider
+	}
+}
+
+// Chains returns the metrics of all rule chains, sorted by chain ID.
+func (r *Registry) Chains() []*ChainMetrics {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	var list []*ChainMetrics
+	for _, m := range r.chains {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].ChainId < list[j].ChainId
+	})
+	return list
+}
+
+// Nodes returns the metrics of all rule nodes, sorted by chain ID and node ID.
+func (r *Registry) Nodes() []*NodeMetrics {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	var list []*NodeMetrics
+	for _, m := range r.nodes {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].ChainId == list[j].ChainId {
+			return list[i].NodeId < list[j].NodeId
+		}
+		return list[i].ChainId < list[j].ChainId
+	})
+	return list
+}
+
+// Pools returns the state of all registered pools.
+func (r *Registry) Pools() map[string]pool.WorkerPoolStats {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	var result = make(map[string]pool.WorkerPoolStats)
+	for name, p := range r.pools {
+		result[name] = p.Stats()
+	}
+	return result
+}
+
+// RemoveChain removes the metrics of the rule chain and its nodes.
+func (r *Registry) RemoveChain(chainId string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.chains, chainId)
+	for key := range r.nodes {
+		if key.chainId == chainId {
+			delete(r.nodes, key)
+		}
+	}
+}
@@ -105,3 +105,19 @@ func WithEndpointEnabled(endpointEnabled bool) Option {
 		return nil
 	}
 }
+
+// WithMessageStore is an option that sets the message store of the Config.
+func WithMessageStore(messageStore MessageStore) Option {
+	return func(c *Config) error {
+		c.MessageStore = messageStore
+		return nil
+	}
+}
+
+// WithDeadLetterQueue is an option that sets the dead letter queue of the Config.
+func WithDeadLetterQueue(queue DeadLetterQueue) Option {
+	return func(c *Config) error {
+		c.DeadLetterQueue = queue
+		return nil
+	}
+}
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package types
+
+// MessageCheckpoint is the persisted state of a message waiting to be processed by a node.
+// A checkpoint is written before a message is handed over to a node and removed once the node
+// has passed the message on (or the branch has ended), so any checkpoint left in the store
+// after a crash represents an unfinished execution.
+type MessageCheckpoint struct {
+	// Id is the unique identifier of the checkpoint.
+	Id string `json:"id"`
+	// RuleChainId is the ID of the rule chain the message is executed in.
+	RuleChainId string `json:"ruleChainId"`
+	// NodeId is the ID of the node that the message is waiting to be processed by.
+	NodeId string `json:"nodeId"`
+	// FromNodeId is the ID of the node that sent the message. Empty for the first node.
+	FromNodeId string `json:"fromNodeId"`
+	// RelationType is the relation type between FromNodeId and NodeId.
+	RelationType string `json:"relationType"`
+	// Msg is the message to be processed.
+	Msg RuleMsg `json:"msg"`
+	// Ts is the time the checkpoint was created, in milliseconds.
+	Ts int64 `json:"ts"`
+}
+
+// MessageStore is the interface for persisting in-flight messages of rule chain executions,
+// used to resume unfinished executions after the process restarts.
+// The default implementation is `store.FileMessageStore`.
+// Register it with the rule engine like this: `rulego.NewConfig(types.WithMessageStore(store))`
+type MessageStore interface {
+	// Save stores a checkpoint. If a checkpoint with the same ID exists, it is replaced.
+	Save(checkpoint MessageCheckpoint) error
+	// Delete removes a checkpoint by its ID. Deleting a non-existent checkpoint is not an error.
+	Delete(ruleChainId, id string) error
+	// List returns all checkpoints of the specified rule chain.
+	List(ruleChainId string) ([]MessageCheckpoint, error)
+}
+
+// DeadLetter is a message whose execution failed at a node that has no `Failure` connection.
+type DeadLetter struct {
+	// Id is the unique identifier of the dead letter.
+	Id string `json:"id"`
+	// RuleChainId is the ID of the rule chain the message was executed in.
+	RuleChainId string `json:"ruleChainId"`
+	// NodeId is the ID of the node that failed to process the message.
+	NodeId string `json:"nodeId"`
+	// Err is the error reported by the failing node.
+	Err string `json:"err"`
+	// Msg is the message passed to `TellFailure` by the failing node.
+	Msg RuleMsg `json:"msg"`
+	// Snapshot is the run snapshot of the rule chain execution up to the failure.
+	Snapshot RuleChainRunSnapshot `json:"snapshot"`
+	// Ts is the time the dead letter was created, in milliseconds.
+	Ts int64 `json:"ts"`
+}
+
+// DeadLetterQueue is the interface for capturing failed messages, so that they can be inspected
+// and replayed later with `RuleEngine.ReplayDeadLetter`.
+// The default implementation is `store.FileDeadLetterQueue`.
+// Register it with the rule engine like this: `rulego.NewConfig(types.WithDeadLetterQueue(queue))`
+type DeadLetterQueue interface {
+	// Put stores a dead letter. If a dead letter with the same ID exists, it is replaced.
+	Put(letter DeadLetter) error
+	// Get returns a dead letter by its ID. It returns an error if the dead letter does not exist.
+	Get(ruleChainId, id string) (DeadLetter, error)
+	// Delete removes a dead letter by its ID. Deleting a non-existent dead letter is not an error.
+	Delete(ruleChainId, id string) error
+	// List returns all dead letters of the specified rule chain, ordered by creation time.
+	List(ruleChainId string) ([]DeadLetter, error)
+}
@@ -29,6 +29,8 @@ const (
 	Failure = "Failure"
 	True    = "True"
 	False   = "False"
+	// Dropped indicates that the message has been discarded, for example, by rate limiting.
+	Dropped = "Dropped"
 )
 
 // Flow direction types indicate the direction of message flow into and out of nodes.
@@ -36,6 +38,10 @@ const (
 	In  = "IN"  // Represents a message flowing into a node.
 	Out = "OUT" // Represents a message flowing out of a node.
 	Log = "Log" // Used for logging purposes.
+	// Retry indicates that a failed execution of a node is about to be retried.
+	Retry = "Retry"
+	// CircuitBreaker indicates that the state of a circuit breaker has changed.
+	CircuitBreaker = "CircuitBreaker"
 )
 
 // Script types define the scripting languages supported for script execution within nodes.
@@ -154,6 +160,12 @@ type ChainCtx interface {
 	GetRuleEnginePool() RuleEnginePool
 }
 
+// NodeDefinitionGetter is implemented by node contexts that expose the parsed definition of the node,
+// independent of the DSL format the rule chain was loaded from.
+type NodeDefinitionGetter interface {
+	NodeDefinition() *RuleNode
+}
+
 // RuleContext is the interface for message processing context within the rule engine.
 // It handles the transfer of messages to the next or multiple nodes and triggers their business logic.
 // It also controls and orchestrates the node flow of the current execution instance.
@@ -0,0 +1,37 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aspect
+
+import (
+	"context"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+type takenOverKey struct{}
+
+// markTakenOver 标记节点已经被环绕切面接管（执行或者拒绝）
+// 引擎会继续调用后续的环绕切面，内置的环绕切面通过 isTakenOver 跳过已经被接管的节点，避免重复执行或者拒绝节点
+func markTakenOver(ctx types.RuleContext) {
+	ctx.SetContext(context.WithValue(baseContext(ctx), takenOverKey{}, ctx))
+}
+
+// isTakenOver 节点是否已经被前面的环绕切面接管，上下文会传递给后续节点，因此需要比较是否同一个节点上下文
+func isTakenOver(ctx types.RuleContext) bool {
+	v, ok := baseContext(ctx).Value(takenOverKey{}).(types.RuleContext)
+	return ok && v == ctx
+}
@@ -0,0 +1,583 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aspect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+// ErrCircuitOpen 熔断器打开，拒绝执行节点
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+var (
+	// Compile-time check CircuitBreakerAspect implements types.AroundAspect.
+	_ types.AroundAspect = (*CircuitBreakerAspect)(nil)
+	// Compile-time check CircuitBreakerAspect implements types.AfterAspect.
+	_ types.AfterAspect = (*CircuitBreakerAspect)(nil)
+	// Compile-time check CircuitBreakerAspect implements types.OnReloadAspect.
+	_ types.OnReloadAspect = (*CircuitBreakerAspect)(nil)
+	// Compile-time check CircuitBreakerAspect implements types.OnDestroyAspect.
+	_ types.OnDestroyAspect = (*CircuitBreakerAspect)(nil)
+)
+
+// CircuitState 熔断器状态
+type CircuitState string
+
+const (
+	// CircuitClosed 关闭状态，正常执行，统计滑动窗口内的失败率和慢调用率
+	CircuitClosed CircuitState = "CLOSED"
+	// CircuitOpen 打开状态，拒绝执行，经过 OpenDuration 后进入半开状态
+	CircuitOpen CircuitState = "OPEN"
+	// CircuitHalfOpen 半开状态，允许 HalfOpenMaxCalls 次探测执行，全部成功则关闭，否则重新打开
+	CircuitHalfOpen CircuitState = "HALF_OPEN"
+)
+
+// CircuitBreakerConfig 熔断器配置
+type CircuitBreakerConfig struct {
+	// WindowSize 滑动窗口大小，统计最近多少次执行，默认20
+	WindowSize int
+	// MinimumCalls 滑动窗口内至少执行多少次才计算失败率，默认10
+	MinimumCalls int
+	// FailureRateThreshold 失败率阈值，百分比，达到后打开熔断器，默认50
+	FailureRateThreshold float64
+	// SlowCallDuration 执行时间超过该值视为慢调用，0表示不统计慢调用
+	SlowCallDuration time.Duration
+	// SlowCallRateThreshold 慢调用率阈值，百分比，达到后打开熔断器，默认100
+	SlowCallRateThreshold float64
+	// OpenDuration 熔断器打开后，多久进入半开状态，默认10秒
+	OpenDuration time.Duration
+	// HalfOpenMaxCalls 半开状态允许的探测执行次数，默认3
+	HalfOpenMaxCalls int
+	// ProbeTimeout 半开状态探测执行的超时时间，超时仍未输出的探测释放名额，其结果不再统计，默认与 OpenDuration 相同
+	ProbeTimeout time.Duration
+}
+
+// withDefaults 填充默认值
+func (c CircuitBreakerConfig) withDefaults() CircuitBreakerConfig {
+	if c.WindowSize <= 0 {
+		c.WindowSize = 20
+	}
+	if c.MinimumCalls <= 0 {
+		c.MinimumCalls = 10
+	}
+	if c.MinimumCalls > c.WindowSize {
+		c.MinimumCalls = c.WindowSize
+	}
+	if c.FailureRateThreshold <= 0 {
+		c.FailureRateThreshold = 50
+	}
+	if c.SlowCallRateThreshold <= 0 {
+		c.SlowCallRateThreshold = 100
+	}
+	if c.OpenDuration <= 0 {
+		c.OpenDuration = time.Second * 10
+	}
+	if c.HalfOpenMaxCalls <= 0 {
+		c.HalfOpenMaxCalls = 3
+	}
+	if c.ProbeTimeout <= 0 {
+		c.ProbeTimeout = c.OpenDuration
+	}
+	return c
+}
+
+// CircuitBreakerStatus 熔断器状态快照
+type CircuitBreakerStatus struct {
+	// Key 熔断器key
+	Key string `json:"key"`
+	// State 当前状态
+	State CircuitState `json:"state"`
+	// Forced 是否是强制状态，强制状态不会自动转换
+	Forced bool `json:"forced"`
+	// Calls 滑动窗口内的执行次数
+	Calls int `json:"calls"`
+	// FailureRate 滑动窗口内的失败率，百分比
+	FailureRate float64 `json:"failureRate"`
+	// SlowCallRate 滑动窗口内的慢调用率，百分比
+	SlowCallRate float64 `json:"slowCallRate"`
+	// OpenedAt 最近一次打开的时间，毫秒
+	OpenedAt int64 `json:"openedAt"`
+}
+
+// CircuitBreaker 熔断器，使用基于次数的滑动窗口统计执行结果
+type CircuitBreaker struct {
+	key    string
+	config CircuitBreakerConfig
+	lock   sync.Mutex
+	state  CircuitState
+	forced bool
+	// 滑动窗口，每次执行的结果
+	outcomes []callOutcome
+	next     int
+	calls    int
+	failures int
+	slows    int
+	openedAt time.Time
+	// 状态代数，每次状态转换加1，用于忽略状态转换前放行的执行结果
+	generation uint64
+	// 半开状态正在执行的探测，探测序号:放行时间
+	probing  map[uint64]time.Time
+	probeSeq uint64
+	// 半开状态探测成功次数
+	probeSuccess int
+}
+
+// circuitTicket 放行凭证，记录放行时的状态代数和探测序号
+type circuitTicket struct {
+	generation uint64
+	probe      uint64
+}
+
+// callOutcome 一次执行结果
+type callOutcome struct {
+	failure bool
+	slow    bool
+}
+
+// newCircuitBreaker 创建关闭状态的熔断器
+func newCircuitBreaker(key string, config CircuitBreakerConfig) *CircuitBreaker {
+	config = config.withDefaults()
+	return &CircuitBreaker{
+		key:      key,
+		config:   config,
+		state:    CircuitClosed,
+		outcomes: make([]callOutcome, config.WindowSize),
+	}
+}
+
+// Key 熔断器key
+func (b *CircuitBreaker) Key() string {
+	return b.key
+}
+
+// State 当前状态
+func (b *CircuitBreaker) State() CircuitState {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.state
+}
+
+// Status 状态快照
+func (b *CircuitBreaker) Status() CircuitBreakerStatus {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	status := CircuitBreakerStatus{
+		Key:    b.key,
+		State:  b.state,
+		Forced: b.forced,
+		Calls:  b.calls,
+	}
+	if b.calls > 0 {
+		status.FailureRate = float64(b.failures) * 100 / float64(b.calls)
+		status.SlowCallRate = float64(b.slows) * 100 / float64(b.calls)
+	}
+	if !b.openedAt.IsZero() {
+		status.OpenedAt = b.openedAt.UnixMilli()
+	}
+	return status
+}
+
+// ForceOpen 强制打开，拒绝所有执行，直到调用 Reset 或者 ForceClosed
+func (b *CircuitBreaker) ForceOpen() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.forced = true
+	b.transition(CircuitOpen)
+}
+
+// ForceClosed 强制关闭，放行所有执行，不会自动打开，直到调用 Reset 或者 ForceOpen
+func (b *CircuitBreaker) ForceClosed() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.forced = true
+	b.transition(CircuitClosed)
+}
+
+// Reset 解除强制状态，并重置为关闭状态
+func (b *CircuitBreaker) Reset() {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.forced = false
+	b.transition(CircuitClosed)
+}
+
+// allow 判断是否允许执行，返回放行凭证和状态变化(如果有)
+func (b *CircuitBreaker) allow() (circuitTicket, bool, *circuitChange) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	var change *circuitChange
+	switch b.state {
+	case CircuitOpen:
+		if b.forced || time.Since(b.openedAt) < b.config.OpenDuration {
+			return circuitTicket{}, false, nil
+		}
+		change = b.transition(CircuitHalfOpen)
+		fallthrough
+	case CircuitHalfOpen:
+		b.expireProbes()
+		if b.probeSuccess+len(b.probing) >= b.config.HalfOpenMaxCalls {
+			return circuitTicket{}, false, change
+		}
+		if b.probing == nil {
+			b.probing = make(map[uint64]time.Time)
+		}
+		b.probeSeq++
+		b.probing[b.probeSeq] = time.Now()
+		return circuitTicket{generation: b.generation, probe: b.probeSeq}, true, change
+	default:
+		return circuitTicket{generation: b.generation}, true, nil
+	}
+}
+
+// expireProbes 释放超时仍未输出的探测名额
+func (b *CircuitBreaker) expireProbes() {
+	for probe, start := range b.probing {
+		if time.Since(start) >= b.config.ProbeTimeout {
+			delete(b.probing, probe)
+		}
+	}
+}
+
+// record 记录一次执行结果，返回状态变化(如果有)
+func (b *CircuitBreaker) record(ticket circuitTicket, failure bool, duration time.Duration) *circuitChange {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	//状态转换前放行的执行不统计，例如关闭状态放行、半开状态才完成的执行
+	if ticket.generation != b.generation {
+		return nil
+	}
+	slow := b.config.SlowCallDuration > 0 && duration >= b.config.SlowCallDuration
+	switch b.state {
+	case CircuitHalfOpen:
+		//已经超时释放名额的探测不统计
+		if _, ok := b.probing[ticket.probe]; !ok {
+			return nil
+		}
+		delete(b.probing, ticket.probe)
+		if failure || slow {
+			return b.transition(CircuitOpen)
+		}
+		b.probeSuccess++
+		if b.probeSuccess >= b.config.HalfOpenMaxCalls {
+			return b.transition(CircuitClosed)
+		}
+	case CircuitClosed:
+		b.add(callOutcome{failure: failure, slow: slow})
+		if b.forced || b.calls < b.config.MinimumCalls {
+			return nil
+		}
+		failureRate := float64(b.failures) * 100 / float64(b.calls)
+		slowCallRate := float64(b.slows) * 100 / float64(b.calls)
+		if failureRate >= b.config.FailureRateThreshold {
+			change := b.transition(CircuitOpen)
+			change.reason = fmt.Errorf("failure rate %.2f%% exceeds threshold %.2f%%", failureRate, b.config.FailureRateThreshold)
+			return change
+		}
+		if b.config.SlowCallDuration > 0 && slowCallRate >= b.config.SlowCallRateThreshold {
+			change := b.transition(CircuitOpen)
+			change.reason = fmt.Errorf("slow call rate %.2f%% exceeds threshold %.2f%%", slowCallRate, b.config.SlowCallRateThreshold)
+			return change
+		}
+	}
+	return nil
+}
+
+// add 把执行结果加入滑动窗口
+func (b *CircuitBreaker) add(outcome callOutcome) {
+	if b.calls == len(b.outcomes) {
+		old := b.outcomes[b.next]
+		if old.failure {
+			b.failures--
+		}
+		if old.slow {
+			b.slows--
+		}
+	} else {
+		b.calls++
+	}
+	b.outcomes[b.next] = outcome
+	b.next = (b.next + 1) % len(b.outcomes)
+	if outcome.failure {
+		b.failures++
+	}
+	if outcome.slow {
+		b.slows++
+	}
+}
+
+// transition 转换状态，并重置统计
+func (b *CircuitBreaker) transition(state CircuitState) *circuitChange {
+	change := &circuitChange{key: b.key, from: b.state, to: state}
+	b.state = state
+	b.generation++
+	b.next, b.calls, b.failures, b.slows = 0, 0, 0, 0
+	b.probing, b.probeSuccess = nil, 0
+	if state == CircuitOpen {
+		b.openedAt = time.Now()
+	}
+	return change
+}
+
+// circuitChange 熔断器状态变化
+type circuitChange struct {
+	key    string
+	from   CircuitState
+	to     CircuitState
+	reason error
+}
+
+// CircuitBreakers 熔断器注册表，同一个注册表中相同key的节点共享熔断器状态，可以跨规则链共享
+type CircuitBreakers struct {
+	breakers sync.Map
+}
+
+// NewCircuitBreakers 创建熔断器注册表
+func NewCircuitBreakers() *CircuitBreakers {
+	return &CircuitBreakers{}
+}
+
+// DefaultCircuitBreakers 默认熔断器注册表
+var DefaultCircuitBreakers = NewCircuitBreakers()
+
+// Get 获取熔断器
+func (r *CircuitBreakers) Get(key string) (*CircuitBreaker, bool) {
+	if v, ok := r.breakers.Load(key); ok {
+		return v.(*CircuitBreaker), true
+	}
+	return nil, false
+}
+
+// List 获取所有熔断器状态，按key排序
+func (r *CircuitBreakers) List() []CircuitBreakerStatus {
+	var list []CircuitBreakerStatus
+	r.breakers.Range(func(key, value any) bool {
+		list = append(list, value.(*CircuitBreaker).Status())
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Key < list[j].Key
+	})
+	return list
+}
+
+// Delete 删除熔断器
+func (r *CircuitBreakers) Delete(key string) {
+	r.breakers.Delete(key)
+}
+
+// getOrCreate 获取熔断器，不存在则使用指定配置创建
+func (r *CircuitBreakers) getOrCreate(key string, config CircuitBreakerConfig) *CircuitBreaker {
+	if breaker, ok := r.Get(key); ok {
+		return breaker
+	}
+	v, _ := r.breakers.LoadOrStore(key, newCircuitBreaker(key, config))
+	return v.(*CircuitBreaker)
+}
+
+type circuitCallKey struct{}
+
+// circuitCall 一次放行的执行
+type circuitCall struct {
+	nodeId  string
+	breaker *CircuitBreaker
+	ticket  circuitTicket
+	start   time.Time
+	done    int32
+}
+
+// CircuitBreakerAspect 熔断器切面
+// 节点执行失败率或者慢调用率在滑动窗口内达到阈值后打开熔断器，直接通过 `Failure` 关系传递 ErrCircuitOpen，不再执行节点；
+// 经过 OpenDuration 后进入半开状态，放行 HalfOpenMaxCalls 次探测执行，全部成功则关闭，否则重新打开。
+// 只统计当前状态下放行的执行结果，超过 ProbeTimeout 仍未输出的探测释放名额。
+//
+// 熔断器key：如果节点使用 ref://{instanceId} 引用了共享资源，则为 {nodeType}/{instanceId}，
+// 引用相同共享资源(例如同一个MySQL连接池)的节点，即使在不同规则链中，也共享同一个熔断器；否则为 {chainId}/{nodeId}。
+// 同一个 Breakers 注册表中的熔断器共享状态，可以通过 Breakers 查看、强制打开或者关闭熔断器。
+//
+// 状态变化通过 Config.OnDebug 回调通知，flowType 为 types.CircuitBreaker，relationType 为新的状态。
+//
+//	breakers := aspect.NewCircuitBreakers()
+//	ruleEngine, err := rulego.New("rule01", def, types.WithAspects(aspect.NewCircuitBreakerAspect(aspect.CircuitBreakerConfig{}, breakers)))
+//	breakers.List()
+type CircuitBreakerAspect struct {
+	// Config 熔断器配置
+	Config CircuitBreakerConfig
+	// Breakers 熔断器注册表，为空使用 DefaultCircuitBreakers
+	Breakers *CircuitBreakers
+	// PointCutFunc 切入点，默认所有节点
+	PointCutFunc func(ctx types.RuleContext, msg types.RuleMsg, relationType string) bool
+	// 节点熔断器key缓存 nodeCacheKey:string
+	keys sync.Map
+}
+
+// NewCircuitBreakerAspect 创建熔断器切面，breakers为空使用 DefaultCircuitBreakers
+func NewCircuitBreakerAspect(config CircuitBreakerConfig, breakers *CircuitBreakers) *CircuitBreakerAspect {
+	return &CircuitBreakerAspect{Config: config, Breakers: breakers}
+}
+
+func (aspect *CircuitBreakerAspect) Order() int {
+	return 12
+}
+
+func (aspect *CircuitBreakerAspect) New() types.Aspect {
+	return &CircuitBreakerAspect{Config: aspect.Config, Breakers: aspect.Breakers, PointCutFunc: aspect.PointCutFunc}
+}
+
+func (aspect *CircuitBreakerAspect) Type() string {
+	return "circuitBreaker"
+}
+
+// PointCut 默认所有节点，可以被 PointCutFunc 覆盖
+func (aspect *CircuitBreakerAspect) PointCut(ctx types.RuleContext, msg types.RuleMsg, relationType string) bool {
+	if ctx.Self() == nil {
+		return false
+	}
+	if aspect.PointCutFunc != nil {
+		return aspect.PointCutFunc(ctx, msg, relationType)
+	}
+	return true
+}
+
+// Around 熔断器打开则拒绝执行，否则记录开始时间
+func (aspect *CircuitBreakerAspect) Around(ctx types.RuleContext, msg types.RuleMsg, relationType string) (types.RuleMsg, bool) {
+	//节点已经被前面的环绕切面拒绝或者执行，不占用半开状态的探测名额
+	if isTakenOver(ctx) {
+		return msg, false
+	}
+	breaker := aspect.getBreakers().getOrCreate(aspect.getKey(ctx), aspect.Config)
+	ticket, allowed, change := breaker.allow()
+	aspect.onChange(ctx, msg, change)
+	if !allowed {
+		markTakenOver(ctx)
+		ctx.TellFailure(msg, ErrCircuitOpen)
+		return msg, false
+	}
+	ctx.SetContext(context.WithValue(baseContext(ctx), circuitCallKey{}, &circuitCall{
+		nodeId:  ctx.GetSelfId(),
+		breaker: breaker,
+		ticket:  ticket,
+		start:   time.Now(),
+	}))
+	return msg, true
+}
+
+// After 节点第一次输出时记录执行结果
+func (aspect *CircuitBreakerAspect) After(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) types.RuleMsg {
+	if call, ok := baseContext(ctx).Value(circuitCallKey{}).(*circuitCall); ok && call.nodeId == ctx.GetSelfId() &&
+		atomic.CompareAndSwapInt32(&call.done, 0, 1) {
+		failure := err != nil || relationType == types.Failure
+		aspect.onChange(ctx, msg, call.breaker.record(call.ticket, failure, time.Since(call.start)))
+	}
+	return msg
+}
+
+// OnReload 节点更新清除熔断器key缓存
+func (aspect *CircuitBreakerAspect) OnReload(parentCtx types.NodeCtx, ctx types.NodeCtx) error {
+	nodeId := ctx.GetNodeId()
+	if nodeId.Type == types.CHAIN {
+		aspect.deleteChainKeys(nodeId.Id)
+	} else {
+		aspect.keys.Delete(nodeCacheKey{chainId: parentCtx.GetNodeId().Id, nodeId: nodeId.Id})
+	}
+	return nil
+}
+
+func (aspect *CircuitBreakerAspect) OnDestroy(ctx types.NodeCtx) {
+	nodeId := ctx.GetNodeId()
+	if nodeId.Type == types.CHAIN {
+		aspect.deleteChainKeys(nodeId.Id)
+	}
+}
+
+// GetBreakers 返回熔断器注册表
+func (aspect *CircuitBreakerAspect) GetBreakers() *CircuitBreakers {
+	return aspect.getBreakers()
+}
+
+func (aspect *CircuitBreakerAspect) getBreakers() *CircuitBreakers {
+	if aspect.Breakers == nil {
+		return DefaultCircuitBreakers
+	}
+	return aspect.Breakers
+}
+
+// onChange 通过 Config.OnDebug 通知状态变化
+func (aspect *CircuitBreakerAspect) onChange(ctx types.RuleContext, msg types.RuleMsg, change *circuitChange) {
+	if change == nil || ctx.Config().OnDebug == nil {
+		return
+	}
+	msg = msg.Copy()
+	msg.Metadata.PutValue(KeyCircuitBreaker, change.key)
+	msg.Metadata.PutValue(KeyCircuitFromState, string(change.from))
+	ctx.Config().OnDebug(chainId(ctx), types.CircuitBreaker, ctx.GetSelfId(), msg, string(change.to), change.reason)
+}
+
+// getKey 获取节点熔断器key
+func (aspect *CircuitBreakerAspect) getKey(ctx types.RuleContext) string {
+	cacheKey := nodeCacheKey{chainId: chainId(ctx), nodeId: ctx.GetSelfId()}
+	if v, ok := aspect.keys.Load(cacheKey); ok {
+		return v.(string)
+	}
+	key := cacheKey.chainId + "/" + cacheKey.nodeId
+	if def := nodeDefinition(ctx); def != nil {
+		if instanceId := sharedInstanceId(def.Configuration); instanceId != "" {
+			key = def.Type + "/" + instanceId
+		}
+	}
+	aspect.keys.Store(cacheKey, key)
+	return key
+}
+
+func (aspect *CircuitBreakerAspect) deleteChainKeys(chainId string) {
+	aspect.keys.Range(func(key, value any) bool {
+		if key.(nodeCacheKey).chainId == chainId {
+			aspect.keys.Delete(key)
+		}
+		return true
+	})
+}
+
+const (
+	// KeyCircuitBreaker 状态变化通知消息中，熔断器key的元数据key
+	KeyCircuitBreaker = "circuitBreaker"
+	// KeyCircuitFromState 状态变化通知消息中，原状态的元数据key
+	KeyCircuitFromState = "fromState"
+)
+
+// sharedInstanceId 获取节点配置中 ref://{instanceId} 引用的共享资源ID
+func sharedInstanceId(configuration types.Configuration) string {
+	var keys []string
+	for k := range configuration {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if v, ok := configuration[k].(string); ok && strings.HasPrefix(v, types.NodeConfigurationPrefixInstanceId) {
+			return v[len(types.NodeConfigurationPrefixInstanceId):]
+		}
+	}
+	return ""
+}
@@ -24,6 +24,10 @@
 // Key components:
 // - Debug: An aspect for logging debug information before and after node execution.
 // - EndpointAspect: An aspect for rule chain endpoint.
+// - TracingAspect: An OpenTelemetry compatible distributed tracing aspect.
+// - RetryAspect: An aspect that retries failed nodes with exponential backoff, configured by the node's `additionalInfo.retry`.
+// - CircuitBreakerAspect: A per-node circuit breaker aspect with half-open probing; nodes referencing the same shared resource share one breaker.
+// - RateLimiterAspect: A token bucket or sliding window rate limiter per rule chain, per node or per key template such as `${metadata.deviceId}`, configured by `additionalInfo.rateLimit`.
 //
 // The package supports features such as:
 // - Before and After execution hooks
@@ -1,18 +1,45 @@
 package aspect
 
 import (
+	"context"
+	"sync/atomic"
+	"time"
+
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/api/types/metrics"
+	"github.com/rulego/rulego/utils/json"
 )
 
 // MetricsAspect 实现了统计规则引擎指标的功能
+// 如果指定了指标注册表（metrics.Registry），则同时统计每个规则链、每个节点的执行次数、输出关系、错误数和耗时直方图，
+// 可以通过 registry.Handler() 以 Prometheus 格式暴露：
+//
+//	registry := metrics.NewRegistry()
+//	ruleEngine, err := rulego.New("rule01", def, types.WithAspects(aspect.NewMetricsAspectWithRegistry(nil, registry)))
+//	restEndpoint.Handle(http.MethodGet, "/metrics", registry.Handler())
 type MetricsAspect struct {
-	metrics *metrics.EngineMetrics
+	metrics  *metrics.EngineMetrics
+	registry *metrics.Registry
 }
 
 var _ types.StartAspect = (*MetricsAspect)(nil)
 var _ types.EndAspect = (*MetricsAspect)(nil)
 var _ types.CompletedAspect = (*MetricsAspect)(nil)
+var _ types.BeforeAspect = (*MetricsAspect)(nil)
+var _ types.AfterAspect = (*MetricsAspect)(nil)
+var _ types.OnCreatedAspect = (*MetricsAspect)(nil)
+
+// PoolName 规则引擎协程池在指标注册表中的名称
+const PoolName = "ruleEngine"
+
+type chainStartKey struct{}
+type nodeStartKey struct{}
+
+// nodeExecution 节点一次执行的开始时间
+type nodeExecution struct {
+	start time.Time
+	done  int32
+}
 
 func NewMetricsAspect(m *metrics.EngineMetrics) *MetricsAspect {
 	if m == nil {
@@ -23,6 +50,13 @@ func NewMetricsAspect(m *metrics.EngineMetrics) *MetricsAspect {
 	}
 }
 
+// NewMetricsAspectWithRegistry 创建统计每个规则链、每个节点指标的切面
+func NewMetricsAspectWithRegistry(m *metrics.EngineMetrics, registry *metrics.Registry) *MetricsAspect {
+	a := NewMetricsAspect(m)
+	a.registry = registry
+	return a
+}
+
 func (a *MetricsAspect) Order() int {
 	return 20
 }
@@ -33,7 +67,8 @@ func (a *MetricsAspect) New() types.Aspect {
 	}
 	a.metrics.Reset()
 	return &MetricsAspect{
-		metrics: a.metrics,
+		metrics:  a.metrics,
+		registry: a.registry,
 	}
 }
 
@@ -44,6 +79,12 @@ func (a *MetricsAspect) PointCut(ctx types.RuleContext, msg types.RuleMsg, relat
 func (a *MetricsAspect) Start(ctx types.RuleContext, msg types.RuleMsg) (types.RuleMsg, error) {
 	a.metrics.IncrementCurrent()
 	a.metrics.IncrementTotal()
+	if a.registry != nil {
+		chainMetrics := a.registry.Chain(chainId(ctx))
+		chainMetrics.IncrementCurrent()
+		chainMetrics.IncrementTotal()
+		ctx.SetContext(context.WithValue(baseContext(ctx), chainStartKey{}, time.Now()))
+	}
 	return msg, nil
 }
 
@@ -53,11 +94,56 @@ func (a *MetricsAspect) End(ctx types.RuleContext, msg types.RuleMsg, err error,
 	} else {
 		a.metrics.IncrementSuccess()
 	}
+	if a.registry != nil {
+		chainMetrics := a.registry.Chain(chainId(ctx))
+		if err != nil {
+			chainMetrics.IncrementFailed()
+		} else {
+			chainMetrics.IncrementSuccess()
+		}
+	}
 	return msg
 }
 
 func (a *MetricsAspect) Completed(ctx types.RuleContext, msg types.RuleMsg) types.RuleMsg {
 	a.metrics.DecrementCurrent()
+	if a.registry != nil {
+		chainMetrics := a.registry.Chain(chainId(ctx))
+		chainMetrics.DecrementCurrent()
+		if start, ok := baseContext(ctx).Value(chainStartKey{}).(time.Time); ok {
+			chainMetrics.Latency.Observe(time.Since(start))
+		}
+	}
+	return msg
+}
+
+// OnCreated 把规则引擎协程池注册到指标注册表
+func (a *MetricsAspect) OnCreated(chainCtx types.NodeCtx) error {
+	if a.registry != nil && chainCtx.Config().Pool != nil {
+		a.registry.RegisterPool(PoolName, chainCtx.Config().Pool)
+	}
+	return nil
+}
+
+// Before 记录节点开始时间，没有指定指标注册表则忽略
+func (a *MetricsAspect) Before(ctx types.RuleContext, msg types.RuleMsg, relationType string) types.RuleMsg {
+	if a.registry != nil && ctx.Self() != nil {
+		ctx.SetContext(context.WithValue(baseContext(ctx), nodeStartKey{}, &nodeExecution{start: time.Now()}))
+	}
+	return msg
+}
+
+// After 统计节点输出关系和错误，节点第一次输出时记录耗时
+func (a *MetricsAspect) After(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) types.RuleMsg {
+	if a.registry == nil || ctx.Self() == nil {
+		return msg
+	}
+	nodeId := ctx.Self().GetNodeId().Id
+	nodeType := ctx.Self().Type()
+	if execution, ok := baseContext(ctx).Value(nodeStartKey{}).(*nodeExecution); ok && atomic.CompareAndSwapInt32(&execution.done, 0, 1) {
+		a.registry.ObserveNode(chainId(ctx), nodeId, nodeType, time.Since(execution.start))
+	}
+	a.registry.Node(chainId(ctx), nodeId, nodeType).ObserveRelation(relationType, err)
 	return msg
 }
 
@@ -65,3 +151,46 @@ func (a *MetricsAspect) Completed(ctx types.RuleContext, msg types.RuleMsg) type
 func (a *MetricsAspect) GetMetrics() *metrics.EngineMetrics {
 	return a.metrics
 }
+
+// GetRegistry 返回指标注册表，没有指定则返回nil
+func (a *MetricsAspect) GetRegistry() *metrics.Registry {
+	return a.registry
+}
+
+func chainId(ctx types.RuleContext) string {
+	if ctx.RuleChain() != nil {
+		return ctx.RuleChain().GetNodeId().Id
+	}
+	return ""
+}
+
+// nodeDefinition 获取当前节点的定义，不依赖规则链的 DSL 格式(JSON/YAML/HCL)，获取不到返回nil
+func nodeDefinition(ctx types.RuleContext) *types.RuleNode {
+	self := ctx.Self()
+	if self == nil {
+		return nil
+	}
+	if getter, ok := self.(types.NodeDefinitionGetter); ok {
+		return getter.NodeDefinition()
+	}
+	var def types.RuleNode
+	if err := json.Unmarshal(self.DSL(), &def); err != nil {
+		return nil
+	}
+	return &def
+}
+
+// chainDefinition 获取当前规则链的定义，获取不到返回nil
+func chainDefinition(ctx types.RuleContext) *types.RuleChain {
+	if chainCtx, ok := ctx.RuleChain().(types.ChainCtx); ok {
+		return chainCtx.Definition()
+	}
+	return nil
+}
+
+func baseContext(ctx types.RuleContext) context.Context {
+	if c := ctx.GetContext(); c != nil {
+		return c
+	}
+	return context.Background()
+}
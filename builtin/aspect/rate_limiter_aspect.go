@@ -0,0 +1,447 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aspect
+
+import (
+	"math"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/components/base"
+	"github.com/rulego/rulego/utils/maps"
+	"github.com/rulego/rulego/utils/str"
+)
+
+// KeyRateLimit 限流配置在规则链或者节点 additionalInfo 中的key
+const KeyRateLimit = "rateLimit"
+
+// 限流算法
+const (
+	// RateLimitTokenBucket 令牌桶，允许突发请求
+	RateLimitTokenBucket = "tokenBucket"
+	// RateLimitSlidingWindow 滑动窗口，任意窗口时间内的请求数不超过限制
+	RateLimitSlidingWindow = "slidingWindow"
+)
+
+// 超过限流后的处理方式
+const (
+	// RateLimitReject 拒绝，通过 `Failure` 关系传递 types.ErrRateLimitExceeded
+	RateLimitReject = "reject"
+	// RateLimitDelay 阻塞等待直到获得许可，等待时间超过 MaxDelay 则拒绝
+	RateLimitDelay = "delay"
+	// RateLimitDrop 丢弃，通过 `Dropped` 关系结束，不返回错误
+	RateLimitDrop = "drop"
+)
+
+var (
+	// Compile-time check RateLimiterAspect implements types.StartAspect.
+	_ types.StartAspect = (*RateLimiterAspect)(nil)
+	// Compile-time check RateLimiterAspect implements types.AroundAspect.
+	_ types.AroundAspect = (*RateLimiterAspect)(nil)
+	// Compile-time check RateLimiterAspect implements types.OnReloadAspect.
+	_ types.OnReloadAspect = (*RateLimiterAspect)(nil)
+	// Compile-time check RateLimiterAspect implements types.OnDestroyAspect.
+	_ types.OnDestroyAspect = (*RateLimiterAspect)(nil)
+)
+
+// RateLimit 限流配置，在规则链或者节点 additionalInfo.rateLimit 中配置，例如每个设备每秒最多处理5条消息：
+//
+//	{
+//	  "ruleChain": {
+//	    "id": "rule01",
+//	    "additionalInfo": {
+//	      "rateLimit": {
+//	        "rate": 5,
+//	        "burst": 10,
+//	        "key": "${metadata.deviceId}",
+//	        "action": "reject"
+//	      }
+//	    }
+//	  }
+//	}
+type RateLimit struct {
+	// Rate 每秒允许的请求数
+	Rate float64
+	// Burst 令牌桶容量，即允许的突发请求数，默认 Rate 向上取整
+	Burst int
+	// Algorithm 限流算法 tokenBucket/slidingWindow，默认 tokenBucket
+	Algorithm string
+	// Window 滑动窗口大小，单位毫秒，默认1000，窗口内最多允许 Rate*Window/1000 个请求
+	Window int
+	// Key 限流key模板，例如：${metadata.deviceId}，每个key使用独立的限流器
+	// 为空则整个规则链或者节点共用一个限流器
+	Key string
+	// Action 超过限流后的处理方式 reject/delay/drop，默认 reject
+	Action string
+	// MaxDelay delay 方式最长等待时间，单位毫秒，默认1000
+	MaxDelay int
+	// key模板
+	keyTemplate str.Template
+}
+
+// limit 滑动窗口内允许的请求数
+func (r *RateLimit) limit() int {
+	n := int(math.Ceil(r.Rate * float64(r.Window) / 1000))
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// newLimiter 根据限流算法创建限流器
+func (r *RateLimit) newLimiter(now time.Time) limiter {
+	if r.Algorithm == RateLimitSlidingWindow {
+		return &slidingWindow{limit: r.limit(), window: time.Duration(r.Window) * time.Millisecond}
+	}
+	return &tokenBucket{rate: r.Rate, burst: float64(r.Burst), tokens: float64(r.Burst), last: now}
+}
+
+// RateLimiterAspect 限流切面，按照每秒请求数限流，支持突发请求，超过限流后可以拒绝、延迟或者丢弃消息。
+// 限流配置来自规则链或者节点的 additionalInfo.rateLimit：
+//   - 规则链级别：在规则链开始执行前限流，没有配置则使用切面的 Limit 配置
+//   - 节点级别：在节点执行前限流
+//
+// 通过 Key 模板可以按照消息元数据或者消息内容进一步划分限流器，例如按设备限流，防止单个设备占用所有的处理能力。
+// 每个规则链实例的限流器状态相互独立，规则链或者节点更新后重新计算。
+type RateLimiterAspect struct {
+	// Limit 规则链默认的限流配置，规则链 additionalInfo 没有配置 rateLimit 时使用，nil表示不限流
+	Limit *RateLimit
+	// IdleTimeout 限流器空闲多久后被清除，默认10分钟，防止按key限流时限流器无限增长
+	IdleTimeout time.Duration
+	// 限流配置缓存 nodeCacheKey:*RateLimit，规则链级别的 nodeId 为空
+	limits sync.Map
+	// 限流器 limiterKey:*limiterEntry
+	limiters sync.Map
+	// 上一次清除空闲限流器的时间
+	lastSweep int64
+}
+
+// limiterKey 限流器key
+type limiterKey struct {
+	chainId string
+	nodeId  string
+	key     string
+}
+
+// limiterEntry 限流器以及最后使用时间
+type limiterEntry struct {
+	limiter  limiter
+	lastUsed int64
+}
+
+// NewRateLimiterAspect 创建限流切面，limit 为规则链默认的限流配置
+func NewRateLimiterAspect(limit *RateLimit) *RateLimiterAspect {
+	if limit != nil {
+		limit = withRateLimitDefaults(*limit)
+	}
+	return &RateLimiterAspect{Limit: limit}
+}
+
+func (aspect *RateLimiterAspect) Order() int {
+	return 5
+}
+
+func (aspect *RateLimiterAspect) New() types.Aspect {
+	return &RateLimiterAspect{Limit: aspect.Limit, IdleTimeout: aspect.IdleTimeout}
+}
+
+func (aspect *RateLimiterAspect) Type() string {
+	return "rateLimiter"
+}
+
+// PointCut 只对配置了限流的规则链或者节点生效
+func (aspect *RateLimiterAspect) PointCut(ctx types.RuleContext, msg types.RuleMsg, relationType string) bool {
+	return aspect.getChainLimit(ctx) != nil || aspect.getNodeLimit(ctx) != nil
+}
+
+// Start 规则链级别限流
+func (aspect *RateLimiterAspect) Start(ctx types.RuleContext, msg types.RuleMsg) (types.RuleMsg, error) {
+	limit := aspect.getChainLimit(ctx)
+	if limit == nil {
+		return msg, nil
+	}
+	return msg, aspect.acquire(ctx, msg, limit, limiterKey{chainId: chainId(ctx)})
+}
+
+// Around 节点级别限流
+func (aspect *RateLimiterAspect) Around(ctx types.RuleContext, msg types.RuleMsg, relationType string) (types.RuleMsg, bool) {
+	if isTakenOver(ctx) {
+		return msg, false
+	}
+	limit := aspect.getNodeLimit(ctx)
+	if limit == nil {
+		return msg, true
+	}
+	err := aspect.acquire(ctx, msg, limit, limiterKey{chainId: chainId(ctx), nodeId: ctx.GetSelfId()})
+	if err == nil {
+		return msg, true
+	}
+	markTakenOver(ctx)
+	switch err {
+	case types.ErrMsgDropped:
+		ctx.TellNext(msg, types.Dropped)
+	default:
+		ctx.TellFailure(msg, err)
+	}
+	return msg, false
+}
+
+// OnReload 规则链或者节点更新清除限流配置和限流器
+func (aspect *RateLimiterAspect) OnReload(parentCtx types.NodeCtx, ctx types.NodeCtx) error {
+	nodeId := ctx.GetNodeId()
+	if nodeId.Type == types.CHAIN {
+		aspect.deleteChain(nodeId.Id)
+	} else {
+		aspect.deleteNode(parentCtx.GetNodeId().Id, nodeId.Id)
+	}
+	return nil
+}
+
+func (aspect *RateLimiterAspect) OnDestroy(ctx types.NodeCtx) {
+	nodeId := ctx.GetNodeId()
+	if nodeId.Type == types.CHAIN {
+		aspect.deleteChain(nodeId.Id)
+	}
+}
+
+// acquire 获取许可，超过限流返回 types.ErrRateLimitExceeded 或者 types.ErrMsgDropped
+func (aspect *RateLimiterAspect) acquire(ctx types.RuleContext, msg types.RuleMsg, limit *RateLimit, key limiterKey) error {
+	if limit.keyTemplate != nil {
+		key.key = limit.keyTemplate.ExecuteFn(func() map[string]any {
+			return base.NodeUtils.GetEvnAndMetadata(ctx, msg)
+		})
+	}
+	var maxDelay time.Duration
+	if limit.Action == RateLimitDelay {
+		maxDelay = time.Duration(limit.MaxDelay) * time.Millisecond
+	}
+	delay, ok := aspect.getLimiter(key, limit).reserve(time.Now(), maxDelay)
+	if !ok {
+		if limit.Action == RateLimitDrop {
+			return types.ErrMsgDropped
+		}
+		return types.ErrRateLimitExceeded
+	}
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-baseContext(ctx).Done():
+		return baseContext(ctx).Err()
+	}
+}
+
+// getLimiter 获取或者创建限流器，并清除空闲的限流器
+func (aspect *RateLimiterAspect) getLimiter(key limiterKey, limit *RateLimit) limiter {
+	now := time.Now()
+	aspect.sweep(now)
+	v, ok := aspect.limiters.Load(key)
+	if !ok {
+		v, _ = aspect.limiters.LoadOrStore(key, &limiterEntry{limiter: limit.newLimiter(now)})
+	}
+	entry := v.(*limiterEntry)
+	atomic.StoreInt64(&entry.lastUsed, now.UnixNano())
+	return entry.limiter
+}
+
+// sweep 每分钟最多清除一次空闲的限流器
+func (aspect *RateLimiterAspect) sweep(now time.Time) {
+	last := atomic.LoadInt64(&aspect.lastSweep)
+	if now.UnixNano()-last < int64(time.Minute) || !atomic.CompareAndSwapInt64(&aspect.lastSweep, last, now.UnixNano()) {
+		return
+	}
+	idleTimeout := aspect.IdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = time.Minute * 10
+	}
+	aspect.limiters.Range(func(key, value any) bool {
+		if now.UnixNano()-atomic.LoadInt64(&value.(*limiterEntry).lastUsed) > int64(idleTimeout) {
+			aspect.limiters.Delete(key)
+		}
+		return true
+	})
+}
+
+// getChainLimit 获取规则链限流配置，没有配置返回nil
+func (aspect *RateLimiterAspect) getChainLimit(ctx types.RuleContext) *RateLimit {
+	if ctx.RuleChain() == nil {
+		return nil
+	}
+	key := nodeCacheKey{chainId: chainId(ctx)}
+	if v, ok := aspect.limits.Load(key); ok {
+		return v.(*RateLimit)
+	}
+	limit := aspect.Limit
+	if def := chainDefinition(ctx); def != nil {
+		if v := parseRateLimit(def.RuleChain.AdditionalInfo); v != nil {
+			limit = v
+		}
+	}
+	aspect.limits.Store(key, limit)
+	return limit
+}
+
+// getNodeLimit 获取节点限流配置，没有配置返回nil
+func (aspect *RateLimiterAspect) getNodeLimit(ctx types.RuleContext) *RateLimit {
+	if ctx.Self() == nil || ctx.RuleChain() == nil {
+		return nil
+	}
+	key := nodeCacheKey{chainId: chainId(ctx), nodeId: ctx.GetSelfId()}
+	if v, ok := aspect.limits.Load(key); ok {
+		return v.(*RateLimit)
+	}
+	var limit *RateLimit
+	if def := nodeDefinition(ctx); def != nil {
+		limit = parseRateLimit(def.AdditionalInfo)
+	}
+	aspect.limits.Store(key, limit)
+	return limit
+}
+
+func (aspect *RateLimiterAspect) deleteChain(chainId string) {
+	aspect.limits.Range(func(key, value any) bool {
+		if key.(nodeCacheKey).chainId == chainId {
+			aspect.limits.Delete(key)
+		}
+		return true
+	})
+	aspect.limiters.Range(func(key, value any) bool {
+		if key.(limiterKey).chainId == chainId {
+			aspect.limiters.Delete(key)
+		}
+		return true
+	})
+}
+
+func (aspect *RateLimiterAspect) deleteNode(chainId, nodeId string) {
+	aspect.limits.Delete(nodeCacheKey{chainId: chainId, nodeId: nodeId})
+	aspect.limiters.Range(func(key, value any) bool {
+		if k := key.(limiterKey); k.chainId == chainId && k.nodeId == nodeId {
+			aspect.limiters.Delete(key)
+		}
+		return true
+	})
+}
+
+// parseRateLimit 从 additionalInfo.rateLimit 解析限流配置，没有配置或者 rate 小于等于0返回nil
+func parseRateLimit(additionalInfo map[string]interface{}) *RateLimit {
+	if additionalInfo == nil {
+		return nil
+	}
+	v, ok := additionalInfo[KeyRateLimit]
+	if !ok || v == nil {
+		return nil
+	}
+	var limit RateLimit
+	if err := maps.Map2Struct(v, &limit); err != nil || limit.Rate <= 0 {
+		return nil
+	}
+	return withRateLimitDefaults(limit)
+}
+
+func withRateLimitDefaults(limit RateLimit) *RateLimit {
+	if limit.Burst <= 0 {
+		limit.Burst = int(math.Ceil(limit.Rate))
+	}
+	if limit.Window <= 0 {
+		limit.Window = 1000
+	}
+	if limit.Action == "" {
+		limit.Action = RateLimitReject
+	}
+	if limit.MaxDelay <= 0 {
+		limit.MaxDelay = 1000
+	}
+	if limit.Key != "" {
+		limit.keyTemplate = str.NewTemplate(limit.Key)
+	}
+	return &limit
+}
+
+// limiter 限流器
+type limiter interface {
+	// reserve 预约一个许可，返回获得许可需要等待的时间
+	// 如果等待时间超过 maxDelay 则不占用许可，并返回false
+	reserve(now time.Time, maxDelay time.Duration) (time.Duration, bool)
+}
+
+// tokenBucket 令牌桶限流器，以 rate 的速度生成令牌，最多存储 burst 个令牌
+// 令牌可以预支，预支的令牌需要等待生成
+type tokenBucket struct {
+	lock   sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func (b *tokenBucket) reserve(now time.Time, maxDelay time.Duration) (time.Duration, bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	if now.After(b.last) {
+		b.tokens = math.Min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0, true
+	}
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	if delay > maxDelay {
+		b.tokens++
+		return delay, false
+	}
+	return delay, true
+}
+
+// slidingWindow 滑动窗口限流器，记录窗口内每个许可的时间，任意 window 时间内的许可数不超过 limit
+type slidingWindow struct {
+	lock   sync.Mutex
+	limit  int
+	window time.Duration
+	// 许可时间，按时间递增，可能包含预约的未来时间
+	times []time.Time
+}
+
+func (w *slidingWindow) reserve(now time.Time, maxDelay time.Duration) (time.Duration, bool) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	//移除窗口外的许可
+	start := now.Add(-w.window)
+	i := 0
+	for i < len(w.times) && !w.times[i].After(start) {
+		i++
+	}
+	w.times = w.times[i:]
+	at := now
+	if len(w.times) >= w.limit {
+		//等待倒数第limit个许可移出窗口
+		at = w.times[len(w.times)-w.limit].Add(w.window)
+	}
+	delay := at.Sub(now)
+	if delay > maxDelay {
+		return delay, false
+	}
+	w.times = append(w.times, at)
+	return delay, true
+}
@@ -0,0 +1,370 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aspect
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/utils/maps"
+)
+
+// KeyRetry 节点重试策略在 additionalInfo 中的key
+const KeyRetry = "retry"
+
+// ErrAttemptTimeout 单次执行超时错误
+var ErrAttemptTimeout = errors.New("attempt timeout")
+
+var (
+	// Compile-time check RetryAspect implements types.AroundAspect.
+	_ types.AroundAspect = (*RetryAspect)(nil)
+	// Compile-time check RetryAspect implements types.OnReloadAspect.
+	_ types.OnReloadAspect = (*RetryAspect)(nil)
+	// Compile-time check RetryAspect implements types.OnDestroyAspect.
+	_ types.OnDestroyAspect = (*RetryAspect)(nil)
+)
+
+// RetryPolicy 节点重试策略，在节点 additionalInfo.retry 中配置，例如：
+//
+//	{
+//	  "id": "s1",
+//	  "type": "restApiCall",
+//	  "additionalInfo": {
+//	    "retry": {
+//	      "maxAttempts": 3,
+//	      "initialInterval": 200,
+//	      "maxInterval": 5000,
+//	      "multiplier": 2,
+//	      "jitter": 0.2,
+//	      "timeout": 3000,
+//	      "retryOn": ["connection refused", "status code:503"]
+//	    }
+//	  }
+//	}
+type RetryPolicy struct {
+	// MaxAttempts 最大执行次数，包括第一次执行，小于等于1不重试
+	MaxAttempts int
+	// InitialInterval 第一次重试前的等待时间，单位毫秒，默认100
+	InitialInterval int
+	// MaxInterval 重试等待时间的上限，单位毫秒，默认10000
+	MaxInterval int
+	// Multiplier 每次重试等待时间的增长倍数，默认2
+	Multiplier float64
+	// Jitter 等待时间随机抖动比例，取值[0,1]，例如0.2表示在等待时间的±20%范围内随机
+	Jitter float64
+	// Timeout 单次执行超时时间，单位毫秒，0表示不限制
+	// 超时后按失败处理，该次执行后续的结果会被丢弃
+	Timeout int
+	// RetryOn 可重试的错误，错误信息包含其中任意一项才重试，为空则所有错误都重试
+	RetryOn []string
+}
+
+// Backoff 返回第attempt次执行失败后，重试前的等待时间
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	interval := float64(p.InitialInterval) * math.Pow(p.Multiplier, float64(attempt-1))
+	if interval > float64(p.MaxInterval) {
+		interval = float64(p.MaxInterval)
+	}
+	if p.Jitter > 0 {
+		interval = interval * (1 + p.Jitter*(rand.Float64()*2-1))
+	}
+	return time.Duration(interval * float64(time.Millisecond))
+}
+
+// IsRetryable 判断错误是否可重试
+func (p *RetryPolicy) IsRetryable(err error) bool {
+	if len(p.RetryOn) == 0 {
+		return true
+	}
+	if err == nil {
+		return false
+	}
+	errStr := err.Error()
+	for _, item := range p.RetryOn {
+		if strings.Contains(errStr, item) {
+			return true
+		}
+	}
+	return false
+}
+
+// RetryAspect 节点失败重试切面
+// 只对 additionalInfo 配置了 retry 策略的节点生效：节点调用 TellFailure 后，按照指数退避策略，使用消息副本重新执行节点 OnMsg，
+// 直到执行成功或者达到最大执行次数，最后一次失败才会通过 `Failure` 关系传递。
+// 重试次数记录在运行日志 RuleNodeRunLog.Attempts 中，每次失败的错误记录在 RuleNodeRunLog.LogItems 中。
+// 该切面接管了节点的执行，Order 更大的环绕切面不会作用于配置了重试策略的节点。
+type RetryAspect struct {
+	// RetryableFunc 自定义可重试错误判断，如果配置则替代策略中的 RetryOn
+	RetryableFunc func(ctx types.RuleContext, msg types.RuleMsg, err error) bool
+	// 节点重试策略缓存 nodeCacheKey:*RetryPolicy
+	policies sync.Map
+}
+
+// nodeCacheKey 节点缓存key
+type nodeCacheKey struct {
+	chainId string
+	nodeId  string
+}
+
+func (aspect *RetryAspect) Order() int {
+	return 15
+}
+
+func (aspect *RetryAspect) New() types.Aspect {
+	return &RetryAspect{RetryableFunc: aspect.RetryableFunc}
+}
+
+func (aspect *RetryAspect) Type() string {
+	return "retry"
+}
+
+// PointCut 只对配置了重试策略的节点生效
+func (aspect *RetryAspect) PointCut(ctx types.RuleContext, msg types.RuleMsg, relationType string) bool {
+	policy := aspect.getPolicy(ctx)
+	return policy != nil && policy.MaxAttempts > 1
+}
+
+// Around 接管节点执行，执行第一次尝试
+func (aspect *RetryAspect) Around(ctx types.RuleContext, msg types.RuleMsg, relationType string) (types.RuleMsg, bool) {
+	if isTakenOver(ctx) {
+		return msg, false
+	}
+	policy := aspect.getPolicy(ctx)
+	if policy == nil {
+		return msg, true
+	}
+	markTakenOver(ctx)
+	aspect.attempt(ctx, policy, msg, 1)
+	return msg, false
+}
+
+// OnReload 节点更新清除重试策略缓存
+func (aspect *RetryAspect) OnReload(parentCtx types.NodeCtx, ctx types.NodeCtx) error {
+	nodeId := ctx.GetNodeId()
+	if nodeId.Type == types.CHAIN {
+		aspect.deleteChainPolicies(nodeId.Id)
+	} else {
+		aspect.policies.Delete(nodeCacheKey{chainId: parentCtx.GetNodeId().Id, nodeId: nodeId.Id})
+	}
+	return nil
+}
+
+func (aspect *RetryAspect) OnDestroy(ctx types.NodeCtx) {
+	nodeId := ctx.GetNodeId()
+	if nodeId.Type == types.CHAIN {
+		aspect.deleteChainPolicies(nodeId.Id)
+	}
+}
+
+// attempt 使用消息副本执行节点第n次尝试
+func (aspect *RetryAspect) attempt(ctx types.RuleContext, policy *RetryPolicy, msg types.RuleMsg, n int) {
+	attemptCtx := &retryRuleContext{
+		RuleContext: ctx,
+		aspect:      aspect,
+		policy:      policy,
+		msg:         msg,
+		attempt:     n,
+	}
+	parent := ctx.GetContext()
+	if parent == nil {
+		parent = context.Background()
+	}
+	if policy.Timeout <= 0 {
+		attemptCtx.context, attemptCtx.cancel = context.WithCancel(parent)
+	} else {
+		attemptCtx.context, attemptCtx.cancel = context.WithTimeout(parent, time.Duration(policy.Timeout)*time.Millisecond)
+		//超时按失败处理，执行完成后取消上下文，等待结束
+		go func() {
+			<-attemptCtx.context.Done()
+			if errors.Is(attemptCtx.context.Err(), context.DeadlineExceeded) {
+				attemptCtx.fail(msg, ErrAttemptTimeout)
+			}
+		}()
+	}
+	func() {
+		defer func() {
+			//捕捉异常，按失败处理
+			if e := recover(); e != nil {
+				attemptCtx.fail(msg, fmt.Errorf("%v", e))
+			}
+		}()
+		ctx.Self().OnMsg(attemptCtx, msg.Copy())
+	}()
+}
+
+// retry 等待退避时间后执行下一次尝试
+func (aspect *RetryAspect) retry(ctx types.RuleContext, policy *RetryPolicy, msg types.RuleMsg, failedAttempt int, err error) {
+	//记录重试，用于运行日志统计执行次数
+	ctx.OnDebug(chainId(ctx), types.Retry, ctx.GetSelfId(), msg, types.Failure, err)
+	time.AfterFunc(policy.Backoff(failedAttempt), func() {
+		aspect.attempt(ctx, policy, msg, failedAttempt+1)
+	})
+}
+
+func (aspect *RetryAspect) isRetryable(ctx types.RuleContext, policy *RetryPolicy, msg types.RuleMsg, err error) bool {
+	if aspect.RetryableFunc != nil {
+		return aspect.RetryableFunc(ctx, msg, err)
+	}
+	return policy.IsRetryable(err)
+}
+
+// getPolicy 获取节点重试策略，没有配置返回nil
+func (aspect *RetryAspect) getPolicy(ctx types.RuleContext) *RetryPolicy {
+	if ctx.Self() == nil || ctx.RuleChain() == nil {
+		return nil
+	}
+	key := nodeCacheKey{chainId: ctx.RuleChain().GetNodeId().Id, nodeId: ctx.GetSelfId()}
+	if v, ok := aspect.policies.Load(key); ok {
+		return v.(*RetryPolicy)
+	}
+	policy := parseRetryPolicy(nodeDefinition(ctx))
+	aspect.policies.Store(key, policy)
+	return policy
+}
+
+func (aspect *RetryAspect) deleteChainPolicies(chainId string) {
+	aspect.policies.Range(func(key, value any) bool {
+		if key.(nodeCacheKey).chainId == chainId {
+			aspect.policies.Delete(key)
+		}
+		return true
+	})
+}
+
+// parseRetryPolicy 从节点配置 additionalInfo.retry 解析重试策略，没有配置返回nil
+func parseRetryPolicy(def *types.RuleNode) *RetryPolicy {
+	if def == nil || def.AdditionalInfo == nil {
+		return nil
+	}
+	v, ok := def.AdditionalInfo[KeyRetry]
+	if !ok || v == nil {
+		return nil
+	}
+	policy := &RetryPolicy{}
+	if err := maps.Map2Struct(v, policy); err != nil {
+		return nil
+	}
+	if policy.InitialInterval <= 0 {
+		policy.InitialInterval = 100
+	}
+	if policy.MaxInterval <= 0 {
+		policy.MaxInterval = 10000
+	}
+	if policy.Multiplier < 1 {
+		policy.Multiplier = 2
+	}
+	if policy.Jitter < 0 {
+		policy.Jitter = 0
+	} else if policy.Jitter > 1 {
+		policy.Jitter = 1
+	}
+	return policy
+}
+
+const (
+	// 执行中
+	attemptPending int32 = iota
+	// 已经把结果传递给下一个节点
+	attemptPassed
+	// 执行失败，已经重试或者传递失败
+	attemptAbandoned
+)
+
+// retryRuleContext 单次尝试的上下文，拦截节点的执行结果：
+// 成功则传递给原上下文，失败则按照策略重试或者传递失败
+type retryRuleContext struct {
+	types.RuleContext
+	aspect  *RetryAspect
+	policy  *RetryPolicy
+	msg     types.RuleMsg
+	attempt int
+	state   int32
+	context context.Context
+	cancel  context.CancelFunc
+}
+
+func (r *retryRuleContext) TellSuccess(msg types.RuleMsg) {
+	if r.pass() {
+		r.RuleContext.TellSuccess(msg)
+	}
+}
+
+func (r *retryRuleContext) TellFailure(msg types.RuleMsg, err error) {
+	if atomic.LoadInt32(&r.state) == attemptPassed {
+		r.RuleContext.TellFailure(msg, err)
+	} else {
+		r.fail(msg, err)
+	}
+}
+
+func (r *retryRuleContext) TellNext(msg types.RuleMsg, relationTypes ...string) {
+	if r.pass() {
+		r.RuleContext.TellNext(msg, relationTypes...)
+	}
+}
+
+func (r *retryRuleContext) TellNextOrElse(msg types.RuleMsg, defaultRelationType string, relationTypes ...string) {
+	if r.pass() {
+		r.RuleContext.TellNextOrElse(msg, defaultRelationType, relationTypes...)
+	}
+}
+
+// GetContext 返回单次尝试的上下文，配置了超时时间则带有截止时间
+func (r *retryRuleContext) GetContext() context.Context {
+	return r.context
+}
+
+// pass 标记该次尝试成功，返回是否需要传递结果
+// 节点可能多次传递结果，成功后的结果都会传递，丢弃后的结果都不传递
+func (r *retryRuleContext) pass() bool {
+	//已经超时的结果按超时处理
+	if atomic.LoadInt32(&r.state) == attemptPending && errors.Is(r.context.Err(), context.DeadlineExceeded) {
+		r.fail(r.msg, ErrAttemptTimeout)
+		return false
+	}
+	if atomic.CompareAndSwapInt32(&r.state, attemptPending, attemptPassed) {
+		r.release()
+		return true
+	}
+	return atomic.LoadInt32(&r.state) == attemptPassed
+}
+
+// fail 处理执行中的尝试失败(节点失败、超时或者异常)，达到最大执行次数或者错误不可重试则传递失败
+// 失败后该次尝试后续的结果都会被丢弃
+func (r *retryRuleContext) fail(msg types.RuleMsg, err error) {
+	if !atomic.CompareAndSwapInt32(&r.state, attemptPending, attemptAbandoned) {
+		return
+	}
+	r.release()
+	if r.attempt < r.policy.MaxAttempts && r.aspect.isRetryable(r.RuleContext, r.policy, r.msg, err) {
+		r.aspect.retry(r.RuleContext, r.policy, r.msg, r.attempt, err)
+	} else {
+		r.RuleContext.TellFailure(msg, err)
+	}
+}
+
+func (r *retryRuleContext) release() {
+	r.cancel()
+}
@@ -0,0 +1,223 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package aspect
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/utils/trace"
+)
+
+const (
+	// AttrChainId 规则链ID属性
+	AttrChainId = "rulego.chain.id"
+	// AttrNodeId 节点ID属性
+	AttrNodeId = "rulego.node.id"
+	// AttrNodeType 节点类型属性
+	AttrNodeType = "rulego.node.type"
+	// AttrMsgId 消息ID属性
+	AttrMsgId = "rulego.msg.id"
+	// AttrMsgType 消息类型属性
+	AttrMsgType = "rulego.msg.type"
+	// AttrRelationType 节点输出关系属性
+	AttrRelationType = "rulego.relation_type"
+	// EventBranchEnd 分支结束事件
+	EventBranchEnd = "rulego.branch.end"
+)
+
+var (
+	_ types.StartAspect     = (*TracingAspect)(nil)
+	_ types.BeforeAspect    = (*TracingAspect)(nil)
+	_ types.AfterAspect     = (*TracingAspect)(nil)
+	_ types.EndAspect       = (*TracingAspect)(nil)
+	_ types.CompletedAspect = (*TracingAspect)(nil)
+)
+
+type chainTraceKey struct{}
+type nodeSpanKey struct{}
+
+// chainTrace 一次规则链执行的链路，规则链执行完成后一起导出
+type chainTrace struct {
+	span  *trace.Span
+	spans []*trace.Span
+	lock  sync.Mutex
+}
+
+func (t *chainTrace) add(span *trace.Span) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.spans = append(t.spans, span)
+}
+
+func (t *chainTrace) all() []*trace.Span {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]*trace.Span{t.span}, t.spans...)
+}
+
+// TracingAspect 分布式链路追踪切面，兼容 OpenTelemetry 和 W3C Trace Context。
+// 每次规则链执行创建一个span，每个节点创建一个子span，规则链执行完成后通过 SpanExporter 导出。
+//
+// 链路上下文传递：
+//   - 如果消息元数据中存在 traceparent（例如：由 endpoint 从请求头中读取），则作为父span
+//   - 节点执行时元数据 traceparent 替换为当前节点span，restApiCall 等组件会把它传递给下游服务
+//   - 子规则链（flow）的span作为调用节点span的子span
+//   - MQTT 3.1.1 没有用户属性（user properties），mqttClient 和 mqtt endpoint 开启 TraceEnvelope 后通过 trace.Envelope 负荷信封传递
+//
+// 使用方式：
+//
+//	exporter := trace.NewOtlpHttpExporter("http://127.0.0.1:4318")
+//	ruleEngine, err := rulego.New("rule01", def, types.WithAspects(aspect.NewTracingAspect(exporter)))
+type TracingAspect struct {
+	exporter trace.SpanExporter
+}
+
+// NewTracingAspect 创建链路追踪切面，exporter为nil则不导出
+func NewTracingAspect(exporter trace.SpanExporter) *TracingAspect {
+	return &TracingAspect{exporter: exporter}
+}
+
+func (aspect *TracingAspect) Order() int {
+	return 5
+}
+
+func (aspect *TracingAspect) New() types.Aspect {
+	return &TracingAspect{exporter: aspect.exporter}
+}
+
+func (aspect *TracingAspect) Type() string {
+	return "tracing"
+}
+
+// PointCut 切入点 所有节点都会执行
+func (aspect *TracingAspect) PointCut(ctx types.RuleContext, msg types.RuleMsg, relationType string) bool {
+	return true
+}
+
+// Start 创建规则链span
+func (aspect *TracingAspect) Start(ctx types.RuleContext, msg types.RuleMsg) (types.RuleMsg, error) {
+	parent, _ := aspect.parentContext(ctx, msg, false)
+	span := trace.StartSpan(chainId(ctx), trace.SpanKindServer, parent)
+	if ctx.RuleChain() != nil {
+		span.SetAttribute(AttrChainId, ctx.RuleChain().GetNodeId().Id)
+	}
+	span.SetAttribute(AttrMsgId, msg.Id)
+	span.SetAttribute(AttrMsgType, msg.Type)
+	ctx.SetContext(context.WithValue(baseContext(ctx), chainTraceKey{}, &chainTrace{span: span}))
+	//避免修改调用方的元数据
+	msg.Metadata = aspect.copyMetadata(msg.Metadata)
+	trace.Inject(span.Context(), msg.Metadata.PutValue)
+	return msg, nil
+}
+
+// Before 创建节点span，并把节点span写入元数据traceparent，用于传递给下游服务
+func (aspect *TracingAspect) Before(ctx types.RuleContext, msg types.RuleMsg, relationType string) types.RuleMsg {
+	if ctx.Self() == nil {
+		return msg
+	}
+	parent, chain := aspect.parentContext(ctx, msg, true)
+	nodeId := ctx.Self().GetNodeId().Id
+	span := trace.StartSpan(nodeId, trace.SpanKindInternal, parent)
+	span.SetAttribute(AttrNodeId, nodeId)
+	span.SetAttribute(AttrNodeType, ctx.Self().Type())
+	span.SetAttribute(AttrMsgId, msg.Id)
+	span.SetAttribute(AttrMsgType, msg.Type)
+	if chain != nil {
+		chain.add(span)
+	}
+	ctx.SetContext(context.WithValue(baseContext(ctx), nodeSpanKey{}, span))
+	if msg.Metadata == nil {
+		msg.Metadata = types.NewMetadata()
+	}
+	trace.Inject(span.Context(), msg.Metadata.PutValue)
+	return msg
+}
+
+// After 结束节点span，节点多次输出只记录第一次
+func (aspect *TracingAspect) After(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) types.RuleMsg {
+	span, ok := baseContext(ctx).Value(nodeSpanKey{}).(*trace.Span)
+	if !ok || span.Ended() {
+		return msg
+	}
+	span.SetAttribute(AttrRelationType, relationType)
+	span.SetError(err)
+	if span.End() {
+		//不在规则链执行中，例如：TellNode，则直接导出
+		if _, ok := baseContext(ctx).Value(chainTraceKey{}).(*chainTrace); !ok {
+			aspect.export(ctx, []*trace.Span{span})
+		}
+	}
+	return msg
+}
+
+// End 记录分支结束事件
+func (aspect *TracingAspect) End(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) types.RuleMsg {
+	if chain, ok := baseContext(ctx).Value(chainTraceKey{}).(*chainTrace); ok {
+		attributes := map[string]string{AttrRelationType: relationType}
+		if err != nil {
+			attributes["error"] = err.Error()
+		}
+		chain.span.AddEvent(EventBranchEnd, attributes)
+		chain.span.SetError(err)
+	}
+	return msg
+}
+
+// Completed 结束规则链span，并导出本次执行的所有span
+func (aspect *TracingAspect) Completed(ctx types.RuleContext, msg types.RuleMsg) types.RuleMsg {
+	if chain, ok := baseContext(ctx).Value(chainTraceKey{}).(*chainTrace); ok {
+		if chain.span.End() {
+			aspect.export(ctx, chain.all())
+		}
+	}
+	return msg
+}
+
+// parentContext 获取父span上下文，优先级：规则链span > 调用方节点span(子规则链) > 元数据traceparent
+func (aspect *TracingAspect) parentContext(ctx types.RuleContext, msg types.RuleMsg, withChain bool) (trace.SpanContext, *chainTrace) {
+	c := baseContext(ctx)
+	if withChain {
+		if chain, ok := c.Value(chainTraceKey{}).(*chainTrace); ok {
+			return chain.span.Context(), chain
+		}
+	}
+	if span, ok := c.Value(nodeSpanKey{}).(*trace.Span); ok {
+		return span.Context(), nil
+	}
+	sc, _ := trace.Extract(msg.Metadata.GetValue)
+	return sc, nil
+}
+
+func (aspect *TracingAspect) export(ctx types.RuleContext, spans []*trace.Span) {
+	if aspect.exporter == nil || len(spans) == 0 || !spans[0].Sampled {
+		return
+	}
+	go func() {
+		if err := aspect.exporter.Export(spans); err != nil {
+			ctx.Config().Logger.Printf("export spans error:%s", err)
+		}
+	}()
+}
+
+func (aspect *TracingAspect) copyMetadata(metadata types.Metadata) types.Metadata {
+	if metadata == nil {
+		return types.NewMetadata()
+	}
+	return metadata.Copy()
+}
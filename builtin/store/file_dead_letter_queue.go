@@ -0,0 +1,79 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+var _ types.DeadLetterQueue = (*FileDeadLetterQueue)(nil)
+
+// ErrDeadLetterNotFound is returned when the dead letter does not exist.
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
+
+// FileDeadLetterQueue stores each dead letter as a JSON file under a directory per rule chain:
+// {dir}/{ruleChainId}/{deadLetterId}.json
+// Files are written the same way as FileMessageStore, so a crash never leaves a partially written dead letter.
+type FileDeadLetterQueue struct {
+	fileStore
+	// Sync indicates whether to fsync each dead letter file before renaming it, default is true.
+	Sync bool
+}
+
+// NewFileDeadLetterQueue creates a file dead letter queue in the specified directory. The directory is created if it does not exist.
+func NewFileDeadLetterQueue(dir string) (*FileDeadLetterQueue, error) {
+	if dir == "" {
+		return nil, errors.New("dir can not empty")
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &FileDeadLetterQueue{fileStore: fileStore{dir: dir}, Sync: true}, nil
+}
+
+func (q *FileDeadLetterQueue) Put(letter types.DeadLetter) error {
+	if letter.Id == "" {
+		return errors.New("dead letter id can not empty")
+	}
+	return q.put(letter.RuleChainId, letter.Id, letter, q.Sync)
+}
+
+func (q *FileDeadLetterQueue) Get(ruleChainId, id string) (types.DeadLetter, error) {
+	var letter types.DeadLetter
+	if err := q.get(ruleChainId, id, &letter); err != nil {
+		if os.IsNotExist(err) {
+			return letter, fmt.Errorf("id=%s %w", id, ErrDeadLetterNotFound)
+		}
+		return letter, err
+	}
+	return letter, nil
+}
+
+func (q *FileDeadLetterQueue) Delete(ruleChainId, id string) error {
+	return q.delete(ruleChainId, id)
+}
+
+// List returns all dead letters of the rule chain, ordered by creation time.
+func (q *FileDeadLetterQueue) List(ruleChainId string) ([]types.DeadLetter, error) {
+	return listRecords(&q.fileStore, ruleChainId, func(letter types.DeadLetter) int64 {
+		return letter.Ts
+	})
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestFileDeadLetterQueue(t *testing.T) {
+	q, err := NewFileDeadLetterQueue(t.TempDir())
+	assert.Nil(t, err)
+
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.BuildMetadata(types.Metadata{"k": "v"}), "{\"a\":1}")
+	snapshot := types.RuleChainRunSnapshot{Id: msg.Id, Logs: []types.RuleNodeRunLog{{Id: "s1", Err: "error"}}}
+	assert.Nil(t, q.Put(types.DeadLetter{Id: "2", RuleChainId: "chain01", NodeId: "s2", Err: "error2", Msg: msg, Ts: 2}))
+	assert.Nil(t, q.Put(types.DeadLetter{Id: "1", RuleChainId: "chain01", NodeId: "s1", Err: "error", Msg: msg, Snapshot: snapshot, Ts: 1}))
+	assert.NotNil(t, q.Put(types.DeadLetter{RuleChainId: "chain01"}))
+
+	list, err := q.List("chain01")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(list))
+	assert.Equal(t, "s1", list[0].NodeId)
+	assert.Equal(t, "s2", list[1].NodeId)
+
+	letter, err := q.Get("chain01", "1")
+	assert.Nil(t, err)
+	assert.Equal(t, "error", letter.Err)
+	assert.Equal(t, msg.Id, letter.Msg.Id)
+	assert.Equal(t, "v", letter.Msg.Metadata.GetValue("k"))
+	assert.Equal(t, 1, len(letter.Snapshot.Logs))
+	assert.Equal(t, "error", letter.Snapshot.Logs[0].Err)
+
+	_, err = q.Get("chain01", "notFound")
+	assert.True(t, errors.Is(err, ErrDeadLetterNotFound))
+
+	assert.Nil(t, q.Delete("chain01", "1"))
+	assert.Nil(t, q.Delete("chain01", "notFound"))
+	list, _ = q.List("chain01")
+	assert.Equal(t, 1, len(list))
+
+	list, err = q.List("notFound")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(list))
+
+	_, err = NewFileDeadLetterQueue("")
+	assert.NotNil(t, err)
+}
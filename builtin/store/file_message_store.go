@@ -0,0 +1,69 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package store provides built-in local persistence implementations for the RuleGo rule engine.
+//
+// Key components:
+// - FileMessageStore: A types.MessageStore that keeps in-flight message checkpoints as files on the local disk.
+// - FileDeadLetterQueue: A types.DeadLetterQueue that keeps failed messages as files on the local disk.
+package store
+
+import (
+	"errors"
+	"os"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+var _ types.MessageStore = (*FileMessageStore)(nil)
+
+// FileMessageStore stores each checkpoint as a JSON file under a directory per rule chain:
+// {dir}/{ruleChainId}/{checkpointId}.json
+// Files are written to a temporary file, synced and then renamed, so a crash never leaves a partially written checkpoint.
+type FileMessageStore struct {
+	fileStore
+	// Sync indicates whether to fsync each checkpoint file before renaming it, default is true.
+	Sync bool
+}
+
+// NewFileMessageStore creates a file message store in the specified directory. The directory is created if it does not exist.
+func NewFileMessageStore(dir string) (*FileMessageStore, error) {
+	if dir == "" {
+		return nil, errors.New("dir can not empty")
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return nil, err
+	}
+	return &FileMessageStore{fileStore: fileStore{dir: dir}, Sync: true}, nil
+}
+
+func (s *FileMessageStore) Save(checkpoint types.MessageCheckpoint) error {
+	if checkpoint.Id == "" {
+		return errors.New("checkpoint id can not empty")
+	}
+	return s.put(checkpoint.RuleChainId, checkpoint.Id, checkpoint, s.Sync)
+}
+
+func (s *FileMessageStore) Delete(ruleChainId, id string) error {
+	return s.delete(ruleChainId, id)
+}
+
+// List returns all checkpoints of the rule chain, ordered by creation time.
+func (s *FileMessageStore) List(ruleChainId string) ([]types.MessageCheckpoint, error) {
+	return listRecords(&s.fileStore, ruleChainId, func(checkpoint types.MessageCheckpoint) int64 {
+		return checkpoint.Ts
+	})
+}
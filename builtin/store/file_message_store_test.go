@@ -0,0 +1,79 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestFileMessageStore(t *testing.T) {
+	dir := t.TempDir()
+	s, err := NewFileMessageStore(dir)
+	assert.Nil(t, err)
+
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.BuildMetadata(types.Metadata{"k": "v"}), "{\"a\":1}")
+	assert.Nil(t, s.Save(types.MessageCheckpoint{Id: "2", RuleChainId: "chain/01", NodeId: "s2", Msg: msg, Ts: 2}))
+	assert.Nil(t, s.Save(types.MessageCheckpoint{Id: "1", RuleChainId: "chain/01", NodeId: "s1", Msg: msg, Ts: 1}))
+	assert.Nil(t, s.Save(types.MessageCheckpoint{Id: "3", RuleChainId: "..", NodeId: "s1", Msg: msg, Ts: 1}))
+	assert.NotNil(t, s.Save(types.MessageCheckpoint{RuleChainId: "chain/01"}))
+
+	list, err := s.List("chain/01")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(list))
+	assert.Equal(t, "s1", list[0].NodeId)
+	assert.Equal(t, "s2", list[1].NodeId)
+	assert.Equal(t, msg.Id, list[0].Msg.Id)
+	assert.Equal(t, "v", list[0].Msg.Metadata.GetValue("k"))
+
+	//覆盖
+	assert.Nil(t, s.Save(types.MessageCheckpoint{Id: "1", RuleChainId: "chain/01", NodeId: "s3", Msg: msg, Ts: 1}))
+	list, _ = s.List("chain/01")
+	assert.Equal(t, 2, len(list))
+	assert.Equal(t, "s3", list[0].NodeId)
+
+	//未写完的临时文件会被清除
+	tmpFile := filepath.Join(dir, escapeFileName("chain/01"), "4.json.tmp")
+	assert.Nil(t, os.WriteFile(tmpFile, []byte("{"), 0644))
+	list, err = s.List("chain/01")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(list))
+	_, err = os.Stat(tmpFile)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Nil(t, s.Delete("chain/01", "1"))
+	assert.Nil(t, s.Delete("chain/01", "notFound"))
+	list, _ = s.List("chain/01")
+	assert.Equal(t, 1, len(list))
+
+	//不能访问上级目录
+	list, _ = s.List("..")
+	assert.Equal(t, 1, len(list))
+	_, err = os.Stat(filepath.Join(dir, "..", "3.json"))
+	assert.True(t, os.IsNotExist(err))
+
+	list, err = s.List("notFound")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(list))
+
+	_, err = NewFileMessageStore("")
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,168 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package store
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/rulego/rulego/utils/json"
+)
+
+const (
+	recordFileExt = ".json"
+	tmpFileExt    = ".tmp"
+)
+
+// fileStore stores each record as a JSON file under a directory per rule chain:
+// {dir}/{ruleChainId}/{id}.json
+// Files are written to a temporary file, synced and then renamed, so a crash never leaves a partially written record.
+type fileStore struct {
+	// dir is the root directory of the store.
+	dir  string
+	lock sync.RWMutex
+}
+
+// Dir returns the root directory of the store.
+func (s *fileStore) Dir() string {
+	return s.dir
+}
+
+// put writes the record as a JSON file, and fsyncs it before renaming if sync is true.
+func (s *fileStore) put(ruleChainId, id string, v interface{}, sync bool) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	chainDir := s.chainDir(ruleChainId)
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if err = os.MkdirAll(chainDir, os.ModePerm); err != nil {
+		return err
+	}
+	filePath := s.filePath(ruleChainId, id)
+	tmpPath := filePath + tmpFileExt
+	if err = writeFile(tmpPath, data, sync); err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+	return os.Rename(tmpPath, filePath)
+}
+
+// get reads the record into v. The error satisfies os.IsNotExist if the record does not exist.
+func (s *fileStore) get(ruleChainId, id string, v interface{}) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	data, err := os.ReadFile(s.filePath(ruleChainId, id))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// delete removes the record. Deleting a non-existent record is not an error.
+func (s *fileStore) delete(ruleChainId, id string) error {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if err := os.Remove(s.filePath(ruleChainId, id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// listRecords returns all records of the rule chain, ordered by ts.
+// Temporary files left by an unfinished write before a crash are removed.
+func listRecords[T any](s *fileStore, ruleChainId string, ts func(T) int64) ([]T, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	chainDir := s.chainDir(ruleChainId)
+	entries, err := os.ReadDir(chainDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var list []T
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() {
+			continue
+		}
+		if strings.HasSuffix(name, tmpFileExt) {
+			// Unfinished write before a crash
+			_ = os.Remove(filepath.Join(chainDir, name))
+			continue
+		}
+		if !strings.HasSuffix(name, recordFileExt) {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(chainDir, name))
+		if err != nil {
+			return nil, err
+		}
+		var item T
+		if err = json.Unmarshal(data, &item); err != nil {
+			return nil, err
+		}
+		list = append(list, item)
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		return ts(list[i]) < ts(list[j])
+	})
+	return list, nil
+}
+
+func (s *fileStore) chainDir(ruleChainId string) string {
+	return filepath.Join(s.dir, escapeFileName(ruleChainId))
+}
+
+func (s *fileStore) filePath(ruleChainId, id string) string {
+	return filepath.Join(s.chainDir(ruleChainId), escapeFileName(id)+recordFileExt)
+}
+
+// writeFile writes data to the file, and fsyncs it if sync is true.
+func writeFile(path string, data []byte, sync bool) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if sync {
+		if err = file.Sync(); err != nil {
+			_ = file.Close()
+			return err
+		}
+	}
+	return file.Close()
+}
+
+// escapeFileName converts an ID to a safe file name that can not reference a parent directory.
+func escapeFileName(id string) string {
+	name := url.PathEscape(id)
+	if name == "" || name == "." || name == ".." {
+		return strings.ReplaceAll("_"+name, ".", "%2E")
+	}
+	return name
+}
@@ -0,0 +1,417 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package chain provides a fluent builder API for constructing rule chains in Go code.
+//
+// The builder produces a types.RuleChain equivalent to a JSON DSL file and validates it
+// with engine.Validate at Build time, so rule chains can be created and unit tested without JSON fixtures:
+//
+//	def, err := chain.New("rule01").Name("测试规则链").
+//		Node("f1", "jsFilter", types.Configuration{"jsScript": "return msg.temperature > 50;"}).
+//		On(types.True).To("t1", "jsTransform", types.Configuration{"jsScript": "return {'msg':msg,'metadata':metadata,'msgType':msgType};"}).
+//		On(types.Success).Flow("sub1", "sub_chain_01").
+//		Build()
+//
+// Endpoints are declared with Endpoint and its routers with Router, mirroring the endpoint.Router From().To() API:
+//
+//	chain.New("rule01").
+//		Endpoint("e1", "http", types.Configuration{"server": ":9090"}).
+//		Router("/api/v1/msg", "POST").To("chain:rule01").Wait().End().
+//		Chain()
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/engine"
+)
+
+// FlowNodeType 子规则链节点类型
+const FlowNodeType = "flow"
+
+// Builder 规则链构建器
+type Builder struct {
+	def      types.RuleChain
+	registry types.ComponentRegistry
+	//firstNodeId 第一个节点ID，为空则使用第一个添加的节点
+	firstNodeId string
+	errs        []error
+}
+
+// New 创建规则链构建器
+func New(id string) *Builder {
+	b := &Builder{}
+	b.def.RuleChain.ID = id
+	if id == "" {
+		b.errs = append(b.errs, errors.New("rule chain id can not be empty"))
+	}
+	return b
+}
+
+// Name 设置规则链名称
+func (b *Builder) Name(name string) *Builder {
+	b.def.RuleChain.Name = name
+	return b
+}
+
+// DebugMode 设置规则链所有节点是否开启调试模式
+func (b *Builder) DebugMode(debugMode bool) *Builder {
+	b.def.RuleChain.DebugMode = debugMode
+	return b
+}
+
+// Root 设置是否是根规则链
+func (b *Builder) Root(root bool) *Builder {
+	b.def.RuleChain.Root = root
+	return b
+}
+
+// Disabled 设置是否禁用规则链
+func (b *Builder) Disabled(disabled bool) *Builder {
+	b.def.RuleChain.Disabled = disabled
+	return b
+}
+
+// Configuration 合并规则链配置，例如 vars
+func (b *Builder) Configuration(configs ...types.Configuration) *Builder {
+	b.def.RuleChain.Configuration = mergeConfiguration(b.def.RuleChain.Configuration, configs...)
+	return b
+}
+
+// AdditionalInfo 设置规则链扩展信息
+func (b *Builder) AdditionalInfo(key string, value interface{}) *Builder {
+	if b.def.RuleChain.AdditionalInfo == nil {
+		b.def.RuleChain.AdditionalInfo = make(map[string]interface{})
+	}
+	b.def.RuleChain.AdditionalInfo[key] = value
+	return b
+}
+
+// Registry 设置校验使用的组件注册器，默认使用 engine.Registry
+func (b *Builder) Registry(registry types.ComponentRegistry) *Builder {
+	b.registry = registry
+	return b
+}
+
+// Node 添加节点，configs 合并成节点配置
+func (b *Builder) Node(id, nodeType string, configs ...types.Configuration) *NodeBuilder {
+	if id == "" {
+		b.errs = append(b.errs, fmt.Errorf("node id can not be empty, type=%s", nodeType))
+	}
+	node := &types.RuleNode{Id: id, Type: nodeType, Configuration: mergeConfiguration(nil, configs...)}
+	b.def.Metadata.Nodes = append(b.def.Metadata.Nodes, node)
+	return &NodeBuilder{chain: b, node: node}
+}
+
+// Flow 添加子规则链节点
+func (b *Builder) Flow(id, ruleChainId string) *NodeBuilder {
+	return b.Node(id, FlowNodeType, types.Configuration{"targetId": ruleChainId})
+}
+
+// Connect 添加节点连接关系
+func (b *Builder) Connect(fromId, relationType, toId string) *Builder {
+	b.def.Metadata.Connections = append(b.def.Metadata.Connections, types.NodeConnection{
+		FromId: fromId,
+		ToId:   toId,
+		Type:   relationType,
+	})
+	return b
+}
+
+// FirstNode 设置第一个执行的节点，默认是第一个添加的节点
+func (b *Builder) FirstNode(id string) *Builder {
+	b.firstNodeId = id
+	return b
+}
+
+// Endpoint 添加嵌入规则链的 endpoint
+func (b *Builder) Endpoint(id, endpointType string, configs ...types.Configuration) *EndpointBuilder {
+	def := &types.EndpointDsl{RuleNode: types.RuleNode{Id: id, Type: endpointType, Configuration: mergeConfiguration(nil, configs...)}}
+	return b.EndpointDsl(def)
+}
+
+// EndpointDsl 添加已经定义好的 endpoint
+func (b *Builder) EndpointDsl(def *types.EndpointDsl) *EndpointBuilder {
+	b.def.Metadata.Endpoints = append(b.def.Metadata.Endpoints, def)
+	return &EndpointBuilder{chain: b, def: def}
+}
+
+// Validate 静态校验规则链，返回所有诊断信息，包括警告
+func (b *Builder) Validate() engine.Diagnostics {
+	def, err := b.definition()
+	if err != nil {
+		return engine.Diagnostics{{Severity: engine.SeverityError, Code: "builder", Message: err.Error()}}
+	}
+	return engine.Validate(def, b.registry)
+}
+
+// Build 生成规则链定义，并通过 engine.Validate 校验，存在错误则返回 *engine.ValidationError
+func (b *Builder) Build() (types.RuleChain, error) {
+	def, err := b.definition()
+	if err != nil {
+		return def, err
+	}
+	if diagnostics := engine.Validate(def, b.registry); diagnostics.HasError() {
+		return def, &engine.ValidationError{Diagnostics: diagnostics}
+	}
+	return def, nil
+}
+
+// MustBuild 生成规则链定义，校验失败则 panic，用于测试或者初始化
+func (b *Builder) MustBuild() types.RuleChain {
+	def, err := b.Build()
+	if err != nil {
+		panic(err)
+	}
+	return def
+}
+
+// DSL 生成并校验规则链，返回Json格式的DSL，可以直接用于创建规则引擎实例
+func (b *Builder) DSL() ([]byte, error) {
+	def, err := b.Build()
+	if err != nil {
+		return nil, err
+	}
+	return (&engine.JsonParser{}).EncodeRuleChain(def)
+}
+
+// definition 返回规则链定义的副本，构建器可以继续修改
+func (b *Builder) definition() (types.RuleChain, error) {
+	def := b.def
+	def.Metadata.Nodes = append([]*types.RuleNode{}, b.def.Metadata.Nodes...)
+	def.Metadata.Connections = append([]types.NodeConnection{}, b.def.Metadata.Connections...)
+	if len(b.def.Metadata.Endpoints) > 0 {
+		def.Metadata.Endpoints = append([]*types.EndpointDsl{}, b.def.Metadata.Endpoints...)
+	}
+	if len(b.errs) > 0 {
+		var messages []string
+		for _, err := range b.errs {
+			messages = append(messages, err.Error())
+		}
+		return def, errors.New(strings.Join(messages, "; "))
+	}
+	if b.firstNodeId != "" {
+		def.Metadata.FirstNodeIndex = -1
+		for i, node := range def.Metadata.Nodes {
+			if node.Id == b.firstNodeId {
+				def.Metadata.FirstNodeIndex = i
+				break
+			}
+		}
+		if def.Metadata.FirstNodeIndex < 0 {
+			return def, fmt.Errorf("first node not found, nodeId=%s", b.firstNodeId)
+		}
+	}
+	return def, nil
+}
+
+// NodeBuilder 节点构建器
+type NodeBuilder struct {
+	chain *Builder
+	node  *types.RuleNode
+}
+
+// Id 节点ID
+func (n *NodeBuilder) Id() string {
+	return n.node.Id
+}
+
+// Name 设置节点名称
+func (n *NodeBuilder) Name(name string) *NodeBuilder {
+	n.node.Name = name
+	return n
+}
+
+// DebugMode 设置节点是否开启调试模式
+func (n *NodeBuilder) DebugMode(debugMode bool) *NodeBuilder {
+	n.node.DebugMode = debugMode
+	return n
+}
+
+// Configuration 合并节点配置
+func (n *NodeBuilder) Configuration(configs ...types.Configuration) *NodeBuilder {
+	n.node.Configuration = mergeConfiguration(n.node.Configuration, configs...)
+	return n
+}
+
+// Set 设置节点配置项
+func (n *NodeBuilder) Set(key string, value interface{}) *NodeBuilder {
+	return n.Configuration(types.Configuration{key: value})
+}
+
+// AdditionalInfo 设置节点扩展信息，例如可视化的 layoutX/layoutY
+func (n *NodeBuilder) AdditionalInfo(key string, value interface{}) *NodeBuilder {
+	if n.node.AdditionalInfo == nil {
+		n.node.AdditionalInfo = make(map[string]interface{})
+	}
+	n.node.AdditionalInfo[key] = value
+	return n
+}
+
+// On 指定从该节点出发的关系类型，多个关系类型连接到同一个节点
+func (n *NodeBuilder) On(relationTypes ...string) *Relation {
+	if len(relationTypes) == 0 {
+		n.chain.errs = append(n.chain.errs, fmt.Errorf("relation type can not be empty, nodeId=%s", n.node.Id))
+	}
+	return &Relation{from: n, relationTypes: relationTypes}
+}
+
+// Node 添加新节点，同 Builder.Node
+func (n *NodeBuilder) Node(id, nodeType string, configs ...types.Configuration) *NodeBuilder {
+	return n.chain.Node(id, nodeType, configs...)
+}
+
+// Chain 返回规则链构建器
+func (n *NodeBuilder) Chain() *Builder {
+	return n.chain
+}
+
+// Build 同 Builder.Build
+func (n *NodeBuilder) Build() (types.RuleChain, error) {
+	return n.chain.Build()
+}
+
+// Relation 节点的关系，用于连接下一个节点
+type Relation struct {
+	from          *NodeBuilder
+	relationTypes []string
+}
+
+// To 添加新节点并连接，返回新节点的构建器
+func (r *Relation) To(id, nodeType string, configs ...types.Configuration) *NodeBuilder {
+	to := r.from.chain.Node(id, nodeType, configs...)
+	r.connect(id)
+	return to
+}
+
+// Flow 添加子规则链节点并连接，返回子规则链节点的构建器
+func (r *Relation) Flow(id, ruleChainId string) *NodeBuilder {
+	to := r.from.chain.Flow(id, ruleChainId)
+	r.connect(id)
+	return to
+}
+
+// Link 连接到已经添加或者之后添加的节点，返回源节点的构建器，用于继续添加其他关系
+func (r *Relation) Link(toId string) *NodeBuilder {
+	r.connect(toId)
+	return r.from
+}
+
+func (r *Relation) connect(toId string) {
+	for _, relationType := range r.relationTypes {
+		r.from.chain.Connect(r.from.node.Id, relationType, toId)
+	}
+}
+
+// EndpointBuilder 嵌入规则链的 endpoint 构建器
+type EndpointBuilder struct {
+	chain *Builder
+	def   *types.EndpointDsl
+}
+
+// Name 设置 endpoint 名称
+func (e *EndpointBuilder) Name(name string) *EndpointBuilder {
+	e.def.Name = name
+	return e
+}
+
+// Processors 设置 endpoint 全局处理器，使用 builtin/processor 注册的处理器名称
+func (e *EndpointBuilder) Processors(processors ...string) *EndpointBuilder {
+	e.def.Processors = append(e.def.Processors, processors...)
+	return e
+}
+
+// Router 添加路由，params 是路由参数，例如 http endpoint 的请求方法 POST/GET
+func (e *EndpointBuilder) Router(from string, params ...interface{}) *RouterBuilder {
+	def := &types.RouterDsl{Params: params, From: types.FromDsl{Path: from}}
+	e.def.Routers = append(e.def.Routers, def)
+	return &RouterBuilder{endpoint: e, def: def}
+}
+
+// Chain 返回规则链构建器
+func (e *EndpointBuilder) Chain() *Builder {
+	return e.chain
+}
+
+// RouterBuilder 路由构建器
+type RouterBuilder struct {
+	endpoint *EndpointBuilder
+	def      *types.RouterDsl
+}
+
+// Id 设置路由ID，默认使用 from path
+func (r *RouterBuilder) Id(id string) *RouterBuilder {
+	r.def.Id = id
+	return r
+}
+
+// FromConfiguration 合并 from 配置
+func (r *RouterBuilder) FromConfiguration(configs ...types.Configuration) *RouterBuilder {
+	r.def.From.Configuration = mergeConfiguration(r.def.From.Configuration, configs...)
+	return r
+}
+
+// Transform 添加 from 处理器
+func (r *RouterBuilder) Transform(processors ...string) *RouterBuilder {
+	r.def.From.Processors = append(r.def.From.Processors, processors...)
+	return r
+}
+
+// To 设置路由目标，例如 chain:{chainId} 或者 component:{nodeType}
+func (r *RouterBuilder) To(path string, configs ...types.Configuration) *RouterBuilder {
+	r.def.To.Path = path
+	r.def.To.Configuration = mergeConfiguration(r.def.To.Configuration, configs...)
+	return r
+}
+
+// Process 添加 to 处理器
+func (r *RouterBuilder) Process(processors ...string) *RouterBuilder {
+	r.def.To.Processors = append(r.def.To.Processors, processors...)
+	return r
+}
+
+// Wait 等待目标执行完成，例如 http 需要响应规则链的处理结果
+func (r *RouterBuilder) Wait() *RouterBuilder {
+	r.def.To.Wait = true
+	return r
+}
+
+// Ack 设置路由的确认策略
+func (r *RouterBuilder) Ack(successRelationTypes ...string) *RouterBuilder {
+	r.def.Ack = &types.AckPolicy{SuccessRelationTypes: successRelationTypes}
+	return r
+}
+
+// End 结束路由，返回 endpoint 构建器
+func (r *RouterBuilder) End() *EndpointBuilder {
+	return r.endpoint
+}
+
+// mergeConfiguration 把 configs 合并到 dst，返回合并后的配置
+func mergeConfiguration(dst types.Configuration, configs ...types.Configuration) types.Configuration {
+	if dst == nil {
+		dst = make(types.Configuration)
+	}
+	for _, config := range configs {
+		for k, v := range config {
+			dst[k] = v
+		}
+	}
+	return dst
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package chain
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/engine"
+	"github.com/rulego/rulego/test/assert"
+)
+
+const transformScript = "metadata['path']=(metadata['path']||'')+'/'+msgType;return {'msg':msg,'metadata':metadata,'msgType':msgType};"
+
+func TestBuild(t *testing.T) {
+	def, err := New("rule01").Name("测试规则链").DebugMode(true).Root(true).
+		Configuration(types.Configuration{"vars": map[string]string{"ip": "127.0.0.1"}}).
+		Node("f1", "jsFilter", types.Configuration{"jsScript": "return msg.temperature > 50;"}).Name("过滤").
+		On(types.True).To("t1", "jsTransform").Set("jsScript", transformScript).
+		On(types.Success).Flow("sub1", "sub_chain_01").
+		Chain().Node("t2", "jsTransform", types.Configuration{"jsScript": transformScript}).AdditionalInfo("layoutX", 100).
+		Chain().Connect("f1", types.False, "t2").
+		Build()
+	assert.Nil(t, err)
+
+	assert.Equal(t, "rule01", def.RuleChain.ID)
+	assert.Equal(t, "测试规则链", def.RuleChain.Name)
+	assert.True(t, def.RuleChain.DebugMode)
+	assert.True(t, def.RuleChain.Root)
+	assert.Equal(t, 0, def.Metadata.FirstNodeIndex)
+	assert.Equal(t, 4, len(def.Metadata.Nodes))
+	assert.Equal(t, "过滤", def.Metadata.Nodes[0].Name)
+	assert.Equal(t, transformScript, def.Metadata.Nodes[1].Configuration["jsScript"])
+	assert.Equal(t, FlowNodeType, def.Metadata.Nodes[2].Type)
+	assert.Equal(t, "sub_chain_01", def.Metadata.Nodes[2].Configuration["targetId"])
+	assert.Equal(t, 100, def.Metadata.Nodes[3].AdditionalInfo["layoutX"])
+	assert.Equal(t, []types.NodeConnection{
+		{FromId: "f1", ToId: "t1", Type: types.True},
+		{FromId: "t1", ToId: "sub1", Type: types.Success},
+		{FromId: "f1", ToId: "t2", Type: types.False},
+	}, def.Metadata.Connections)
+}
+
+func TestBuildAndRun(t *testing.T) {
+	pool := engine.NewPool()
+	subDsl, err := New("sub_chain_01").
+		Node("s1", "jsTransform", types.Configuration{"jsScript": transformScript}).
+		Chain().DSL()
+	assert.Nil(t, err)
+	_, err = pool.New("sub_chain_01", subDsl)
+	assert.Nil(t, err)
+
+	//多个关系类型连接到同一个节点，Link 连接之后定义的节点
+	dsl, err := New("rule01").
+		Node("f1", "jsFilter", types.Configuration{"jsScript": "return msg.temperature > 50;"}).
+		On(types.True, types.False).Link("t1").
+		Node("t1", "jsTransform", types.Configuration{"jsScript": transformScript}).
+		On(types.Success).Flow("sub1", "sub_chain_01").
+		Chain().DSL()
+	assert.Nil(t, err)
+	ruleEngine, err := pool.New("rule01", dsl)
+	assert.Nil(t, err)
+	defer pool.Stop()
+
+	var group sync.WaitGroup
+	group.Add(1)
+	msg := types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{\"temperature\":41}")
+	ruleEngine.OnMsg(msg, types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+		assert.Nil(t, err)
+		assert.Equal(t, "/TEST/TEST", msg.Metadata.GetValue("path"))
+		group.Done()
+	}))
+	group.Wait()
+}
+
+func TestBuildFirstNode(t *testing.T) {
+	def, err := New("rule01").
+		Node("t1", "jsTransform", types.Configuration{"jsScript": transformScript}).
+		Chain().Node("f1", "jsFilter", types.Configuration{"jsScript": "return true;"}).
+		On(types.True).Link("t1").
+		Chain().FirstNode("f1").
+		Build()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, def.Metadata.FirstNodeIndex)
+
+	_, err = New("rule01").
+		Node("t1", "jsTransform", types.Configuration{"jsScript": transformScript}).
+		Chain().FirstNode("notFound").
+		Build()
+	assert.Equal(t, "first node not found, nodeId=notFound", err.Error())
+}
+
+func TestBuildEndpoint(t *testing.T) {
+	def, err := New("rule01").
+		Endpoint("e1", "http", types.Configuration{"server": ":9090"}).Name("http server").Processors("headersToMetadata").
+		Router("/api/v1/msg", "POST").Id("r1").Transform("toHttpMsg").To("chain:rule01").Wait().Ack(types.Success).End().
+		Router("/api/v1/node/:id", "GET").To("component:jsTransform", types.Configuration{"jsScript": transformScript}).End().
+		Chain().Node("t1", "jsTransform", types.Configuration{"jsScript": transformScript}).
+		Build()
+	assert.Nil(t, err)
+
+	assert.Equal(t, 1, len(def.Metadata.Endpoints))
+	endpointDsl := def.Metadata.Endpoints[0]
+	assert.Equal(t, "e1", endpointDsl.Id)
+	assert.Equal(t, "http", endpointDsl.Type)
+	assert.Equal(t, "http server", endpointDsl.Name)
+	assert.Equal(t, ":9090", endpointDsl.Configuration["server"])
+	assert.Equal(t, []string{"headersToMetadata"}, endpointDsl.Processors)
+	assert.Equal(t, 2, len(endpointDsl.Routers))
+
+	router := endpointDsl.Routers[0]
+	assert.Equal(t, "r1", router.Id)
+	assert.Equal(t, []interface{}{"POST"}, router.Params)
+	assert.Equal(t, "/api/v1/msg", router.From.Path)
+	assert.Equal(t, []string{"toHttpMsg"}, router.From.Processors)
+	assert.Equal(t, "chain:rule01", router.To.Path)
+	assert.True(t, router.To.Wait)
+	assert.Equal(t, []string{types.Success}, router.Ack.SuccessRelationTypes)
+	assert.Equal(t, transformScript, endpointDsl.Routers[1].To.Configuration["jsScript"])
+
+	//使用已有的 endpoint 定义
+	def, err = New("rule01").
+		EndpointDsl(&types.EndpointDsl{RuleNode: types.RuleNode{Id: "e2", Type: "mqtt"}}).
+		Chain().Node("t1", "jsTransform", types.Configuration{"jsScript": transformScript}).
+		Build()
+	assert.Nil(t, err)
+	assert.Equal(t, "e2", def.Metadata.Endpoints[0].Id)
+
+	//json 编解码后保持一致
+	dsl, err := New("rule01").
+		Endpoint("e1", "http", types.Configuration{"server": ":9090"}).
+		Router("/api/v1/msg", "POST").To("chain:rule01").End().
+		Chain().Node("t1", "jsTransform", types.Configuration{"jsScript": transformScript}).
+		Chain().DSL()
+	assert.Nil(t, err)
+	decoded, err := (&engine.JsonParser{}).DecodeRuleChain(dsl)
+	assert.Nil(t, err)
+	assert.Equal(t, "/api/v1/msg", decoded.Metadata.Endpoints[0].Routers[0].From.Path)
+}
+
+func TestBuildValidationError(t *testing.T) {
+	//未注册的组件和不存在的节点
+	builder := New("rule01").
+		Node("f1", "jsFilter", types.Configuration{"jsScript": "return true;"}).
+		On(types.True).To("t1", "notFoundType").
+		Chain().Connect("t1", types.Success, "notFoundNode")
+	_, err := builder.Build()
+	var validationError *engine.ValidationError
+	assert.True(t, errors.As(err, &validationError))
+	var codes []string
+	for _, item := range validationError.Diagnostics.Errors() {
+		codes = append(codes, item.Code)
+	}
+	assert.Equal(t, []string{engine.CodeComponentNotFound, engine.CodeNodeNotFound}, codes)
+	assert.True(t, builder.Validate().HasError())
+
+	//jsFilter 不会输出 Success 关系，只是警告，不影响构建
+	builder = New("rule01").
+		Node("f1", "jsFilter", types.Configuration{"jsScript": "return true;"}).
+		On(types.Success).To("t1", "jsTransform", types.Configuration{"jsScript": transformScript}).
+		Chain()
+	_, err = builder.Build()
+	assert.Nil(t, err)
+	diagnostics := builder.Validate()
+	assert.Equal(t, 1, len(diagnostics))
+	assert.Equal(t, engine.CodeUnknownRelationType, diagnostics[0].Code)
+
+	//空ID
+	_, err = New("").Node("", "jsFilter").Build()
+	assert.Equal(t, "rule chain id can not be empty; node id can not be empty, type=jsFilter", err.Error())
+
+	defer func() {
+		assert.NotNil(t, recover())
+	}()
+	New("rule01").Node("t1", "notFoundType").Chain().MustBuild()
+}
+
+func TestBuildWithRegistry(t *testing.T) {
+	registry := &engine.RuleComponentRegistry{}
+	_, err := New("rule01").Registry(registry).
+		Node("t1", "jsTransform", types.Configuration{"jsScript": transformScript}).
+		Build()
+	var validationError *engine.ValidationError
+	assert.True(t, errors.As(err, &validationError))
+	assert.Equal(t, engine.CodeComponentNotFound, validationError.Diagnostics.Errors()[0].Code)
+}
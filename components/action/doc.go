@@ -26,6 +26,8 @@
 // - IteratorNode: Iterates over data (deprecated, use ForNode instead)
 // - JoinNode: Merges results from multiple asynchronous nodes
 // - JsLogNode: Logs messages using JavaScript
+// - StreamEmitNode: Pushes partial outputs to the client of a streaming HTTP response
+// - WasmNode: Processes messages with a WebAssembly module
 //
 // Each component is registered with the Registry, allowing them to be used
 // within rule chains. These components can be configured and connected to create
@@ -0,0 +1,94 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package action
+
+//规则链节点配置示例：
+//{
+//        "id": "s1",
+//        "type": "streamEmit",
+//        "name": "推送进度",
+//        "configuration": {
+//          "event": "progress"
+//        }
+//  }
+import (
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/components/base"
+	"github.com/rulego/rulego/utils/maps"
+	"github.com/rulego/rulego/utils/str"
+)
+
+// 注册节点
+func init() {
+	Registry.Add(&StreamEmitNode{})
+}
+
+// StreamEmitNodeConfiguration 节点配置
+type StreamEmitNodeConfiguration struct {
+	//事件名称，为空使用默认事件，例如 SSE 的 message 事件
+	//可以使用 ${metadata.key} 从元数据变量中获取或者通过 ${msg.key} 从消息负荷中获取
+	Event string
+}
+
+// StreamEmitNode 把当前消息作为部分输出推送给流式响应的客户端，例如在 for 节点的每次迭代中推送进度
+// 消息由开启流式响应(sse/chunked)的 http endpoint 触发时有效，否则不推送，直接通过 Success 链路发送到下一个节点
+// 客户端已经断开连接则通过 Failure 链路发送到下一个节点
+type StreamEmitNode struct {
+	//节点配置
+	Config StreamEmitNodeConfiguration
+	//事件名称是否有变量
+	hasVar bool
+}
+
+// Type 组件类型
+func (x *StreamEmitNode) Type() string {
+	return "streamEmit"
+}
+
+func (x *StreamEmitNode) New() types.Node {
+	return &StreamEmitNode{}
+}
+
+// Init 初始化
+func (x *StreamEmitNode) Init(_ types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &x.Config)
+	x.hasVar = str.CheckHasVar(x.Config.Event)
+	return err
+}
+
+// OnMsg 处理消息
+func (x *StreamEmitNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	writer, ok := endpoint.StreamWriterFromContext(ctx.GetContext())
+	if !ok {
+		ctx.TellSuccess(msg)
+		return
+	}
+	event := x.Config.Event
+	if x.hasVar {
+		event = str.ExecuteTemplate(event, base.NodeUtils.GetEvnAndMetadata(ctx, msg))
+	}
+	if err := writer.Write(endpoint.StreamEvent{Event: event, Data: []byte(msg.Data)}); err != nil {
+		ctx.TellFailure(msg, err)
+	} else {
+		ctx.TellSuccess(msg)
+	}
+}
+
+// Destroy 销毁
+func (x *StreamEmitNode) Destroy() {
+}
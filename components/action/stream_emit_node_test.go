@@ -0,0 +1,88 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package action
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+)
+
+type testStreamWriter struct {
+	events []endpoint.StreamEvent
+	closed bool
+}
+
+func (w *testStreamWriter) Write(event endpoint.StreamEvent) error {
+	if w.closed {
+		return endpoint.ErrStreamClosed
+	}
+	w.events = append(w.events, event)
+	return nil
+}
+
+func TestStreamEmitNode(t *testing.T) {
+	var targetNodeType = "streamEmit"
+
+	t.Run("NewNode", func(t *testing.T) {
+		test.NodeNew(t, targetNodeType, &StreamEmitNode{}, types.Configuration{}, Registry)
+	})
+
+	t.Run("InitNode", func(t *testing.T) {
+		test.NodeInit(t, targetNodeType, types.Configuration{
+			"event": "progress",
+		}, types.Configuration{
+			"event": "progress",
+		}, Registry)
+	})
+
+	t.Run("OnMsg", func(t *testing.T) {
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"event": "${metadata.event}",
+		}, Registry)
+		assert.Nil(t, err)
+		metaData := types.BuildMetadata(make(map[string]string))
+		metaData.PutValue("event", "progress")
+		msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, metaData, `{"step":1}`)
+
+		var relationTypes []string
+		var lastErr error
+		callback := func(msg types.RuleMsg, relationType string, err error) {
+			relationTypes = append(relationTypes, relationType)
+			lastErr = err
+		}
+
+		//没有流式响应
+		ctx := test.NewRuleContext(types.NewConfig(), callback)
+		node.OnMsg(ctx, msg)
+
+		writer := &testStreamWriter{}
+		ctx = test.NewRuleContext(types.NewConfig(), callback).SetContext(endpoint.WithStreamWriter(context.Background(), writer))
+		node.OnMsg(ctx, msg)
+		assert.Equal(t, []endpoint.StreamEvent{{Event: "progress", Data: []byte(`{"step":1}`)}}, writer.events)
+
+		//客户端已经断开连接
+		writer.closed = true
+		node.OnMsg(ctx, msg)
+		assert.Equal(t, []string{types.Success, types.Success, types.Failure}, relationTypes)
+		assert.Equal(t, endpoint.ErrStreamClosed, lastErr)
+	})
+}
@@ -0,0 +1,171 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package action
+
+//规则链节点配置示例：
+//{
+//        "id": "s2",
+//        "type": "wasm",
+//        "name": "wasm自定义节点",
+//        "debugMode": false,
+//        "configuration": {
+//          "path": "./plugins/on_msg.wasm",
+//          "memoryLimitPages": 256,
+//          "timeoutMs": 1000,
+//          "reloadInterval": 5
+//        }
+//  }
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/components/wasm"
+	"github.com/rulego/rulego/utils/maps"
+)
+
+// 注册节点
+func init() {
+	Registry.Add(&WasmNode{})
+}
+
+// WasmNodeConfiguration 节点配置
+type WasmNodeConfiguration struct {
+	//Path wasm 模块文件路径
+	Path string
+	//MemoryLimitPages 每个实例最大内存，单位页(64KB)，默认256(16MB)
+	MemoryLimitPages uint32
+	//TimeoutMs 每次执行的超时时间，单位毫秒，默认0:不限制
+	TimeoutMs int
+	//PoolSize 实例池最多缓存的空闲实例数量，默认CPU核数
+	PoolSize int
+	//ReloadInterval 检查模块文件是否更新的间隔，单位秒，文件修改后热更新模块。默认0:不检查
+	ReloadInterval int
+}
+
+// WasmNode 加载 WebAssembly 模块处理消息，模块可以使用任意支持编译成 wasm 的语言开发
+// 模块导出 on_msg(msg, metadata, msgType) 函数，通过宿主函数修改 msg、metadata、msgType
+// 以及通过 tell_next 选择关系，详细 ABI 见 wasm 包说明
+// on_msg 返回0并且没有调用 tell_next，发送信息到`Success`链；
+// 调用了 tell_next，发送信息到选择的关系链；执行失败发送到`Failure`链。
+type WasmNode struct {
+	//节点配置
+	Config WasmNodeConfiguration
+	engine *wasm.Engine
+	//模块文件最后修改时间
+	modTime time.Time
+	stop    chan struct{}
+}
+
+// Type 组件类型
+func (x *WasmNode) Type() string {
+	return "wasm"
+}
+
+func (x *WasmNode) New() types.Node {
+	return &WasmNode{Config: WasmNodeConfiguration{
+		MemoryLimitPages: wasm.DefaultMemoryLimitPages,
+	}}
+}
+
+// Init 初始化
+func (x *WasmNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &x.Config)
+	if err != nil {
+		return err
+	}
+	if x.Config.Path == "" {
+		return errors.New("path can not be empty")
+	}
+	info, err := os.Stat(x.Config.Path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(x.Config.Path)
+	if err != nil {
+		return err
+	}
+	x.engine, err = wasm.NewEngine(data, wasm.Config{
+		MemoryLimitPages: x.Config.MemoryLimitPages,
+		Timeout:          time.Duration(x.Config.TimeoutMs) * time.Millisecond,
+		PoolSize:         x.Config.PoolSize,
+		Logger:           ruleConfig.Logger,
+	})
+	if err != nil {
+		return err
+	}
+	x.modTime = info.ModTime()
+	if x.Config.ReloadInterval > 0 {
+		x.stop = make(chan struct{})
+		go x.watch(x.stop, ruleConfig.Logger, time.Duration(x.Config.ReloadInterval)*time.Second)
+	}
+	return nil
+}
+
+// OnMsg 处理消息
+func (x *WasmNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	result, err := x.engine.Execute(msg.Data, msg.Metadata.Values(), msg.Type)
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return
+	}
+	msg.Data = result.Data
+	msg.Type = result.MsgType
+	msg.Metadata = types.BuildMetadata(result.Metadata)
+	if len(result.Relations) == 0 {
+		ctx.TellSuccess(msg)
+	} else {
+		ctx.TellNext(msg, result.Relations...)
+	}
+}
+
+// Destroy 销毁
+func (x *WasmNode) Destroy() {
+	if x.stop != nil {
+		close(x.stop)
+		x.stop = nil
+	}
+	if x.engine != nil {
+		x.engine.Close()
+	}
+}
+
+// watch 定时检查模块文件，修改后热更新模块，加载失败继续使用旧模块
+func (x *WasmNode) watch(stop chan struct{}, logger types.Logger, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			info, err := os.Stat(x.Config.Path)
+			if err != nil || !info.ModTime().After(x.modTime) {
+				continue
+			}
+			x.modTime = info.ModTime()
+			data, err := os.ReadFile(x.Config.Path)
+			if err == nil {
+				err = x.engine.Reload(data)
+			}
+			if err != nil && logger != nil {
+				logger.Printf("wasm node reload %s error:%s", x.Config.Path, err.Error())
+			}
+		}
+	}
+}
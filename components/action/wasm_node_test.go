@@ -0,0 +1,145 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package action
+
+import (
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var testWasmPath = "../wasm/testdata/on_msg.wasm"
+
+func TestWasmNode(t *testing.T) {
+	var targetNodeType = "wasm"
+
+	t.Run("NewNode", func(t *testing.T) {
+		test.NodeNew(t, targetNodeType, &WasmNode{}, types.Configuration{
+			"memoryLimitPages": uint32(256),
+			"timeoutMs":        0,
+		}, Registry)
+	})
+
+	t.Run("InitNode", func(t *testing.T) {
+		test.NodeInit(t, targetNodeType, types.Configuration{
+			"path":      testWasmPath,
+			"timeoutMs": 1000,
+		}, types.Configuration{
+			"path":      testWasmPath,
+			"timeoutMs": 1000,
+		}, Registry)
+
+		_, err := test.CreateAndInitNode(targetNodeType, types.Configuration{}, Registry)
+		assert.NotNil(t, err)
+		_, err = test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"path": "./testdata/not_found.wasm",
+		}, Registry)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("OnMsg", func(t *testing.T) {
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"path":      testWasmPath,
+			"timeoutMs": 200,
+		}, Registry)
+		assert.Nil(t, err)
+		defer node.Destroy()
+
+		metaData := types.BuildMetadata(make(map[string]string))
+		metaData.PutValue("deviceId", "dev01")
+		var msgList = []test.Msg{
+			{
+				MetaData:   metaData,
+				MsgType:    "TELEMETRY",
+				Data:       "{\"temperature\":41}",
+				AfterSleep: time.Millisecond * 200,
+			},
+			{
+				MetaData:   types.NewMetadata(),
+				MsgType:    "TELEMETRY",
+				Data:       "{\"temperature\":41}",
+				AfterSleep: time.Millisecond * 200,
+			},
+			{
+				MetaData:   types.NewMetadata(),
+				MsgType:    "ERROR",
+				Data:       "{\"temperature\":41}",
+				AfterSleep: time.Millisecond * 200,
+			},
+			{
+				MetaData:   types.NewMetadata(),
+				MsgType:    "LOOP",
+				Data:       "{\"temperature\":41}",
+				AfterSleep: time.Millisecond * 500,
+			},
+		}
+		test.NodeOnMsg(t, node, msgList, func(msg types.RuleMsg, relationType string, err error) {
+			switch relationType {
+			case types.True:
+				assert.Equal(t, "dev01", msg.Data)
+				assert.Equal(t, "WASM_MSG", msg.Type)
+				assert.Equal(t, "true", msg.Metadata.GetValue("fromWasm"))
+			case types.False:
+				assert.Equal(t, "{\"temperature\":41}", msg.Data)
+				assert.Equal(t, "", msg.Metadata.GetValue("deviceId"))
+			default:
+				assert.Equal(t, types.Failure, relationType)
+				if msg.Type == "ERROR" {
+					assert.Equal(t, "boom", err.Error())
+				} else {
+					assert.Equal(t, "execution timeout", err.Error())
+				}
+			}
+		})
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		data, err := os.ReadFile(testWasmPath)
+		assert.Nil(t, err)
+		path := filepath.Join(t.TempDir(), "on_msg.wasm")
+		assert.Nil(t, os.WriteFile(path, data, 0644))
+
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"path":           path,
+			"reloadInterval": 1,
+		}, Registry)
+		assert.Nil(t, err)
+		defer node.Destroy()
+		wasmNode := node.(*WasmNode)
+		info, err := os.Stat(path)
+		assert.Nil(t, err)
+		modTime := info.ModTime()
+
+		//无效的模块不影响当前模块
+		assert.Nil(t, os.WriteFile(path, []byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00}, 0644))
+		assert.Nil(t, os.Chtimes(path, time.Now(), modTime.Add(time.Second)))
+		time.Sleep(time.Millisecond * 1500)
+		_, err = wasmNode.engine.Execute("", nil, "TELEMETRY")
+		assert.Nil(t, err)
+
+		assert.Nil(t, os.WriteFile(path, data, 0644))
+		assert.Nil(t, os.Chtimes(path, time.Now(), modTime.Add(time.Second*2)))
+		time.Sleep(time.Millisecond * 1500)
+		result, err := wasmNode.engine.Execute("", map[string]string{"deviceId": "dev02"}, "TELEMETRY")
+		assert.Nil(t, err)
+		assert.Equal(t, "dev02", result.Data)
+	})
+}
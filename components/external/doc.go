@@ -18,8 +18,10 @@
 // These components facilitate communication and integration with external systems:
 //
 // - MqttClientNode: Connects to MQTT brokers and publishes messages
+// - KafkaProducerNode: Publishes messages to Kafka topics
 // - RestApiCallNode: Performs HTTP requests to external APIs
 // - DbClientNode: Connects to databases and performs SQL operations
+// - WsPushNode: Pushes messages to clients connected to a WebSocket endpoint
 // Each component is registered with the Registry, allowing them to be used
 // within rule chains. These components enable the rule engine to interact
 // with external systems, expanding its capabilities for data input, output,
@@ -0,0 +1,169 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package external
+
+import (
+	"strconv"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/components/base"
+	"github.com/rulego/rulego/components/kafka"
+	"github.com/rulego/rulego/utils/maps"
+	"github.com/rulego/rulego/utils/str"
+	"github.com/rulego/rulego/utils/trace"
+)
+
+// 规则链节点配置示例：
+//
+//	{
+//	       "id": "s3",
+//	       "type": "kafkaProducer",
+//	       "name": "kafka推送数据",
+//	       "configuration": {
+//	         "server": "127.0.0.1:9092",
+//	         "topic": "device.msg",
+//	         "key": "${metadata.deviceId}"
+//	       }
+//	     }
+//
+// server 可以使用 ref://{resourceId} 引用共享节点池中的kafka客户端，例如kafka接收端点
+
+const (
+	// KeyKafkaPartition 消息写入的分区metadataKey
+	KeyKafkaPartition = "partition"
+	// KeyKafkaOffset 消息写入的offset metadataKey
+	KeyKafkaOffset = "offset"
+)
+
+func init() {
+	Registry.Add(&KafkaProducerNode{})
+}
+
+// KafkaProducerNodeConfiguration 节点配置
+type KafkaProducerNodeConfiguration struct {
+	// Server kafka broker 地址，多个使用逗号分隔
+	Server string
+	// Topic 发布主题 可以使用 ${metadata.key} 读取元数据中的变量或者使用 ${msg.key} 读取消息负荷中的变量进行替换
+	Topic string
+	// Key 消息key，用于分区，可以使用 ${metadata.key} 读取元数据中的变量或者使用 ${msg.key} 读取消息负荷中的变量进行替换
+	Key string
+	// Headers 消息头，key和value可以使用 ${metadata.key} 读取元数据中的变量或者使用 ${msg.key} 读取消息负荷中的变量进行替换
+	Headers map[string]string
+	// ClientId 客户端ID
+	ClientId string
+	// Version kafka 协议版本，例如：2.1.0，为空使用默认版本
+	Version string
+}
+
+// KafkaProducerNode 把消息负荷发布到kafka主题
+// 发布成功，把写入的分区和offset放到元数据partition和offset，并发送到`Success`链；否则发送到`Failure`链
+// 如果元数据有traceparent，并且消息头没有指定，则把链路上下文传递到消息头
+type KafkaProducerNode struct {
+	base.SharedNode[*kafka.Client]
+	//节点配置
+	Config KafkaProducerNodeConfiguration
+	//topic 模板
+	topicTemplate str.Template
+	//key 模板
+	keyTemplate str.Template
+	//headers 模板
+	headersTemplate map[str.Template]str.Template
+	client          *kafka.Client
+}
+
+// Type 组件类型
+func (x *KafkaProducerNode) Type() string {
+	return "kafkaProducer"
+}
+
+func (x *KafkaProducerNode) New() types.Node {
+	return &KafkaProducerNode{Config: KafkaProducerNodeConfiguration{
+		Server: "127.0.0.1:9092",
+		Topic:  "device.msg",
+	}}
+}
+
+// Init 初始化
+func (x *KafkaProducerNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &x.Config)
+	if err == nil {
+		_ = x.SharedNode.Init(ruleConfig, x.Type(), x.Config.Server, false, func() (*kafka.Client, error) {
+			return x.initClient()
+		})
+		x.topicTemplate = str.NewTemplate(x.Config.Topic)
+		x.keyTemplate = str.NewTemplate(x.Config.Key)
+		var headerTemplates = make(map[str.Template]str.Template)
+		for key, value := range x.Config.Headers {
+			headerTemplates[str.NewTemplate(key)] = str.NewTemplate(value)
+		}
+		x.headersTemplate = headerTemplates
+	}
+	return err
+}
+
+// OnMsg 处理消息
+func (x *KafkaProducerNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	evn := base.NodeUtils.GetEvnAndMetadata(ctx, msg)
+	topic := x.topicTemplate.Execute(evn)
+	key := x.keyTemplate.Execute(evn)
+	var headers = make(map[string]string)
+	for k, v := range x.headersTemplate {
+		headers[k.Execute(evn)] = v.Execute(evn)
+	}
+	//传递链路上下文，配置中指定的traceparent优先
+	if _, ok := headers[trace.TraceParentKey]; !ok {
+		if sc, ok := trace.Extract(msg.Metadata.GetValue); ok {
+			trace.Inject(sc, func(key, value string) {
+				headers[key] = value
+			})
+		}
+	}
+	if client, err := x.SharedNode.Get(); err != nil {
+		ctx.TellFailure(msg, err)
+	} else {
+		if partition, offset, err := client.Publish(topic, key, []byte(msg.Data), headers); err != nil {
+			ctx.TellFailure(msg, err)
+		} else {
+			msg.Metadata.PutValue(KeyKafkaPartition, strconv.Itoa(int(partition)))
+			msg.Metadata.PutValue(KeyKafkaOffset, strconv.FormatInt(offset, 10))
+			ctx.TellSuccess(msg)
+		}
+	}
+}
+
+// Destroy 销毁
+func (x *KafkaProducerNode) Destroy() {
+	if x.client != nil {
+		_ = x.client.Close()
+	}
+}
+
+// initClient 初始化客户端
+func (x *KafkaProducerNode) initClient() (*kafka.Client, error) {
+	x.Locker.Lock()
+	defer x.Locker.Unlock()
+	if x.client != nil {
+		return x.client, nil
+	}
+	var err error
+	x.client, err = kafka.NewClient(kafka.Config{
+		Server:   x.Config.Server,
+		ClientId: x.Config.ClientId,
+		Version:  x.Config.Version,
+	})
+	return x.client, err
+}
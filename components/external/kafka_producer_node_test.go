@@ -0,0 +1,142 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package external
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestKafkaProducerNode(t *testing.T) {
+	var targetNodeType = "kafkaProducer"
+
+	//本地kafka broker替身
+	broker := sarama.NewMockBroker(t, 1)
+	defer broker.Close()
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader("device.msg", 0, broker.BrokerID()).
+			SetLeader("device.error", 0, broker.BrokerID()),
+		"ProduceRequest": sarama.NewMockProduceResponse(t).
+			SetError("device.error", 0, sarama.ErrMessageSizeTooLarge),
+	})
+
+	t.Run("NewNode", func(t *testing.T) {
+		test.NodeNew(t, targetNodeType, &KafkaProducerNode{}, types.Configuration{
+			"server": "127.0.0.1:9092",
+			"topic":  "device.msg",
+		}, Registry)
+	})
+
+	t.Run("InitNode", func(t *testing.T) {
+		test.NodeInit(t, targetNodeType, types.Configuration{
+			"server": broker.Addr(),
+			"topic":  "device.msg",
+			"key":    "${metadata.deviceId}",
+		}, types.Configuration{
+			"server": broker.Addr(),
+			"topic":  "device.msg",
+			"key":    "${metadata.deviceId}",
+		}, Registry)
+	})
+
+	t.Run("OnMsg", func(t *testing.T) {
+		node1, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"server":  broker.Addr(),
+			"topic":   "${metadata.topic}",
+			"key":     "${metadata.deviceId}",
+			"headers": map[string]string{"productType": "${metadata.productType}"},
+		}, Registry)
+		assert.Nil(t, err)
+		defer node1.Destroy()
+
+		nodeClientFromPool, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"server": types.NodeConfigurationPrefixInstanceId + "my_kafka_client",
+			"topic":  "device.msg",
+		}, Registry)
+		assert.Nil(t, err)
+		assert.Equal(t, "my_kafka_client", nodeClientFromPool.(*KafkaProducerNode).InstanceId)
+
+		metaData := types.BuildMetadata(make(map[string]string))
+		metaData.PutValue("productType", "test")
+		metaData.PutValue("deviceId", "aa")
+		metaData.PutValue("topic", "device.msg")
+		errMetaData := types.BuildMetadata(make(map[string]string))
+		errMetaData.PutValue("topic", "device.error")
+
+		var wg sync.WaitGroup
+		wg.Add(3)
+
+		var nodeList = []test.NodeAndCallback{
+			{
+				Node: node1,
+				MsgList: []test.Msg{
+					{MetaData: metaData, MsgType: "ACTIVITY_EVENT1", Data: "{\"temperature\":60}"},
+				},
+				Callback: func(msg types.RuleMsg, relationType string, err error) {
+					defer wg.Done()
+					assert.Equal(t, types.Success, relationType)
+					assert.Equal(t, "0", msg.Metadata.GetValue(KeyKafkaPartition))
+				},
+			},
+			{
+				Node: node1,
+				MsgList: []test.Msg{
+					{MetaData: errMetaData, MsgType: "ACTIVITY_EVENT1", Data: "{\"temperature\":60}"},
+				},
+				Callback: func(msg types.RuleMsg, relationType string, err error) {
+					defer wg.Done()
+					assert.Equal(t, types.Failure, relationType)
+				},
+			},
+			{
+				//没有配置共享节点池
+				Node: nodeClientFromPool,
+				MsgList: []test.Msg{
+					{MetaData: metaData, MsgType: "ACTIVITY_EVENT1", Data: "{\"temperature\":60}"},
+				},
+				Callback: func(msg types.RuleMsg, relationType string, err error) {
+					defer wg.Done()
+					assert.Equal(t, types.Failure, relationType)
+				},
+			},
+		}
+		for _, item := range nodeList {
+			test.NodeOnMsgWithChildren(t, item.Node, item.MsgList, item.ChildrenNodes, item.Callback)
+		}
+		wg.Wait()
+		//broker 在响应后记录请求历史
+		var produceCount int
+		for i := 0; i < 20 && produceCount < 2; i++ {
+			time.Sleep(time.Millisecond * 10)
+			produceCount = 0
+			for _, item := range broker.History() {
+				if _, ok := item.Request.(*sarama.ProduceRequest); ok {
+					produceCount++
+				}
+			}
+		}
+		assert.Equal(t, 2, produceCount)
+	})
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/rulego/rulego/components/mqtt"
 	"github.com/rulego/rulego/utils/maps"
 	"github.com/rulego/rulego/utils/str"
+	"github.com/rulego/rulego/utils/trace"
 	"time"
 )
 
@@ -57,6 +58,9 @@ type MqttClientNodeConfiguration struct {
 	CAFile               string
 	CertFile             string
 	CertKeyFile          string
+	//TraceEnvelope MQTT 3.1.1 没有用户属性，开启后如果元数据中存在traceparent，
+	//把链路上下文和消息数据封装成 trace.Envelope 负荷信封发布，由mqtt接收端点解析
+	TraceEnvelope bool
 }
 
 func (x *MqttClientNodeConfiguration) ToMqttConfig() mqtt.Config {
@@ -120,7 +124,7 @@ func (x *MqttClientNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
 	if client, err := x.SharedNode.Get(); err != nil {
 		ctx.TellFailure(msg, err)
 	} else {
-		if err := client.Publish(topic, x.Config.QOS, []byte(msg.Data)); err != nil {
+		if err := client.Publish(topic, x.Config.QOS, x.payload(msg)); err != nil {
 			ctx.TellFailure(msg, err)
 		} else {
 			ctx.TellSuccess(msg)
@@ -128,6 +132,16 @@ func (x *MqttClientNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
 	}
 }
 
+// payload 发布的负荷，开启 TraceEnvelope 则封装链路上下文
+func (x *MqttClientNode) payload(msg types.RuleMsg) []byte {
+	if x.Config.TraceEnvelope {
+		if sc, ok := trace.Extract(msg.Metadata.GetValue); ok {
+			return trace.WrapEnvelope(sc, []byte(msg.Data))
+		}
+	}
+	return []byte(msg.Data)
+}
+
 // Destroy 销毁
 func (x *MqttClientNode) Destroy() {
 	if x.client != nil {
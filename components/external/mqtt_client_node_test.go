@@ -20,6 +20,7 @@ import (
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/test"
 	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/utils/trace"
 	"testing"
 	"time"
 )
@@ -131,3 +132,22 @@ func TestMqttClientNode(t *testing.T) {
 		time.Sleep(time.Second * 2)
 	})
 }
+
+// 测试通过负荷信封传递链路上下文
+func TestMqttClientNodeTraceEnvelope(t *testing.T) {
+	traceParent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	metadata := types.NewMetadata()
+	metadata.PutValue(trace.TraceParentKey, traceParent)
+	msg := types.NewMsg(0, "TEST", types.JSON, metadata, "{\"temperature\":41}")
+
+	node := &MqttClientNode{}
+	assert.Equal(t, msg.Data, string(node.payload(msg)))
+
+	node.Config.TraceEnvelope = true
+	sc, payload, ok := trace.UnwrapEnvelope(node.payload(msg))
+	assert.True(t, ok)
+	assert.Equal(t, traceParent, sc.TraceParent())
+	assert.Equal(t, msg.Data, string(payload))
+	//没有链路上下文，原样发布
+	assert.Equal(t, "a", string(node.payload(types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "a"))))
+}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/components/base"
+	"github.com/rulego/rulego/utils/codec"
 	"github.com/rulego/rulego/utils/maps"
 )
 
@@ -47,10 +48,13 @@ type NetNodeConfiguration struct {
 	ConnectTimeout int
 	// 心跳间隔，用于定期发送心跳消息，单位为秒，如果<=0 则默认60
 	HeartbeatInterval int
+	// Codec 帧编解码器，为空在消息负荷最后增加结束符：'\n'，配置后消息负荷和心跳使用该编解码器编码
+	// 例如：{"type":"delimiter","start":"0x02","end":"0x03","checksum":"xor8"}
+	Codec *codec.Config
 }
 
 // NetNode 把消息负荷通过网络协议发送，支持协议：tcp、udp、ip4:1、ip6:ipv6-icmp、ip6:58、unix、unixgram，以及net包支持的协议类型。
-// 发送前会在消息负荷最后增加结束符：'\n'
+// 发送前会在消息负荷最后增加结束符：'\n'，或者使用配置的帧编解码器编码
 type NetNode struct {
 	base.SharedNode[net.Conn]
 	// 节点配置
@@ -65,6 +69,10 @@ type NetNode struct {
 	heartbeatDuration time.Duration
 	// 连接是否已经断开，0：没端口；1：端口
 	disconnected int32
+	// 帧编解码器
+	codec codec.Codec
+	// 心跳数据
+	pingData []byte
 }
 
 // Type 组件类型
@@ -89,6 +97,15 @@ func (x *NetNode) Init(ruleConfig types.Config, configuration types.Configuratio
 	// 设置默认值
 	x.setDefaultConfig()
 	x.heartbeatDuration = time.Duration(x.Config.HeartbeatInterval) * time.Second
+	x.pingData = PingData
+	if x.Config.Codec != nil {
+		var err error
+		if x.codec, err = codec.New(*x.Config.Codec); err != nil {
+			return err
+		}
+		//不能编码心跳的帧格式(例如固定长度)不发送心跳
+		x.pingData, _ = x.codec.Encode(PingData[:len(PingData)-1])
+	}
 	return x.SharedNode.Init(ruleConfig, x.Type(), x.Config.Server, false, x.initConnect)
 }
 
@@ -96,8 +113,16 @@ func (x *NetNode) Init(ruleConfig types.Config, configuration types.Configuratio
 func (x *NetNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
 	// 将消息的数据转换为字节数组
 	data := []byte(msg.Data)
-	// 在数据的末尾加上结束符
-	data = append(data, EndSign)
+	if x.codec != nil {
+		var err error
+		if data, err = x.codec.Encode(data); err != nil {
+			ctx.TellFailure(msg, err)
+			return
+		}
+	} else {
+		// 在数据的末尾加上结束符
+		data = append(data, EndSign)
+	}
 	x.onWrite(ctx, msg, data)
 }
 
@@ -165,9 +190,13 @@ func (x *NetNode) onPing() {
 		x.tryReconnect()
 		return
 	}
+	if len(x.pingData) == 0 {
+		x.heartbeatTimer.Reset(x.heartbeatDuration)
+		return
+	}
 	// 发送心跳
 	if conn, err := x.SharedNode.Get(); err == nil {
-		if _, err := conn.Write(PingData); err != nil {
+		if _, err := conn.Write(x.pingData); err != nil {
 			x.Printf("Ping failed: %v", err)
 			x.setDisconnected(true)
 			x.tryReconnect()
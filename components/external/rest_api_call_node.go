@@ -37,6 +37,7 @@ import (
 	"github.com/rulego/rulego/components/base"
 	"github.com/rulego/rulego/utils/maps"
 	"github.com/rulego/rulego/utils/str"
+	"github.com/rulego/rulego/utils/trace"
 	"io"
 	"net/http"
 	"net/url"
@@ -178,6 +179,12 @@ func (x *RestApiCallNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
 	for key, value := range x.headersTemplate {
 		req.Header.Set(key.Execute(evn), value.Execute(evn))
 	}
+	//传递链路上下文，配置中指定的traceparent优先
+	if req.Header.Get(trace.TraceParentKey) == "" {
+		if sc, ok := trace.Extract(msg.Metadata.GetValue); ok {
+			trace.Inject(sc, req.Header.Set)
+		}
+	}
 
 	response, err := x.httpClient.Do(req)
 	defer func() {
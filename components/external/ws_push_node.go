@@ -0,0 +1,150 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package external
+
+//规则链节点配置示例：
+//{
+//        "id": "s1",
+//        "type": "wsPush",
+//        "name": "推送到设备看板",
+//        "configuration": {
+//          "server": ":9090",
+//          "mode": "room",
+//          "target": "deviceId:${metadata.deviceId}"
+//        }
+//  }
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/components/base"
+	"github.com/rulego/rulego/utils/maps"
+	"github.com/rulego/rulego/utils/str"
+)
+
+const (
+	// WsPushModeSession 推送到指定会话
+	WsPushModeSession = "session"
+	// WsPushModeRoom 推送到房间中所有会话
+	WsPushModeRoom = "room"
+	// WsPushModeBroadcast 推送到所有会话
+	WsPushModeBroadcast = "broadcast"
+	// KeyPushCount 推送成功的会话数量在msg元数据中的key
+	KeyPushCount = "pushCount"
+)
+
+// 注册节点
+func init() {
+	Registry.Add(&WsPushNode{})
+}
+
+// WsPushNodeConfiguration 节点配置
+type WsPushNodeConfiguration struct {
+	//Server websocket endpoint 服务地址，例如：:9090
+	Server string
+	//Mode 推送方式：session/room/broadcast，默认 session
+	Mode string
+	//Target 会话ID或者房间，broadcast 方式不需要
+	//可以使用 ${metadata.key} 从元数据变量中获取或者通过 ${msg.key} 从消息负荷中获取
+	//默认 ${metadata.sessionId}，即推送给 websocket endpoint 触发消息的会话
+	Target string
+}
+
+// WsPushNode 把消息推送给 websocket endpoint 已经连接的客户端，可以推送到会话、房间或者广播
+// 二进制类型的消息以二进制帧发送，其他类型以文本帧发送
+// 推送成功的会话数量保存在元数据 pushCount 中，通过 Success 链路发送到下一个节点
+// endpoint 没有启动、会话不存在或者会话发送缓冲区已满，通过 Failure 链路发送到下一个节点
+type WsPushNode struct {
+	//节点配置
+	Config WsPushNodeConfiguration
+	//目标是否有变量
+	hasVar bool
+}
+
+// Type 组件类型
+func (x *WsPushNode) Type() string {
+	return "wsPush"
+}
+
+func (x *WsPushNode) New() types.Node {
+	return &WsPushNode{Config: WsPushNodeConfiguration{
+		Server: ":9090",
+		Mode:   WsPushModeSession,
+		Target: "${metadata.sessionId}",
+	}}
+}
+
+// Init 初始化
+func (x *WsPushNode) Init(_ types.Config, configuration types.Configuration) error {
+	if err := maps.Map2Struct(configuration, &x.Config); err != nil {
+		return err
+	}
+	if x.Config.Server == "" {
+		return errors.New("server can not empty")
+	}
+	switch x.Config.Mode {
+	case "":
+		x.Config.Mode = WsPushModeSession
+	case WsPushModeSession, WsPushModeRoom, WsPushModeBroadcast:
+	default:
+		return fmt.Errorf("unsupported mode: %s", x.Config.Mode)
+	}
+	if x.Config.Mode != WsPushModeBroadcast && x.Config.Target == "" {
+		return errors.New("target can not empty")
+	}
+	x.hasVar = str.CheckHasVar(x.Config.Target)
+	return nil
+}
+
+// OnMsg 处理消息
+func (x *WsPushNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	manager, ok := endpoint.GetSessionManager(x.Config.Server)
+	if !ok {
+		ctx.TellFailure(msg, fmt.Errorf("websocket endpoint not found server=%s", x.Config.Server))
+		return
+	}
+	target := x.Config.Target
+	if x.hasVar {
+		target = str.ExecuteTemplate(target, base.NodeUtils.GetEvnAndMetadata(ctx, msg))
+	}
+	pushMsg := endpoint.PushMessage{Data: []byte(msg.Data), Binary: msg.DataType == types.BINARY}
+	var count int
+	var err error
+	switch x.Config.Mode {
+	case WsPushModeRoom:
+		count, err = manager.PushToRoom(target, pushMsg)
+	case WsPushModeBroadcast:
+		count, err = manager.Broadcast(pushMsg)
+	default:
+		if err = manager.PushToSession(target, pushMsg); err == nil {
+			count = 1
+		}
+	}
+	if err != nil {
+		ctx.TellFailure(msg, err)
+		return
+	}
+	msg.Metadata.PutValue(KeyPushCount, strconv.Itoa(count))
+	ctx.TellSuccess(msg)
+}
+
+// Destroy 销毁
+func (x *WsPushNode) Destroy() {
+}
@@ -0,0 +1,135 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package external
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+)
+
+type testSessionManager struct {
+	lock   sync.Mutex
+	pushed []string
+}
+
+func (m *testSessionManager) add(item string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.pushed = append(m.pushed, item)
+}
+
+func (m *testSessionManager) all() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.pushed
+}
+
+func (m *testSessionManager) PushToSession(sessionId string, msg endpoint.PushMessage) error {
+	if sessionId != "s1" {
+		return endpoint.ErrSessionNotFound
+	}
+	m.add("session:" + sessionId + ":" + string(msg.Data))
+	return nil
+}
+
+func (m *testSessionManager) PushToRoom(room string, msg endpoint.PushMessage) (int, error) {
+	m.add("room:" + room + ":" + string(msg.Data))
+	return 2, nil
+}
+
+func (m *testSessionManager) Broadcast(msg endpoint.PushMessage) (int, error) {
+	m.add("broadcast:" + string(msg.Data))
+	return 3, nil
+}
+
+func TestWsPushNode(t *testing.T) {
+	var targetNodeType = "wsPush"
+
+	t.Run("NewNode", func(t *testing.T) {
+		test.NodeNew(t, targetNodeType, &WsPushNode{}, types.Configuration{
+			"server": ":9090",
+			"mode":   WsPushModeSession,
+			"target": "${metadata.sessionId}",
+		}, Registry)
+	})
+
+	t.Run("InitNode", func(t *testing.T) {
+		test.NodeInit(t, targetNodeType, types.Configuration{
+			"server": ":9091",
+			"mode":   WsPushModeBroadcast,
+			"target": "",
+		}, types.Configuration{
+			"server": ":9091",
+			"mode":   WsPushModeBroadcast,
+		}, Registry)
+		_, err := test.CreateAndInitNode(targetNodeType, types.Configuration{"mode": "topic"}, Registry)
+		assert.NotNil(t, err)
+		_, err = test.CreateAndInitNode(targetNodeType, types.Configuration{"mode": WsPushModeRoom, "target": ""}, Registry)
+		assert.NotNil(t, err)
+		_, err = test.CreateAndInitNode(targetNodeType, types.Configuration{"server": ""}, Registry)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("OnMsg", func(t *testing.T) {
+		manager := &testSessionManager{}
+		endpoint.RegisterSessionManager(":9190", manager)
+		defer endpoint.UnregisterSessionManager(":9190", manager)
+
+		metaData := types.BuildMetadata(make(map[string]string))
+		metaData.PutValue("sessionId", "s1")
+		metaData.PutValue("room", "r1")
+		msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, metaData, "aa")
+
+		tests := []struct {
+			configuration types.Configuration
+			count         string
+			err           error
+		}{
+			{types.Configuration{"server": ":9190"}, "1", nil},
+			{types.Configuration{"server": ":9190", "target": "s2"}, "", endpoint.ErrSessionNotFound},
+			{types.Configuration{"server": ":9190", "mode": WsPushModeRoom, "target": "${metadata.room}"}, "2", nil},
+			{types.Configuration{"server": ":9190", "mode": WsPushModeBroadcast}, "3", nil},
+		}
+		for _, item := range tests {
+			item := item
+			node, err := test.CreateAndInitNode(targetNodeType, item.configuration, Registry)
+			assert.Nil(t, err)
+			test.NodeOnMsg(t, node, []test.Msg{{MetaData: metaData.Copy(), MsgType: msg.Type, Data: msg.Data, AfterSleep: time.Millisecond * 20}}, func(msg types.RuleMsg, relationType string, err error) {
+				assert.Equal(t, item.err, err)
+				if err == nil {
+					assert.Equal(t, types.Success, relationType)
+					assert.Equal(t, item.count, msg.Metadata.GetValue(KeyPushCount))
+				} else {
+					assert.Equal(t, types.Failure, relationType)
+				}
+			})
+		}
+		assert.Equal(t, []string{"session:s1:aa", "room:r1:aa", "broadcast:aa"}, manager.all())
+
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{"server": ":9191"}, Registry)
+		assert.Nil(t, err)
+		test.NodeOnMsg(t, node, []test.Msg{{MetaData: metaData, MsgType: msg.Type, Data: msg.Data, AfterSleep: time.Millisecond * 20}}, func(msg types.RuleMsg, relationType string, err error) {
+			assert.Equal(t, types.Failure, relationType)
+		})
+	})
+}
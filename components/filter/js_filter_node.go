@@ -47,6 +47,12 @@ type JsFilterNodeConfiguration struct {
 	//function Filter(msg, metadata, msgType) { ${JsScript} }
 	//return bool
 	JsScript string
+	//Async 是否开启异步模式，开启后脚本可以使用 await、setTimeout 和 fetch
+	//节点等待脚本返回的 Promise 完成，最长等待 ScriptMaxExecutionTime
+	//例如：var res = await fetch('http://127.0.0.1/api/device/' + msg.id); msg.device = await res.json();
+	Async bool
+	//Fetch 异步模式下 fetch 函数的超时、代理以及允许访问的主机配置，默认不允许访问任何主机，需要配置 AllowedHosts
+	Fetch js.FetchConfig
 }
 
 // JsFilterNode 使用js脚本过滤传入信息
@@ -76,8 +82,13 @@ func (x *JsFilterNode) New() types.Node {
 func (x *JsFilterNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
 	err := maps.Map2Struct(configuration, &x.Config)
 	if err == nil {
-		jsScript := fmt.Sprintf("function Filter(msg, metadata, msgType) { %s }", x.Config.JsScript)
-		x.jsEngine, err = js.NewGojaJsEngine(ruleConfig, jsScript, base.NodeUtils.GetVars(configuration))
+		if x.Config.Async {
+			jsScript := fmt.Sprintf("async function Filter(msg, metadata, msgType) { %s }", x.Config.JsScript)
+			x.jsEngine, err = js.NewAsyncGojaJsEngine(ruleConfig, jsScript, base.NodeUtils.GetVars(configuration), x.Config.Fetch)
+		} else {
+			jsScript := fmt.Sprintf("function Filter(msg, metadata, msgType) { %s }", x.Config.JsScript)
+			x.jsEngine, err = js.NewGojaJsEngine(ruleConfig, jsScript, base.NodeUtils.GetVars(configuration))
+		}
 	}
 	return err
 }
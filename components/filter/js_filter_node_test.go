@@ -101,4 +101,34 @@ func TestJsFilterNode(t *testing.T) {
 			})
 		}
 	})
+	t.Run("OnMsgAsync", func(t *testing.T) {
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"async":    true,
+			"jsScript": "await new Promise(function(resolve) { setTimeout(resolve, 10); }); return msg.temperature > 50;",
+		}, Registry)
+		assert.Nil(t, err)
+
+		metaData := types.BuildMetadata(make(map[string]string))
+		var msgList = []test.Msg{
+			{
+				MetaData:   metaData,
+				MsgType:    "ACTIVITY_EVENT",
+				Data:       "{\"temperature\":60}",
+				AfterSleep: time.Millisecond * 200,
+			},
+			{
+				MetaData:   metaData,
+				MsgType:    "ACTIVITY_EVENT",
+				Data:       "{\"temperature\":40}",
+				AfterSleep: time.Millisecond * 200,
+			},
+		}
+		test.NodeOnMsg(t, node, msgList, func(msg types.RuleMsg, relationType string, err2 error) {
+			if msg.Data == "{\"temperature\":60}" {
+				assert.Equal(t, types.True, relationType)
+			} else {
+				assert.Equal(t, types.False, relationType)
+			}
+		})
+	})
 }
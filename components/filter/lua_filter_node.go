@@ -0,0 +1,110 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+//规则链节点配置示例：
+//{
+//        "id": "s2",
+//        "type": "luaFilter",
+//        "name": "过滤",
+//        "debugMode": false,
+//        "configuration": {
+//          "luaScript": "return msg.temperature > 50"
+//        }
+//      }
+import (
+	"fmt"
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/components/base"
+	"github.com/rulego/rulego/components/lua"
+	"github.com/rulego/rulego/utils/json"
+	"github.com/rulego/rulego/utils/maps"
+)
+
+func init() {
+	Registry.Add(&LuaFilterNode{})
+}
+
+// LuaFilterNodeConfiguration 节点配置
+type LuaFilterNodeConfiguration struct {
+	//LuaScript 配置函数体脚本内容
+	// 使用lua脚本进行过滤
+	//完整脚本函数：
+	//function Filter(msg, metadata, msgType) ${LuaScript} end
+	//return bool
+	LuaScript string
+}
+
+// LuaFilterNode 使用lua脚本过滤传入信息
+// 如果 `True`发送信息到`True`链, `False`发到`False`链。
+// 如果 脚本执行失败则发送到`Failure`链
+// 消息体可以通过`msg`变量访问，如果消息的dataType是json类型，可以通过 `msg.XX`方式访问msg的字段。例如:`return msg.temperature > 50`
+// 消息元数据可以通过`metadata`变量访问。例如 `metadata.customerName == 'Lala'`
+// 消息类型可以通过`msgType`变量访问.
+type LuaFilterNode struct {
+	//节点配置
+	Config    LuaFilterNodeConfiguration
+	luaEngine types.JsEngine
+}
+
+// Type 组件类型
+func (x *LuaFilterNode) Type() string {
+	return "luaFilter"
+}
+
+func (x *LuaFilterNode) New() types.Node {
+	return &LuaFilterNode{Config: LuaFilterNodeConfiguration{
+		LuaScript: "return msg.temperature > 50",
+	}}
+}
+
+// Init 初始化
+func (x *LuaFilterNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &x.Config)
+	if err == nil {
+		luaScript := fmt.Sprintf("function Filter(msg, metadata, msgType) %s end", x.Config.LuaScript)
+		x.luaEngine, err = lua.NewLuaEngine(ruleConfig, luaScript, base.NodeUtils.GetVars(configuration))
+	}
+	return err
+}
+
+// OnMsg 处理消息
+func (x *LuaFilterNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	var data interface{} = msg.Data
+	if msg.DataType == types.JSON {
+		var dataMap interface{}
+		if err := json.Unmarshal([]byte(msg.Data), &dataMap); err == nil {
+			data = dataMap
+		}
+	}
+
+	out, err := x.luaEngine.Execute("Filter", data, msg.Metadata.Values(), msg.Type)
+	if err != nil {
+		ctx.TellFailure(msg, err)
+	} else {
+		if formatData, ok := out.(bool); ok && formatData {
+			ctx.TellNext(msg, types.True)
+		} else {
+			ctx.TellNext(msg, types.False)
+		}
+	}
+}
+
+// Destroy 销毁
+func (x *LuaFilterNode) Destroy() {
+	x.luaEngine.Stop()
+}
@@ -0,0 +1,104 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+	"testing"
+	"time"
+)
+
+func TestLuaFilterNode(t *testing.T) {
+	var targetNodeType = "luaFilter"
+
+	t.Run("NewNode", func(t *testing.T) {
+		test.NodeNew(t, targetNodeType, &LuaFilterNode{}, types.Configuration{
+			"luaScript": "return msg.temperature > 50",
+		}, Registry)
+	})
+
+	t.Run("InitNode", func(t *testing.T) {
+		test.NodeInit(t, targetNodeType, types.Configuration{
+			"luaScript": "return msg.temperature > 50",
+		}, types.Configuration{
+			"luaScript": "return msg.temperature > 50",
+		}, Registry)
+		_, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"luaScript": "return msg.temperature >",
+		}, Registry)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("OnMsg", func(t *testing.T) {
+		node1, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"luaScript": "return type(msg) == 'table' and msg.temperature > 50 and metadata.productType == 'test'",
+		}, Registry)
+		assert.Nil(t, err)
+		node2, _ := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"luaScript": `return 1`,
+		}, Registry)
+		node3, _ := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"luaScript": `return a.b`,
+		}, Registry)
+		node4, _ := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"vars": map[string]interface{}{
+				"max": 50,
+			},
+			"luaScript": "return msgType == 'ACTIVITY_EVENT' and type(msg) == 'table' and msg.temperature > vars.max",
+		}, Registry)
+
+		var nodeList = []types.Node{node1, node2, node3, node4}
+
+		for _, node := range nodeList {
+			metaData := types.BuildMetadata(make(map[string]string))
+			metaData.PutValue("productType", "test")
+			var msgList = []test.Msg{
+				{
+					MetaData:   metaData,
+					MsgType:    "ACTIVITY_EVENT",
+					Data:       "AA",
+					AfterSleep: time.Millisecond * 200,
+				},
+				{
+					MetaData:   metaData,
+					MsgType:    "ACTIVITY_EVENT",
+					Data:       "{\"temperature\":60}",
+					AfterSleep: time.Millisecond * 200,
+				},
+				{
+					MetaData:   metaData,
+					MsgType:    "ACTIVITY_EVENT",
+					Data:       "{\"temperature\":40}",
+					AfterSleep: time.Millisecond * 200,
+				},
+			}
+			test.NodeOnMsg(t, node, msgList, func(msg types.RuleMsg, relationType string, err2 error) {
+				if node.(*LuaFilterNode).Config.LuaScript == `return 1` {
+					assert.Equal(t, types.False, relationType)
+				} else if node.(*LuaFilterNode).Config.LuaScript == `return a.b` {
+					assert.NotNil(t, err2)
+				} else if msg.Data == "{\"temperature\":60}" {
+					assert.Equal(t, types.True, relationType)
+				} else {
+					assert.Equal(t, types.False, relationType)
+				}
+			})
+		}
+	})
+}
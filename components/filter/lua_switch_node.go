@@ -0,0 +1,118 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+//规则链节点配置示例：
+//{
+//        "id": "s2",
+//        "type": "luaSwitch",
+//        "name": "脚本路由",
+//        "debugMode": false,
+//        "configuration": {
+//          "luaScript": "return {'one','two'}"
+//        }
+//      }
+import (
+	"fmt"
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/components/base"
+	"github.com/rulego/rulego/components/lua"
+	"github.com/rulego/rulego/utils/json"
+	"github.com/rulego/rulego/utils/maps"
+	"github.com/rulego/rulego/utils/str"
+)
+
+func init() {
+	Registry.Add(&LuaSwitchNode{})
+}
+
+// LuaSwitchNodeConfiguration 节点配置
+type LuaSwitchNodeConfiguration struct {
+	//LuaScript 配置函数体脚本内容
+	//完整脚本函数：
+	//function Switch(msg, metadata, msgType) ${LuaScript} end
+	//return {'relationType1','relationType2'}
+	LuaScript string
+}
+
+// LuaSwitchNode 节点执行已配置的Lua脚本。脚本应返回消息应路由到的下一个链名称的数组(table)。
+// 如果数组为空-消息不路由到下一个节点。
+// 消息体可以通过`msg`变量访问，如果消息的dataType是json类型，可以通过 `msg.XX`方式访问msg的字段。例如:`msg.temperature > 50`
+// 消息元数据可以通过`metadata`变量访问。例如 `metadata.customerName == 'Lala'`
+// 消息类型可以通过`msgType`变量访问.
+type LuaSwitchNode struct {
+	//节点配置
+	Config              LuaSwitchNodeConfiguration
+	luaEngine           types.JsEngine
+	defaultRelationType string
+}
+
+// Type 组件类型
+func (x *LuaSwitchNode) Type() string {
+	return "luaSwitch"
+}
+func (x *LuaSwitchNode) New() types.Node {
+	return &LuaSwitchNode{Config: LuaSwitchNodeConfiguration{
+		LuaScript: `return {'msgType1','msgType2'}`,
+	}}
+}
+
+// Init 初始化
+func (x *LuaSwitchNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &x.Config)
+	if err == nil {
+		luaScript := fmt.Sprintf("function Switch(msg, metadata, msgType) %s end", x.Config.LuaScript)
+		x.luaEngine, err = lua.NewLuaEngine(ruleConfig, luaScript, base.NodeUtils.GetVars(configuration))
+		if v := ruleConfig.Properties.GetValue(KeyOtherRelationTypeName); v != "" {
+			x.defaultRelationType = v
+		} else {
+			x.defaultRelationType = KeyDefaultRelationType
+		}
+	}
+	return err
+}
+
+// OnMsg 处理消息
+func (x *LuaSwitchNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	var data interface{} = msg.Data
+	if msg.DataType == types.JSON {
+		var dataMap = make(map[string]interface{})
+		if err := json.Unmarshal([]byte(msg.Data), &dataMap); err == nil {
+			data = dataMap
+		}
+	}
+
+	out, err := x.luaEngine.Execute("Switch", data, msg.Metadata.Values(), msg.Type)
+
+	if err != nil {
+		ctx.TellFailure(msg, err)
+	} else {
+		if formatData, ok := out.([]interface{}); ok {
+			for _, relationType := range formatData {
+				ctx.TellNextOrElse(msg, x.defaultRelationType, str.ToString(relationType))
+			}
+		} else if formatData, ok := out.(map[string]interface{}); !ok || len(formatData) != 0 {
+			//空table等同于空数组，其他返回值格式错误
+			ctx.TellFailure(msg, JsSwitchReturnFormatErr)
+		}
+	}
+}
+
+// Destroy 销毁
+func (x *LuaSwitchNode) Destroy() {
+	x.luaEngine.Stop()
+}
@@ -0,0 +1,106 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package filter
+
+import (
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+	"testing"
+	"time"
+)
+
+func TestLuaSwitchNode(t *testing.T) {
+	var targetNodeType = "luaSwitch"
+
+	t.Run("NewNode", func(t *testing.T) {
+		test.NodeNew(t, targetNodeType, &LuaSwitchNode{}, types.Configuration{
+			"luaScript": `return {'msgType1','msgType2'}`,
+		}, Registry)
+	})
+
+	t.Run("InitNode", func(t *testing.T) {
+		test.NodeInit(t, targetNodeType, types.Configuration{
+			"luaScript": `return {'msgType1','msgType2'}`,
+		}, types.Configuration{
+			"luaScript": `return {'msgType1','msgType2'}`,
+		}, Registry)
+	})
+
+	t.Run("InitNodeDefault", func(t *testing.T) {
+		config := types.NewConfig()
+		node := LuaSwitchNode{}
+		err := node.Init(config, types.Configuration{})
+		assert.Nil(t, err)
+		assert.Equal(t, node.defaultRelationType, KeyDefaultRelationType)
+
+		config.Properties.PutValue(KeyOtherRelationTypeName, "Default")
+		err = node.Init(config, types.Configuration{})
+		assert.Nil(t, err)
+		assert.Equal(t, node.defaultRelationType, "Default")
+	})
+
+	t.Run("OnMsg", func(t *testing.T) {
+		node1, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"luaScript": `
+				local relationTypes = {'one'}
+				if type(msg) == 'table' and msg.temperature > 50 then
+					table.insert(relationTypes, 'two')
+				end
+				return relationTypes`,
+		}, Registry)
+		assert.Nil(t, err)
+		node2, _ := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"luaScript": `return 1`,
+		}, Registry)
+		node3, _ := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"luaScript": `return a.b`,
+		}, Registry)
+
+		var nodeList = []types.Node{node1, node2, node3}
+
+		for _, node := range nodeList {
+			metaData := types.BuildMetadata(make(map[string]string))
+			metaData.PutValue("productType", "test")
+			var msgList = []test.Msg{
+				{
+					MetaData:   metaData,
+					MsgType:    "ACTIVITY_EVENT",
+					Data:       "AA",
+					AfterSleep: time.Millisecond * 200,
+				},
+				{
+					MetaData:   metaData,
+					MsgType:    "ACTIVITY_EVENT",
+					Data:       "{\"temperature\":60}",
+					AfterSleep: time.Millisecond * 200,
+				},
+			}
+			test.NodeOnMsg(t, node, msgList, func(msg types.RuleMsg, relationType string, err2 error) {
+				if node.(*LuaSwitchNode).Config.LuaScript == `return 1` {
+					assert.Equal(t, JsSwitchReturnFormatErr.Error(), err2.Error())
+				} else if node.(*LuaSwitchNode).Config.LuaScript == `return a.b` {
+					assert.NotNil(t, err2)
+				} else if msg.Data == "AA" {
+					assert.Equal(t, "one", relationType)
+				} else {
+					assert.True(t, relationType == "one" || relationType == "two")
+				}
+			})
+		}
+	})
+}
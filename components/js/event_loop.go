@@ -0,0 +1,389 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package js
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/rulego/rulego/utils/json"
+)
+
+const (
+	// SetTimeoutKey 异步模式下可用的定时器函数：setTimeout(fn, delayMs, ...args)
+	SetTimeoutKey = "setTimeout"
+	// ClearTimeoutKey 取消定时器函数：clearTimeout(id)
+	ClearTimeoutKey = "clearTimeout"
+	// FetchKey 异步模式下可用的HTTP请求函数：fetch(url, {method, headers, body})
+	FetchKey = "fetch"
+	// DefaultMaxResponseSize fetch 响应体默认最大字节数
+	DefaultMaxResponseSize = 1024 * 1024
+)
+
+var (
+	ErrExecutionTimeout  = errors.New("execution timeout")
+	ErrPromiseNotSettled = errors.New("promise not settled")
+	ErrFetchNotAllowed   = errors.New("fetch not allowed")
+	ErrResponseTooLarge  = errors.New("response too large")
+)
+
+// FetchConfig fetch 函数的HTTP配置，和 restApiCall 节点的超时、代理配置一致
+type FetchConfig struct {
+	//ReadTimeoutMs 单个请求超时，单位毫秒，默认0:不限制，但仍然受 ScriptMaxExecutionTime 限制
+	ReadTimeoutMs int
+	//InsecureSkipVerify 是否跳过证书验证
+	InsecureSkipVerify bool
+	//EnableProxy 是否开启代理
+	EnableProxy bool
+	//UseSystemProxyProperties 使用系统配置代理（环境变量 HTTP_PROXY/HTTPS_PROXY），需要同时开启 EnableProxy
+	UseSystemProxyProperties bool
+	//ProxyScheme 代理协议
+	ProxyScheme string
+	//ProxyHost 代理主机
+	ProxyHost string
+	//ProxyPort 代理端口
+	ProxyPort int
+	//ProxyUser 代理用户名
+	ProxyUser string
+	//ProxyPassword 代理密码
+	ProxyPassword string
+	//AllowedHosts 允许访问的主机，支持 path.Match 通配符，例如：*.example.com
+	//为空不允许访问任何主机，* 表示不限制。重定向的目标主机同样需要在允许列表中
+	AllowedHosts []string
+	//MaxResponseSize 响应体最大字节数，默认1MB
+	MaxResponseSize int64
+}
+
+// newFetchClient 创建 fetch 使用的 http.Client
+func newFetchClient(config FetchConfig) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: config.InsecureSkipVerify}
+	//没有开启代理时不使用环境变量 HTTP_PROXY/HTTPS_PROXY 配置的代理
+	transport.Proxy = nil
+	if config.EnableProxy && config.UseSystemProxyProperties {
+		transport.Proxy = http.ProxyFromEnvironment
+	} else if config.EnableProxy {
+		urlProxy, _ := url.Parse(fmt.Sprintf("%s://%s:%d", config.ProxyScheme, config.ProxyHost, config.ProxyPort))
+		if urlProxy != nil {
+			if config.ProxyUser != "" && config.ProxyPassword != "" {
+				urlProxy.User = url.UserPassword(config.ProxyUser, config.ProxyPassword)
+			}
+			transport.Proxy = http.ProxyURL(urlProxy)
+		}
+	}
+	return &http.Client{Transport: transport,
+		Timeout: time.Duration(config.ReadTimeoutMs) * time.Millisecond,
+		//重定向不能绕过允许访问的主机和协议限制
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			if (req.URL.Scheme != "http" && req.URL.Scheme != "https") || !isAllowedHost(config.AllowedHosts, req.URL.Hostname()) {
+				return fmt.Errorf("%w: %s", ErrFetchNotAllowed, req.URL.String())
+			}
+			return nil
+		}}
+}
+
+// eventLoop 每个vm的事件循环，提供 setTimeout、clearTimeout 和 fetch 函数
+// vm 只在执行 Execute 的协程中运行，定时器和HTTP请求完成后通过 jobs 通道回到该协程执行回调
+type eventLoop struct {
+	vm     *goja.Runtime
+	client *http.Client
+	config FetchConfig
+	//当前执行，没有执行时为nil
+	current *loopRun
+}
+
+// loopRun 一次 Execute 的事件循环状态，执行结束后未完成的定时器和请求全部取消
+type loopRun struct {
+	ctx    context.Context
+	jobs   chan func() error
+	timers map[int64]*time.Timer
+	nextId int64
+	//未完成的定时器和请求数量
+	pending int
+}
+
+func newEventLoop(vm *goja.Runtime, client *http.Client, config FetchConfig) *eventLoop {
+	if config.MaxResponseSize <= 0 {
+		config.MaxResponseSize = DefaultMaxResponseSize
+	}
+	l := &eventLoop{vm: vm, client: client, config: config}
+	_ = vm.Set(SetTimeoutKey, l.setTimeout)
+	_ = vm.Set(ClearTimeoutKey, l.clearTimeout)
+	_ = vm.Set(FetchKey, l.fetch)
+	return l
+}
+
+// run 执行函数，如果返回 Promise 则运行事件循环直到 Promise 完成或者超时，timeout<=0 不限制
+func (l *eventLoop) run(fn goja.Callable, timeout time.Duration, args ...goja.Value) (goja.Value, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+	r := &loopRun{ctx: ctx, jobs: make(chan func() error), timers: make(map[int64]*time.Timer)}
+	l.current = r
+	defer func() {
+		cancel()
+		for _, timer := range r.timers {
+			timer.Stop()
+		}
+		l.current = nil
+	}()
+	res, err := fn(goja.Undefined(), args...)
+	if err != nil {
+		return nil, err
+	}
+	promise, ok := res.Export().(*goja.Promise)
+	if !ok {
+		return res, nil
+	}
+	for {
+		switch promise.State() {
+		case goja.PromiseStateFulfilled:
+			return promise.Result(), nil
+		case goja.PromiseStateRejected:
+			return nil, promiseError(promise.Result())
+		}
+		if r.pending == 0 {
+			return nil, ErrPromiseNotSettled
+		}
+		select {
+		case job := <-r.jobs:
+			if err = job(); err != nil {
+				return nil, err
+			}
+		case <-ctx.Done():
+			return nil, ErrExecutionTimeout
+		}
+	}
+}
+
+// enqueue 在其他协程调用，把回调交给vm所在协程执行，执行已经结束则丢弃
+func (r *loopRun) enqueue(job func() error) {
+	select {
+	case r.jobs <- job:
+	case <-r.ctx.Done():
+	}
+}
+
+func (l *eventLoop) setTimeout(call goja.FunctionCall) goja.Value {
+	r := l.current
+	if r == nil {
+		panic(l.vm.NewTypeError("setTimeout is only available while the script is running"))
+	}
+	fn, ok := goja.AssertFunction(call.Argument(0))
+	if !ok {
+		panic(l.vm.NewTypeError("setTimeout callback is not a function"))
+	}
+	delay := call.Argument(1).ToInteger()
+	if delay < 0 {
+		delay = 0
+	}
+	var args []goja.Value
+	if len(call.Arguments) > 2 {
+		args = append(args, call.Arguments[2:]...)
+	}
+	r.nextId++
+	id := r.nextId
+	r.pending++
+	r.timers[id] = time.AfterFunc(time.Duration(delay)*time.Millisecond, func() {
+		r.enqueue(func() error {
+			//已经被 clearTimeout 取消
+			if _, ok := r.timers[id]; !ok {
+				return nil
+			}
+			delete(r.timers, id)
+			r.pending--
+			_, err := fn(goja.Undefined(), args...)
+			return err
+		})
+	})
+	return l.vm.ToValue(id)
+}
+
+func (l *eventLoop) clearTimeout(id int64) {
+	r := l.current
+	if r == nil {
+		return
+	}
+	if timer, ok := r.timers[id]; ok {
+		timer.Stop()
+		delete(r.timers, id)
+		r.pending--
+	}
+}
+
+// fetch 受限的 fetch 实现，只支持 http/https 协议和 AllowedHosts 中的主机
+// options 支持 method、headers、body，body 不是字符串则转换成JSON
+// 返回 Promise，结果包含 status、statusText、ok、url、headers 以及 text()、json() 方法
+func (l *eventLoop) fetch(rawUrl string, options map[string]interface{}) *goja.Promise {
+	r := l.current
+	if r == nil {
+		panic(l.vm.NewTypeError("fetch is only available while the script is running"))
+	}
+	promise, resolve, reject := l.vm.NewPromise()
+	req, err := l.newRequest(r.ctx, rawUrl, options)
+	if err != nil {
+		reject(l.vm.NewGoError(err))
+		return promise
+	}
+	r.pending++
+	go func() {
+		status, statusText, header, body, err := l.do(req)
+		r.enqueue(func() error {
+			r.pending--
+			if err != nil {
+				reject(l.vm.NewGoError(err))
+			} else {
+				resolve(l.newResponse(req.URL.String(), status, statusText, header, body))
+			}
+			return nil
+		})
+	}()
+	return promise
+}
+
+func (l *eventLoop) newRequest(ctx context.Context, rawUrl string, options map[string]interface{}) (*http.Request, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || !isAllowedHost(l.config.AllowedHosts, u.Hostname()) {
+		return nil, errors.New(ErrFetchNotAllowed.Error() + ":" + rawUrl)
+	}
+	method := http.MethodGet
+	if v, ok := options["method"]; ok {
+		method = strings.ToUpper(fmt.Sprint(v))
+	}
+	var body io.Reader
+	if v, ok := options["body"]; ok && v != nil {
+		if s, ok := v.(string); ok {
+			body = strings.NewReader(s)
+		} else if b, err := json.Marshal(v); err != nil {
+			return nil, err
+		} else {
+			body = bytes.NewReader(b)
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if headers, ok := options["headers"].(map[string]interface{}); ok {
+		for k, v := range headers {
+			req.Header.Set(k, fmt.Sprint(v))
+		}
+	}
+	return req, nil
+}
+
+// isAllowedHost 主机是否在允许列表中，列表为空不允许访问任何主机
+func isAllowedHost(allowedHosts []string, host string) bool {
+	for _, pattern := range allowedHosts {
+		if pattern == "*" {
+			return true
+		}
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// do 执行HTTP请求，在独立协程运行，不能访问vm
+func (l *eventLoop) do(req *http.Request) (int, string, http.Header, []byte, error) {
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return 0, "", nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, l.config.MaxResponseSize+1))
+	if err != nil {
+		return 0, "", nil, nil, err
+	}
+	if int64(len(body)) > l.config.MaxResponseSize {
+		return 0, "", nil, nil, ErrResponseTooLarge
+	}
+	return resp.StatusCode, http.StatusText(resp.StatusCode), resp.Header, body, nil
+}
+
+func (l *eventLoop) newResponse(rawUrl string, status int, statusText string, header http.Header, body []byte) *goja.Object {
+	vm := l.vm
+	headers := vm.NewObject()
+	for k := range header {
+		_ = headers.Set(strings.ToLower(k), header.Get(k))
+	}
+	_ = headers.Set("get", func(name string) goja.Value {
+		if v := header.Get(name); v != "" {
+			return vm.ToValue(v)
+		}
+		return goja.Null()
+	})
+	res := vm.NewObject()
+	_ = res.Set("url", rawUrl)
+	_ = res.Set("status", status)
+	_ = res.Set("statusText", statusText)
+	_ = res.Set("ok", status >= 200 && status < 300)
+	_ = res.Set("headers", headers)
+	_ = res.Set("text", func() *goja.Promise {
+		promise, resolve, _ := vm.NewPromise()
+		resolve(string(body))
+		return promise
+	})
+	_ = res.Set("json", func() *goja.Promise {
+		promise, resolve, reject := vm.NewPromise()
+		var v interface{}
+		if err := json.Unmarshal(body, &v); err != nil {
+			reject(vm.NewGoError(err))
+		} else {
+			resolve(v)
+		}
+		return promise
+	})
+	return res
+}
+
+// promiseError 把 Promise 拒绝的原因转换成错误
+func promiseError(reason goja.Value) error {
+	if reason == nil || goja.IsUndefined(reason) || goja.IsNull(reason) {
+		return errors.New("promise rejected")
+	}
+	//vm.NewGoError 创建的错误，原始错误保存在 value 属性
+	if obj, ok := reason.(*goja.Object); ok {
+		if v := obj.Get("value"); v != nil {
+			if err, ok := v.Export().(error); ok {
+				return err
+			}
+		}
+	}
+	return errors.New(reason.String())
+}
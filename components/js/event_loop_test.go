@@ -0,0 +1,200 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package js
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestAsyncJsEngine(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/device":
+			body, _ := io.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"method":"` + r.Method + `","token":"` + r.Header.Get("token") + `","body":` + string(body) + `}`))
+		case "/slow":
+			time.Sleep(time.Millisecond * 500)
+		case "/large":
+			_, _ = w.Write([]byte(strings.Repeat("a", 200)))
+		case "/redirect":
+			//重定向到不允许访问的主机
+			http.Redirect(w, r, strings.Replace("http://"+r.Host, "127.0.0.1", "localhost", 1)+"/device", http.StatusFound)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	jsScript := `
+	async function Fetch(msg, metadata, msgType) {
+		var res = await fetch(msg.url + '/device', {method: 'post', headers: {token: 'aa'}, body: {id: msg.id}});
+		var data = await res.json();
+		return {status: res.status, ok: res.ok, type: res.headers.get('Content-Type'), data: data};
+	}
+	async function NotFound(msg) {
+		var res = await fetch(msg.url + '/notFound');
+		return res.status + ':' + res.ok + ':' + (await res.text());
+	}
+	async function Sleep(msg) {
+		var start = Date.now();
+		await new Promise(function(resolve) { setTimeout(resolve, 50); });
+		var id = setTimeout(function() { throw new Error('cleared'); }, 10);
+		clearTimeout(id);
+		return Date.now() - start >= 50;
+	}
+	async function Reject(msg) {
+		throw new Error('async error');
+	}
+	async function Slow(msg) {
+		await fetch(msg.url + '/slow');
+		return true;
+	}
+	async function Never(msg) {
+		await new Promise(function(resolve) {});
+	}
+	async function Large(msg) {
+		return await (await fetch(msg.url + '/large')).text();
+	}
+	async function NotAllowed(msg) {
+		return await fetch('file:///etc/passwd');
+	}
+	async function Redirect(msg) {
+		return await fetch(msg.url + '/redirect');
+	}
+	function Sync(msg) {
+		return msg.id;
+	}
+	`
+	config := types.NewConfig(types.WithScriptMaxExecutionTime(time.Millisecond * 200))
+	jsEngine, err := NewAsyncGojaJsEngine(config, jsScript, nil, FetchConfig{MaxResponseSize: 100, AllowedHosts: []string{"127.0.0.1"}})
+	assert.Nil(t, err)
+	defer jsEngine.Stop()
+
+	msg := map[string]interface{}{"url": server.URL, "id": "dev01"}
+	var group sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			out, err := jsEngine.Execute("Fetch", msg)
+			assert.Nil(t, err)
+			result := out.(map[string]interface{})
+			assert.Equal(t, int64(200), result["status"])
+			assert.Equal(t, true, result["ok"])
+			assert.Equal(t, "application/json", result["type"])
+			assert.Equal(t, map[string]interface{}{"method": "POST", "token": "aa", "body": map[string]interface{}{"id": "dev01"}}, result["data"])
+		}()
+	}
+	group.Wait()
+
+	out, err := jsEngine.Execute("NotFound", msg)
+	assert.Nil(t, err)
+	assert.Equal(t, "404:false:", out)
+
+	out, err = jsEngine.Execute("Sleep", msg)
+	assert.Nil(t, err)
+	assert.Equal(t, true, out)
+
+	_, err = jsEngine.Execute("Reject", msg)
+	assert.Equal(t, "Error: async error", err.Error())
+
+	start := time.Now()
+	_, err = jsEngine.Execute("Slow", msg)
+	assert.Equal(t, ErrExecutionTimeout, err)
+	assert.True(t, time.Since(start) < time.Millisecond*400)
+
+	_, err = jsEngine.Execute("Never", msg)
+	assert.Equal(t, ErrPromiseNotSettled, err)
+
+	_, err = jsEngine.Execute("Large", msg)
+	assert.Equal(t, ErrResponseTooLarge, err)
+
+	_, err = jsEngine.Execute("NotAllowed", msg)
+	assert.True(t, strings.Contains(err.Error(), ErrFetchNotAllowed.Error()))
+
+	_, err = jsEngine.Execute("Redirect", msg)
+	assert.True(t, strings.Contains(err.Error(), ErrFetchNotAllowed.Error()))
+
+	//超时后vm可以继续使用
+	out, err = jsEngine.Execute("Sync", msg)
+	assert.Nil(t, err)
+	assert.Equal(t, "dev01", out)
+
+	t.Run("AllowedHosts", func(t *testing.T) {
+		jsEngine, err := NewAsyncGojaJsEngine(config, jsScript, nil, FetchConfig{AllowedHosts: []string{"*.example.com"}})
+		assert.Nil(t, err)
+		_, err = jsEngine.Execute("Fetch", msg)
+		assert.True(t, strings.Contains(err.Error(), ErrFetchNotAllowed.Error()))
+
+		//默认不允许访问任何主机
+		jsEngine, err = NewAsyncGojaJsEngine(config, jsScript, nil, FetchConfig{})
+		assert.Nil(t, err)
+		_, err = jsEngine.Execute("Fetch", msg)
+		assert.True(t, strings.Contains(err.Error(), ErrFetchNotAllowed.Error()))
+
+		//* 不限制
+		jsEngine, err = NewAsyncGojaJsEngine(config, jsScript, nil, FetchConfig{AllowedHosts: []string{"*"}})
+		assert.Nil(t, err)
+		out, err := jsEngine.Execute("Fetch", msg)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(200), out.(map[string]interface{})["status"])
+	})
+
+	t.Run("NoTimeout", func(t *testing.T) {
+		//ScriptMaxExecutionTime<=0 不限制执行时间
+		jsEngine, err := NewAsyncGojaJsEngine(types.NewConfig(types.WithScriptMaxExecutionTime(0)), jsScript, nil, FetchConfig{})
+		assert.Nil(t, err)
+		out, err := jsEngine.Execute("Sleep", msg)
+		assert.Nil(t, err)
+		assert.Equal(t, true, out)
+	})
+
+	t.Run("Proxy", func(t *testing.T) {
+		//没有开启代理不使用环境变量配置的代理
+		t.Setenv("HTTP_PROXY", "http://127.0.0.1:1")
+		transport := newFetchClient(FetchConfig{}).Transport.(*http.Transport)
+		assert.True(t, transport.Proxy == nil)
+		transport = newFetchClient(FetchConfig{EnableProxy: true, UseSystemProxyProperties: true}).Transport.(*http.Transport)
+		assert.NotNil(t, transport.Proxy)
+		transport = newFetchClient(FetchConfig{EnableProxy: true, ProxyScheme: "http", ProxyHost: "127.0.0.1", ProxyPort: 8080}).Transport.(*http.Transport)
+		req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+		proxyUrl, err := transport.Proxy(req)
+		assert.Nil(t, err)
+		assert.Equal(t, "127.0.0.1:8080", proxyUrl.Host)
+	})
+
+	t.Run("SyncEngine", func(t *testing.T) {
+		jsEngine, err := NewGojaJsEngine(config, jsScript, nil)
+		assert.Nil(t, err)
+		//同步模式没有 fetch 函数
+		out, err := jsEngine.Execute("NotAllowed", msg)
+		assert.Nil(t, err)
+		assert.NotNil(t, out)
+		_, ok := jsEngine.vmPool.Get().(*eventLoop)
+		assert.False(t, ok)
+	})
+}
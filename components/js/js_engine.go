@@ -26,12 +26,16 @@
 // - GojaJsEngine: The main struct representing the JavaScript engine.
 // - NewGojaJsEngine: Function to create a new instance of the JavaScript engine.
 // - PreCompileJs: Method to precompile user-defined JavaScript functions.
+// - Modules: The registry of shared CommonJS-style modules loaded by require(name).
+// - NewAsyncGojaJsEngine: Function to create an engine running an event loop for async functions.
 //
 // The package supports features such as:
 // - Pooling of JavaScript VMs for efficient reuse
 // - Precompilation of JavaScript code for improved performance
 // - Integration with the RuleGo configuration system
 // - Access to global variables and functions within JavaScript code
+// - Sharing script libraries across rule chains through require(name)
+// - Opt-in async mode with promises, setTimeout and a restricted fetch
 //
 // This package is crucial for components that require JavaScript execution,
 // such as the JsTransformNode and JsFilterNode in the action package.
@@ -40,6 +44,7 @@ package js
 import (
 	"errors"
 	"fmt"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
@@ -51,6 +56,8 @@ import (
 const (
 	//GlobalKey  global properties key,call them through the global.xx method
 	GlobalKey = "global"
+	//RequireKey  load shared modules registered in Modules and allowed by Modules.SetAllowList,call them through the require('name') method
+	RequireKey = "require"
 )
 
 // GojaJsEngine goja js engine
@@ -59,6 +66,9 @@ type GojaJsEngine struct {
 	config            types.Config
 	jsScript          *goja.Program
 	jsUdfProgramCache map[string]*goja.Program
+	//async 是否运行事件循环，支持 async 函数、setTimeout 和 fetch
+	async       bool
+	fetchClient *http.Client
 }
 
 // NewGojaJsEngine Create a new instance of the JavaScript engine
@@ -82,6 +92,24 @@ func NewGojaJsEngine(config types.Config, jsScript string, fromVars map[string]i
 	return jsEngine, nil
 }
 
+// NewAsyncGojaJsEngine Create a new instance of the JavaScript engine with an event loop.
+// Scripts can use async functions, setTimeout and fetch. If the function returns a Promise,
+// Execute waits for it to settle up to ScriptMaxExecutionTime.
+func NewAsyncGojaJsEngine(config types.Config, jsScript string, fromVars map[string]interface{}, fetchConfig FetchConfig) (*GojaJsEngine, error) {
+	jsEngine, err := NewGojaJsEngine(config, jsScript, fromVars)
+	if err != nil {
+		return nil, err
+	}
+	jsEngine.async = true
+	jsEngine.fetchClient = newFetchClient(fetchConfig)
+	jsEngine.vmPool = sync.Pool{
+		New: func() interface{} {
+			return newEventLoop(jsEngine.NewVm(config, fromVars), jsEngine.fetchClient, fetchConfig)
+		},
+	}
+	return jsEngine, nil
+}
+
 // PreCompileJs Precompiled UDF JavaScript file
 func (g *GojaJsEngine) PreCompileJs(config types.Config) error {
 	var jsUdfProgramCache = make(map[string]*goja.Program)
@@ -114,6 +142,10 @@ func (g *GojaJsEngine) PreCompileJs(config types.Config) error {
 // NewVm new a js VM
 func (g *GojaJsEngine) NewVm(config types.Config, fromVars map[string]interface{}) *goja.Runtime {
 	vm := goja.New()
+	//Load shared modules from the module registry through require(name)
+	if err := vm.Set(RequireKey, Modules.require(vm)); err != nil {
+		config.Logger.Printf("set require error,err:" + err.Error())
+	}
 	vars := make(map[string]interface{})
 	if fromVars != nil {
 		for k, v := range fromVars {
@@ -181,7 +213,14 @@ func (g *GojaJsEngine) Execute(functionName string, argumentList ...interface{})
 		}
 	}()
 
-	vm := g.vmPool.Get().(*goja.Runtime)
+	var vm *goja.Runtime
+	var loop *eventLoop
+	if g.async {
+		loop = g.vmPool.Get().(*eventLoop)
+		vm = loop.vm
+	} else {
+		vm = g.vmPool.Get().(*goja.Runtime)
+	}
 
 	state := g.setTimeout(vm)
 
@@ -193,11 +232,22 @@ func (g *GojaJsEngine) Execute(functionName string, argumentList ...interface{})
 	for _, v := range argumentList {
 		params = append(params, vm.ToValue(v))
 	}
-	res, err := f(goja.Undefined(), params...)
+	var res goja.Value
+	if loop != nil {
+		res, err = loop.run(f, g.config.ScriptMaxExecutionTime, params...)
+	} else {
+		res, err = f(goja.Undefined(), params...)
+	}
 	//If there is no timeout, state=0; otherwise, state=-2
 	closeStateChan(state)
 	//Put back to the pool
-	g.vmPool.Put(vm)
+	if loop != nil {
+		//The interrupt may happen while waiting for the event loop
+		vm.ClearInterrupt()
+		g.vmPool.Put(loop)
+	} else {
+		g.vmPool.Put(vm)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -208,7 +258,11 @@ func (g *GojaJsEngine) Stop() {
 }
 
 // setTimeout if timeout interrupt the js script execution
+// ScriptMaxExecutionTime<=0 means no limit, and nil is returned
 func (g *GojaJsEngine) setTimeout(vm *goja.Runtime) chan int {
+	if g.config.ScriptMaxExecutionTime <= 0 {
+		return nil
+	}
 	state := make(chan int, 1)
 	state <- 0
 	time.AfterFunc(g.config.ScriptMaxExecutionTime, func() {
@@ -221,6 +275,9 @@ func (g *GojaJsEngine) setTimeout(vm *goja.Runtime) chan int {
 }
 
 func closeStateChan(state chan int) {
+	if state == nil {
+		return
+	}
 	if <-state == 0 {
 		state <- 1
 	}
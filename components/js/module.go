@@ -0,0 +1,337 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package js
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dop251/goja"
+)
+
+// ModuleVersionSeparator 模块名称和版本的分隔符，例如：require('units@1.0.0')
+const ModuleVersionSeparator = "@"
+
+var (
+	ErrModuleNotFound    = errors.New("module not found")
+	ErrModuleNotAllowed  = errors.New("module not allowed")
+	ErrInvalidModuleName = errors.New("invalid module name")
+)
+
+// Modules 全局JS模块注册表，js脚本可以通过 require(name) 加载其中允许加载的模块
+// 默认不允许加载任何模块，需要通过 SetAllowList 开启，例如注册一个单位转换模块：
+//
+//	js.Modules.Register("units", "1.0.0", "exports.c2f = function(c) { return c * 9 / 5 + 32; };")
+//	js.Modules.SetAllowList("units")
+//
+// 在 jsTransform 脚本中使用：
+//
+//	var units = require('units'); msg.f = units.c2f(msg.c); return {'msg':msg,'metadata':metadata,'msgType':msgType};
+var Modules = NewModuleRegistry()
+
+// Module JS模块，使用CommonJS规范，通过 exports 或者 module.exports 导出
+type Module struct {
+	// Name 模块名称，可以包含路径，例如：validation/device
+	Name string
+	// Version 模块版本，可以为空
+	Version string
+	// Source 模块源码
+	Source string
+	// 预编译的模块
+	program *goja.Program
+}
+
+// ModuleRegistry JS模块注册表
+// 模块注册时预编译一次，脚本只能加载注册表中的模块，不能访问文件系统。
+// 重新注册相同名称和版本的模块会替换旧模块(热更新)，脚本下一次调用 require 时加载新模块。
+type ModuleRegistry struct {
+	lock sync.RWMutex
+	// name:version:*Module
+	modules map[string]map[string]*Module
+	// 允许脚本加载的模块名称，支持通配符，例如：validation/*，* 允许加载所有模块，为空则不允许加载任何模块
+	allowList []string
+	// 通过 LoadDir 从文件夹加载的模块，dir:name@version:*Module
+	dirModules map[string]map[string]*Module
+}
+
+// NewModuleRegistry 创建JS模块注册表
+func NewModuleRegistry() *ModuleRegistry {
+	return &ModuleRegistry{modules: make(map[string]map[string]*Module), dirModules: make(map[string]map[string]*Module)}
+}
+
+// Register 注册模块，编译失败返回错误
+func (r *ModuleRegistry) Register(name, version, source string) error {
+	_, err := r.register(name, version, source)
+	return err
+}
+
+func (r *ModuleRegistry) register(name, version, source string) (*Module, error) {
+	if !isValidModuleName(name) || strings.Contains(version, ModuleVersionSeparator) {
+		return nil, ErrInvalidModuleName
+	}
+	program, err := goja.Compile(name, "(function(exports, require, module) {"+source+"\n})", true)
+	if err != nil {
+		return nil, err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	versions, ok := r.modules[name]
+	if !ok {
+		versions = make(map[string]*Module)
+		r.modules[name] = versions
+	}
+	m := &Module{Name: name, Version: version, Source: source, program: program}
+	versions[version] = m
+	return m, nil
+}
+
+// Unregister 删除模块，version为空则删除该名称所有版本
+func (r *ModuleRegistry) Unregister(name string, version ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(version) == 0 {
+		delete(r.modules, name)
+		return
+	}
+	if versions, ok := r.modules[name]; ok {
+		for _, v := range version {
+			delete(versions, v)
+		}
+		if len(versions) == 0 {
+			delete(r.modules, name)
+		}
+	}
+}
+
+// Get 获取模块，id格式：name 或者 name@version，不指定版本则返回最高版本
+func (r *ModuleRegistry) Get(id string) (Module, bool) {
+	name, version := splitModuleId(id)
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	versions, ok := r.modules[name]
+	if !ok {
+		return Module{}, false
+	}
+	if version != "" {
+		m, ok := versions[version]
+		if !ok {
+			return Module{}, false
+		}
+		return *m, true
+	}
+	var latest *Module
+	for _, m := range versions {
+		if latest == nil || compareVersion(m.Version, latest.Version) > 0 {
+			latest = m
+		}
+	}
+	return *latest, true
+}
+
+// List 获取所有模块，按名称和版本排序
+func (r *ModuleRegistry) List() []Module {
+	r.lock.RLock()
+	var list []Module
+	for _, versions := range r.modules {
+		for _, m := range versions {
+			list = append(list, *m)
+		}
+	}
+	r.lock.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return compareVersion(list[i].Version, list[j].Version) < 0
+	})
+	return list
+}
+
+// SetAllowList 设置允许脚本加载的模块名称，支持 path.Match 通配符，例如：validation/*
+// * 允许加载所有已注册的模块，为空则不允许加载任何模块(默认)
+func (r *ModuleRegistry) SetAllowList(patterns ...string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.allowList = patterns
+}
+
+// IsAllowed 判断脚本是否允许加载该模块
+func (r *ModuleRegistry) IsAllowed(name string) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	for _, pattern := range r.allowList {
+		if pattern == "*" {
+			return true
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// LoadDir 加载文件夹中的所有 .js 文件，模块名称为文件相对路径去掉 .js 后缀，
+// 文件名可以包含版本，例如：validation/device@1.0.0.js 注册为模块 validation/device 版本 1.0.0
+// 重复调用可以热更新文件夹中的模块，上一次从该文件夹加载、文件已经删除的模块会被删除
+func (r *ModuleRegistry) LoadDir(dir string) error {
+	loaded := make(map[string]*Module)
+	err := filepath.WalkDir(dir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || filepath.Ext(filePath) != ".js" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, filePath)
+		if err != nil {
+			return err
+		}
+		source, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		name, version := splitModuleId(strings.TrimSuffix(filepath.ToSlash(rel), ".js"))
+		m, err := r.register(name, version, string(source))
+		if err != nil {
+			return err
+		}
+		loaded[name+ModuleVersionSeparator+version] = m
+		return nil
+	})
+	key := filepath.Clean(dir)
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if err != nil {
+		//加载失败不删除模块，只记录已经加载的模块
+		if r.dirModules[key] == nil {
+			r.dirModules[key] = loaded
+		} else {
+			for id, m := range loaded {
+				r.dirModules[key][id] = m
+			}
+		}
+		return err
+	}
+	for id, m := range r.dirModules[key] {
+		if _, ok := loaded[id]; ok {
+			continue
+		}
+		//没有被其他方式重新注册则删除
+		if versions, ok := r.modules[m.Name]; ok && versions[m.Version] == m {
+			delete(versions, m.Version)
+			if len(versions) == 0 {
+				delete(r.modules, m.Name)
+			}
+		}
+	}
+	r.dirModules[key] = loaded
+	return nil
+}
+
+// require 创建 vm 的 require 函数，每个vm缓存已经加载的模块，模块热更新后重新加载
+func (r *ModuleRegistry) require(vm *goja.Runtime) func(id string) goja.Value {
+	type loadedModule struct {
+		program *goja.Program
+		module  *goja.Object
+	}
+	cache := make(map[string]*loadedModule)
+	var require func(id string) goja.Value
+	require = func(id string) goja.Value {
+		name, _ := splitModuleId(id)
+		if !r.IsAllowed(name) {
+			panic(vm.NewGoError(errors.New(ErrModuleNotAllowed.Error() + ":" + id)))
+		}
+		m, ok := r.Get(id)
+		if !ok {
+			panic(vm.NewGoError(errors.New(ErrModuleNotFound.Error() + ":" + id)))
+		}
+		if loaded, ok := cache[id]; ok && loaded.program == m.program {
+			return loaded.module.Get("exports")
+		}
+		module := vm.NewObject()
+		exports := vm.NewObject()
+		_ = module.Set("exports", exports)
+		//执行前放入缓存，支持循环依赖
+		cache[id] = &loadedModule{program: m.program, module: module}
+		fnValue, err := vm.RunProgram(m.program)
+		if err != nil {
+			delete(cache, id)
+			panic(err)
+		}
+		fn, _ := goja.AssertFunction(fnValue)
+		if _, err = fn(goja.Undefined(), exports, vm.ToValue(require), module); err != nil {
+			delete(cache, id)
+			panic(err)
+		}
+		return module.Get("exports")
+	}
+	return require
+}
+
+func splitModuleId(id string) (string, string) {
+	if i := strings.LastIndex(id, ModuleVersionSeparator); i > 0 {
+		return id[:i], id[i+1:]
+	}
+	return id, ""
+}
+
+// isValidModuleName 模块名称不能是绝对路径，也不能包含 .. 和 \
+func isValidModuleName(name string) bool {
+	if name == "" || strings.HasPrefix(name, "/") || strings.Contains(name, "\\") {
+		return false
+	}
+	for _, item := range strings.Split(name, "/") {
+		if item == "" || item == "." || item == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// compareVersion 比较版本号，按 . 分隔逐段比较，数字按数值比较
+func compareVersion(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y string
+		if i < len(as) {
+			x = as[i]
+		}
+		if i < len(bs) {
+			y = bs[i]
+		}
+		xn, xErr := strconv.Atoi(x)
+		yn, yErr := strconv.Atoi(y)
+		if xErr == nil && yErr == nil {
+			if xn != yn {
+				if xn < yn {
+					return -1
+				}
+				return 1
+			}
+		} else if x != y {
+			return strings.Compare(x, y)
+		}
+	}
+	return 0
+}
@@ -0,0 +1,174 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package js
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestModules(t *testing.T) {
+	defer func() {
+		Modules = NewModuleRegistry()
+	}()
+	assert.Nil(t, Modules.Register("units", "1.0.0", `exports.c2f = function(c) { return c * 9 / 5 + 32; };`))
+	assert.Nil(t, Modules.Register("units", "1.10.0", `
+		var base = require('units@1.0.0');
+		module.exports = { c2f: base.c2f, f2c: function(f) { return (f - 32) * 5 / 9; } };`))
+	assert.Nil(t, Modules.Register("units", "1.2.0", `exports.c2f = function(c) { return 0; };`))
+	assert.Nil(t, Modules.Register("validation/device", "", `
+		var units = require('units');
+		exports.check = function(msg) { return msg.id !== undefined && units.c2f(msg.c) < 200; };`))
+	assert.Nil(t, Modules.Register("internal/secret", "", `exports.key = 'secret';`))
+
+	assert.NotNil(t, Modules.Register("bad", "", `exports.a = function( {`))
+	assert.Equal(t, ErrInvalidModuleName, Modules.Register("../etc/passwd", "", ``))
+	assert.Equal(t, ErrInvalidModuleName, Modules.Register("/etc/passwd", "", ``))
+	assert.Equal(t, ErrInvalidModuleName, Modules.Register("a/./b", "", ``))
+
+	m, ok := Modules.Get("units")
+	assert.True(t, ok)
+	assert.Equal(t, "1.10.0", m.Version)
+	m, ok = Modules.Get("units@1.2.0")
+	assert.True(t, ok)
+	assert.Equal(t, "1.2.0", m.Version)
+	_, ok = Modules.Get("units@2.0.0")
+	assert.False(t, ok)
+	list := Modules.List()
+	assert.Equal(t, 5, len(list))
+	assert.Equal(t, "internal/secret", list[0].Name)
+	assert.Equal(t, "1.0.0", list[1].Version)
+	assert.Equal(t, "1.10.0", list[3].Version)
+	assert.Equal(t, "validation/device", list[4].Name)
+
+	jsScript := `
+	function Transform(msg, metadata, msgType) {
+		var units = require('units');
+		return {f: units.c2f(msg.c), c: units.f2c(212), old: require('units@1.2.0').c2f(100)};
+	}
+	function Check(msg, metadata, msgType) {
+		return require('validation/device').check(msg);
+	}
+	function Secret(msg, metadata, msgType) {
+		return require('internal/secret').key;
+	}
+	function NotFound(msg, metadata, msgType) {
+		return require('fs');
+	}
+	`
+	jsEngine, err := NewGojaJsEngine(types.NewConfig(), jsScript, nil)
+	assert.Nil(t, err)
+	defer jsEngine.Stop()
+
+	//默认不允许加载任何模块
+	_, err = jsEngine.Execute("Secret", map[string]interface{}{})
+	assert.True(t, strings.Contains(err.Error(), ErrModuleNotAllowed.Error()))
+	Modules.SetAllowList("*")
+
+	out, err := jsEngine.Execute("Transform", map[string]interface{}{"c": 100})
+	assert.Nil(t, err)
+	result := out.(map[string]interface{})
+	assert.Equal(t, int64(212), result["f"])
+	assert.Equal(t, int64(100), result["c"])
+	assert.Equal(t, int64(0), result["old"])
+
+	out, err = jsEngine.Execute("Check", map[string]interface{}{"id": "dev01", "c": 30})
+	assert.Nil(t, err)
+	assert.Equal(t, true, out)
+
+	out, err = jsEngine.Execute("Secret", map[string]interface{}{})
+	assert.Nil(t, err)
+	assert.Equal(t, "secret", out)
+
+	_, err = jsEngine.Execute("NotFound", map[string]interface{}{})
+	assert.True(t, strings.Contains(err.Error(), ErrModuleNotFound.Error()))
+
+	t.Run("AllowList", func(t *testing.T) {
+		Modules.SetAllowList("units", "validation/*")
+		defer Modules.SetAllowList("*")
+		_, err = jsEngine.Execute("Secret", map[string]interface{}{})
+		assert.True(t, strings.Contains(err.Error(), ErrModuleNotAllowed.Error()))
+		out, err = jsEngine.Execute("Check", map[string]interface{}{"id": "dev01", "c": 30})
+		assert.Nil(t, err)
+		assert.Equal(t, true, out)
+	})
+
+	t.Run("HotReload", func(t *testing.T) {
+		assert.Nil(t, Modules.Register("units", "1.10.0", `
+			exports.c2f = function(c) { return -1; };
+			exports.f2c = function(f) { return -1; };`))
+		out, err = jsEngine.Execute("Transform", map[string]interface{}{"c": 100})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(-1), out.(map[string]interface{})["f"])
+
+		Modules.Unregister("units", "1.10.0")
+		out, err = jsEngine.Execute("Transform", map[string]interface{}{"c": 100})
+		//最高版本是 1.2.0，没有 f2c 函数
+		assert.NotNil(t, err)
+
+		Modules.Unregister("validation/device")
+		_, err = jsEngine.Execute("Check", map[string]interface{}{"id": "dev01", "c": 30})
+		assert.True(t, strings.Contains(err.Error(), ErrModuleNotFound.Error()))
+	})
+
+	t.Run("LoadDir", func(t *testing.T) {
+		dir := t.TempDir()
+		assert.Nil(t, os.MkdirAll(filepath.Join(dir, "validation"), 0755))
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, "validation", "device@2.0.0.js"), []byte(`exports.check = function(msg) { return msg.id === 'dev02'; };`), 0644))
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, "readme.txt"), []byte(`ignored`), 0644))
+		assert.Nil(t, Modules.LoadDir(dir))
+
+		m, ok := Modules.Get("validation/device")
+		assert.True(t, ok)
+		assert.Equal(t, "2.0.0", m.Version)
+		out, err = jsEngine.Execute("Check", map[string]interface{}{"id": "dev02"})
+		assert.Nil(t, err)
+		assert.Equal(t, true, out)
+
+		//删除文件后重新加载，模块被删除
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, "units@3.0.0.js"), []byte(`exports.c2f = function(c) { return 3; };`), 0644))
+		assert.Nil(t, Modules.LoadDir(dir))
+		m, _ = Modules.Get("units")
+		assert.Equal(t, "3.0.0", m.Version)
+		assert.Nil(t, os.Remove(filepath.Join(dir, "units@3.0.0.js")))
+		assert.Nil(t, os.Remove(filepath.Join(dir, "validation", "device@2.0.0.js")))
+		assert.Nil(t, Modules.LoadDir(dir))
+		_, ok = Modules.Get("units@3.0.0")
+		assert.False(t, ok)
+		_, ok = Modules.Get("validation/device")
+		assert.False(t, ok)
+		//其他方式注册的模块不受影响
+		m, _ = Modules.Get("units")
+		assert.Equal(t, "1.2.0", m.Version)
+
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, "bad.js"), []byte(`exports.a = function( {`), 0644))
+		assert.NotNil(t, Modules.LoadDir(dir))
+	})
+}
+
+func TestCompareVersion(t *testing.T) {
+	assert.Equal(t, 0, compareVersion("1.0.0", "1.0.0"))
+	assert.Equal(t, 1, compareVersion("1.10.0", "1.2.0"))
+	assert.Equal(t, -1, compareVersion("1.0", "1.0.1"))
+	assert.Equal(t, -1, compareVersion("", "1.0.0"))
+	assert.Equal(t, 1, compareVersion("1.0.0-beta", "1.0.0-alpha"))
+}
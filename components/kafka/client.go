@@ -0,0 +1,162 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package kafka provides a Kafka client for the RuleGo rule engine.
+//
+// The Client wraps a sarama.Client and lazily creates a synchronous producer on top of it,
+// so that the kafka endpoint (consumer groups) and the kafkaProducer node can share the same
+// connections through the ref:// shared node pool.
+package kafka
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/IBM/sarama"
+)
+
+const (
+	// OffsetNewest 没有已提交的offset时，从最新的消息开始消费
+	OffsetNewest = "newest"
+	// OffsetOldest 没有已提交的offset时，从最早的消息开始消费
+	OffsetOldest = "oldest"
+)
+
+// Config 客户端配置
+type Config struct {
+	// Server kafka broker 地址，多个使用逗号分隔，例如：127.0.0.1:9092,127.0.0.2:9092
+	Server string
+	// ClientId 客户端ID
+	ClientId string
+	// Version kafka 协议版本，例如：2.1.0，为空使用默认版本
+	Version string
+	// OffsetInitial 消费者组没有已提交的offset时的起始位置：newest/oldest，默认newest
+	OffsetInitial string
+}
+
+// Brokers 返回broker地址列表
+func (c Config) Brokers() []string {
+	var brokers []string
+	for _, item := range strings.Split(c.Server, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			brokers = append(brokers, item)
+		}
+	}
+	return brokers
+}
+
+// SaramaConfig 转换成sarama配置
+// 消费者组关闭自动提交，由使用方在消息处理完成后手动提交offset
+func (c Config) SaramaConfig() (*sarama.Config, error) {
+	conf := sarama.NewConfig()
+	if c.ClientId != "" {
+		conf.ClientID = c.ClientId
+	}
+	if c.Version != "" {
+		version, err := sarama.ParseKafkaVersion(c.Version)
+		if err != nil {
+			return nil, err
+		}
+		conf.Version = version
+	}
+	if strings.ToLower(c.OffsetInitial) == OffsetOldest {
+		conf.Consumer.Offsets.Initial = sarama.OffsetOldest
+	} else {
+		conf.Consumer.Offsets.Initial = sarama.OffsetNewest
+	}
+	conf.Consumer.Offsets.AutoCommit.Enable = false
+	conf.Producer.Return.Successes = true
+	conf.Producer.Return.Errors = true
+	return conf, conf.Validate()
+}
+
+// Client kafka 客户端
+type Client struct {
+	client   sarama.Client
+	producer sarama.SyncProducer
+	lock     sync.Mutex
+}
+
+// NewClient 创建客户端并连接broker
+func NewClient(conf Config) (*Client, error) {
+	brokers := conf.Brokers()
+	if len(brokers) == 0 {
+		return nil, errors.New("kafka server can not empty")
+	}
+	saramaConfig, err := conf.SaramaConfig()
+	if err != nil {
+		return nil, err
+	}
+	client, err := sarama.NewClient(brokers, saramaConfig)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{client: client}, nil
+}
+
+// Client 获取sarama客户端，可以用于创建消费者组
+func (c *Client) Client() sarama.Client {
+	return c.client
+}
+
+// Producer 获取同步生产者，首次调用时创建
+func (c *Client) Producer() (sarama.SyncProducer, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.producer != nil {
+		return c.producer, nil
+	}
+	producer, err := sarama.NewSyncProducerFromClient(c.client)
+	if err != nil {
+		return nil, err
+	}
+	c.producer = producer
+	return producer, nil
+}
+
+// Publish 发布消息，返回消息写入的分区和offset
+func (c *Client) Publish(topic string, key string, value []byte, headers map[string]string) (int32, int64, error) {
+	producer, err := c.Producer()
+	if err != nil {
+		return 0, 0, err
+	}
+	msg := &sarama.ProducerMessage{
+		Topic: topic,
+		Value: sarama.ByteEncoder(value),
+	}
+	if key != "" {
+		msg.Key = sarama.StringEncoder(key)
+	}
+	for k, v := range headers {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(k), Value: []byte(v)})
+	}
+	return producer.SendMessage(msg)
+}
+
+// Close 关闭生产者和客户端
+func (c *Client) Close() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.producer != nil {
+		_ = c.producer.Close()
+		c.producer = nil
+	}
+	if c.client != nil && !c.client.Closed() {
+		return c.client.Close()
+	}
+	return nil
+}
@@ -0,0 +1,444 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package lua provides Lua execution capabilities for the RuleGo rule engine.
+//
+// This package implements a Lua engine using the gopher-lua library. It implements
+// the same types.JsEngine interface as the JavaScript engine, so script nodes can
+// switch between the two languages without changing the way they are executed.
+//
+// Key components:
+// - LuaEngine: The main struct representing the Lua engine.
+// - NewLuaEngine: Function to create a new instance of the Lua engine.
+// - PreCompileLua: Method to precompile user-defined Lua functions.
+//
+// The package supports features such as:
+// - Pooling of Lua VMs for efficient reuse
+// - Precompilation of Lua code for improved performance
+// - Enforcement of Config.ScriptMaxExecutionTime
+// - Access to global properties (global.xx), node variables (vars.xx) and
+// user-defined functions registered with Config.RegisterUdf
+//
+// Only the base, table, string, math and a safe subset of os (clock, date, difftime, time)
+// standard libraries are available, scripts cannot access files or execute commands.
+//
+// This package is used by the LuaFilterNode, LuaSwitchNode and LuaTransformNode components.
+package lua
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/utils/json"
+	"github.com/rulego/rulego/utils/maps"
+	lua "github.com/yuin/gopher-lua"
+	"github.com/yuin/gopher-lua/parse"
+)
+
+const (
+	//GlobalKey  global properties key,call them through the global.xx method
+	GlobalKey = "global"
+)
+
+// ErrExecutionTimeout script execution exceeds Config.ScriptMaxExecutionTime
+var ErrExecutionTimeout = errors.New("execution timeout")
+
+// LuaEngine gopher-lua engine
+type LuaEngine struct {
+	vmPool           sync.Pool
+	config           types.Config
+	luaScript        *lua.FunctionProto
+	luaUdfProtoCache map[string]*lua.FunctionProto
+}
+
+// NewLuaEngine Create a new instance of the Lua engine
+func NewLuaEngine(config types.Config, luaScript string, fromVars map[string]interface{}) (*LuaEngine, error) {
+	proto, err := Compile("", luaScript)
+	if err != nil {
+		return nil, err
+	}
+	luaEngine := &LuaEngine{
+		config:    config,
+		luaScript: proto,
+	}
+	if err = luaEngine.PreCompileLua(config); err != nil {
+		return nil, err
+	}
+	luaEngine.vmPool = sync.Pool{
+		New: func() interface{} {
+			return luaEngine.NewVm(config, fromVars)
+		},
+	}
+	return luaEngine, nil
+}
+
+// Compile compiles a Lua script, the result can be registered as the Content of types.Script
+func Compile(name, source string) (*lua.FunctionProto, error) {
+	chunk, err := parse.Parse(strings.NewReader(source), name)
+	if err != nil {
+		return nil, err
+	}
+	return lua.Compile(chunk, name)
+}
+
+// PreCompileLua Precompiled UDF Lua scripts, only types.Script with Type=Lua are used
+func (g *LuaEngine) PreCompileLua(config types.Config) error {
+	var luaUdfProtoCache = make(map[string]*lua.FunctionProto)
+	for k, v := range config.Udf {
+		if script, ok := v.(types.Script); ok && script.Type == types.Lua {
+			if c, ok := script.Content.(string); ok {
+				if p, err := Compile(k, c); err != nil {
+					return err
+				} else {
+					luaUdfProtoCache[k] = p
+				}
+			} else if p, ok := script.Content.(*lua.FunctionProto); ok {
+				luaUdfProtoCache[k] = p
+			}
+		}
+	}
+	g.luaUdfProtoCache = luaUdfProtoCache
+	return nil
+}
+
+// NewVm new a Lua VM
+func (g *LuaEngine) NewVm(config types.Config, fromVars map[string]interface{}) *lua.LState {
+	vm := lua.NewState(lua.Options{SkipOpenLibs: true})
+	openLibs(vm)
+	for k, v := range fromVars {
+		vm.SetGlobal(k, ToLValue(vm, v))
+	}
+	if len(config.Properties.Values()) != 0 {
+		//Add global properties to the Lua runtime and call them through the global.xx method
+		vm.SetGlobal(GlobalKey, ToLValue(vm, config.Properties.Values()))
+	}
+	//Add global custom functions to the Lua runtime
+	for k, v := range config.Udf {
+		var err error
+		if script, ok := v.(types.Script); ok {
+			if script.Type != types.Lua {
+				continue
+			}
+			if p, ok := g.luaUdfProtoCache[k]; ok {
+				vm.Push(vm.NewFunctionFromProto(p))
+				err = vm.PCall(0, lua.MultRet, nil)
+			} else {
+				funcName := strings.Replace(k, types.Lua+types.ScriptFuncSeparator, "", 1)
+				vm.SetGlobal(funcName, ToLValue(vm, script.Content))
+			}
+		} else if _, ok := v.(string); !ok {
+			// parse go func, string udf is js script
+			vm.SetGlobal(k, ToLValue(vm, v))
+		}
+		if err != nil {
+			config.Logger.Printf("parse lua script=" + k + " error,err:" + err.Error())
+		}
+	}
+	vm.Push(vm.NewFunctionFromProto(g.luaScript))
+	if err := g.call(vm, func() error {
+		return vm.PCall(0, lua.MultRet, nil)
+	}); err != nil {
+		config.Logger.Printf("lua vm error,err:" + err.Error())
+	}
+	vm.SetTop(0)
+	return vm
+}
+
+// Execute Execute Lua function
+func (g *LuaEngine) Execute(functionName string, argumentList ...interface{}) (out interface{}, err error) {
+	defer func() {
+		if caught := recover(); caught != nil {
+			err = fmt.Errorf("%s", caught)
+		}
+	}()
+
+	vm := g.vmPool.Get().(*lua.LState)
+
+	fn := vm.GetGlobal(functionName)
+	if fn.Type() != lua.LTFunction {
+		g.vmPool.Put(vm)
+		return nil, errors.New(functionName + " is not a function")
+	}
+	var params []lua.LValue
+	for _, v := range argumentList {
+		params = append(params, ToLValue(vm, v))
+	}
+	err = g.call(vm, func() error {
+		return vm.CallByParam(lua.P{Fn: fn, NRet: 1, Protect: true}, params...)
+	})
+	if err == ErrExecutionTimeout {
+		//Interrupted VM is not reused
+		vm.Close()
+		return nil, err
+	}
+	if err == nil {
+		out = FromLValue(vm.Get(-1))
+	}
+	vm.SetTop(0)
+	//Put back to the pool
+	g.vmPool.Put(vm)
+	return out, err
+}
+
+func (g *LuaEngine) Stop() {
+}
+
+// call if timeout interrupt the Lua script execution
+func (g *LuaEngine) call(vm *lua.LState, f func() error) error {
+	if g.config.ScriptMaxExecutionTime <= 0 {
+		return f()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), g.config.ScriptMaxExecutionTime)
+	defer cancel()
+	vm.SetContext(ctx)
+	err := f()
+	vm.RemoveContext()
+	if err != nil && ctx.Err() != nil {
+		return ErrExecutionTimeout
+	}
+	return err
+}
+
+// openLibs 加载安全的标准库，不允许访问文件和执行命令
+func openLibs(vm *lua.LState) {
+	for _, lib := range []struct {
+		name string
+		open lua.LGFunction
+	}{
+		{lua.BaseLibName, lua.OpenBase},
+		{lua.TabLibName, lua.OpenTable},
+		{lua.StringLibName, lua.OpenString},
+		{lua.MathLibName, lua.OpenMath},
+		{lua.OsLibName, lua.OpenOs},
+	} {
+		vm.Push(vm.NewFunction(lib.open))
+		vm.Push(lua.LString(lib.name))
+		vm.Call(1, 0)
+	}
+	vm.SetGlobal("dofile", lua.LNil)
+	vm.SetGlobal("loadfile", lua.LNil)
+	if osLib, ok := vm.GetGlobal(lua.OsLibName).(*lua.LTable); ok {
+		safeOs := vm.NewTable()
+		for _, name := range []string{"clock", "date", "difftime", "time"} {
+			safeOs.RawSetString(name, osLib.RawGetString(name))
+		}
+		vm.SetGlobal(lua.OsLibName, safeOs)
+	}
+}
+
+// ToLValue converts a Go value to a Lua value.
+// Maps and structs are converted to tables, slices to array tables and functions to Lua functions.
+func ToLValue(vm *lua.LState, v interface{}) lua.LValue {
+	switch value := v.(type) {
+	case nil:
+		return lua.LNil
+	case lua.LValue:
+		return value
+	case *lua.FunctionProto:
+		return vm.NewFunctionFromProto(value)
+	case lua.LGFunction:
+		return vm.NewFunction(value)
+	case func(*lua.LState) int:
+		return vm.NewFunction(value)
+	case bool:
+		return lua.LBool(value)
+	case string:
+		return lua.LString(value)
+	case []byte:
+		return lua.LString(value)
+	case map[string]interface{}:
+		table := vm.CreateTable(0, len(value))
+		for k, item := range value {
+			table.RawSetString(k, ToLValue(vm, item))
+		}
+		return table
+	case map[string]string:
+		table := vm.CreateTable(0, len(value))
+		for k, item := range value {
+			table.RawSetString(k, lua.LString(item))
+		}
+		return table
+	case []interface{}:
+		table := vm.CreateTable(len(value), 0)
+		for _, item := range value {
+			table.Append(ToLValue(vm, item))
+		}
+		return table
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return lua.LNumber(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return lua.LNumber(rv.Uint())
+	case reflect.Float32, reflect.Float64:
+		return lua.LNumber(rv.Float())
+	case reflect.String:
+		return lua.LString(rv.String())
+	case reflect.Func:
+		return newGoFunction(vm, rv)
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return lua.LNil
+		}
+		return ToLValue(vm, rv.Elem().Interface())
+	case reflect.Slice, reflect.Array:
+		table := vm.CreateTable(rv.Len(), 0)
+		for i := 0; i < rv.Len(); i++ {
+			table.Append(ToLValue(vm, rv.Index(i).Interface()))
+		}
+		return table
+	case reflect.Map:
+		table := vm.CreateTable(0, rv.Len())
+		iter := rv.MapRange()
+		for iter.Next() {
+			table.RawSet(ToLValue(vm, iter.Key().Interface()), ToLValue(vm, iter.Value().Interface()))
+		}
+		return table
+	case reflect.Struct:
+		//结构体通过json转换成table
+		var data interface{}
+		if b, err := json.Marshal(v); err == nil && json.Unmarshal(b, &data) == nil {
+			return ToLValue(vm, data)
+		}
+	}
+	return lua.LString(fmt.Sprintf("%v", v))
+}
+
+// FromLValue converts a Lua value to a Go value.
+// Integral numbers are converted to int64, other numbers to float64.
+// Tables whose keys are 1..n are converted to []interface{}, other tables to map[string]interface{}.
+func FromLValue(v lua.LValue) interface{} {
+	switch value := v.(type) {
+	case *lua.LNilType:
+		return nil
+	case lua.LBool:
+		return bool(value)
+	case lua.LString:
+		return string(value)
+	case lua.LNumber:
+		f := float64(value)
+		if f == math.Trunc(f) && f >= math.MinInt64 && f <= math.MaxInt64 {
+			return int64(f)
+		}
+		return f
+	case *lua.LTable:
+		if n := value.MaxN(); n > 0 && tableLen(value) == n {
+			list := make([]interface{}, 0, n)
+			for i := 1; i <= n; i++ {
+				list = append(list, FromLValue(value.RawGetInt(i)))
+			}
+			return list
+		}
+		result := make(map[string]interface{})
+		value.ForEach(func(k lua.LValue, item lua.LValue) {
+			result[k.String()] = FromLValue(item)
+		})
+		return result
+	case *lua.LUserData:
+		return value.Value
+	default:
+		return v.String()
+	}
+}
+
+func tableLen(table *lua.LTable) int {
+	n := 0
+	table.ForEach(func(_ lua.LValue, _ lua.LValue) {
+		n++
+	})
+	return n
+}
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// newGoFunction 把Go函数转换成Lua函数，参数和返回值自动转换
+// 如果最后一个返回值是error并且不为nil，则抛出Lua错误
+func newGoFunction(vm *lua.LState, fn reflect.Value) *lua.LFunction {
+	fnType := fn.Type()
+	return vm.NewFunction(func(L *lua.LState) int {
+		top := L.GetTop()
+		numIn := fnType.NumIn()
+		var args []reflect.Value
+		for i := 0; i < numIn || (fnType.IsVariadic() && i < top); i++ {
+			var argType reflect.Type
+			if fnType.IsVariadic() && i >= numIn-1 {
+				if i >= top {
+					break
+				}
+				argType = fnType.In(numIn - 1).Elem()
+			} else {
+				argType = fnType.In(i)
+			}
+			arg, err := toGoArg(FromLValue(L.Get(i+1)), argType)
+			if err != nil {
+				L.RaiseError("bad argument #%d: %s", i+1, err.Error())
+				return 0
+			}
+			args = append(args, arg)
+		}
+		results := fn.Call(args)
+		if n := len(results); n > 0 && fnType.Out(n-1) == errorType {
+			if err, _ := results[n-1].Interface().(error); err != nil {
+				L.RaiseError("%s", err.Error())
+				return 0
+			}
+			results = results[:n-1]
+		}
+		for _, result := range results {
+			L.Push(ToLValue(L, result.Interface()))
+		}
+		return len(results)
+	})
+}
+
+// toGoArg 把Lua参数转换成Go函数参数类型
+func toGoArg(v interface{}, argType reflect.Type) (reflect.Value, error) {
+	if v == nil {
+		return reflect.Zero(argType), nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Type().AssignableTo(argType) {
+		return rv, nil
+	}
+	if isNumberKind(rv.Kind()) && isNumberKind(argType.Kind()) {
+		return rv.Convert(argType), nil
+	}
+	if argType.Kind() == reflect.String {
+		return reflect.ValueOf(fmt.Sprintf("%v", v)).Convert(argType), nil
+	}
+	if s, ok := v.(string); ok && isNumberKind(argType.Kind()) {
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return reflect.ValueOf(f).Convert(argType), nil
+		}
+	}
+	ptr := reflect.New(argType)
+	if err := maps.Map2Struct(v, ptr.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	return ptr.Elem(), nil
+}
+
+func isNumberKind(kind reflect.Kind) bool {
+	return kind >= reflect.Int && kind <= reflect.Float64
+}
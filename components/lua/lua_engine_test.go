@@ -0,0 +1,182 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package lua
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestLuaEngine(t *testing.T) {
+	var luaScript = `
+	function Filter(msg, metadata, msgType)
+		return msg == "aa"
+	end
+	function Transform(msg, metadata, msgType)
+		local out = {}
+		out.add = add(5, 3)
+		out.add2 = add2(5, 3)
+		out.upper = utils.upper(msgType)
+		out.items = {1, 2, 3}
+		out.name = vars.name
+		return out
+	end
+	function GetValue(msg, metadata, msgType)
+		return global.name
+	end
+	function CallGolangFunc(msg, metadata, msgType)
+		return handleMsg(msg, metadata, msgType)
+	end
+	function CallGolangErr(msg, metadata, msgType)
+		return divide(1, 0)
+	end
+	function Loop(msg, metadata, msgType)
+		while true do end
+	end
+	function UseOs(msg, metadata, msgType)
+		return os.execute == nil and io == nil and dofile == nil and os.time() > 0
+	end
+	`
+	config := types.NewConfig(types.WithScriptMaxExecutionTime(time.Millisecond * 200))
+	//注册全局配置参数
+	config.Properties.PutValue("name", "lala")
+	//注册Go函数，所有脚本类型可用
+	config.RegisterUdf("add", func(a, b int) int {
+		return a + b
+	})
+	config.RegisterUdf("handleMsg", func(msg map[string]string, metadata map[string]string, msgType string) map[string]string {
+		msg["returnFromGo"] = "returnFromGo"
+		msg["msgType"] = msgType
+		return msg
+	})
+	config.RegisterUdf("divide", func(a, b int) (int, error) {
+		if b == 0 {
+			return 0, errors.New("divide by zero")
+		}
+		return a / b, nil
+	})
+	//JS 脚本不会加载到 Lua 引擎
+	config.RegisterUdf("isNumberScript", `function isNumber(value){ return typeof value === "number"; }`)
+	config.RegisterUdf("utils", types.Script{
+		Type:    types.Js,
+		Content: `var utils={}`,
+	})
+	//注册 Lua 脚本
+	config.RegisterUdf("utils", types.Script{
+		Type: types.Lua,
+		Content: `utils = {}
+		function utils.upper(s)
+			return string.upper(s)
+		end`,
+	})
+	config.RegisterUdf("add2", types.Script{
+		Type: types.Lua,
+		Content: func(a, b float64) float64 {
+			return a + b
+		},
+	})
+	proto, err := Compile("add3", `function add3() return 9 end`)
+	assert.Nil(t, err)
+	config.RegisterUdf("add3", types.Script{
+		Type:    types.Lua,
+		Content: proto,
+	})
+
+	_, err = NewLuaEngine(config, "function Filter(", nil)
+	assert.NotNil(t, err)
+
+	luaEngine, err := NewLuaEngine(config, luaScript, map[string]interface{}{
+		types.Vars: map[string]interface{}{"name": "vars01"},
+	})
+	assert.Nil(t, err)
+	defer luaEngine.Stop()
+
+	var group sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			testExecuteLua(t, luaEngine)
+		}()
+	}
+	group.Wait()
+
+	t.Run("Timeout", func(t *testing.T) {
+		start := time.Now()
+		_, err := luaEngine.Execute("Loop", "aa", map[string]string{}, "aa")
+		assert.Equal(t, ErrExecutionTimeout, err)
+		assert.True(t, time.Since(start) < time.Second)
+		//超时后VM不再复用，仍然可以继续执行
+		response, err := luaEngine.Execute("Filter", "aa", map[string]string{}, "aa")
+		assert.Nil(t, err)
+		assert.Equal(t, true, response)
+	})
+}
+
+func testExecuteLua(t *testing.T, luaEngine *LuaEngine) {
+	metadata := map[string]string{
+		"aa": "test",
+	}
+	response, err := luaEngine.Execute("Filter", "aa", metadata, "aa")
+	assert.Nil(t, err)
+	assert.Equal(t, true, response)
+
+	response, err = luaEngine.Execute("Filter", "bb", metadata, "aa")
+	assert.Nil(t, err)
+	assert.Equal(t, false, response)
+
+	response, err = luaEngine.Execute("Transform", map[string]interface{}{"temperature": 41}, metadata, "msgType")
+	assert.Nil(t, err)
+	r := response.(map[string]interface{})
+	assert.Equal(t, int64(8), r["add"])
+	assert.Equal(t, int64(8), r["add2"])
+	assert.Equal(t, "MSGTYPE", r["upper"])
+	assert.Equal(t, []interface{}{int64(1), int64(2), int64(3)}, r["items"])
+	assert.Equal(t, "vars01", r["name"])
+
+	response, err = luaEngine.Execute("GetValue", "aa", metadata, "aa")
+	assert.Nil(t, err)
+	assert.Equal(t, "lala", response)
+
+	response, err = luaEngine.Execute("CallGolangFunc", metadata, metadata, "testMsgType")
+	assert.Nil(t, err)
+	r = response.(map[string]interface{})
+	assert.Equal(t, "returnFromGo", r["returnFromGo"])
+	assert.Equal(t, "testMsgType", r["msgType"])
+	assert.Equal(t, "test", r["aa"])
+
+	_, err = luaEngine.Execute("CallGolangErr", metadata, metadata, "aa")
+	assert.NotNil(t, err)
+
+	response, err = luaEngine.Execute("add3")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(9), response)
+
+	response, err = luaEngine.Execute("UseOs")
+	assert.Nil(t, err)
+	assert.Equal(t, true, response)
+
+	_, err = luaEngine.Execute("isNumber", 5)
+	assert.NotNil(t, err)
+	_, err = luaEngine.Execute("notExist", 5)
+	assert.Equal(t, "notExist is not a function", err.Error())
+}
@@ -76,6 +76,16 @@ type Config struct {
 	CAFile      string
 	CertFile    string
 	CertKeyFile string
+	//AutoAckDisabled 关闭QoS1/2消息的自动确认，由订阅处理器调用 paho.Message.Ack() 确认
+	//mqtt接收端点在规则链处理成功后才确认，未确认的消息在CleanSession=false时，broker会在重连后重新投递
+	AutoAckDisabled bool
+	//MaxRetries mqtt接收端点规则链处理失败后，本地重新处理的最大次数，0不重试
+	MaxRetries int
+	//RetryInterval mqtt接收端点本地重新处理的间隔，单位毫秒，默认1000
+	RetryInterval int
+	//TraceEnvelope MQTT 3.1.1 没有用户属性，开启后mqtt接收端点解析 trace.Envelope 负荷信封，
+	//把信封中的traceparent/tracestate写入消息元数据，并使用原始负荷作为消息数据
+	TraceEnvelope bool
 }
 
 // Client mqtt客户端
@@ -100,6 +110,7 @@ func NewClient(ctx context.Context, conf Config) (*Client, error) {
 	opts.SetUsername(conf.Username)
 	opts.SetPassword(conf.Password)
 	opts.SetCleanSession(conf.CleanSession)
+	opts.SetAutoAckDisabled(conf.AutoAckDisabled)
 	if conf.ClientID == "" {
 		//随机clientId
 		opts.SetClientID("rulego/" + string2.RandomStr(8))
@@ -0,0 +1,484 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/utils/json"
+)
+
+const (
+	// TransportStdio 通过插件进程的 stdin/stdout 通信
+	TransportStdio = "stdio"
+	// TransportUnix 通过 Unix socket 通信
+	TransportUnix = "unix"
+	// DefaultCallTimeout 默认握手、初始化和销毁的超时时间
+	DefaultCallTimeout = time.Second * 10
+	// DefaultMsgTimeout 默认处理单条消息的超时时间
+	DefaultMsgTimeout = time.Second * 30
+	// DefaultRestartInterval 默认插件进程退出后重启的间隔
+	DefaultRestartInterval = time.Second
+	// DefaultStableUptime 默认插件进程持续运行多久后重置重启次数
+	DefaultStableUptime = time.Minute
+)
+
+var socketSeq int64
+
+// Config 外部插件配置
+type Config struct {
+	// Command 插件可执行文件
+	Command string
+	// Args 插件启动参数
+	Args []string
+	// Env 追加的环境变量，格式：key=value
+	Env []string
+	// Transport 通信方式：stdio/unix，默认stdio
+	Transport string
+	// CallTimeout 握手、初始化和销毁的超时时间，默认10秒
+	CallTimeout time.Duration
+	// MsgTimeout 插件处理单条消息的超时时间，超时后节点走 Failure 分支，默认30秒
+	MsgTimeout time.Duration
+	// MaxRestarts 插件进程异常退出后最多重启次数，0:不限制，小于0:不重启
+	MaxRestarts int
+	// RestartInterval 重启间隔，默认1秒
+	RestartInterval time.Duration
+	// StableUptime 插件进程持续运行超过该时间后退出，重启次数重新计算，默认1分钟
+	StableUptime time.Duration
+	// Logger 记录插件 stderr 输出和重启日志
+	Logger types.Logger
+}
+
+// Client 宿主端的插件客户端，负责启动、监控插件进程以及调用插件组件
+type Client struct {
+	config Config
+	nextId uint64
+	lock   sync.Mutex
+	//当前连接，进程退出后到重启成功前为nil
+	conn  *connection
+	forms []types.ComponentForm
+	//已经初始化的节点实例，插件重启后重新初始化
+	instances map[string]*RemoteNode
+	closed    bool
+	restarts  int
+	done      chan struct{}
+}
+
+// connection 一个插件进程及其连接
+type connection struct {
+	cmd       *exec.Cmd
+	reader    io.Reader
+	writer    io.WriteCloser
+	writeLock sync.Mutex
+	lock      sync.Mutex
+	pending   map[uint64]func(*Frame, error)
+	exited    bool
+	done      chan struct{}
+	//握手成功的时间
+	startedAt time.Time
+}
+
+// Start 启动插件进程，握手并获取插件提供的组件
+func Start(config Config) (*Client, error) {
+	if config.Command == "" {
+		return nil, errors.New("command can not be empty")
+	}
+	if config.Transport == "" {
+		config.Transport = TransportStdio
+	}
+	if config.Transport != TransportStdio && config.Transport != TransportUnix {
+		return nil, fmt.Errorf("unsupported transport:%s", config.Transport)
+	}
+	if config.CallTimeout <= 0 {
+		config.CallTimeout = DefaultCallTimeout
+	}
+	if config.MsgTimeout <= 0 {
+		config.MsgTimeout = DefaultMsgTimeout
+	}
+	if config.RestartInterval <= 0 {
+		config.RestartInterval = DefaultRestartInterval
+	}
+	if config.StableUptime <= 0 {
+		config.StableUptime = DefaultStableUptime
+	}
+	if config.Logger == nil {
+		config.Logger = types.DefaultLogger()
+	}
+	c := &Client{config: config, instances: make(map[string]*RemoteNode), done: make(chan struct{})}
+	conn, forms, err := c.start()
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	c.forms = forms
+	go c.supervise(conn)
+	return c, nil
+}
+
+// Components 插件提供的组件，可以注册到组件注册器
+func (c *Client) Components() []types.Node {
+	var nodes []types.Node
+	for _, form := range c.forms {
+		nodes = append(nodes, &RemoteNode{client: c, form: form})
+	}
+	return nodes
+}
+
+// Close 关闭插件进程，不再重启
+func (c *Client) Close() error {
+	c.lock.Lock()
+	if c.closed {
+		c.lock.Unlock()
+		return nil
+	}
+	c.closed = true
+	close(c.done)
+	conn := c.conn
+	c.conn = nil
+	c.lock.Unlock()
+	if conn != nil {
+		conn.stop(c.config.CallTimeout)
+	}
+	return nil
+}
+
+// start 启动插件进程并握手
+func (c *Client) start() (*connection, []types.ComponentForm, error) {
+	cmd := exec.Command(c.config.Command, c.config.Args...)
+	cmd.Env = append(os.Environ(), c.config.Env...)
+	cmd.Stderr = &logWriter{logger: c.config.Logger, prefix: filepath.Base(c.config.Command)}
+	conn := &connection{cmd: cmd, pending: make(map[uint64]func(*Frame, error)), done: make(chan struct{})}
+
+	if c.config.Transport == TransportUnix {
+		path := filepath.Join(os.TempDir(), fmt.Sprintf("rulego-plugin-%d-%d.sock", os.Getpid(), atomic.AddInt64(&socketSeq, 1)))
+		listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+		if err != nil {
+			return nil, nil, err
+		}
+		defer listener.Close()
+		cmd.Env = append(cmd.Env, SocketEnv+"="+path)
+		if err = cmd.Start(); err != nil {
+			return nil, nil, err
+		}
+		_ = listener.SetDeadline(time.Now().Add(c.config.CallTimeout))
+		socket, err := listener.Accept()
+		if err != nil {
+			_ = cmd.Process.Kill()
+			_ = cmd.Wait()
+			return nil, nil, err
+		}
+		conn.reader = socket
+		conn.writer = socket
+	} else {
+		stdin, err := cmd.StdinPipe()
+		if err != nil {
+			return nil, nil, err
+		}
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return nil, nil, err
+		}
+		if err = cmd.Start(); err != nil {
+			return nil, nil, err
+		}
+		conn.reader = stdout
+		conn.writer = stdin
+	}
+	go conn.readLoop()
+
+	frame, err := c.call(conn, MethodHandshake, HandshakeRequest{Version: ProtocolVersion})
+	var res HandshakeResponse
+	if err == nil {
+		err = json.Unmarshal(frame.Payload, &res)
+	}
+	if err == nil && res.Version != ProtocolVersion {
+		err = fmt.Errorf("%w: host=%d plugin=%d", ErrVersionMismatch, ProtocolVersion, res.Version)
+	}
+	if err != nil {
+		conn.stop(c.config.CallTimeout)
+		return nil, nil, err
+	}
+	conn.startedAt = time.Now()
+	return conn, res.Components, nil
+}
+
+// supervise 插件进程异常退出后重启，并重新初始化节点实例
+func (c *Client) supervise(conn *connection) {
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-conn.done:
+		}
+		c.lock.Lock()
+		if c.closed {
+			c.lock.Unlock()
+			return
+		}
+		c.conn = nil
+		//稳定运行一段时间后才退出，重新计算重启次数
+		if time.Since(conn.startedAt) >= c.config.StableUptime {
+			c.restarts = 0
+		}
+		c.lock.Unlock()
+		c.config.Logger.Printf("plugin %s exited", c.config.Command)
+
+		conn = c.restart()
+		if conn == nil {
+			return
+		}
+	}
+}
+
+func (c *Client) restart() *connection {
+	for {
+		c.lock.Lock()
+		if c.config.MaxRestarts < 0 || (c.config.MaxRestarts > 0 && c.restarts >= c.config.MaxRestarts) {
+			c.lock.Unlock()
+			c.config.Logger.Printf("plugin %s exceeded max restarts, giving up", c.config.Command)
+			return nil
+		}
+		c.restarts++
+		c.lock.Unlock()
+
+		select {
+		case <-c.done:
+			return nil
+		case <-time.After(c.config.RestartInterval):
+		}
+		conn, _, err := c.start()
+		if err != nil {
+			c.config.Logger.Printf("plugin %s restart error:%s", c.config.Command, err.Error())
+			continue
+		}
+		c.lock.Lock()
+		if c.closed {
+			c.lock.Unlock()
+			conn.stop(c.config.CallTimeout)
+			return nil
+		}
+		c.conn = conn
+		var instances []*RemoteNode
+		for _, node := range c.instances {
+			instances = append(instances, node)
+		}
+		c.lock.Unlock()
+		for _, node := range instances {
+			if _, err := c.call(conn, MethodInit, node.initRequest()); err != nil {
+				c.config.Logger.Printf("plugin %s reinit node %s error:%s", c.config.Command, node.instanceId, err.Error())
+			}
+		}
+		c.config.Logger.Printf("plugin %s restarted", c.config.Command)
+		return conn
+	}
+}
+
+func (c *Client) current() (*connection, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return nil, ErrPluginClosed
+	}
+	if c.conn == nil {
+		return nil, ErrPluginExited
+	}
+	return c.conn, nil
+}
+
+func (c *Client) initInstance(node *RemoteNode) error {
+	conn, err := c.current()
+	if err != nil {
+		return err
+	}
+	if _, err = c.call(conn, MethodInit, node.initRequest()); err != nil {
+		return err
+	}
+	c.lock.Lock()
+	c.instances[node.instanceId] = node
+	c.lock.Unlock()
+	return nil
+}
+
+func (c *Client) destroyInstance(node *RemoteNode) {
+	c.lock.Lock()
+	delete(c.instances, node.instanceId)
+	c.lock.Unlock()
+	if conn, err := c.current(); err == nil {
+		_, _ = c.call(conn, MethodDestroy, DestroyRequest{InstanceId: node.instanceId})
+	}
+}
+
+func (c *Client) onMsg(instanceId string, msg types.RuleMsg, callback func(*Frame, error)) {
+	conn, err := c.current()
+	if err != nil {
+		callback(nil, err)
+		return
+	}
+	var lock sync.Mutex
+	var timer *time.Timer
+	var finished bool
+	id := c.send(conn, MethodOnMsg, OnMsgRequest{InstanceId: instanceId, Msg: msg}, func(frame *Frame, err error) {
+		lock.Lock()
+		finished = true
+		if timer != nil {
+			timer.Stop()
+		}
+		lock.Unlock()
+		callback(frame, err)
+	})
+	lock.Lock()
+	defer lock.Unlock()
+	if finished {
+		return
+	}
+	//超时移除等待的回调，回调由 remove 保证只会被调用一次
+	timer = time.AfterFunc(c.config.MsgTimeout, func() {
+		if conn.remove(id) != nil {
+			callback(nil, ErrMsgTimeout)
+		}
+	})
+}
+
+// call 同步调用
+func (c *Client) call(conn *connection, method string, payload interface{}) (*Frame, error) {
+	type result struct {
+		frame *Frame
+		err   error
+	}
+	ch := make(chan result, 1)
+	id := c.send(conn, method, payload, func(frame *Frame, err error) {
+		ch <- result{frame: frame, err: err}
+	})
+	select {
+	case r := <-ch:
+		return r.frame, r.err
+	case <-time.After(c.config.CallTimeout):
+		conn.remove(id)
+		return nil, fmt.Errorf("plugin call %s timeout", method)
+	}
+}
+
+// send 发送请求，收到响应、出错或者进程退出时调用 callback
+func (c *Client) send(conn *connection, method string, payload interface{}, callback func(*Frame, error)) uint64 {
+	id := atomic.AddUint64(&c.nextId, 1)
+	data, err := json.Marshal(payload)
+	if err != nil {
+		callback(nil, err)
+		return id
+	}
+	if !conn.add(id, callback) {
+		callback(nil, ErrPluginExited)
+		return id
+	}
+	conn.writeLock.Lock()
+	err = WriteFrame(conn.writer, &Frame{Id: id, Method: method, Payload: data})
+	conn.writeLock.Unlock()
+	if err != nil && conn.remove(id) != nil {
+		callback(nil, err)
+	}
+	return id
+}
+
+func (conn *connection) add(id uint64, callback func(*Frame, error)) bool {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	if conn.exited {
+		return false
+	}
+	conn.pending[id] = callback
+	return true
+}
+
+func (conn *connection) remove(id uint64) func(*Frame, error) {
+	conn.lock.Lock()
+	defer conn.lock.Unlock()
+	callback := conn.pending[id]
+	delete(conn.pending, id)
+	return callback
+}
+
+func (conn *connection) readLoop() {
+	for {
+		frame, err := ReadFrame(conn.reader)
+		if err != nil {
+			break
+		}
+		if !frame.Reply {
+			continue
+		}
+		if callback := conn.remove(frame.Id); callback != nil {
+			if frame.Error != "" {
+				callback(frame, errors.New(frame.Error))
+			} else {
+				callback(frame, nil)
+			}
+		}
+	}
+	conn.lock.Lock()
+	conn.exited = true
+	pending := conn.pending
+	conn.pending = make(map[uint64]func(*Frame, error))
+	conn.lock.Unlock()
+	for _, callback := range pending {
+		callback(nil, ErrPluginExited)
+	}
+	_ = conn.writer.Close()
+	_ = conn.cmd.Wait()
+	close(conn.done)
+}
+
+// stop 关闭连接，插件进程在超时时间内没有退出则强制结束
+func (conn *connection) stop(timeout time.Duration) {
+	_ = conn.writer.Close()
+	select {
+	case <-conn.done:
+	case <-time.After(timeout):
+		_ = conn.cmd.Process.Kill()
+		<-conn.done
+	}
+}
+
+// logWriter 把插件进程的 stderr 按行写入日志
+type logWriter struct {
+	logger types.Logger
+	prefix string
+	buf    []byte
+}
+
+func (w *logWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.logger.Printf("plugin [%s] %s", w.prefix, string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
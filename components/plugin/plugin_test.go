@@ -0,0 +1,323 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/utils/maps"
+)
+
+const helperEnv = "RULEGO_PLUGIN_HELPER"
+
+// TestHelperPlugin 测试用的插件进程，由测试通过 os.Args[0] 启动
+func TestHelperPlugin(t *testing.T) {
+	if os.Getenv(helperEnv) != "1" {
+		return
+	}
+	_ = Serve(&upperNode{}, &crashNode{})
+	os.Exit(0)
+}
+
+func helperConfig(transport string) Config {
+	return Config{
+		Command:         os.Args[0],
+		Args:            []string{"-test.run=TestHelperPlugin"},
+		Env:             []string{helperEnv + "=1"},
+		Transport:       transport,
+		RestartInterval: time.Millisecond * 100,
+	}
+}
+
+func TestPlugin(t *testing.T) {
+	for _, transport := range []string{TransportStdio, TransportUnix} {
+		t.Run(transport, func(t *testing.T) {
+			client, err := Start(helperConfig(transport))
+			assert.Nil(t, err)
+			defer client.Close()
+
+			components := client.Components()
+			assert.Equal(t, 2, len(components))
+			var upper, crash types.Node
+			for _, component := range components {
+				if component.Type() == "test/upper" {
+					upper = component
+				} else if component.Type() == "test/crash" {
+					crash = component
+				}
+			}
+			assert.NotNil(t, upper)
+			assert.NotNil(t, crash)
+			form := upper.(types.ComponentDefGetter).Def()
+			field, ok := form.Fields.GetField("prefix")
+			assert.True(t, ok)
+			assert.Equal(t, "string", field.Type)
+
+			node := upper.New()
+			err = node.Init(types.NewConfig(), types.Configuration{"prefix": "plugin:"})
+			assert.Nil(t, err)
+			defer node.Destroy()
+
+			err = crash.New().Init(types.NewConfig(), types.Configuration{"fail": true})
+			assert.Equal(t, "init failed", err.Error())
+
+			metaData := types.NewMetadata()
+			var msgList = []test.Msg{
+				{
+					MetaData:   metaData,
+					MsgType:    "TEST",
+					Data:       "aa",
+					AfterSleep: time.Millisecond * 100,
+				},
+				{
+					MetaData:   metaData,
+					MsgType:    "ERROR",
+					Data:       "aa",
+					AfterSleep: time.Millisecond * 100,
+				},
+			}
+			test.NodeOnMsg(t, node, msgList, func(msg types.RuleMsg, relationType string, err error) {
+				if msg.Type == "ERROR" {
+					assert.Equal(t, types.Failure, relationType)
+					assert.Equal(t, "error msg", err.Error())
+				} else {
+					assert.Equal(t, types.Success, relationType)
+					assert.Equal(t, "plugin:AA", msg.Data)
+					assert.Equal(t, "true", msg.Metadata.GetValue("fromPlugin"))
+				}
+			})
+		})
+	}
+}
+
+func TestPluginRestart(t *testing.T) {
+	client, err := Start(helperConfig(TransportStdio))
+	assert.Nil(t, err)
+	defer client.Close()
+
+	var upper, crash types.Node
+	for _, component := range client.Components() {
+		if component.Type() == "test/upper" {
+			upper = component.New()
+		} else {
+			crash = component.New()
+		}
+	}
+	assert.Nil(t, upper.Init(types.NewConfig(), types.Configuration{"prefix": "p:"}))
+	assert.Nil(t, crash.Init(types.NewConfig(), types.Configuration{}))
+
+	var group sync.WaitGroup
+	group.Add(1)
+	ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+		assert.Equal(t, types.Failure, relationType)
+		assert.True(t, errors.Is(err, ErrPluginExited))
+		group.Done()
+	})
+	crash.OnMsg(ctx, types.NewMsg(0, "CRASH", types.TEXT, types.NewMetadata(), "aa"))
+	group.Wait()
+
+	//等待重启完成，节点实例重新初始化
+	var result string
+	for i := 0; i < 50 && result == ""; i++ {
+		time.Sleep(time.Millisecond * 100)
+		group.Add(1)
+		upper.OnMsg(test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+			if relationType == types.Success {
+				result = msg.Data
+			}
+			group.Done()
+		}), types.NewMsg(0, "TEST", types.TEXT, types.NewMetadata(), "bb"))
+		group.Wait()
+	}
+	assert.Equal(t, "p:BB", result)
+
+	assert.Nil(t, client.Close())
+	group.Add(1)
+	upper.OnMsg(test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+		assert.Equal(t, ErrPluginClosed, err)
+		group.Done()
+	}), types.NewMsg(0, "TEST", types.TEXT, types.NewMetadata(), "bb"))
+	group.Wait()
+}
+
+func TestPluginRestartCounterReset(t *testing.T) {
+	config := helperConfig(TransportStdio)
+	config.MaxRestarts = 1
+	config.RestartInterval = time.Millisecond * 10
+	config.StableUptime = time.Millisecond * 300
+	client, err := Start(config)
+	assert.Nil(t, err)
+	defer client.Close()
+
+	var crash types.Node
+	for _, component := range client.Components() {
+		if component.Type() == "test/crash" {
+			crash = component.New()
+		}
+	}
+	assert.Nil(t, crash.Init(types.NewConfig(), types.Configuration{}))
+
+	var group sync.WaitGroup
+	//退出并等待重启完成，返回是否重启
+	crashAndRestart := func() bool {
+		before, err := client.current()
+		assert.Nil(t, err)
+		group.Add(1)
+		crash.OnMsg(test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+			group.Done()
+		}), types.NewMsg(0, "CRASH", types.TEXT, types.NewMetadata(), "aa"))
+		group.Wait()
+		for i := 0; i < 50; i++ {
+			if conn, err := client.current(); err == nil && conn != before {
+				return true
+			}
+			time.Sleep(time.Millisecond * 20)
+		}
+		return false
+	}
+
+	//每次稳定运行后退出，重启次数重新计算，不会超过最大重启次数
+	for i := 0; i < 2; i++ {
+		time.Sleep(config.StableUptime)
+		assert.True(t, crashAndRestart())
+	}
+
+	//重启后很快退出，超过最大重启次数，不再重启
+	assert.False(t, crashAndRestart())
+}
+
+func TestPluginMsgTimeout(t *testing.T) {
+	config := helperConfig(TransportStdio)
+	config.MsgTimeout = time.Millisecond * 200
+	client, err := Start(config)
+	assert.Nil(t, err)
+	defer client.Close()
+
+	var crash types.Node
+	for _, component := range client.Components() {
+		if component.Type() == "test/crash" {
+			crash = component.New()
+		}
+	}
+	assert.Nil(t, crash.Init(types.NewConfig(), types.Configuration{}))
+
+	var count int32
+	var group sync.WaitGroup
+	group.Add(1)
+	crash.OnMsg(test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+		atomic.AddInt32(&count, 1)
+		assert.Equal(t, types.Failure, relationType)
+		assert.Equal(t, ErrMsgTimeout, err)
+		group.Done()
+	}), types.NewMsg(0, "SLOW", types.TEXT, types.NewMetadata(), "aa"))
+	group.Wait()
+
+	//插件迟到的响应被丢弃，不会再次回调
+	time.Sleep(time.Second)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&count))
+
+	group.Add(1)
+	crash.OnMsg(test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+		assert.Equal(t, types.Success, relationType)
+		group.Done()
+	}), types.NewMsg(0, "TEST", types.TEXT, types.NewMetadata(), "aa"))
+	group.Wait()
+}
+
+func TestPluginStartError(t *testing.T) {
+	_, err := Start(Config{})
+	assert.NotNil(t, err)
+	_, err = Start(Config{Command: "./not_found_plugin"})
+	assert.NotNil(t, err)
+	_, err = Start(Config{Command: os.Args[0], Transport: "tcp"})
+	assert.NotNil(t, err)
+}
+
+//以下是插件进程内的测试组件
+
+type upperNodeConfiguration struct {
+	Prefix string
+}
+
+type upperNode struct {
+	Config upperNodeConfiguration
+}
+
+func (x *upperNode) Type() string {
+	return "test/upper"
+}
+
+func (x *upperNode) New() types.Node {
+	return &upperNode{}
+}
+
+func (x *upperNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	return maps.Map2Struct(configuration, &x.Config)
+}
+
+func (x *upperNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	if msg.Type == "ERROR" {
+		ctx.TellFailure(msg, errors.New("error msg"))
+		return
+	}
+	msg.Data = x.Config.Prefix + strings.ToUpper(msg.Data)
+	msg.Metadata.PutValue("fromPlugin", "true")
+	ctx.TellSuccess(msg)
+}
+
+func (x *upperNode) Destroy() {
+}
+
+type crashNode struct {
+}
+
+func (x *crashNode) Type() string {
+	return "test/crash"
+}
+
+func (x *crashNode) New() types.Node {
+	return &crashNode{}
+}
+
+func (x *crashNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	if configuration["fail"] == true {
+		return errors.New("init failed")
+	}
+	return nil
+}
+
+func (x *crashNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	if msg.Type == "CRASH" {
+		os.Exit(2)
+	}
+	if msg.Type == "SLOW" {
+		time.Sleep(time.Second)
+	}
+	ctx.TellSuccess(msg)
+}
+
+func (x *crashNode) Destroy() {
+}
@@ -0,0 +1,176 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package plugin provides out-of-process component plugins for the RuleGo rule engine.
+//
+// Unlike Go plugins loaded by RuleComponentRegistry.RegisterPlugin, an external plugin is a
+// standalone executable launched as a subprocess. The host and the plugin speak a versioned,
+// length-prefixed JSON protocol over the plugin's stdio or over a Unix socket, so a crashing
+// or mismatched plugin cannot bring down the host and can be stopped when it is unregistered.
+//
+// Plugin side, build an executable that serves its components:
+//
+//	func main() {
+//		plugin.Serve(&UpperNode{}, &TimeNode{})
+//	}
+//
+// Host side, register the executable:
+//
+//	rulego.Registry.RegisterExternalPlugin("test", plugin.Config{Command: "./my-plugin"})
+//
+// Protocol:
+//
+// Each frame is a 4-byte big-endian length followed by a JSON encoded Frame. The host first sends
+// a handshake with ProtocolVersion, the plugin answers with its version and the ComponentForm of
+// every component it provides. Then the host calls init/onMsg/destroy for each remote node instance.
+// The reply of onMsg carries the message and relation types the remote component passed to
+// TellSuccess/TellFailure/TellNext.
+//
+// The host supervises the subprocess: when it exits unexpectedly, in-flight messages are sent to
+// the Failure relation, the plugin is restarted and all live node instances are initialized again.
+package plugin
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+const (
+	// ProtocolVersion 插件协议版本，握手时版本不一致则拒绝加载
+	ProtocolVersion = 1
+	// MaxFrameSize 单帧最大长度
+	MaxFrameSize = 64 * 1024 * 1024
+	// SocketEnv 使用 Unix socket 通信时，通过该环境变量把 socket 路径传给插件进程
+	SocketEnv = "RULEGO_PLUGIN_SOCKET"
+)
+
+const (
+	// MethodHandshake 握手，获取插件提供的组件列表
+	MethodHandshake = "handshake"
+	// MethodInit 初始化节点实例
+	MethodInit = "init"
+	// MethodOnMsg 节点实例处理消息
+	MethodOnMsg = "onMsg"
+	// MethodDestroy 销毁节点实例
+	MethodDestroy = "destroy"
+)
+
+var (
+	// ErrFrameTooLarge 帧长度超过 MaxFrameSize
+	ErrFrameTooLarge = errors.New("plugin frame too large")
+	// ErrVersionMismatch 插件协议版本不一致
+	ErrVersionMismatch = errors.New("plugin protocol version mismatch")
+	// ErrPluginExited 插件进程已退出
+	ErrPluginExited = errors.New("plugin process exited")
+	// ErrPluginClosed 插件已经关闭
+	ErrPluginClosed = errors.New("plugin closed")
+	// ErrMsgTimeout 插件处理消息超时
+	ErrMsgTimeout = errors.New("plugin message timeout")
+)
+
+// Frame 协议帧，请求和响应使用相同的Id关联
+type Frame struct {
+	//Id 请求ID
+	Id uint64 `json:"id"`
+	//Method 请求方法，响应为空
+	Method string `json:"method,omitempty"`
+	//Reply 是否是响应
+	Reply bool `json:"reply,omitempty"`
+	//Error 响应错误
+	Error string `json:"error,omitempty"`
+	//Payload 请求或者响应内容
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// HandshakeRequest 握手请求
+type HandshakeRequest struct {
+	Version int `json:"version"`
+}
+
+// HandshakeResponse 握手响应
+type HandshakeResponse struct {
+	Version int `json:"version"`
+	//Components 插件提供的组件表单
+	Components []types.ComponentForm `json:"components"`
+}
+
+// InitRequest 初始化节点实例请求
+type InitRequest struct {
+	InstanceId    string              `json:"instanceId"`
+	Type          string              `json:"type"`
+	Configuration types.Configuration `json:"configuration"`
+}
+
+// OnMsgRequest 处理消息请求
+type OnMsgRequest struct {
+	InstanceId string        `json:"instanceId"`
+	Msg        types.RuleMsg `json:"msg"`
+}
+
+// OnMsgResponse 处理消息响应，组件调用 TellSuccess/TellFailure/TellNext 的结果
+type OnMsgResponse struct {
+	Msg           types.RuleMsg `json:"msg"`
+	RelationTypes []string      `json:"relationTypes"`
+	//Error 组件调用 TellFailure 的错误
+	Error string `json:"error,omitempty"`
+}
+
+// DestroyRequest 销毁节点实例请求
+type DestroyRequest struct {
+	InstanceId string `json:"instanceId"`
+}
+
+// WriteFrame 写入一帧
+func WriteFrame(w io.Writer, frame *Frame) error {
+	data, err := json.Marshal(frame)
+	if err != nil {
+		return err
+	}
+	if len(data) > MaxFrameSize {
+		return ErrFrameTooLarge
+	}
+	buf := make([]byte, 4+len(data))
+	binary.BigEndian.PutUint32(buf, uint32(len(data)))
+	copy(buf[4:], data)
+	_, err = w.Write(buf)
+	return err
+}
+
+// ReadFrame 读取一帧
+func ReadFrame(r io.Reader) (*Frame, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+	size := binary.BigEndian.Uint32(header[:])
+	if size > MaxFrameSize {
+		return nil, ErrFrameTooLarge
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	frame := &Frame{}
+	if err := json.Unmarshal(data, frame); err != nil {
+		return nil, fmt.Errorf("invalid plugin frame: %w", err)
+	}
+	return frame, nil
+}
@@ -0,0 +1,89 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"errors"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/utils/json"
+)
+
+// RemoteNode 宿主端的代理节点，Init/OnMsg/Destroy 转发给插件进程内的组件执行
+// 组件类型和表单使用插件握手时提供的 ComponentForm
+type RemoteNode struct {
+	client *Client
+	form   types.ComponentForm
+	//instanceId 插件进程内的节点实例ID
+	instanceId    string
+	configuration types.Configuration
+}
+
+// Type 组件类型
+func (x *RemoteNode) Type() string {
+	return x.form.Type
+}
+
+func (x *RemoteNode) New() types.Node {
+	return &RemoteNode{client: x.client, form: x.form}
+}
+
+// Def 插件提供的组件表单
+func (x *RemoteNode) Def() types.ComponentForm {
+	return x.form
+}
+
+// Init 初始化
+func (x *RemoteNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	id, err := uuid.NewV4()
+	if err != nil {
+		return err
+	}
+	x.instanceId = id.String()
+	x.configuration = configuration
+	return x.client.initInstance(x)
+}
+
+// OnMsg 处理消息，插件进程退出或者调用失败发送到`Failure`链
+func (x *RemoteNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	x.client.onMsg(x.instanceId, msg, func(frame *Frame, err error) {
+		if err != nil {
+			ctx.TellFailure(msg, err)
+			return
+		}
+		var res OnMsgResponse
+		if err = json.Unmarshal(frame.Payload, &res); err != nil {
+			ctx.TellFailure(msg, err)
+		} else if res.Error != "" {
+			ctx.TellFailure(res.Msg, errors.New(res.Error))
+		} else {
+			ctx.TellNext(res.Msg, res.RelationTypes...)
+		}
+	})
+}
+
+// Destroy 销毁
+func (x *RemoteNode) Destroy() {
+	if x.instanceId != "" {
+		x.client.destroyInstance(x)
+	}
+}
+
+func (x *RemoteNode) initRequest() InitRequest {
+	return InitRequest{InstanceId: x.instanceId, Type: x.form.Type, Configuration: x.configuration}
+}
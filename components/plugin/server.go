@@ -0,0 +1,352 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/utils/json"
+	"github.com/rulego/rulego/utils/reflect"
+)
+
+// ErrNotSupported 插件进程内不支持的 RuleContext 方法
+var ErrNotSupported = errors.New("not supported in plugin process")
+
+// Serve 插件进程入口，提供组件给宿主调用，直到宿主关闭连接
+// 如果设置了 SocketEnv 环境变量，通过 Unix socket 通信，否则通过 stdin/stdout 通信。
+// 使用 stdio 时 os.Stdout 会被替换成 os.Stderr，防止组件的输出破坏协议数据
+func Serve(components ...types.Node) error {
+	if path := os.Getenv(SocketEnv); path != "" {
+		conn, err := net.Dial("unix", path)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		return ServeConn(conn, components...)
+	}
+	out := os.Stdout
+	os.Stdout = os.Stderr
+	return ServeConn(&stdio{Reader: os.Stdin, Writer: out}, components...)
+}
+
+// ServeConn 通过指定的连接提供组件
+func ServeConn(conn io.ReadWriter, components ...types.Node) error {
+	s := &server{
+		conn:       conn,
+		config:     types.NewConfig(),
+		components: make(map[string]types.Node),
+		instances:  make(map[string]types.Node),
+	}
+	for _, component := range components {
+		s.components[component.Type()] = component
+		s.forms = append(s.forms, reflect.GetComponentForm(component.New()))
+	}
+	defer s.destroyAll()
+	for {
+		frame, err := ReadFrame(conn)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		go s.handle(frame)
+	}
+}
+
+type stdio struct {
+	io.Reader
+	io.Writer
+}
+
+// server 插件进程内的服务端
+type server struct {
+	conn       io.ReadWriter
+	writeLock  sync.Mutex
+	config     types.Config
+	components map[string]types.Node
+	forms      []types.ComponentForm
+	lock       sync.RWMutex
+	//节点实例，key:实例ID
+	instances map[string]types.Node
+}
+
+func (s *server) handle(frame *Frame) {
+	var result interface{}
+	var err error
+	switch frame.Method {
+	case MethodHandshake:
+		result, err = s.handshake(frame.Payload)
+	case MethodInit:
+		err = s.init(frame.Payload)
+	case MethodOnMsg:
+		//由 remoteContext 响应
+		if err = s.onMsg(frame.Id, frame.Payload); err == nil {
+			return
+		}
+	case MethodDestroy:
+		err = s.destroy(frame.Payload)
+	default:
+		err = fmt.Errorf("unknown method:%s", frame.Method)
+	}
+	s.reply(frame.Id, result, err)
+}
+
+func (s *server) handshake(payload []byte) (interface{}, error) {
+	var req HandshakeRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return nil, err
+	}
+	if req.Version != ProtocolVersion {
+		return nil, fmt.Errorf("%w: host=%d plugin=%d", ErrVersionMismatch, req.Version, ProtocolVersion)
+	}
+	return HandshakeResponse{Version: ProtocolVersion, Components: s.forms}, nil
+}
+
+func (s *server) init(payload []byte) error {
+	var req InitRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return err
+	}
+	component, ok := s.components[req.Type]
+	if !ok {
+		return fmt.Errorf("component not found. componentType=%s", req.Type)
+	}
+	node := component.New()
+	if err := node.Init(s.config, req.Configuration); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	old := s.instances[req.InstanceId]
+	s.instances[req.InstanceId] = node
+	s.lock.Unlock()
+	if old != nil {
+		old.Destroy()
+	}
+	return nil
+}
+
+func (s *server) onMsg(id uint64, payload []byte) error {
+	var req OnMsgRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return err
+	}
+	s.lock.RLock()
+	node, ok := s.instances[req.InstanceId]
+	s.lock.RUnlock()
+	if !ok {
+		return fmt.Errorf("node instance not found. instanceId=%s", req.InstanceId)
+	}
+	node.OnMsg(&remoteContext{server: s, id: id, self: node, context: context.Background()}, req.Msg)
+	return nil
+}
+
+func (s *server) destroy(payload []byte) error {
+	var req DestroyRequest
+	if err := json.Unmarshal(payload, &req); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	node, ok := s.instances[req.InstanceId]
+	delete(s.instances, req.InstanceId)
+	s.lock.Unlock()
+	if ok {
+		node.Destroy()
+	}
+	return nil
+}
+
+func (s *server) destroyAll() {
+	s.lock.Lock()
+	instances := s.instances
+	s.instances = make(map[string]types.Node)
+	s.lock.Unlock()
+	for _, node := range instances {
+		node.Destroy()
+	}
+}
+
+func (s *server) reply(id uint64, result interface{}, err error) {
+	frame := &Frame{Id: id, Reply: true}
+	if err != nil {
+		frame.Error = err.Error()
+	} else if result != nil {
+		if frame.Payload, err = json.Marshal(result); err != nil {
+			frame.Error = err.Error()
+		}
+	}
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+	if err = WriteFrame(s.conn, frame); err != nil {
+		s.config.Logger.Printf("plugin reply error:%s", err.Error())
+	}
+}
+
+// remoteContext 插件进程内的 RuleContext，把组件第一次调用 Tell* 的结果作为 onMsg 的响应返回给宿主
+// 不支持调用子规则链、节点等依赖宿主规则引擎的方法
+type remoteContext struct {
+	server  *server
+	id      uint64
+	self    types.Node
+	once    sync.Once
+	context context.Context
+	endFunc types.OnEndFunc
+}
+
+func (ctx *remoteContext) tell(msg types.RuleMsg, err error, relationTypes ...string) {
+	replied := false
+	ctx.once.Do(func() {
+		replied = true
+		res := OnMsgResponse{Msg: msg, RelationTypes: relationTypes}
+		if err != nil {
+			res.Error = err.Error()
+		}
+		ctx.server.reply(ctx.id, res, nil)
+	})
+	if !replied {
+		ctx.server.config.Logger.Printf("plugin node tell more than once, ignored. msgId=%s", msg.Id)
+	}
+}
+
+func (ctx *remoteContext) TellSuccess(msg types.RuleMsg) {
+	ctx.tell(msg, nil, types.Success)
+}
+
+func (ctx *remoteContext) TellFailure(msg types.RuleMsg, err error) {
+	ctx.tell(msg, err, types.Failure)
+}
+
+func (ctx *remoteContext) TellNext(msg types.RuleMsg, relationTypes ...string) {
+	ctx.tell(msg, nil, relationTypes...)
+}
+
+func (ctx *remoteContext) TellSelf(msg types.RuleMsg, delayMs int64) {
+	time.AfterFunc(time.Millisecond*time.Duration(delayMs), func() {
+		ctx.self.OnMsg(ctx, msg)
+	})
+}
+
+func (ctx *remoteContext) TellNextOrElse(msg types.RuleMsg, defaultRelationType string, relationTypes ...string) {
+	ctx.tell(msg, nil, relationTypes...)
+}
+
+func (ctx *remoteContext) TellFlow(_ context.Context, _ string, msg types.RuleMsg, endFunc types.OnEndFunc, onAllNodeCompleted func()) {
+	ctx.notSupported(msg, endFunc, onAllNodeCompleted)
+}
+
+func (ctx *remoteContext) TellNode(_ context.Context, _ string, msg types.RuleMsg, _ bool, onEnd types.OnEndFunc, onAllNodeCompleted func()) {
+	ctx.notSupported(msg, onEnd, onAllNodeCompleted)
+}
+
+func (ctx *remoteContext) TellChainNode(_ context.Context, _, _ string, msg types.RuleMsg, _ bool, onEnd types.OnEndFunc, onAllNodeCompleted func()) {
+	ctx.notSupported(msg, onEnd, onAllNodeCompleted)
+}
+
+func (ctx *remoteContext) notSupported(msg types.RuleMsg, onEnd types.OnEndFunc, onAllNodeCompleted func()) {
+	if onEnd != nil {
+		onEnd(ctx, msg, ErrNotSupported, types.Failure)
+	}
+	if onAllNodeCompleted != nil {
+		onAllNodeCompleted()
+	}
+}
+
+func (ctx *remoteContext) NewMsg(msgType string, metaData types.Metadata, data string) types.RuleMsg {
+	return types.NewMsg(0, msgType, types.JSON, metaData, data)
+}
+
+func (ctx *remoteContext) GetSelfId() string {
+	return ""
+}
+
+func (ctx *remoteContext) Self() types.NodeCtx {
+	return nil
+}
+
+func (ctx *remoteContext) From() types.NodeCtx {
+	return nil
+}
+
+func (ctx *remoteContext) RuleChain() types.NodeCtx {
+	return nil
+}
+
+func (ctx *remoteContext) Config() types.Config {
+	return ctx.server.config
+}
+
+func (ctx *remoteContext) SubmitTack(task func()) {
+	go task()
+}
+
+func (ctx *remoteContext) SetEndFunc(f types.OnEndFunc) types.RuleContext {
+	ctx.endFunc = f
+	return ctx
+}
+
+func (ctx *remoteContext) GetEndFunc() types.OnEndFunc {
+	return ctx.endFunc
+}
+
+func (ctx *remoteContext) SetContext(c context.Context) types.RuleContext {
+	ctx.context = c
+	return ctx
+}
+
+func (ctx *remoteContext) GetContext() context.Context {
+	return ctx.context
+}
+
+func (ctx *remoteContext) SetOnAllNodeCompleted(onAllNodeCompleted func()) {
+}
+
+func (ctx *remoteContext) DoOnEnd(msg types.RuleMsg, err error, relationType string) {
+}
+
+func (ctx *remoteContext) SetCallbackFunc(functionName string, f interface{}) {
+}
+
+func (ctx *remoteContext) GetCallbackFunc(functionName string) interface{} {
+	return nil
+}
+
+func (ctx *remoteContext) OnDebug(ruleChainId string, flowType string, nodeId string, msg types.RuleMsg, relationType string, err error) {
+}
+
+func (ctx *remoteContext) SetExecuteNode(nodeId string, relationTypes ...string) {
+}
+
+func (ctx *remoteContext) TellCollect(msg types.RuleMsg, callback func(msgList []types.WrapperMsg)) bool {
+	callback(nil)
+	return true
+}
+
+func (ctx *remoteContext) GetOut() types.RuleMsg {
+	return types.RuleMsg{}
+}
+
+func (ctx *remoteContext) GetErr() error {
+	return nil
+}
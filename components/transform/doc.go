@@ -4,6 +4,7 @@
 //
 // - ExprTransformNode: Transforms data using expression language
 // - JsTransformNode: Transforms data using JavaScript
+// - LuaTransformNode: Transforms data using Lua
 // - TemplateNode: Transforms data using a text/template
 //
 // Each component is registered with the Registry, allowing them to be used
@@ -52,6 +52,12 @@ type JsTransformNodeConfiguration struct {
 	//function Transform(msg, metadata, msgType) { ${JsScript} }
 	//return {'msg':msg,'metadata':metadata,'msgType':msgType};
 	JsScript string
+	//Async 是否开启异步模式，开启后脚本可以使用 await、setTimeout 和 fetch
+	//节点等待脚本返回的 Promise 完成，最长等待 ScriptMaxExecutionTime
+	//例如：var res = await fetch('http://127.0.0.1/api/device/' + msg.id); msg.device = await res.json();
+	Async bool
+	//Fetch 异步模式下 fetch 函数的超时、代理以及允许访问的主机配置，默认不允许访问任何主机，需要配置 AllowedHosts
+	Fetch js.FetchConfig
 }
 
 // JsTransformNode 使用JavaScript更改消息metadata，msg或msgType
@@ -87,8 +93,13 @@ func (x *JsTransformNode) Init(ruleConfig types.Config, configuration types.Conf
 			fromVars = make(map[string]interface{})
 			fromVars[types.Vars] = v
 		}
-		jsScript := fmt.Sprintf("function Transform(msg, metadata, msgType) { %s }", x.Config.JsScript)
-		x.jsEngine, err = js.NewGojaJsEngine(ruleConfig, jsScript, base.NodeUtils.GetVars(configuration))
+		if x.Config.Async {
+			jsScript := fmt.Sprintf("async function Transform(msg, metadata, msgType) { %s }", x.Config.JsScript)
+			x.jsEngine, err = js.NewAsyncGojaJsEngine(ruleConfig, jsScript, base.NodeUtils.GetVars(configuration), x.Config.Fetch)
+		} else {
+			jsScript := fmt.Sprintf("function Transform(msg, metadata, msgType) { %s }", x.Config.JsScript)
+			x.jsEngine, err = js.NewGojaJsEngine(ruleConfig, jsScript, base.NodeUtils.GetVars(configuration))
+		}
 	}
 	return err
 }
@@ -17,6 +17,9 @@
 package transform
 
 import (
+	"net/http"
+	"net/http/httptest"
+
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/test"
 	"github.com/rulego/rulego/test/assert"
@@ -100,6 +103,37 @@ func TestJsTransformNode(t *testing.T) {
 			})
 		}
 	})
+	t.Run("OnMsgAsync", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(`{"name":"device-` + r.URL.Query().Get("id") + `"}`))
+		}))
+		defer server.Close()
+
+		node, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"async": true,
+			"fetch": map[string]interface{}{
+				"readTimeoutMs": 1000,
+				"allowedHosts":  []string{"127.0.0.1"},
+			},
+			"jsScript": "var res = await fetch(metadata.url + '?id=' + msg.id); msg.device = (await res.json()).name; return {'msg':msg,'metadata':metadata,'msgType':msgType};",
+		}, Registry)
+		assert.Nil(t, err)
+
+		metaData := types.BuildMetadata(make(map[string]string))
+		metaData.PutValue("url", server.URL)
+		var msgList = []test.Msg{
+			{
+				MetaData:   metaData,
+				MsgType:    "ACTIVITY_EVENT",
+				Data:       "{\"id\":\"01\"}",
+				AfterSleep: time.Millisecond * 200,
+			},
+		}
+		test.NodeOnMsg(t, node, msgList, func(msg types.RuleMsg, relationType string, err2 error) {
+			assert.Equal(t, types.Success, relationType)
+			assert.Equal(t, "{\"device\":\"device-01\",\"id\":\"01\"}", msg.Data)
+		})
+	})
 	t.Run("OnMsgError", func(t *testing.T) {
 		node1, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
 			"jsScript": "msg['add']=5+msg['test'];return {'msg':msg,'metadata':metadata,'msgType':msgType};",
@@ -0,0 +1,128 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package transform
+
+//规则链节点配置示例：
+//{
+//        "id": "s2",
+//        "type": "luaTransform",
+//        "name": "转换",
+//        "debugMode": false,
+//        "configuration": {
+//          "luaScript": "metadata['test']='test02'\n metadata['index']=52\n msgType='TEST_MSG_TYPE2'\n msg['aa']=66\n return {msg=msg,metadata=metadata,msgType=msgType}"
+//        }
+//      }
+import (
+	"fmt"
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/components/base"
+	"github.com/rulego/rulego/components/lua"
+	"github.com/rulego/rulego/utils/json"
+	"github.com/rulego/rulego/utils/maps"
+	string2 "github.com/rulego/rulego/utils/str"
+)
+
+func init() {
+	Registry.Add(&LuaTransformNode{})
+}
+
+// LuaTransformNodeConfiguration 节点配置
+type LuaTransformNodeConfiguration struct {
+	//LuaScript 配置函数体脚本内容
+	//对msg、metadata、msgType 进行转换、增强
+	//完整脚本函数：
+	//function Transform(msg, metadata, msgType) ${LuaScript} end
+	//return {msg=msg,metadata=metadata,msgType=msgType}
+	LuaScript string
+}
+
+// LuaTransformNode 使用Lua更改消息metadata，msg或msgType
+// Lua 函数接收3个参数：
+// metadata:是消息的 metadata
+// msg:是消息的payload
+// msgType:是消息的 type
+// 返回结构:return {msg=msg,metadata=metadata,msgType=msgType}
+// 脚本执行成功，发送信息到`Success`链, 否则发到`Failure`链。
+type LuaTransformNode struct {
+	//节点配置
+	Config    LuaTransformNodeConfiguration
+	luaEngine types.JsEngine
+}
+
+// Type 组件类型
+func (x *LuaTransformNode) Type() string {
+	return "luaTransform"
+}
+
+func (x *LuaTransformNode) New() types.Node {
+	return &LuaTransformNode{Config: LuaTransformNodeConfiguration{
+		LuaScript: "return {msg=msg,metadata=metadata,msgType=msgType}",
+	}}
+}
+
+// Init 初始化
+func (x *LuaTransformNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &x.Config)
+	if err == nil {
+		luaScript := fmt.Sprintf("function Transform(msg, metadata, msgType) %s end", x.Config.LuaScript)
+		x.luaEngine, err = lua.NewLuaEngine(ruleConfig, luaScript, base.NodeUtils.GetVars(configuration))
+	}
+	return err
+}
+
+// OnMsg 处理消息
+func (x *LuaTransformNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	var data interface{} = msg.Data
+	if msg.DataType == types.JSON {
+		var dataMap interface{}
+		if err := json.Unmarshal([]byte(msg.Data), &dataMap); err == nil {
+			data = dataMap
+		}
+	}
+	out, err := x.luaEngine.Execute("Transform", data, msg.Metadata.Values(), msg.Type)
+	if err != nil {
+		ctx.TellFailure(msg, err)
+	} else {
+		formatData, ok := out.(map[string]interface{})
+		if ok {
+			if formatMsgType, ok := formatData[types.MsgTypeKey]; ok {
+				msg.Type = string2.ToString(formatMsgType)
+			}
+
+			if formatMetaData, ok := formatData[types.MetadataKey]; ok {
+				msg.Metadata = types.BuildMetadata(string2.ToStringMapString(formatMetaData))
+			}
+
+			if formatMsgData, ok := formatData[types.MsgKey]; ok {
+				if newValue, err := string2.ToStringMaybeErr(formatMsgData); err == nil {
+					msg.Data = newValue
+				} else {
+					ctx.TellFailure(msg, err)
+					return
+				}
+			}
+			ctx.TellNext(msg, types.Success)
+		} else {
+			ctx.TellFailure(msg, JsTransformReturnFormatErr)
+		}
+	}
+}
+
+// Destroy 销毁
+func (x *LuaTransformNode) Destroy() {
+	x.luaEngine.Stop()
+}
@@ -0,0 +1,115 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package transform
+
+import (
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+	"testing"
+	"time"
+)
+
+func TestLuaTransformNode(t *testing.T) {
+	var targetNodeType = "luaTransform"
+
+	t.Run("NewNode", func(t *testing.T) {
+		test.NodeNew(t, targetNodeType, &LuaTransformNode{}, types.Configuration{
+			"luaScript": "return {msg=msg,metadata=metadata,msgType=msgType}",
+		}, Registry)
+	})
+
+	t.Run("InitNode", func(t *testing.T) {
+		test.NodeInit(t, targetNodeType, types.Configuration{
+			"luaScript": "return {msg=msg,metadata=metadata,msgType=msgType}",
+		}, types.Configuration{
+			"luaScript": "return {msg=msg,metadata=metadata,msgType=msgType}",
+		}, Registry)
+	})
+
+	t.Run("OnMsg", func(t *testing.T) {
+		node1, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"luaScript": "metadata['test']='addFromLua'\n msgType='MSG_TYPE_MODIFY_BY_LUA'\n return {msg=msg,metadata=metadata,msgType=msgType}",
+		}, Registry)
+		assert.Nil(t, err)
+		node2, _ := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"luaScript": `return true`,
+		}, Registry)
+		node3, _ := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"luaScript": `return a.b`,
+		}, Registry)
+		node4, _ := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"vars": map[string]string{
+				"ip": "192.168.1.1",
+			},
+			"luaScript": "metadata['test']='addFromLua'\n metadata['ip']=vars.ip\n msgType='MSG_TYPE_MODIFY_BY_LUA'\n return {msg=msg,metadata=metadata,msgType=msgType}",
+		}, Registry)
+		var nodeList = []types.Node{node1, node2, node3, node4}
+
+		for _, node := range nodeList {
+			metaData := types.BuildMetadata(make(map[string]string))
+			metaData.PutValue("productType", "test")
+			var msgList = []test.Msg{
+				{
+					MetaData:   metaData,
+					MsgType:    "ACTIVITY_EVENT",
+					Data:       "AA",
+					AfterSleep: time.Millisecond * 200,
+				},
+				{
+					MetaData:   metaData,
+					MsgType:    "ACTIVITY_EVENT",
+					Data:       "{\"name\":\"lala\"}",
+					AfterSleep: time.Millisecond * 200,
+				},
+			}
+			test.NodeOnMsg(t, node, msgList, func(msg types.RuleMsg, relationType string, err2 error) {
+				if node.(*LuaTransformNode).Config.LuaScript == `return true` {
+					assert.Equal(t, JsTransformReturnFormatErr.Error(), err2.Error())
+				} else if node.(*LuaTransformNode).Config.LuaScript == `return a.b` {
+					assert.NotNil(t, err2)
+				} else {
+					assert.True(t, msg.Metadata.GetValue("ip") == "" || msg.Metadata.GetValue("ip") == "192.168.1.1")
+					assert.Equal(t, "test", msg.Metadata.GetValue("productType"))
+					assert.Equal(t, "addFromLua", msg.Metadata.GetValue("test"))
+					assert.Equal(t, "MSG_TYPE_MODIFY_BY_LUA", msg.Type)
+					assert.True(t, msg.Data == "AA" || msg.Data == "{\"name\":\"lala\"}")
+				}
+			})
+		}
+	})
+
+	t.Run("OnMsgError", func(t *testing.T) {
+		node1, err := test.CreateAndInitNode(targetNodeType, types.Configuration{
+			"luaScript": "msg['add']=5+msg['test']\n return {msg=msg,metadata=metadata,msgType=msgType}",
+		}, Registry)
+		assert.Nil(t, err)
+
+		metaData := types.BuildMetadata(make(map[string]string))
+		var msgList = []test.Msg{
+			{
+				MetaData:   metaData,
+				MsgType:    "ACTIVITY_EVENT",
+				Data:       "{\"name\":\"lala\"}",
+				AfterSleep: time.Millisecond * 200,
+			},
+		}
+		test.NodeOnMsg(t, node1, msgList, func(msg types.RuleMsg, relationType string, err2 error) {
+			assert.Equal(t, types.Failure, relationType)
+		})
+	})
+}
@@ -0,0 +1,71 @@
+;; 测试模块，使用 wat2wasm 编译成 on_msg.wasm
+;; msgType=ERROR: 返回错误
+;; msgType=LOOP: 死循环，测试超时
+;; msgType=GROW: 申请 64MB 内存，测试内存限制
+;; 其他: msg 替换为 metadata.deviceId，添加 metadata.fromWasm=true，
+;; 存在 deviceId 则 TellNext(True)，否则 TellNext(False)
+(module
+  (import "rulego" "log" (func $log (param i32 i32 i32)))
+  (import "rulego" "get_metadata" (func $get_metadata (param i32 i32 i32 i32) (result i32)))
+  (import "rulego" "set_metadata" (func $set_metadata (param i32 i32 i32 i32)))
+  (import "rulego" "set_msg" (func $set_msg (param i32 i32)))
+  (import "rulego" "set_msg_type" (func $set_msg_type (param i32 i32)))
+  (import "rulego" "tell_next" (func $tell_next (param i32 i32)))
+  (import "rulego" "set_error" (func $set_error (param i32 i32)))
+  (memory (export "memory") 1)
+  (global $heap (mut i32) (i32.const 1024))
+  (data (i32.const 0) "deviceId")
+  (data (i32.const 16) "True")
+  (data (i32.const 24) "False")
+  (data (i32.const 32) "fromWasm")
+  (data (i32.const 40) "true")
+  (data (i32.const 48) "boom")
+  (data (i32.const 56) "grow failed")
+  (data (i32.const 72) "WASM_MSG")
+
+  ;; alloc 简单的线性分配器，每次 on_msg 执行结束后重置
+  (func $alloc (export "alloc") (param $size i32) (result i32)
+    (local $ptr i32)
+    (local.set $ptr (global.get $heap))
+    (global.set $heap (i32.add (local.get $ptr) (local.get $size)))
+    (if (i32.gt_u (global.get $heap) (i32.mul (memory.size) (i32.const 65536)))
+      (then
+        (drop (memory.grow
+          (i32.add (i32.div_u (i32.sub (global.get $heap) (i32.mul (memory.size) (i32.const 65536))) (i32.const 65536)) (i32.const 1))))))
+    (local.get $ptr))
+
+  (func (export "on_msg") (param $msg i32) (param $msgLen i32) (param $meta i32) (param $metaLen i32)
+                          (param $type i32) (param $typeLen i32) (result i32)
+    (local $buf i32)
+    (local $n i32)
+    (call $log (i32.const 1) (local.get $type) (local.get $typeLen))
+    ;; ERROR
+    (if (i32.eq (i32.load8_u (local.get $type)) (i32.const 69))
+      (then
+        (call $set_error (i32.const 48) (i32.const 4))
+        (global.set $heap (i32.const 1024))
+        (return (i32.const 1))))
+    ;; LOOP
+    (if (i32.eq (i32.load8_u (local.get $type)) (i32.const 76))
+      (then (loop $forever (br $forever))))
+    ;; GROW
+    (if (i32.eq (i32.load8_u (local.get $type)) (i32.const 71))
+      (then
+        (if (i32.eq (memory.grow (i32.const 1024)) (i32.const -1))
+          (then
+            (call $set_error (i32.const 56) (i32.const 11))
+            (global.set $heap (i32.const 1024))
+            (return (i32.const 2))))))
+    (local.set $buf (call $alloc (i32.const 64)))
+    (local.set $n (call $get_metadata (i32.const 0) (i32.const 8) (local.get $buf) (i32.const 64)))
+    (call $set_metadata (i32.const 32) (i32.const 8) (i32.const 40) (i32.const 4))
+    (call $set_msg_type (i32.const 72) (i32.const 8))
+    (if (i32.lt_s (local.get $n) (i32.const 0))
+      (then
+        (call $tell_next (i32.const 24) (i32.const 5)))
+      (else
+        (call $set_msg (local.get $buf) (local.get $n))
+        (call $tell_next (i32.const 16) (i32.const 4))))
+    (global.set $heap (i32.const 1024))
+    (i32.const 0))
+)
@@ -0,0 +1,424 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package wasm provides WebAssembly execution capabilities for the RuleGo rule engine.
+//
+// This package runs user-defined nodes compiled to WebAssembly with the pure-Go wazero
+// runtime, so custom logic can be written in any language targeting wasm and loaded
+// at runtime without cgo or Go plugins.
+//
+// A module must export:
+// - memory: The linear memory.
+// - alloc(size i32) -> ptr i32: Allocates memory for the host to write the arguments.
+// - on_msg(msgPtr, msgLen, metadataPtr, metadataLen, msgTypePtr, msgTypeLen i32) -> i32:
+// Handles the message, metadata is a JSON object. Returns 0 on success, otherwise failure.
+//
+// Optionally free(ptr, size i32) is called for each argument after on_msg returns.
+//
+// The host module "rulego" provides:
+// - log(level, ptr, len): Writes a log, level 0:debug 1:info 2:warn 3:error.
+// - get_metadata(keyPtr, keyLen, bufPtr, bufCap) -> i32: Copies the metadata value into buf,
+// returns the length of the value or -1 if the key does not exist.
+// - set_metadata(keyPtr, keyLen, valuePtr, valueLen): Sets a metadata value.
+// - set_msg(ptr, len): Replaces the message data.
+// - set_msg_type(ptr, len): Replaces the message type.
+// - tell_next(ptr, len): Adds a relation type the message is sent to, default Success.
+// - set_error(ptr, len): Sets the error message returned when on_msg fails.
+//
+// WASI (wasi_snapshot_preview1) is available without file system, environment or network access.
+// Instances are pooled, each instance is limited by MemoryLimitPages and each call by Timeout.
+//
+// This package is used by the WasmNode component.
+package wasm
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/utils/json"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+const (
+	// HostModuleName 宿主函数模块名称
+	HostModuleName = "rulego"
+	// OnMsgFunc 处理消息的导出函数
+	OnMsgFunc = "on_msg"
+	// AllocFunc 分配内存的导出函数
+	AllocFunc = "alloc"
+	// FreeFunc 释放内存的导出函数，可选
+	FreeFunc = "free"
+	// DefaultMemoryLimitPages 默认每个实例最大内存，单位页(64KB)，即16MB
+	DefaultMemoryLimitPages = 256
+)
+
+var (
+	// ErrExecutionTimeout 执行超过 Timeout
+	ErrExecutionTimeout = errors.New("execution timeout")
+	// ErrMissingExport 模块缺少必须的导出函数
+	ErrMissingExport = errors.New("missing export")
+	// ErrMemoryOutOfRange 读写的内存超出范围
+	ErrMemoryOutOfRange = errors.New("memory out of range")
+)
+
+var logLevels = []string{"DEBUG", "INFO", "WARN", "ERROR"}
+
+// Config wasm 引擎配置
+type Config struct {
+	// MemoryLimitPages 每个实例最大内存，单位页(64KB)，默认256(16MB)
+	MemoryLimitPages uint32
+	// Timeout 每次执行的超时时间，0不限制
+	Timeout time.Duration
+	// PoolSize 实例池最多缓存的空闲实例数量，默认CPU核数
+	PoolSize int
+	// Logger 宿主函数 log 的输出
+	Logger types.Logger
+}
+
+// Result on_msg 的执行结果
+type Result struct {
+	// Data 消息内容
+	Data string
+	// Metadata 消息元数据
+	Metadata map[string]string
+	// MsgType 消息类型
+	MsgType string
+	// Relations 通过 tell_next 选择的关系，为空则使用 Success
+	Relations []string
+}
+
+// Engine wasm 引擎，一个引擎加载一个模块，可以通过 Reload 热更新模块
+type Engine struct {
+	config  Config
+	runtime wazero.Runtime
+	lock    sync.RWMutex
+	module  *module
+}
+
+// module 编译后的模块和它的实例池
+type module struct {
+	compiled  wazero.CompiledModule
+	instances chan api.Module
+	// refs 引用计数，引擎持有一个引用，每次执行持有一个引用，计数为0时关闭模块
+	refs int32
+	// hash 模块内容的摘要，运行时按内容缓存编译结果，内容相同的模块共享编译结果
+	hash [sha256.Size]byte
+}
+
+// callState 一次 on_msg 调用的状态，通过 context 传给宿主函数
+type callState struct {
+	result *Result
+	err    string
+}
+
+type callStateKey struct{}
+
+// NewEngine 编译wasm模块并创建引擎
+func NewEngine(wasm []byte, config Config) (*Engine, error) {
+	if config.MemoryLimitPages == 0 {
+		config.MemoryLimitPages = DefaultMemoryLimitPages
+	}
+	if config.PoolSize <= 0 {
+		config.PoolSize = runtime.NumCPU()
+	}
+	ctx := context.Background()
+	r := wazero.NewRuntimeWithConfig(ctx, wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(config.MemoryLimitPages).
+		WithCloseOnContextDone(true))
+	e := &Engine{config: config, runtime: r}
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, r); err != nil {
+		_ = r.Close(ctx)
+		return nil, err
+	}
+	if err := e.instantiateHostModule(ctx); err != nil {
+		_ = r.Close(ctx)
+		return nil, err
+	}
+	if err := e.Reload(wasm); err != nil {
+		_ = r.Close(ctx)
+		return nil, err
+	}
+	return e, nil
+}
+
+// Reload 重新编译并替换模块，旧模块在正在执行的消息全部完成后关闭
+func (e *Engine) Reload(wasm []byte) error {
+	ctx := context.Background()
+	compiled, err := e.runtime.CompileModule(ctx, wasm)
+	if err != nil {
+		return err
+	}
+	exports := compiled.ExportedFunctions()
+	for _, name := range []string{OnMsgFunc, AllocFunc} {
+		if _, ok := exports[name]; !ok {
+			_ = compiled.Close(ctx)
+			return fmt.Errorf("%w: %s", ErrMissingExport, name)
+		}
+	}
+	m := &module{compiled: compiled, instances: make(chan api.Module, e.config.PoolSize), refs: 1, hash: sha256.Sum256(wasm)}
+	//提前实例化一次，检查导入的函数和内存限制
+	instance, err := e.instantiate(ctx, m)
+	if err != nil {
+		_ = compiled.Close(ctx)
+		return err
+	}
+	m.instances <- instance
+
+	e.lock.Lock()
+	old := e.module
+	e.module = m
+	e.lock.Unlock()
+	if old != nil {
+		e.release(ctx, old)
+	}
+	return nil
+}
+
+// Execute 调用模块的 on_msg 函数
+func (e *Engine) Execute(data string, metadata map[string]string, msgType string) (*Result, error) {
+	metadataJson, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, err
+	}
+	m := e.acquire()
+	if m == nil {
+		return nil, errors.New("engine is closed")
+	}
+	ctx := context.Background()
+	defer e.release(ctx, m)
+	instance, err := e.get(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Data: data, MsgType: msgType, Metadata: make(map[string]string, len(metadata))}
+	for k, v := range metadata {
+		result.Metadata[k] = v
+	}
+	state := &callState{result: result}
+	ctx = context.WithValue(ctx, callStateKey{}, state)
+	if e.config.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, e.config.Timeout)
+		defer cancel()
+	}
+
+	var params []uint64
+	for _, arg := range [][]byte{[]byte(data), metadataJson, []byte(msgType)} {
+		ptr, err := e.write(ctx, instance, arg)
+		if err != nil {
+			e.discard(instance, err)
+			return nil, err
+		}
+		params = append(params, uint64(ptr), uint64(len(arg)))
+	}
+	code, err := instance.ExportedFunction(OnMsgFunc).Call(ctx, params...)
+	if err != nil {
+		//执行出错的实例状态未知，不再复用
+		e.discard(instance, err)
+		var exitErr *sys.ExitError
+		if errors.As(err, &exitErr) && (exitErr.ExitCode() == sys.ExitCodeDeadlineExceeded || exitErr.ExitCode() == sys.ExitCodeContextCanceled) {
+			return nil, ErrExecutionTimeout
+		}
+		return nil, err
+	}
+	if free := instance.ExportedFunction(FreeFunc); free != nil {
+		for i := 0; i < len(params); i += 2 {
+			if _, err = free.Call(ctx, params[i], params[i+1]); err != nil {
+				e.discard(instance, err)
+				instance = nil
+				break
+			}
+		}
+	}
+	if instance != nil {
+		e.put(m, instance)
+	}
+	if len(code) > 0 && int32(code[0]) != 0 {
+		if state.err != "" {
+			return nil, errors.New(state.err)
+		}
+		return nil, fmt.Errorf("%s returned %d", OnMsgFunc, int32(code[0]))
+	}
+	return result, nil
+}
+
+// Close 关闭引擎以及所有实例
+func (e *Engine) Close() {
+	e.lock.Lock()
+	e.module = nil
+	e.lock.Unlock()
+	_ = e.runtime.Close(context.Background())
+}
+
+// acquire 获取当前模块并增加引用计数，使用完成后需要调用 release
+func (e *Engine) acquire() *module {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	if e.module != nil {
+		atomic.AddInt32(&e.module.refs, 1)
+	}
+	return e.module
+}
+
+func (e *Engine) instantiate(ctx context.Context, m *module) (api.Module, error) {
+	//名称为空，同一个模块可以创建多个实例。支持 TinyGo 等 reactor 模块的初始化函数
+	return e.runtime.InstantiateModule(ctx, m.compiled, wazero.NewModuleConfig().WithName("").WithStartFunctions("_initialize"))
+}
+
+func (e *Engine) get(ctx context.Context, m *module) (api.Module, error) {
+	select {
+	case instance := <-m.instances:
+		return instance, nil
+	default:
+		return e.instantiate(ctx, m)
+	}
+}
+
+func (e *Engine) put(m *module, instance api.Module) {
+	e.lock.RLock()
+	defer e.lock.RUnlock()
+	//模块已经热更新，旧实例不再放回实例池
+	if e.module != m {
+		_ = instance.Close(context.Background())
+		return
+	}
+	select {
+	case m.instances <- instance:
+	default:
+		_ = instance.Close(context.Background())
+	}
+}
+
+func (e *Engine) discard(instance api.Module, err error) {
+	_ = instance.Close(context.Background())
+	if e.config.Logger != nil {
+		e.config.Logger.Printf("wasm instance discarded,err:%s", err.Error())
+	}
+}
+
+// write 调用 alloc 分配内存并写入数据
+func (e *Engine) write(ctx context.Context, instance api.Module, data []byte) (uint32, error) {
+	res, err := instance.ExportedFunction(AllocFunc).Call(ctx, uint64(len(data)))
+	if err != nil {
+		return 0, err
+	}
+	ptr := uint32(res[0])
+	if !instance.Memory().Write(ptr, data) {
+		return 0, ErrMemoryOutOfRange
+	}
+	return ptr, nil
+}
+
+// release 减少模块的引用计数，最后一个引用释放后关闭实例池中的实例和编译后的模块
+// 如果当前模块和它内容相同，共享编译结果，则不关闭编译后的模块
+func (e *Engine) release(ctx context.Context, m *module) {
+	if atomic.AddInt32(&m.refs, -1) != 0 {
+		return
+	}
+	e.lock.RLock()
+	shared := e.module != nil && e.module.hash == m.hash
+	e.lock.RUnlock()
+	m.close(ctx, !shared)
+}
+
+func (m *module) close(ctx context.Context, closeCompiled bool) {
+	for {
+		select {
+		case instance := <-m.instances:
+			_ = instance.Close(ctx)
+		default:
+			if closeCompiled {
+				_ = m.compiled.Close(ctx)
+			}
+			return
+		}
+	}
+}
+
+// instantiateHostModule 注册宿主函数
+func (e *Engine) instantiateHostModule(ctx context.Context) error {
+	_, err := e.runtime.NewHostModuleBuilder(HostModuleName).
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, level, ptr, size uint32) {
+		if e.config.Logger == nil {
+			return
+		}
+		levelName := strconv.Itoa(int(level))
+		if int(level) < len(logLevels) {
+			levelName = logLevels[level]
+		}
+		e.config.Logger.Printf("wasm [%s] %s", levelName, readString(m, ptr, size))
+	}).Export("log").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, keyPtr, keyLen, bufPtr, bufCap uint32) int32 {
+		value, ok := stateFrom(ctx).result.Metadata[readString(m, keyPtr, keyLen)]
+		if !ok {
+			return -1
+		}
+		n := uint32(len(value))
+		if n > bufCap {
+			n = bufCap
+		}
+		if !m.Memory().Write(bufPtr, []byte(value[:n])) {
+			panic(ErrMemoryOutOfRange)
+		}
+		return int32(len(value))
+	}).Export("get_metadata").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, keyPtr, keyLen, valuePtr, valueLen uint32) {
+		stateFrom(ctx).result.Metadata[readString(m, keyPtr, keyLen)] = readString(m, valuePtr, valueLen)
+	}).Export("set_metadata").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, size uint32) {
+		stateFrom(ctx).result.Data = readString(m, ptr, size)
+	}).Export("set_msg").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, size uint32) {
+		stateFrom(ctx).result.MsgType = readString(m, ptr, size)
+	}).Export("set_msg_type").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, size uint32) {
+		state := stateFrom(ctx)
+		state.result.Relations = append(state.result.Relations, readString(m, ptr, size))
+	}).Export("tell_next").
+		NewFunctionBuilder().WithFunc(func(ctx context.Context, m api.Module, ptr, size uint32) {
+		stateFrom(ctx).err = readString(m, ptr, size)
+	}).Export("set_error").
+		Instantiate(ctx)
+	return err
+}
+
+func stateFrom(ctx context.Context) *callState {
+	if state, ok := ctx.Value(callStateKey{}).(*callState); ok {
+		return state
+	}
+	//在 on_msg 之外调用宿主函数，例如在 _initialize 中
+	return &callState{result: &Result{Metadata: map[string]string{}}}
+}
+
+func readString(m api.Module, ptr, size uint32) string {
+	b, ok := m.Memory().Read(ptr, size)
+	if !ok {
+		panic(ErrMemoryOutOfRange)
+	}
+	return string(b)
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package wasm
+
+import (
+	"errors"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestWasmEngine(t *testing.T) {
+	wasm, err := os.ReadFile("testdata/on_msg.wasm")
+	assert.Nil(t, err)
+
+	_, err = NewEngine([]byte("not wasm"), Config{})
+	assert.NotNil(t, err)
+
+	engine, err := NewEngine(wasm, Config{
+		Timeout:          time.Millisecond * 200,
+		MemoryLimitPages: 16,
+		PoolSize:         2,
+		Logger:           types.DefaultLogger(),
+	})
+	assert.Nil(t, err)
+	defer engine.Close()
+
+	var group sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			result, err := engine.Execute(`{"temperature":41}`, map[string]string{"deviceId": "dev01"}, "TELEMETRY")
+			assert.Nil(t, err)
+			assert.Equal(t, "dev01", result.Data)
+			assert.Equal(t, "WASM_MSG", result.MsgType)
+			assert.Equal(t, map[string]string{"deviceId": "dev01", "fromWasm": "true"}, result.Metadata)
+			assert.Equal(t, []string{types.True}, result.Relations)
+		}()
+	}
+	group.Wait()
+
+	result, err := engine.Execute(`{"temperature":41}`, map[string]string{}, "TELEMETRY")
+	assert.Nil(t, err)
+	assert.Equal(t, `{"temperature":41}`, result.Data)
+	assert.Equal(t, []string{types.False}, result.Relations)
+
+	_, err = engine.Execute("", nil, "ERROR")
+	assert.Equal(t, "boom", err.Error())
+
+	t.Run("Timeout", func(t *testing.T) {
+		start := time.Now()
+		_, err := engine.Execute("", nil, "LOOP")
+		assert.Equal(t, ErrExecutionTimeout, err)
+		assert.True(t, time.Since(start) < time.Second)
+		//超时的实例被丢弃，仍然可以继续执行
+		result, err := engine.Execute("", map[string]string{"deviceId": "dev02"}, "TELEMETRY")
+		assert.Nil(t, err)
+		assert.Equal(t, "dev02", result.Data)
+	})
+
+	t.Run("MemoryLimit", func(t *testing.T) {
+		_, err := engine.Execute("", nil, "GROW")
+		assert.Equal(t, "grow failed", err.Error())
+
+		unlimited, err := NewEngine(wasm, Config{MemoryLimitPages: 2048})
+		assert.Nil(t, err)
+		defer unlimited.Close()
+		_, err = unlimited.Execute("", map[string]string{"deviceId": "dev01"}, "GROW")
+		assert.Nil(t, err)
+	})
+
+	t.Run("Reload", func(t *testing.T) {
+		err := engine.Reload([]byte{0x00, 0x61, 0x73, 0x6d, 0x01, 0x00, 0x00, 0x00})
+		assert.True(t, errors.Is(err, ErrMissingExport))
+		//加载失败不影响当前模块
+		_, err = engine.Execute("", nil, "TELEMETRY")
+		assert.Nil(t, err)
+
+		assert.Nil(t, engine.Reload(wasm))
+		result, err := engine.Execute("", map[string]string{"deviceId": "dev03"}, "TELEMETRY")
+		assert.Nil(t, err)
+		assert.Equal(t, "dev03", result.Data)
+	})
+
+	t.Run("ReloadWhileExecuting", func(t *testing.T) {
+		//热更新期间正在执行的消息不受影响
+		var group sync.WaitGroup
+		stop := make(chan struct{})
+		for i := 0; i < 8; i++ {
+			group.Add(1)
+			go func() {
+				defer group.Done()
+				for {
+					select {
+					case <-stop:
+						return
+					default:
+					}
+					result, err := engine.Execute("", map[string]string{"deviceId": "dev04"}, "TELEMETRY")
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					assert.Equal(t, "dev04", result.Data)
+				}
+			}()
+		}
+		for i := 0; i < 20; i++ {
+			assert.Nil(t, engine.Reload(wasm))
+		}
+		close(stop)
+		group.Wait()
+	})
+}
@@ -287,7 +287,7 @@ func (e *DynamicEndpoint) AddRouterFromDef(routerDsl *types.RouterDsl) (string,
 			to.Wait()
 		}
 	}
-	router := from.End()
+	router := from.End().SetAckPolicy(routerDsl.Ack)
 	if id, err := e.Endpoint.AddRouter(router, routerDsl.Params...); err != nil {
 		return "", err
 	} else {
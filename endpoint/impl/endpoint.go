@@ -46,6 +46,7 @@ import (
 	"github.com/rulego/rulego/api/types/endpoint"
 	"github.com/rulego/rulego/engine"
 	"github.com/rulego/rulego/utils/str"
+	"github.com/rulego/rulego/utils/trace"
 )
 
 const (
@@ -286,6 +287,8 @@ type Router struct {
 	disable uint32
 	//路由定义，如果没设置会返回nil
 	def *types.RouterDsl
+	//消息确认策略，nil使用默认策略
+	ackPolicy *types.AckPolicy
 	//配置参数
 	params []interface{}
 	//记录初始化的错误
@@ -334,6 +337,17 @@ func (r *Router) Definition() *types.RouterDsl {
 	return r.def
 }
 
+// SetAckPolicy 设置哪些规则链执行结果视为成功，用于确认支持ack的消息，例如：mqtt、kafka
+func (r *Router) SetAckPolicy(policy *types.AckPolicy) endpoint.Router {
+	r.ackPolicy = policy
+	return r
+}
+
+// GetAckPolicy 获取消息确认策略，如果没设置会返回nil，表示使用默认策略
+func (r *Router) GetAckPolicy() *types.AckPolicy {
+	return r.ackPolicy
+}
+
 func (r *Router) SetId(id string) endpoint.Router {
 	r.id = id
 	return r
@@ -430,21 +444,47 @@ func (e *BaseEndpoint) AddInterceptors(interceptors ...endpoint.Process) {
 func (e *BaseEndpoint) DoProcess(baseCtx context.Context, router endpoint.Router, exchange *endpoint.Exchange) {
 	//创建上下文
 	ctx := e.createContext(baseCtx, router, exchange)
+	//传递W3C链路上下文
+	e.extractTraceContext(exchange)
 	for _, item := range e.interceptors {
 		//执行全局拦截器
 		if !item(router, exchange) {
+			//消息被拦截，视为处理完成
+			_ = exchange.Ack()
 			return
 		}
 	}
 	//执行from端逻辑
 	if fromFlow := router.GetFrom(); fromFlow != nil {
 		if !fromFlow.ExecuteProcess(router, exchange) {
+			_ = exchange.Ack()
 			return
 		}
 	}
-	//执行to端逻辑
+	//执行to端逻辑，由to端执行器在执行结束后确认消息
 	if router.GetFrom() != nil && router.GetFrom().GetTo() != nil {
 		router.GetFrom().GetTo().Execute(ctx, exchange)
+	} else {
+		_ = exchange.Ack()
+	}
+}
+
+// extractTraceContext 把请求头中的 traceparent/tracestate 写入消息元数据，用于链路追踪
+func (e *BaseEndpoint) extractTraceContext(exchange *endpoint.Exchange) {
+	if exchange == nil || exchange.In == nil {
+		return
+	}
+	headers := exchange.In.Headers()
+	if headers == nil {
+		return
+	}
+	if sc, ok := trace.Extract(headers.Get); ok {
+		if msg := exchange.In.GetMsg(); msg != nil {
+			if msg.Metadata == nil {
+				msg.Metadata = types.NewMetadata()
+			}
+			trace.Inject(sc, msg.Metadata.PutValue)
+		}
 	}
 }
 
@@ -533,10 +573,13 @@ func (ce *ChainExecutor) Execute(ctx context.Context, router endpoint.Router, ex
 		tos := strings.Split(toChainId, pathSplitFlag)
 		toChainId = tos[0]
 		//查找规则链，并执行
-		if ruleEngine, ok := router.GetRuleGo(exchange).Get(toChainId); ok {
+		ruleEngine, ok := router.GetRuleGo(exchange).Get(toChainId)
+		if ok && ruleEngine.Initialized() {
 			opts := toFlow.GetOpts()
+			acker := newAcker(router, exchange)
 			//监听结束回调函数
 			endFunc := types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+				acker.observe(relationType, err)
 				if err != nil {
 					exchange.Out.SetError(err)
 				} else {
@@ -554,6 +597,10 @@ func (ce *ChainExecutor) Execute(ctx context.Context, router endpoint.Router, ex
 				opts = append(opts, types.WithStartNode(tos[1]))
 			}
 			opts = append(opts, endFunc)
+			if acker != nil {
+				//所有分支执行结束后确认消息
+				opts = append(opts, withOnAllNodeCompleted(acker.complete))
+			}
 
 			if toFlow.IsWait() {
 				//同步
@@ -563,18 +610,39 @@ func (ce *ChainExecutor) Execute(ctx context.Context, router endpoint.Router, ex
 				ruleEngine.OnMsg(*inMsg, opts...)
 			}
 		} else {
-			//找不到规则链返回错误
+			//找不到规则链或者规则链未初始化返回错误，并拒绝消息，避免传输层消息一直等待确认
+			err := fmt.Errorf("chainId=%s not found error", toChainId)
+			if ok {
+				err = fmt.Errorf("chainId=%s not initialized error", toChainId)
+			}
 			for _, process := range toFlow.GetProcessList() {
-				exchange.Out.SetError(fmt.Errorf("chainId=%s not found error", toChainId))
+				exchange.Out.SetError(err)
 				if !process(router, exchange) {
 					break
 				}
 			}
+			_ = exchange.Nack(err)
 		}
 
 	}
 }
 
+// withOnAllNodeCompleted 所有分支执行结束回调，包装调用方通过 To.SetOpts 设置的回调
+func withOnAllNodeCompleted(onAllNodeCompleted func()) types.RuleContextOption {
+	return func(rc types.RuleContext) {
+		var custom func()
+		if ctx, ok := rc.(*engine.DefaultRuleContext); ok {
+			custom = ctx.GetOnAllNodeCompleted()
+		}
+		rc.SetOnAllNodeCompleted(func() {
+			if custom != nil {
+				custom()
+			}
+			onAllNodeCompleted()
+		})
+	}
+}
+
 // ComponentExecutor node组件执行器
 type ComponentExecutor struct {
 	component types.Node
@@ -616,8 +684,10 @@ func (ce *ComponentExecutor) Execute(ctx context.Context, router endpoint.Router
 
 		inMsg := exchange.In.GetMsg()
 		if toFlow := fromFlow.GetTo(); toFlow != nil && inMsg != nil {
+			acker := newAcker(router, exchange)
 			//初始化的空上下文
 			ruleCtx := engine.NewRuleContext(ctx, ce.config, nil, nil, nil, ce.config.Pool, func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+				acker.observe(relationType, err)
 				if err != nil {
 					exchange.Out.SetError(err)
 				} else {
@@ -633,6 +703,7 @@ func (ce *ComponentExecutor) Execute(ctx context.Context, router endpoint.Router
 			if toFlow.IsWait() {
 				c := make(chan struct{})
 				ruleCtx.SetOnAllNodeCompleted(func() {
+					acker.complete()
 					close(c)
 				})
 				//执行组件逻辑
@@ -640,6 +711,9 @@ func (ce *ComponentExecutor) Execute(ctx context.Context, router endpoint.Router
 				//等待执行结束
 				<-c
 			} else {
+				if acker != nil {
+					ruleCtx.SetOnAllNodeCompleted(acker.complete)
+				}
 				//执行组件逻辑
 				ce.component.OnMsg(ruleCtx, *inMsg)
 			}
@@ -647,6 +721,52 @@ func (ce *ComponentExecutor) Execute(ctx context.Context, router endpoint.Router
 	}
 }
 
+// acker 汇总规则链各分支的执行结果，所有分支执行结束后根据路由的确认策略确认消息
+type acker struct {
+	policy   *types.AckPolicy
+	exchange *endpoint.Exchange
+	lock     sync.Mutex
+	err      error
+}
+
+// newAcker 如果消息不支持确认，返回nil
+func newAcker(router endpoint.Router, exchange *endpoint.Exchange) *acker {
+	if !exchange.IsAckable() {
+		return nil
+	}
+	return &acker{policy: router.GetAckPolicy(), exchange: exchange}
+}
+
+// observe 记录分支执行结果，只保留第一个失败的结果
+func (a *acker) observe(relationType string, err error) {
+	if a == nil || a.policy.IsSuccess(relationType, err) {
+		return
+	}
+	if err == nil {
+		err = fmt.Errorf("relationType=%s is not success", relationType)
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.err == nil {
+		a.err = err
+	}
+}
+
+// complete 所有分支执行结束，确认消息
+func (a *acker) complete() {
+	if a == nil {
+		return
+	}
+	a.lock.Lock()
+	err := a.err
+	a.lock.Unlock()
+	if err != nil {
+		_ = a.exchange.Nack(err)
+	} else {
+		_ = a.exchange.Ack()
+	}
+}
+
 // DefaultExecutorFactory 默认to端执行器注册器
 var DefaultExecutorFactory = new(ExecutorFactory)
 
@@ -24,6 +24,7 @@ import (
 	"github.com/rulego/rulego/components/transform"
 	"github.com/rulego/rulego/engine"
 	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/utils/trace"
 	"net/textproto"
 	"os"
 	"strings"
@@ -412,6 +413,26 @@ func TestEndpoint(t *testing.T) {
 		executeRouterTest(router2, exchange)
 	})
 
+	t.Run("DoProcessTraceContext", func(t *testing.T) {
+		traceParent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+		in := &testRequestMessage{body: []byte("{\"productName\":\"lala\"}")}
+		in.Headers().Set(trace.TraceParentKey, traceParent)
+		in.Headers().Set(trace.TraceStateKey, "rulego=1")
+		exchange := &endpoint.Exchange{
+			In:  in,
+			Out: &testResponseMessage{}}
+		var metadata types.Metadata
+		router := NewRouter(endpoint.RouterOptions.WithRuleConfig(config)).From(from).
+			Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+				metadata = exchange.In.GetMsg().Metadata
+				return false
+			}).End()
+		testEp := &testEndpoint{}
+		testEp.DoProcess(context.Background(), router, exchange)
+		assert.Equal(t, traceParent, metadata.GetValue(trace.TraceParentKey))
+		assert.Equal(t, "rulego=1", metadata.GetValue(trace.TraceStateKey))
+	})
+
 	t.Run("DoProcessContextIsNil", func(t *testing.T) {
 		defer func() {
 			if caught := recover(); caught != nil {
@@ -435,6 +456,125 @@ func TestEndpoint(t *testing.T) {
 
 }
 
+func TestAck(t *testing.T) {
+	buf, err := os.ReadFile("../../testdata/rule/sub_chain.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := engine.NewConfig(types.WithDefaultPool())
+	_, err = engine.New("ackChain", buf, engine.WithConfig(config))
+	assert.Nil(t, err)
+	defer engine.Del("ackChain")
+	errChain := strings.Replace(string(buf), "\"jsScript\": \"return msg=='aa';\"", "\"jsScript\": \"return a;\"", -1)
+	_, err = engine.New("ackErrChain", []byte(errChain), engine.WithConfig(config))
+	assert.Nil(t, err)
+	defer engine.Del("ackErrChain")
+
+	testEp := &testEndpoint{}
+	//等待确认结果
+	doProcess := func(router endpoint.Router) (bool, error) {
+		in := &testAckableMessage{testRequestMessage: testRequestMessage{body: []byte("{\"productName\":\"lala\"}")}, result: make(chan error, 2)}
+		exchange := &endpoint.Exchange{In: in, Out: &testResponseMessage{}}
+		testEp.DoProcess(context.Background(), router, exchange)
+		select {
+		case err := <-in.result:
+			//只确认一次
+			time.Sleep(time.Millisecond * 20)
+			assert.Equal(t, 0, len(in.result))
+			return err == nil, err
+		case <-time.After(time.Second * 2):
+			t.Fatal("ack timeout")
+			return false, nil
+		}
+	}
+
+	t.Run("AckPolicy", func(t *testing.T) {
+		var policy *types.AckPolicy
+		assert.True(t, policy.IsSuccess(types.Success, nil))
+		assert.True(t, policy.IsSuccess(types.False, nil))
+		assert.False(t, policy.IsSuccess(types.Failure, nil))
+		assert.False(t, policy.IsSuccess(types.Success, fmt.Errorf("error")))
+		policy = &types.AckPolicy{SuccessRelationTypes: []string{types.True}}
+		assert.True(t, policy.IsSuccess(types.True, nil))
+		assert.False(t, policy.IsSuccess(types.False, nil))
+	})
+
+	t.Run("ChainAck", func(t *testing.T) {
+		//规则链以False结束，默认策略视为成功
+		ok, _ := doProcess(NewRouter().From("aa").To("chain:ackChain").End())
+		assert.True(t, ok)
+		ok, _ = doProcess(NewRouter().From("aa").To("chain:ackChain").Wait().End())
+		assert.True(t, ok)
+	})
+
+	t.Run("ChainAckWithCustomOnAllNodeCompleted", func(t *testing.T) {
+		//调用方设置的回调和确认都执行
+		completed := make(chan struct{}, 1)
+		router := NewRouter().From("aa").To("chain:ackChain").SetOpts(types.WithOnAllNodeCompleted(func() {
+			completed <- struct{}{}
+		})).End()
+		ok, _ := doProcess(router)
+		assert.True(t, ok)
+		select {
+		case <-completed:
+		case <-time.After(time.Second * 2):
+			t.Fatal("onAllNodeCompleted not called")
+		}
+	})
+
+	t.Run("ChainNackByPolicy", func(t *testing.T) {
+		router := NewRouter().From("aa").To("chain:ackChain").End().SetAckPolicy(&types.AckPolicy{SuccessRelationTypes: []string{types.True}})
+		ok, err := doProcess(router)
+		assert.False(t, ok)
+		assert.Equal(t, "relationType=False is not success", err.Error())
+	})
+
+	t.Run("ChainNackByError", func(t *testing.T) {
+		ok, err := doProcess(NewRouter().From("aa").To("chain:ackErrChain").End())
+		assert.False(t, ok)
+		assert.NotNil(t, err)
+		ok, err = doProcess(NewRouter().From("aa").To("chain:notFound").End())
+		assert.False(t, ok)
+		assert.Equal(t, "chainId=notFound not found error", err.Error())
+
+		//规则链已停止，未初始化
+		stoppedEngine, err := engine.New("ackStoppedChain", buf, engine.WithConfig(config))
+		assert.Nil(t, err)
+		defer engine.Del("ackStoppedChain")
+		stoppedEngine.Stop()
+		ok, err = doProcess(NewRouter().From("aa").To("chain:ackStoppedChain").End())
+		assert.False(t, ok)
+		assert.Equal(t, "chainId=ackStoppedChain not initialized error", err.Error())
+	})
+
+	t.Run("ComponentAck", func(t *testing.T) {
+		ok, _ := doProcess(NewRouter(endpoint.RouterOptions.WithRuleConfig(config)).From("aa").To("component:jsTransform", types.Configuration{
+			"jsScript": "return {'msg':msg,'metadata':metadata,'msgType':msgType};",
+		}).End())
+		assert.True(t, ok)
+		ok, _ = doProcess(NewRouter(endpoint.RouterOptions.WithRuleConfig(config)).From("aa").To("component:jsTransform", types.Configuration{
+			"jsScript": "return a",
+		}).Wait().End())
+		assert.False(t, ok)
+	})
+
+	t.Run("AckWithoutTo", func(t *testing.T) {
+		ok, _ := doProcess(NewRouter().From("aa").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			return false
+		}).End())
+		assert.True(t, ok)
+		ok, _ = doProcess(NewRouter().From("aa").End())
+		assert.True(t, ok)
+	})
+
+	t.Run("NotAckable", func(t *testing.T) {
+		exchange := &endpoint.Exchange{In: &testRequestMessage{}, Out: &testResponseMessage{}}
+		assert.False(t, exchange.IsAckable())
+		assert.Nil(t, exchange.Ack())
+		assert.Nil(t, exchange.Nack(fmt.Errorf("error")))
+	})
+}
+
 func executeRouterTest(router endpoint.Router, exchange *endpoint.Exchange) {
 	//执行from端逻辑
 	if fromFlow := router.GetFrom(); fromFlow != nil {
@@ -449,6 +589,22 @@ func executeRouterTest(router endpoint.Router, exchange *endpoint.Exchange) {
 }
 
 // testRequestMessage 请求消息
+// testAckableMessage 支持确认的请求消息，Ack 写入nil，Nack 写入错误
+type testAckableMessage struct {
+	testRequestMessage
+	result chan error
+}
+
+func (r *testAckableMessage) Ack() error {
+	r.result <- nil
+	return nil
+}
+
+func (r *testAckableMessage) Nack(err error) error {
+	r.result <- err
+	return nil
+}
+
 type testRequestMessage struct {
 	headers textproto.MIMEHeader
 	body    []byte
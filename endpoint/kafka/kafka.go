@@ -0,0 +1,677 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package kafka provides a Kafka endpoint implementation for the RuleGo framework.
+// It joins a consumer group, subscribes to the topics of its routers and routes the
+// consumed records to rule chains or components.
+//
+// Each router subscribes to one topic, specified by router.From. Adding or removing
+// a router after the endpoint has started rejoins the consumer group with the new topic list.
+//
+// Offsets are committed manually. If the router's To is set to Wait(), the offset of a record
+// is committed only after the rule chain has acknowledged it, that is, all branches have ended
+// with success according to the router's AckPolicy; if it is negatively acknowledged, the
+// record is processed again after RetryInterval, until it succeeds or the partition is revoked.
+// After MaxAttempts failed attempts the record is published to DeadLetterTopic, if configured,
+// and its offset is committed, so that a poison record does not block its partition.
+// Records routed to routers without Wait() are committed as soon as they have been dispatched.
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/components/base"
+	"github.com/rulego/rulego/components/kafka"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/utils/maps"
+	"github.com/rulego/rulego/utils/runtime"
+)
+
+// Type 组件类型
+const Type = types.EndpointTypePrefix + "kafka"
+
+const (
+	// KeyResponseTopic 响应主题metadataKey
+	KeyResponseTopic = "responseTopic"
+	// KeyResponseKey 响应消息key metadataKey
+	KeyResponseKey = "responseKey"
+	// KeyTopic 消息主题metadataKey
+	KeyTopic = "topic"
+	// KeyKey 消息key metadataKey
+	KeyKey = "key"
+	// KeyPartition 消息分区metadataKey
+	KeyPartition = "partition"
+	// KeyOffset 消息offset metadataKey
+	KeyOffset = "offset"
+)
+
+// Endpoint 别名
+type Endpoint = Kafka
+
+// Config kafka 接收端点配置
+type Config struct {
+	// Server kafka broker 地址，多个使用逗号分隔
+	Server string
+	// GroupId 消费者组ID
+	GroupId string
+	// ClientId 客户端ID
+	ClientId string
+	// Version kafka 协议版本，例如：2.1.0，为空使用默认版本
+	Version string
+	// OffsetInitial 消费者组没有已提交的offset时的起始位置：newest/oldest，默认newest
+	OffsetInitial string
+	// RetryInterval 等待模式下规则链处理失败后，重新处理消息的间隔，单位毫秒，默认1000
+	RetryInterval int
+	// MaxAttempts 等待模式下消息的最大处理次数，达到后跳过该消息并提交offset，默认10，小于等于0不限制
+	MaxAttempts int
+	// DeadLetterTopic 达到最大处理次数的消息发布到该主题，为空只记录日志
+	// 死信消息保留原消息的key和消息头，并在消息头中增加 error、topic、partition 和 offset
+	DeadLetterTopic string
+}
+
+// ToKafkaConfig 转换成客户端配置
+func (c Config) ToKafkaConfig() kafka.Config {
+	return kafka.Config{
+		Server:        c.Server,
+		ClientId:      c.ClientId,
+		Version:       c.Version,
+		OffsetInitial: c.OffsetInitial,
+	}
+}
+
+var _ endpoint.AckableMessage = (*RequestMessage)(nil)
+
+// RequestMessage kafka 请求消息
+type RequestMessage struct {
+	headers textproto.MIMEHeader
+	request *sarama.ConsumerMessage
+	body    []byte
+	msg     *types.RuleMsg
+	err     error
+	//确认结果
+	acked   bool
+	nackErr error
+	locker  sync.Mutex
+}
+
+// Body 获取请求体
+func (r *RequestMessage) Body() []byte {
+	if r.body == nil && r.request != nil {
+		r.body = r.request.Value
+	}
+	return r.body
+}
+
+// Headers 获取kafka消息头
+func (r *RequestMessage) Headers() textproto.MIMEHeader {
+	if r.headers == nil {
+		r.headers = make(map[string][]string)
+		if r.request != nil {
+			for _, item := range r.request.Headers {
+				if item != nil {
+					r.headers.Add(string(item.Key), string(item.Value))
+				}
+			}
+			r.headers.Set(KeyTopic, r.request.Topic)
+		}
+	}
+	return r.headers
+}
+
+// From 获取主题
+func (r *RequestMessage) From() string {
+	if r.request == nil {
+		return ""
+	}
+	return r.request.Topic
+}
+
+// GetParam 不提供获取参数
+func (r *RequestMessage) GetParam(key string) string {
+	return ""
+}
+
+func (r *RequestMessage) SetMsg(msg *types.RuleMsg) {
+	r.msg = msg
+}
+
+func (r *RequestMessage) GetMsg() *types.RuleMsg {
+	if r.msg == nil {
+		//默认指定是JSON格式，如果不是该类型，请在process函数中修改
+		ruleMsg := types.NewMsg(0, r.From(), types.JSON, types.NewMetadata(), string(r.Body()))
+		if r.request != nil {
+			ruleMsg.Metadata.PutValue(KeyTopic, r.request.Topic)
+			ruleMsg.Metadata.PutValue(KeyKey, string(r.request.Key))
+			ruleMsg.Metadata.PutValue(KeyPartition, strconv.Itoa(int(r.request.Partition)))
+			ruleMsg.Metadata.PutValue(KeyOffset, strconv.FormatInt(r.request.Offset, 10))
+		}
+		r.msg = &ruleMsg
+	}
+	return r.msg
+}
+
+// SetStatusCode 不提供设置状态码
+func (r *RequestMessage) SetStatusCode(statusCode int) {
+}
+
+// SetBody 设置消息体
+func (r *RequestMessage) SetBody(body []byte) {
+	r.body = body
+}
+
+func (r *RequestMessage) SetError(err error) {
+	r.err = err
+}
+
+func (r *RequestMessage) GetError() error {
+	return r.err
+}
+
+// Request 获取原始kafka消息
+func (r *RequestMessage) Request() *sarama.ConsumerMessage {
+	return r.request
+}
+
+// Ack 确认消息，offset由端点在消息处理结束后提交
+func (r *RequestMessage) Ack() error {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	r.acked = true
+	return nil
+}
+
+// Nack 规则链处理失败，端点不提交offset，间隔RetryInterval后重新处理
+func (r *RequestMessage) Nack(err error) error {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	r.nackErr = err
+	return nil
+}
+
+// ackResult 获取确认结果，ok=false表示没有调用Ack或Nack
+func (r *RequestMessage) ackResult() (ok bool, err error) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	return r.acked || r.nackErr != nil, r.nackErr
+}
+
+// ResponseMessage kafka 响应消息
+type ResponseMessage struct {
+	headers  textproto.MIMEHeader
+	request  *sarama.ConsumerMessage
+	response *kafka.Client
+	body     []byte
+	msg      *types.RuleMsg
+	err      error
+	locker   sync.Mutex
+}
+
+func (r *ResponseMessage) Body() []byte {
+	return r.body
+}
+
+func (r *ResponseMessage) Headers() textproto.MIMEHeader {
+	if r.headers == nil {
+		r.headers = make(map[string][]string)
+	}
+	return r.headers
+}
+
+func (r *ResponseMessage) From() string {
+	if r.request == nil {
+		return ""
+	}
+	return r.request.Topic
+}
+
+// GetParam 不提供获取参数
+func (r *ResponseMessage) GetParam(key string) string {
+	return ""
+}
+
+func (r *ResponseMessage) SetMsg(msg *types.RuleMsg) {
+	r.msg = msg
+}
+
+func (r *ResponseMessage) GetMsg() *types.RuleMsg {
+	return r.msg
+}
+
+func (r *ResponseMessage) SetStatusCode(statusCode int) {
+}
+
+// 从msg.Metadata或者响应头获取
+func (r *ResponseMessage) getMetadataValue(metadataName, headerName string) string {
+	var v string
+	if r.GetMsg() != nil {
+		metadata := r.GetMsg().Metadata
+		v = metadata.GetValue(metadataName)
+	}
+	if v == "" {
+		return r.Headers().Get(headerName)
+	} else {
+		return v
+	}
+}
+
+// SetBody 设置响应体，如果指定了响应主题，则把响应体发布到该主题
+func (r *ResponseMessage) SetBody(body []byte) {
+	r.body = body
+	topic := r.getMetadataValue(KeyResponseTopic, KeyResponseTopic)
+	if topic != "" && r.response != nil {
+		key := r.getMetadataValue(KeyResponseKey, KeyResponseKey)
+		if _, _, err := r.response.Publish(topic, key, r.body, nil); err != nil {
+			r.SetError(err)
+		}
+	}
+}
+
+func (r *ResponseMessage) SetError(err error) {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	r.err = err
+}
+
+func (r *ResponseMessage) GetError() error {
+	r.locker.Lock()
+	defer r.locker.Unlock()
+	return r.err
+}
+
+// Response 获取用于发布响应的客户端
+func (r *ResponseMessage) Response() *kafka.Client {
+	return r.response
+}
+
+// Kafka kafka 接收端端点，以消费者组方式订阅路由的主题
+type Kafka struct {
+	impl.BaseEndpoint
+	base.SharedNode[*kafka.Client]
+	RuleConfig types.Config
+	Config     Config
+	client     *kafka.Client
+	group      sarama.ConsumerGroup
+	started    bool
+	// cancel 停止消费
+	cancel context.CancelFunc
+	// sessionCancel 结束当前消费者组会话，用于订阅主题变化后重新加入消费者组
+	sessionCancel context.CancelFunc
+	sessionLock   sync.Mutex
+	done          chan struct{}
+}
+
+// Type 组件类型
+func (x *Kafka) Type() string {
+	return Type
+}
+
+func (x *Kafka) New() types.Node {
+	return &Kafka{Config: Config{
+		Server:        "127.0.0.1:9092",
+		GroupId:       "rulego",
+		RetryInterval: 1000,
+		MaxAttempts:   10,
+	}}
+}
+
+// Init 初始化
+func (x *Kafka) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	err := maps.Map2Struct(configuration, &x.Config)
+	x.RuleConfig = ruleConfig
+	_ = x.SharedNode.Init(x.RuleConfig, x.Type(), x.Config.Server, false, func() (*kafka.Client, error) {
+		return x.initClient()
+	})
+	return err
+}
+
+// Destroy 销毁
+func (x *Kafka) Destroy() {
+	_ = x.Close()
+}
+
+func (x *Kafka) Close() error {
+	x.Lock()
+	cancel, group, done := x.cancel, x.group, x.done
+	x.cancel, x.group, x.done = nil, nil, nil
+	x.started = false
+	x.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+	var err error
+	if group != nil {
+		err = group.Close()
+	}
+	if done != nil {
+		<-done
+	}
+	if x.client != nil {
+		if closeErr := x.client.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+		x.client = nil
+	}
+	return err
+}
+
+func (x *Kafka) Id() string {
+	return x.Config.Server
+}
+
+func (x *Kafka) AddRouter(router endpoint.Router, params ...interface{}) (string, error) {
+	if router == nil {
+		return "", errors.New("router can not nil")
+	}
+	if router.FromToString() == "" {
+		return "", errors.New("router from topic can not empty")
+	}
+	x.CheckAndSetRouterId(router)
+	x.saveRouter(router)
+	//服务已经启动，重新加入消费者组
+	x.resubscribe()
+	return router.GetId(), nil
+}
+
+func (x *Kafka) RemoveRouter(routerId string, params ...interface{}) error {
+	router := x.deleteRouter(routerId)
+	if router == nil {
+		return fmt.Errorf("router: %s not found", routerId)
+	}
+	x.resubscribe()
+	return nil
+}
+
+func (x *Kafka) Start() error {
+	x.Lock()
+	defer x.Unlock()
+	if x.started {
+		return nil
+	}
+	client, err := x.SharedNode.Get()
+	if err != nil {
+		return err
+	}
+	group, err := sarama.NewConsumerGroupFromClient(x.Config.GroupId, client.Client())
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	x.group = group
+	x.cancel = cancel
+	x.done = make(chan struct{})
+	x.started = true
+	go x.consume(ctx, group, x.done)
+	return nil
+}
+
+// consume 加入消费者组并消费，订阅主题变化或者会话结束后重新加入
+func (x *Kafka) consume(ctx context.Context, group sarama.ConsumerGroup, done chan struct{}) {
+	defer close(done)
+	go func() {
+		for err := range group.Errors() {
+			x.Printf("kafka endpoint consumer group err :%v", err)
+		}
+	}()
+	for ctx.Err() == nil {
+		sessionCtx, sessionCancel := context.WithCancel(ctx)
+		x.sessionLock.Lock()
+		x.sessionCancel = sessionCancel
+		x.sessionLock.Unlock()
+
+		if topics := x.topics(); len(topics) == 0 {
+			//没有订阅主题，等待添加路由
+			<-sessionCtx.Done()
+		} else if err := group.Consume(sessionCtx, topics, &groupHandler{endpoint: x}); err != nil {
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+				sessionCancel()
+				return
+			}
+			x.Printf("kafka endpoint consume err :%v", err)
+			select {
+			case <-sessionCtx.Done():
+			case <-time.After(x.retryInterval()):
+			}
+		}
+		sessionCancel()
+	}
+}
+
+// resubscribe 结束当前消费者组会话，使用最新的主题列表重新加入
+func (x *Kafka) resubscribe() {
+	x.sessionLock.Lock()
+	defer x.sessionLock.Unlock()
+	if x.sessionCancel != nil {
+		x.sessionCancel()
+	}
+}
+
+// topics 获取所有路由订阅的主题
+func (x *Kafka) topics() []string {
+	x.RLock()
+	defer x.RUnlock()
+	var topics []string
+	var exists = make(map[string]bool)
+	for _, router := range x.RouterStorage {
+		if topic := router.FromToString(); topic != "" && !exists[topic] {
+			exists[topic] = true
+			topics = append(topics, topic)
+		}
+	}
+	return topics
+}
+
+// routers 获取订阅指定主题的路由
+func (x *Kafka) routers(topic string) []endpoint.Router {
+	x.RLock()
+	defer x.RUnlock()
+	var routers []endpoint.Router
+	for _, router := range x.RouterStorage {
+		if router.FromToString() == topic {
+			routers = append(routers, router)
+		}
+	}
+	return routers
+}
+
+// 存储路由
+func (x *Kafka) saveRouter(routers ...endpoint.Router) {
+	x.Lock()
+	defer x.Unlock()
+	if x.RouterStorage == nil {
+		x.RouterStorage = make(map[string]endpoint.Router)
+	}
+	for _, item := range routers {
+		x.RouterStorage[item.GetId()] = item
+	}
+}
+
+// 从存储器中删除路由
+func (x *Kafka) deleteRouter(id string) endpoint.Router {
+	x.Lock()
+	defer x.Unlock()
+	if x.RouterStorage != nil {
+		if router, ok := x.RouterStorage[id]; ok {
+			delete(x.RouterStorage, id)
+			return router
+		}
+	}
+	return nil
+}
+
+// handle 把消息交给订阅该主题的路由处理，等待模式的路由处理失败则间隔RetryInterval重新处理，
+// 直到全部成功或者达到MaxAttempts返回true，如果会话在此期间结束返回false，消息不提交
+func (x *Kafka) handle(ctx context.Context, client *kafka.Client, msg *sarama.ConsumerMessage) bool {
+	pending := x.routers(msg.Topic)
+	for attempts := 1; ; attempts++ {
+		var failed []endpoint.Router
+		var lastErr error
+		for _, router := range pending {
+			if err := x.process(client, router, msg); err != nil {
+				x.Printf("kafka endpoint process topic=%s partition=%d offset=%d err :%v", msg.Topic, msg.Partition, msg.Offset, err)
+				failed = append(failed, router)
+				lastErr = err
+			}
+		}
+		if len(failed) == 0 {
+			return true
+		}
+		if x.Config.MaxAttempts > 0 && attempts >= x.Config.MaxAttempts {
+			return x.deadLetter(ctx, client, msg, lastErr)
+		}
+		pending = failed
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(x.retryInterval()):
+		}
+	}
+}
+
+// deadLetter 跳过达到最大处理次数的消息，如果配置了DeadLetterTopic，发布到死信主题
+// 发布失败则间隔RetryInterval重新发布，如果会话在此期间结束返回false，消息不提交
+func (x *Kafka) deadLetter(ctx context.Context, client *kafka.Client, msg *sarama.ConsumerMessage, err error) bool {
+	x.Printf("kafka endpoint skip topic=%s partition=%d offset=%d after %d attempts err :%v", msg.Topic, msg.Partition, msg.Offset, x.Config.MaxAttempts, err)
+	if x.Config.DeadLetterTopic == "" {
+		return true
+	}
+	headers := make(map[string]string)
+	for _, item := range msg.Headers {
+		if item != nil {
+			headers[string(item.Key)] = string(item.Value)
+		}
+	}
+	if err != nil {
+		headers["error"] = err.Error()
+	}
+	headers[KeyTopic] = msg.Topic
+	headers[KeyPartition] = strconv.Itoa(int(msg.Partition))
+	headers[KeyOffset] = strconv.FormatInt(msg.Offset, 10)
+	for {
+		_, _, publishErr := client.Publish(x.Config.DeadLetterTopic, string(msg.Key), msg.Value, headers)
+		if publishErr == nil {
+			return true
+		}
+		x.Printf("kafka endpoint publish dead letter topic=%s err :%v", x.Config.DeadLetterTopic, publishErr)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(x.retryInterval()):
+		}
+	}
+}
+
+// process 执行路由，如果路由是等待模式，返回消息否定确认的错误
+func (x *Kafka) process(client *kafka.Client, router endpoint.Router, msg *sarama.ConsumerMessage) (err error) {
+	wait := router.GetFrom() != nil && router.GetFrom().GetTo() != nil && router.GetFrom().GetTo().IsWait()
+	defer func() {
+		//捕捉异常
+		if e := recover(); e != nil {
+			x.Printf("kafka endpoint handler err :\n%v", runtime.Stack())
+			if wait {
+				err = fmt.Errorf("%v", e)
+			}
+		}
+	}()
+	request := &RequestMessage{
+		request: msg,
+	}
+	exchange := &endpoint.Exchange{
+		In: request,
+		Out: &ResponseMessage{
+			request:  msg,
+			response: client,
+		}}
+	x.DoProcess(context.Background(), router, exchange)
+	if wait {
+		if ok, nackErr := request.ackResult(); ok {
+			return nackErr
+		}
+		//执行器不支持确认，使用执行结果的错误
+		return exchange.Out.GetError()
+	}
+	return nil
+}
+
+func (x *Kafka) retryInterval() time.Duration {
+	if x.Config.RetryInterval <= 0 {
+		return time.Second
+	}
+	return time.Duration(x.Config.RetryInterval) * time.Millisecond
+}
+
+func (x *Kafka) Printf(format string, v ...interface{}) {
+	if x.RuleConfig.Logger != nil {
+		x.RuleConfig.Logger.Printf(format, v...)
+	}
+}
+
+// initClient 初始化客户端
+func (x *Kafka) initClient() (*kafka.Client, error) {
+	x.SharedNode.Locker.Lock()
+	defer x.SharedNode.Locker.Unlock()
+	if x.client != nil {
+		return x.client, nil
+	}
+	var err error
+	x.client, err = kafka.NewClient(x.Config.ToKafkaConfig())
+	return x.client, err
+}
+
+// groupHandler 消费者组会话处理器
+type groupHandler struct {
+	endpoint *Kafka
+}
+
+func (h *groupHandler) Setup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+func (h *groupHandler) Cleanup(sarama.ConsumerGroupSession) error {
+	return nil
+}
+
+// ConsumeClaim 顺序处理分区消息，处理完成后提交offset
+func (h *groupHandler) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	client, err := h.endpoint.SharedNode.Get()
+	if err != nil {
+		return err
+	}
+	for {
+		select {
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+			if !h.endpoint.handle(session.Context(), client, msg) {
+				//会话结束，未处理成功的消息不提交，由新的会话重新消费
+				return nil
+			}
+			session.MarkMessage(msg, "")
+			session.Commit()
+		case <-session.Context().Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,306 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/IBM/sarama"
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/engine"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+)
+
+const (
+	testGroupId = "rulego-test"
+	testTopic   = "device.msg"
+)
+
+// 测试请求/响应消息
+func TestKafkaMessage(t *testing.T) {
+	t.Run("Request", func(t *testing.T) {
+		var request = &RequestMessage{}
+		test.EndpointMessage(t, request)
+	})
+	t.Run("Response", func(t *testing.T) {
+		var response = &ResponseMessage{}
+		test.EndpointMessage(t, response)
+	})
+	t.Run("RequestMetadata", func(t *testing.T) {
+		var request = &RequestMessage{request: &sarama.ConsumerMessage{
+			Topic:     testTopic,
+			Key:       []byte("aa"),
+			Value:     []byte("{\"temperature\":41}"),
+			Partition: 1,
+			Offset:    10,
+			Headers:   []*sarama.RecordHeader{{Key: []byte("traceparent"), Value: []byte("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")}},
+		}}
+		msg := request.GetMsg()
+		assert.Equal(t, testTopic, msg.Type)
+		assert.Equal(t, "{\"temperature\":41}", msg.Data)
+		assert.Equal(t, "aa", msg.Metadata.GetValue(KeyKey))
+		assert.Equal(t, "1", msg.Metadata.GetValue(KeyPartition))
+		assert.Equal(t, "10", msg.Metadata.GetValue(KeyOffset))
+		assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", request.Headers().Get("traceparent"))
+		assert.Equal(t, testTopic, request.Headers().Get(KeyTopic))
+	})
+}
+
+func TestRouterId(t *testing.T) {
+	config := types.NewConfig()
+	var ep = &Endpoint{}
+	err := ep.Init(config, types.Configuration{"server": "127.0.0.1:9092"})
+	assert.Nil(t, err)
+	assert.Equal(t, "127.0.0.1:9092", ep.Id())
+	router := impl.NewRouter().SetId("r1").From(testTopic).End()
+	routerId, _ := ep.AddRouter(router)
+	assert.Equal(t, "r1", routerId)
+
+	router = impl.NewRouter().From(testTopic).End()
+	routerId, _ = ep.AddRouter(router)
+	assert.Equal(t, testTopic, routerId)
+	assert.Equal(t, []string{testTopic}, ep.topics())
+
+	_, err = ep.AddRouter(impl.NewRouter().From("").End())
+	assert.NotNil(t, err)
+
+	err = ep.RemoveRouter("r1")
+	assert.Nil(t, err)
+	err = ep.RemoveRouter(testTopic)
+	assert.Nil(t, err)
+	err = ep.RemoveRouter(testTopic)
+	assert.Equal(t, fmt.Sprintf("router: %s not found", testTopic), err.Error())
+	assert.Equal(t, 0, len(ep.topics()))
+}
+
+// flakyNode 前 failures 次处理offset为1的消息时失败
+type flakyNode struct {
+	lock     sync.Mutex
+	attempts map[string]int
+	failures int
+}
+
+func (x *flakyNode) Type() string {
+	return "test/kafkaFlaky"
+}
+
+func (x *flakyNode) New() types.Node {
+	return x
+}
+
+func (x *flakyNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	return nil
+}
+
+func (x *flakyNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	offset := msg.Metadata.GetValue(KeyOffset)
+	x.lock.Lock()
+	x.attempts[offset]++
+	attempts := x.attempts[offset]
+	x.lock.Unlock()
+	if offset == "1" && attempts <= x.failures {
+		ctx.TellFailure(msg, errors.New("flaky error"))
+	} else {
+		ctx.TellSuccess(msg)
+	}
+}
+
+func (x *flakyNode) Destroy() {
+}
+
+func (x *flakyNode) getAttempts(offset string) int {
+	x.lock.Lock()
+	defer x.lock.Unlock()
+	return x.attempts[offset]
+}
+
+const testDeadLetterTopic = "device.msg.dlq"
+
+// newTestBroker 创建本地kafka broker替身，分区0有offset为0和1的两条消息
+func newTestBroker(t *testing.T) *sarama.MockBroker {
+	broker := sarama.NewMockBroker(t, 1)
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"ApiVersionsRequest": sarama.NewMockApiVersionsResponse(t),
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader(testTopic, 0, broker.BrokerID()).
+			SetLeader(testDeadLetterTopic, 0, broker.BrokerID()),
+		"ProduceRequest": sarama.NewMockProduceResponse(t),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorGroup, testGroupId, broker),
+		"JoinGroupRequest": sarama.NewMockJoinGroupResponse(t).SetGroupProtocol(sarama.RangeBalanceStrategyName),
+		"SyncGroupRequest": sarama.NewMockSyncGroupResponse(t).SetMemberAssignment(
+			&sarama.ConsumerGroupMemberAssignment{
+				Version: 1,
+				Topics:  map[string][]int32{testTopic: {0}},
+			}),
+		"HeartbeatRequest":    sarama.NewMockHeartbeatResponse(t),
+		"LeaveGroupRequest":   sarama.NewMockLeaveGroupResponse(t),
+		"OffsetCommitRequest": sarama.NewMockOffsetCommitResponse(t),
+		"OffsetFetchRequest": sarama.NewMockOffsetFetchResponse(t).
+			SetOffset(testGroupId, testTopic, 0, 0, "", sarama.ErrNoError),
+		"OffsetRequest": sarama.NewMockOffsetResponse(t).
+			SetOffset(testTopic, 0, sarama.OffsetOldest, 0).
+			SetOffset(testTopic, 0, sarama.OffsetNewest, 2),
+		"FetchRequest": sarama.NewMockFetchResponse(t, 2).
+			SetMessage(testTopic, 0, 0, sarama.StringEncoder("{\"temperature\":41}")).
+			SetMessage(testTopic, 0, 1, sarama.StringEncoder("{\"temperature\":42}")).
+			SetHighWaterMark(testTopic, 0, 2),
+	})
+	return broker
+}
+
+// committedOffsets 获取broker收到的分区0的提交offset
+func committedOffsets(broker *sarama.MockBroker) []int64 {
+	var offsets []int64
+	for _, item := range broker.History() {
+		if req, ok := item.Request.(*sarama.OffsetCommitRequest); ok {
+			if offset, _, err := req.Offset(testTopic, 0); err == nil {
+				offsets = append(offsets, offset)
+			}
+		}
+	}
+	return offsets
+}
+
+func TestKafkaEndpoint(t *testing.T) {
+	broker := newTestBroker(t)
+	defer broker.Close()
+
+	node := &flakyNode{attempts: make(map[string]int), failures: 1}
+	_ = engine.Registry.Register(node)
+	defer func() {
+		_ = engine.Registry.Unregister(node.Type())
+	}()
+	config := engine.NewConfig(types.WithDefaultPool())
+	_, err := engine.New("testKafkaEndpoint", []byte(`{
+	  "ruleChain": {"id": "testKafkaEndpoint"},
+	  "metadata": {"nodes": [{"id": "s1", "type": "test/kafkaFlaky"}]}
+	}`), engine.WithConfig(config))
+	assert.Nil(t, err)
+	defer engine.Del("testKafkaEndpoint")
+
+	var ep = &Endpoint{}
+	err = ep.Init(config, types.Configuration{
+		"server":        broker.Addr(),
+		"groupId":       testGroupId,
+		"offsetInitial": "oldest",
+		"retryInterval": 50,
+	})
+	assert.Nil(t, err)
+	defer ep.Destroy()
+
+	var lock sync.Mutex
+	var results []string
+	router := impl.NewRouter().From(testTopic).To("chain:testKafkaEndpoint").Wait().Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		msg := exchange.In.GetMsg()
+		lock.Lock()
+		defer lock.Unlock()
+		if exchange.Out.GetError() != nil {
+			results = append(results, msg.Metadata.GetValue(KeyOffset)+":"+exchange.Out.GetError().Error())
+			//失败时offset 1 未提交
+			for _, offset := range committedOffsets(broker) {
+				assert.True(t, offset <= 1)
+			}
+		} else {
+			results = append(results, msg.Metadata.GetValue(KeyOffset))
+		}
+		return true
+	}).End()
+	_, err = ep.AddRouter(router)
+	assert.Nil(t, err)
+	err = ep.Start()
+	assert.Nil(t, err)
+
+	//等待消费并提交
+	for i := 0; i < 100; i++ {
+		offsets := committedOffsets(broker)
+		if len(offsets) > 0 && offsets[len(offsets)-1] == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+	lock.Lock()
+	assert.Equal(t, []string{"0", "1:flaky error", "1"}, results)
+	lock.Unlock()
+	assert.Equal(t, 1, node.getAttempts("0"))
+	assert.Equal(t, 2, node.getAttempts("1"))
+	assert.Equal(t, []int64{1, 2}, committedOffsets(broker))
+}
+
+// 测试达到最大处理次数后发布到死信主题并提交offset
+func TestKafkaEndpointDeadLetter(t *testing.T) {
+	broker := newTestBroker(t)
+	defer broker.Close()
+
+	node := &flakyNode{attempts: make(map[string]int), failures: 100}
+	_ = engine.Registry.Register(node)
+	defer func() {
+		_ = engine.Registry.Unregister(node.Type())
+	}()
+	config := engine.NewConfig(types.WithDefaultPool())
+	_, err := engine.New("testKafkaDeadLetter", []byte(`{
+	  "ruleChain": {"id": "testKafkaDeadLetter"},
+	  "metadata": {"nodes": [{"id": "s1", "type": "test/kafkaFlaky"}]}
+	}`), engine.WithConfig(config))
+	assert.Nil(t, err)
+	defer engine.Del("testKafkaDeadLetter")
+
+	var ep = &Endpoint{}
+	assert.Equal(t, 10, ep.New().(*Endpoint).Config.MaxAttempts)
+	err = ep.Init(config, types.Configuration{
+		"server":          broker.Addr(),
+		"groupId":         testGroupId,
+		"offsetInitial":   "oldest",
+		"retryInterval":   20,
+		"maxAttempts":     3,
+		"deadLetterTopic": testDeadLetterTopic,
+	})
+	assert.Nil(t, err)
+	defer ep.Destroy()
+
+	_, err = ep.AddRouter(impl.NewRouter().From(testTopic).To("chain:testKafkaDeadLetter").Wait().End())
+	assert.Nil(t, err)
+	err = ep.Start()
+	assert.Nil(t, err)
+
+	for i := 0; i < 100; i++ {
+		offsets := committedOffsets(broker)
+		if len(offsets) > 0 && offsets[len(offsets)-1] == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond * 50)
+	}
+	assert.Equal(t, 3, node.getAttempts("1"))
+	assert.Equal(t, []int64{1, 2}, committedOffsets(broker))
+
+	//只有死信消息会发布
+	var deadLetters int
+	for _, item := range broker.History() {
+		if _, ok := item.Request.(*sarama.ProduceRequest); ok {
+			deadLetters++
+		}
+	}
+	assert.Equal(t, 1, deadLetters)
+}
@@ -27,6 +27,14 @@
 // define topic subscriptions and their corresponding rule chain or component destinations.
 // It also provides flexibility in handling different MQTT QoS levels and message formats.
 //
+// RequestMessage implements endpoint.AckableMessage. With Config.AutoAckDisabled, QoS 1/2 messages
+// are acknowledged only after the rule chain has succeeded according to the router's AckPolicy.
+// On failure, the message is processed again locally up to Config.MaxRetries times; after that it
+// stays unacknowledged and the broker redelivers it when the client reconnects with CleanSession=false.
+//
+// MQTT 3.1.1 has no user properties. With Config.TraceEnvelope, payloads wrapped in a trace.Envelope
+// (see the mqttClient node) are unwrapped and the W3C trace context is passed to the rule chain.
+//
 // This package integrates with the broader RuleGo ecosystem, enabling seamless
 // data flow from MQTT messages to rule processing and back to MQTT responses.
 package mqtt
@@ -47,6 +55,7 @@ import (
 	"github.com/rulego/rulego/endpoint/impl"
 	"github.com/rulego/rulego/utils/maps"
 	"github.com/rulego/rulego/utils/runtime"
+	"github.com/rulego/rulego/utils/trace"
 )
 
 // Type 组件类型
@@ -61,6 +70,8 @@ const (
 // Endpoint 别名
 type Endpoint = Mqtt
 
+var _ endpoint.AckableMessage = (*RequestMessage)(nil)
+
 // RequestMessage http请求消息
 type RequestMessage struct {
 	headers textproto.MIMEHeader
@@ -68,6 +79,8 @@ type RequestMessage struct {
 	body    []byte
 	msg     *types.RuleMsg
 	err     error
+	//规则链处理失败回调
+	onNack func(err error)
 }
 
 // Body 获取请求体
@@ -138,6 +151,22 @@ func (r *RequestMessage) Request() paho.Message {
 	return r.request
 }
 
+// Ack 确认消息，如果客户端关闭了自动确认，则向broker发送确认
+func (r *RequestMessage) Ack() error {
+	if r.request != nil {
+		r.request.Ack()
+	}
+	return nil
+}
+
+// Nack 规则链处理失败，根据端点配置本地重新处理
+func (r *RequestMessage) Nack(err error) error {
+	if r.onNack != nil {
+		r.onNack(err)
+	}
+	return nil
+}
+
 // ResponseMessage http响应消息
 type ResponseMessage struct {
 	headers  textproto.MIMEHeader
@@ -353,23 +382,53 @@ func (x *Mqtt) deleteRouter(id string) endpoint.Router {
 
 func (x *Mqtt) handler(router endpoint.Router) func(c paho.Client, data paho.Message) {
 	return func(c paho.Client, data paho.Message) {
-		defer func() {
-			//捕捉异常
-			if e := recover(); e != nil {
-				x.Printf("mqtt endpoint handler err :\n%v", runtime.Stack())
+		x.process(c, router, data, 0)
+	}
+}
+
+// process 处理消息，规则链处理失败则间隔RetryInterval重新处理，最多重试MaxRetries次
+// 重试次数用完后，如果关闭了自动确认，消息不确认，由broker重连后重新投递
+func (x *Mqtt) process(c paho.Client, router endpoint.Router, data paho.Message, retries int) {
+	defer func() {
+		//捕捉异常
+		if e := recover(); e != nil {
+			x.Printf("mqtt endpoint handler err :\n%v", runtime.Stack())
+		}
+	}()
+	in := &RequestMessage{
+		request: data,
+		onNack: func(err error) {
+			if retries < x.Config.MaxRetries {
+				time.AfterFunc(x.retryInterval(), func() {
+					x.process(c, router, data, retries+1)
+				})
+			} else {
+				x.Printf("mqtt endpoint process topic=%s retries=%d err :%v", data.Topic(), retries, err)
 			}
-		}()
-		exchange := &endpoint.Exchange{
-			In: &RequestMessage{
-				request: data,
-			},
-			Out: &ResponseMessage{
-				request:  data,
-				response: c,
-			}}
-
-		x.DoProcess(context.Background(), router, exchange)
+		},
+	}
+	//从负荷信封中读取链路上下文
+	if x.Config.TraceEnvelope {
+		if sc, payload, ok := trace.UnwrapEnvelope(data.Payload()); ok {
+			in.body = payload
+			trace.Inject(sc, in.Headers().Set)
+		}
+	}
+	exchange := &endpoint.Exchange{
+		In: in,
+		Out: &ResponseMessage{
+			request:  data,
+			response: c,
+		}}
+
+	x.DoProcess(context.Background(), router, exchange)
+}
+
+func (x *Mqtt) retryInterval() time.Duration {
+	if x.Config.RetryInterval <= 0 {
+		return time.Second
 	}
+	return time.Duration(x.Config.RetryInterval) * time.Millisecond
 }
 
 func (x *Mqtt) Printf(format string, v ...interface{}) {
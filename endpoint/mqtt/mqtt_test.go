@@ -10,6 +10,7 @@ import (
 	"github.com/rulego/rulego/test"
 	"github.com/rulego/rulego/test/assert"
 	"github.com/rulego/rulego/utils/maps"
+	"github.com/rulego/rulego/utils/trace"
 	"os"
 	"reflect"
 	"testing"
@@ -176,3 +177,39 @@ func startServer(t *testing.T, stop chan struct{}) {
 	<-stop
 	ep.Destroy()
 }
+
+type testMessage struct {
+	topic   string
+	payload []byte
+}
+
+func (m *testMessage) Duplicate() bool   { return false }
+func (m *testMessage) Qos() byte         { return 0 }
+func (m *testMessage) Retained() bool    { return false }
+func (m *testMessage) Topic() string     { return m.topic }
+func (m *testMessage) MessageID() uint16 { return 1 }
+func (m *testMessage) Payload() []byte   { return m.payload }
+func (m *testMessage) Ack()              {}
+
+// 测试从负荷信封中读取链路上下文
+func TestTraceEnvelope(t *testing.T) {
+	traceParent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, _ := trace.ParseTraceParent(traceParent)
+	for _, enabled := range []bool{true, false} {
+		ep := &Endpoint{Config: mqtt.Config{TraceEnvelope: enabled}}
+		var msg types.RuleMsg
+		router := impl.NewRouter().From("/device/msg").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			msg = *exchange.In.GetMsg()
+			return false
+		}).End()
+		data := trace.WrapEnvelope(sc, []byte(msgContent1))
+		ep.process(nil, router, &testMessage{topic: "/device/msg", payload: data}, 0)
+		if enabled {
+			assert.Equal(t, msgContent1, msg.Data)
+			assert.Equal(t, traceParent, msg.Metadata.GetValue(trace.TraceParentKey))
+		} else {
+			assert.Equal(t, string(data), msg.Data)
+			assert.Equal(t, "", msg.Metadata.GetValue(trace.TraceParentKey))
+		}
+	}
+}
@@ -0,0 +1,165 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package net
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/engine"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/utils/codec"
+)
+
+// 测试帧编解码器和按帧头部字段路由
+func TestNetEndpointCodec(t *testing.T) {
+	server := "127.0.0.1:8890"
+	//[命令 2字节][长度 2字节][数据]
+	codecConfig := map[string]interface{}{
+		"type":                codec.TypeLengthField,
+		"lengthFieldOffset":   2,
+		"lengthFieldSize":     2,
+		"initialBytesToStrip": 4,
+	}
+	ep := &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{
+		"server":   server,
+		"codec":    codecConfig,
+		"ackReply": "00ack",
+	})
+	assert.Nil(t, err)
+
+	received := make(chan types.RuleMsg, 10)
+	//回复内容的前两个字节是命令
+	reply := func(cmd string) endpoint.Process {
+		return func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			msg := exchange.In.GetMsg()
+			received <- *msg
+			exchange.Out.SetBody([]byte(cmd + msg.Data))
+			return false
+		}
+	}
+	_, err = ep.AddRouter(impl.NewRouter().From("", types.Configuration{
+		HeadersConfigKey: map[string]string{codec.HeaderPrefix: "^0001$"},
+	}).Process(reply("A1")).End())
+	assert.Nil(t, err)
+	_, err = ep.AddRouter(impl.NewRouter().From("^b", types.Configuration{
+		HeadersConfigKey: map[string]string{codec.HeaderPrefix: "^0002$"},
+	}).Process(reply("B2")).End())
+	assert.Nil(t, err)
+	_, err = ep.AddRouter(impl.NewRouter().From("", types.Configuration{
+		HeadersConfigKey: map[string]string{codec.HeaderPrefix: "("},
+	}).Process(reply("C3")).End())
+	assert.NotNil(t, err)
+	assert.Nil(t, ep.Start())
+	defer ep.Destroy()
+	time.Sleep(time.Millisecond * 100)
+
+	conn, err := net.Dial("tcp", server)
+	assert.Nil(t, err)
+	defer conn.Close()
+	frameCodec, _ := codec.New(codec.Config{Type: codec.TypeLengthField, LengthFieldOffset: 2, LengthFieldSize: 2, InitialBytesToStrip: 4})
+	reader := bufio.NewReader(conn)
+	send := func(data []byte) {
+		frame, err := frameCodec.Encode(data)
+		assert.Nil(t, err)
+		_, err = conn.Write(frame)
+		assert.Nil(t, err)
+	}
+	read := func() string {
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second * 3))
+		frame, err := frameCodec.Decode(reader)
+		assert.Nil(t, err)
+		return frame.Headers[codec.HeaderPrefix] + ":" + string(frame.Data)
+	}
+
+	send(append([]byte{0x00, 0x01}, "a\n1"...))
+	assert.Equal(t, "4131:a\n1", read())
+	assert.Equal(t, "3030:ack", read())
+	msg := <-received
+	assert.Equal(t, types.BINARY, msg.DataType)
+	assert.Equal(t, "0001", msg.Metadata.GetValue(codec.HeaderPrefix))
+	assert.Equal(t, "3", msg.Metadata.GetValue(codec.HeaderLength))
+
+	//头部字段和数据正则表达式都匹配
+	send(append([]byte{0x00, 0x02}, "x"...))
+	send(append([]byte{0x00, 0x02}, "b"...))
+	assert.Equal(t, "4232:b", read())
+	assert.Equal(t, "3030:ack", read())
+	assert.Equal(t, "b", (<-received).Data)
+	assert.Equal(t, 0, len(received))
+}
+
+// 测试 net 节点使用帧编解码器发送
+func TestNetNodeCodec(t *testing.T) {
+	server := "127.0.0.1:8891"
+	codecConfig := map[string]interface{}{
+		"type":     codec.TypeDelimiter,
+		"start":    "0x02",
+		"end":      "0x03",
+		"checksum": codec.ChecksumXor8,
+	}
+	ep := &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{"server": server, "codec": codecConfig})
+	assert.Nil(t, err)
+	received := make(chan string, 10)
+	_, err = ep.AddRouter(impl.NewRouter().From("").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		received <- exchange.In.GetMsg().Data
+		return false
+	}).End())
+	assert.Nil(t, err)
+	assert.Nil(t, ep.Start())
+	defer ep.Destroy()
+	time.Sleep(time.Millisecond * 100)
+
+	node, err := engine.Registry.NewNode("net")
+	assert.Nil(t, err)
+	err = node.Init(types.NewConfig(), types.Configuration{"server": server, "codec": codecConfig})
+	assert.Nil(t, err)
+	defer node.Destroy()
+	ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+		assert.Equal(t, types.Success, relationType)
+	})
+	node.OnMsg(ctx, ctx.NewMsg("TEST", types.NewMetadata(), "a\nb"))
+	node.OnMsg(ctx, ctx.NewMsg("TEST", types.NewMetadata(), "c"))
+	for _, expected := range []string{"a\nb", "c"} {
+		select {
+		case data := <-received:
+			assert.Equal(t, expected, data)
+		case <-time.After(time.Second * 3):
+			t.Fatal("timeout")
+		}
+	}
+
+	//校验失败的帧被丢弃
+	conn, err := net.Dial("tcp", server)
+	assert.Nil(t, err)
+	defer conn.Close()
+	_, _ = conn.Write([]byte{0x02, 'x', 0x00, 0x03, 0x02, 'y', 'y', 0x03})
+	select {
+	case data := <-received:
+		assert.Equal(t, "y", data)
+	case <-time.After(time.Second * 3):
+		t.Fatal("timeout")
+	}
+}
@@ -40,11 +40,13 @@ import (
 	"net/textproto"
 	"os"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/api/types/endpoint"
 	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/utils/codec"
 	"github.com/rulego/rulego/utils/maps"
 	"github.com/rulego/rulego/utils/runtime"
 )
@@ -56,11 +58,17 @@ const (
 	RemoteAddrKey = "remoteAddr"
 	// PingData 心跳数据
 	PingData = "ping"
+	// NackReplyErrorVar NackReply 中的错误信息变量
+	NackReplyErrorVar = "${error}"
+	// HeadersConfigKey 路由 from 配置中匹配帧头部字段的key，值是正则表达式，例如：{"headers":{"prefix":"^01"}}
+	HeadersConfigKey = "headers"
 )
 
 // Endpoint 别名
 type Endpoint = Net
 
+var _ endpoint.AckableMessage = (*RequestMessage)(nil)
+
 // RequestMessage 请求消息
 type RequestMessage struct {
 	headers textproto.MIMEHeader
@@ -68,6 +76,14 @@ type RequestMessage struct {
 	body    []byte
 	msg     *types.RuleMsg
 	err     error
+	//确认回复内容
+	ackReply string
+	//否定确认回复内容
+	nackReply string
+	//消息数据类型
+	dataType types.DataType
+	//编码回复内容，nil 原样回复
+	codec codec.Codec
 }
 
 func (r *RequestMessage) Body() []byte {
@@ -104,6 +120,9 @@ func (r *RequestMessage) SetMsg(msg *types.RuleMsg) {
 func (r *RequestMessage) GetMsg() *types.RuleMsg {
 	if r.msg == nil {
 		dataType := types.TEXT
+		if r.dataType != "" {
+			dataType = r.dataType
+		}
 		ruleMsg := types.NewMsg(0, r.From(), dataType, types.NewMetadata(), string(r.Body()))
 		r.msg = &ruleMsg
 	}
@@ -130,6 +149,27 @@ func (r *RequestMessage) Conn() net.Conn {
 	return r.conn
 }
 
+// Ack 规则链处理成功，如果配置了AckReply，则回复客户端
+func (r *RequestMessage) Ack() error {
+	return r.reply(r.ackReply)
+}
+
+// Nack 规则链处理失败，如果配置了NackReply，则回复客户端，由客户端决定是否重发
+func (r *RequestMessage) Nack(err error) error {
+	var errStr string
+	if err != nil {
+		errStr = err.Error()
+	}
+	return r.reply(strings.ReplaceAll(r.nackReply, NackReplyErrorVar, errStr))
+}
+
+func (r *RequestMessage) reply(data string) error {
+	if data == "" || r.conn == nil {
+		return nil
+	}
+	return write(r.conn, r.codec, []byte(data))
+}
+
 // ResponseMessage 响应消息
 type ResponseMessage struct {
 	headers textproto.MIMEHeader
@@ -138,6 +178,8 @@ type ResponseMessage struct {
 	body    []byte
 	msg     *types.RuleMsg
 	err     error
+	//编码响应内容，nil 原样响应
+	codec codec.Codec
 }
 
 func (r *ResponseMessage) Body() []byte {
@@ -181,11 +223,23 @@ func (r *ResponseMessage) SetBody(body []byte) {
 		r.SetError(errors.New("write err: conn is nil"))
 		return
 	}
-	if _, err := r.conn.Write(body); err != nil {
+	if err := write(r.conn, r.codec, body); err != nil {
 		r.SetError(err)
 	}
 }
 
+// write 使用编解码器编码后写入连接，codec 为 nil 原样写入
+func write(conn net.Conn, c codec.Codec, data []byte) error {
+	if c != nil {
+		var err error
+		if data, err = c.Encode(data); err != nil {
+			return err
+		}
+	}
+	_, err := conn.Write(data)
+	return err
+}
+
 func (r *ResponseMessage) SetError(err error) {
 	r.err = err
 }
@@ -202,6 +256,15 @@ type Config struct {
 	Server string
 	// 读取超时，用于设置读取数据的超时时间，单位为秒，可以为0表示不设置超时
 	ReadTimeout int
+	// AckReply 规则链处理成功后回复客户端的内容，为空不回复
+	AckReply string
+	// NackReply 规则链处理失败后回复客户端的内容，为空不回复，可以使用${error}引用错误信息
+	NackReply string
+	// Codec 帧编解码器，为空按行读取文本消息并原样响应
+	// 配置后响应和回复内容使用该编解码器编码，除 line 类型外，消息数据类型为 BINARY
+	// lengthField 类型编码时，内容中长度字段之前的字节作为帧前缀
+	// 例如：{"type":"lengthField","lengthFieldOffset":2,"lengthFieldSize":2,"initialBytesToStrip":4}
+	Codec *codec.Config
 }
 
 // RegexpRouter 正则表达式路由
@@ -212,6 +275,21 @@ type RegexpRouter struct {
 	router endpoint.Router
 	//正则表达式
 	regexp *regexp.Regexp
+	//帧头部字段正则表达式
+	headers map[string]*regexp.Regexp
+}
+
+// match 是否匹配帧数据和头部字段
+func (r *RegexpRouter) match(frame *codec.Frame) bool {
+	if r.regexp != nil && !r.regexp.Match(frame.Data) {
+		return false
+	}
+	for key, re := range r.headers {
+		if v, ok := frame.Headers[key]; !ok || !re.MatchString(v) {
+			return false
+		}
+	}
+	return true
 }
 
 // Net net endpoint组件
@@ -227,6 +305,8 @@ type Net struct {
 	listener net.Listener
 	// 路由映射表
 	routers map[string]*RegexpRouter
+	// 帧编解码器
+	codec codec.Codec
 }
 
 // Type 组件类型
@@ -244,10 +324,16 @@ func (ep *Net) New() types.Node {
 func (ep *Net) Init(ruleConfig types.Config, configuration types.Configuration) error {
 	// 将配置转换为EndpointConfiguration结构体
 	err := maps.Map2Struct(configuration, &ep.Config)
+	if err != nil {
+		return err
+	}
 	if ep.Config.Protocol == "" {
 		ep.Config.Protocol = "tcp"
 	}
 	ep.RuleConfig = ruleConfig
+	if ep.Config.Codec != nil {
+		ep.codec, err = codec.New(*ep.Config.Codec)
+	}
 	return err
 }
 
@@ -284,6 +370,10 @@ func (ep *Net) AddRouter(router endpoint.Router, params ...interface{}) (string,
 				regexpV = re
 			}
 		}
+		headers, err := routerHeaders(router)
+		if err != nil {
+			return "", err
+		}
 		ep.CheckAndSetRouterId(router)
 		ep.Lock()
 		defer ep.Unlock()
@@ -294,8 +384,9 @@ func (ep *Net) AddRouter(router endpoint.Router, params ...interface{}) (string,
 			return router.GetId(), fmt.Errorf("duplicate router %s", expr)
 		} else {
 			ep.routers[router.GetId()] = &RegexpRouter{
-				router: router,
-				regexp: regexpV,
+				router:  router,
+				regexp:  regexpV,
+				headers: headers,
 			}
 			return router.GetId(), nil
 		}
@@ -303,6 +394,27 @@ func (ep *Net) AddRouter(router endpoint.Router, params ...interface{}) (string,
 	}
 }
 
+// routerHeaders 编译路由 from 配置中的帧头部字段正则表达式
+func routerHeaders(router endpoint.Router) (map[string]*regexp.Regexp, error) {
+	from, ok := router.GetFrom().(*impl.From)
+	if !ok || from == nil || from.Config[HeadersConfigKey] == nil {
+		return nil, nil
+	}
+	var exprs map[string]string
+	if err := maps.Map2Struct(from.Config[HeadersConfigKey], &exprs); err != nil {
+		return nil, err
+	}
+	headers := make(map[string]*regexp.Regexp)
+	for key, expr := range exprs {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, err
+		}
+		headers[key] = re
+	}
+	return headers, nil
+}
+
 func (ep *Net) RemoveRouter(routerId string, params ...interface{}) error {
 	ep.Lock()
 	defer ep.Unlock()
@@ -389,6 +501,16 @@ func (x *ClientHandler) handler() {
 	})
 	// 创建一个缓冲读取器，用于读取客户端发送的数据
 	reader := bufio.NewReader(x.conn)
+	// 帧编解码器，没有配置按行读取，响应原样写入
+	frameCodec := x.endpoint.codec
+	decoder := frameCodec
+	dataType := types.BINARY
+	if frameCodec == nil {
+		decoder, _ = codec.New(codec.Config{Type: codec.TypeLine})
+		dataType = types.TEXT
+	} else if t := x.endpoint.Config.Codec.Type; t == "" || t == codec.TypeLine {
+		dataType = types.TEXT
+	}
 	// 循环读取客户端发送的数据
 	for {
 		// 设置读取超时
@@ -400,9 +522,13 @@ func (x *ClientHandler) handler() {
 			}
 		}
 
-		// 读取一行数据，直到遇到\n或者\t\n为止
-		data, _, err := reader.ReadLine()
-
+		// 读取一帧数据，默认读取一行，直到遇到\n或者\r\n为止
+		frame, err := decoder.Decode(reader)
+		if errors.Is(err, codec.ErrChecksum) {
+			//丢弃校验失败的帧
+			x.endpoint.Printf("net endpoint decode err :%v", err)
+			continue
+		}
 		if err != nil && err.Error() != os.ErrDeadlineExceeded.Error() {
 			if e, ok := err.(*net.OpError); ok {
 				if e.Err != os.ErrDeadlineExceeded {
@@ -416,6 +542,10 @@ func (x *ClientHandler) handler() {
 				break
 			}
 		}
+		if frame == nil {
+			continue
+		}
+		data := frame.Data
 		//重置读超时定时器
 		if x.endpoint.Config.ReadTimeout > 0 {
 			x.readTimeoutTimer.Reset(readTimeoutDuration)
@@ -426,23 +556,33 @@ func (x *ClientHandler) handler() {
 		// 创建一个交换对象，用于存储输入和输出的消息
 		exchange := &endpoint.Exchange{
 			In: &RequestMessage{
-				conn: x.conn,
-				body: data,
+				conn:      x.conn,
+				body:      data,
+				ackReply:  x.endpoint.Config.AckReply,
+				nackReply: x.endpoint.Config.NackReply,
+				dataType:  dataType,
+				codec:     frameCodec,
 			},
 			Out: &ResponseMessage{
 				log: func(format string, v ...interface{}) {
 					x.endpoint.Printf(format, v...)
 				},
-				conn: x.conn,
+				conn:  x.conn,
+				codec: frameCodec,
 			}}
 
 		msg := exchange.In.GetMsg()
+		// 把帧头部字段放到msg元数据中
+		for key, value := range frame.Headers {
+			exchange.In.Headers().Set(key, value)
+			msg.Metadata.PutValue(key, value)
+		}
 		// 把客户端连接的地址放到msg元数据中
 		msg.Metadata.PutValue(RemoteAddrKey, x.conn.RemoteAddr().String())
 
 		// 匹配符合的路由，处理消息
 		for _, v := range x.endpoint.routers {
-			if v.regexp == nil || v.regexp.Match(data) {
+			if v.match(frame) {
 				x.endpoint.DoProcess(context.Background(), v.router, exchange)
 			}
 		}
@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/kafka"
 	"github.com/rulego/rulego/endpoint/mqtt"
 	"github.com/rulego/rulego/endpoint/net"
 	"github.com/rulego/rulego/endpoint/rest"
@@ -37,6 +38,7 @@ func init() {
 	_ = Registry.Register(&net.Endpoint{})
 	_ = Registry.Register(&websocket.Endpoint{})
 	_ = Registry.Register(&schedule.Endpoint{})
+	_ = Registry.Register(&kafka.Endpoint{})
 }
 
 // Registry is the default registry for endpoint components.
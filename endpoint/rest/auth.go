@@ -0,0 +1,569 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/utils/maps"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// AuthTypeNone 不认证，用于路由覆盖端点的认证配置，例如健康检查接口
+	AuthTypeNone = "none"
+	// AuthTypeApiKey API Key 认证
+	AuthTypeApiKey = "apiKey"
+	// AuthTypeBasic HTTP Basic 认证
+	AuthTypeBasic = "basic"
+	// AuthTypeHmac HMAC 签名认证，用于 webhook
+	AuthTypeHmac = "hmac"
+	// AuthTypeJwt JWT 认证
+	AuthTypeJwt = "jwt"
+	// AuthTypeMtls 客户端证书认证
+	AuthTypeMtls = "mtls"
+)
+
+const (
+	// AuthConfigKey 路由 from 配置中认证配置的key
+	AuthConfigKey = "auth"
+	// PrincipalKey 认证通过后，principal 名称在元数据中的key
+	PrincipalKey = "principal"
+	// PrincipalRolesKey principal 角色在元数据中的key，多个角色使用逗号分隔
+	PrincipalRolesKey = "principal_roles"
+	// PrincipalClaimPrefix principal claims 在元数据中的key前缀
+	PrincipalClaimPrefix = "principal_"
+
+	defaultApiKeyHeader = "X-API-Key"
+	defaultHmacHeader   = "X-Signature"
+	defaultMaxSkew      = 300
+	defaultMaxBodySize  = 1 << 20
+	defaultRolesClaim   = "roles"
+)
+
+var (
+	// ErrUnauthorized 认证失败，返回 401
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden 认证成功但没有权限，返回 403
+	ErrForbidden = errors.New("forbidden")
+	// ErrRequestTooLarge 请求体超过认证允许的大小，返回 413
+	ErrRequestTooLarge = errors.New("request entity too large")
+)
+
+// AuthConfig 认证配置，可以配置在端点级别(Config.Auth)或者路由级别(from 配置的 auth 字段)
+// 路由级别的配置覆盖端点级别的配置
+type AuthConfig struct {
+	// Type 认证类型：apiKey/basic/hmac/jwt/mtls 或者通过 RegisterAuthenticator 注册的类型
+	// none 表示不认证
+	Type string
+	// Roles 授权角色，principal 需要拥有其中一个角色，否则返回 403。为空则只认证
+	Roles []string
+	// Header 凭证所在的请求头，apiKey 默认 X-API-Key，hmac 默认 X-Signature
+	Header string
+	// Query 凭证所在的url参数，用于浏览器 websocket 等无法设置请求头的场景，apiKey 和 jwt 有效
+	Query string
+	// Keys apiKey 列表，key:principal，principal 格式：name[:role1,role2]
+	Keys map[string]string
+	// UsersFile basic 认证用户文件，每行格式：username:bcryptHash[:role1,role2]，#开头为注释
+	UsersFile string
+	// Secret hmac 签名密钥，或者 jwt HS256/HS384/HS512 密钥
+	Secret string
+	// Algorithm hmac 签名算法：sha256(默认)/sha1/sha512
+	Algorithm string
+	// TimestampHeader hmac 时间戳请求头(unix秒)，不为空则签名内容为：timestamp.body，并校验时间戳防重放
+	TimestampHeader string
+	// MaxSkew hmac 时间戳允许的最大偏差，单位秒，默认300
+	MaxSkew int
+	// MaxBodySize hmac 校验签名读取的最大请求体字节数，默认1MB，超过返回 413
+	MaxBodySize int64
+	// JwksFile jwt 本地 JWKS 文件
+	JwksFile string
+	// PublicKeyFile jwt PEM 格式公钥或者证书文件
+	PublicKeyFile string
+	// Issuer jwt iss 校验，为空不校验
+	Issuer string
+	// Audience jwt aud 校验，为空不校验
+	Audience string
+	// RolesClaim jwt 角色 claim，默认 roles
+	RolesClaim string
+	// Subjects mtls 允许的客户端证书主题，匹配 CN 或者完整主题，支持通配符，例如：device-*
+	// 需要配置 Config.CaFile 校验客户端证书
+	Subjects []string
+	// Options 自定义认证器的配置
+	Options types.Configuration
+}
+
+// Principal 认证通过的主体
+type Principal struct {
+	// Name 名称，例如用户名、jwt sub、证书 CN
+	Name string
+	// Roles 角色
+	Roles []string
+	// Claims 其他属性，会以 principal_ 前缀写入消息元数据
+	Claims map[string]string
+}
+
+// HasAnyRole 是否拥有其中一个角色
+func (p *Principal) HasAnyRole(roles ...string) bool {
+	for _, role := range roles {
+		for _, item := range p.Roles {
+			if item == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PutMetadata 把 principal 写入消息元数据
+// 先删除元数据中来自请求（例如url参数）的 principal、principal_* 字段，防止伪造，
+// 未认证（principal 为nil）也会删除
+func (p *Principal) PutMetadata(metadata types.Metadata) {
+	if metadata == nil {
+		return
+	}
+	for k := range metadata {
+		if k == PrincipalKey || strings.HasPrefix(k, PrincipalClaimPrefix) {
+			delete(metadata, k)
+		}
+	}
+	if p == nil {
+		return
+	}
+	for k, v := range p.Claims {
+		metadata.PutValue(PrincipalClaimPrefix+k, v)
+	}
+	metadata.PutValue(PrincipalKey, p.Name)
+	//没有角色也写入空值
+	metadata.PutValue(PrincipalRolesKey, strings.Join(p.Roles, ","))
+}
+
+// Authenticator 认证器，从请求中解析 principal
+// 认证失败返回 ErrUnauthorized，没有权限返回 ErrForbidden(可以使用 fmt.Errorf("%w", ErrForbidden) 包装)
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// AuthenticatorFunc 函数类型的认证器
+type AuthenticatorFunc func(r *http.Request) (*Principal, error)
+
+func (f AuthenticatorFunc) Authenticate(r *http.Request) (*Principal, error) {
+	return f(r)
+}
+
+// AuthenticatorFactory 根据认证配置创建认证器
+type AuthenticatorFactory func(config AuthConfig) (Authenticator, error)
+
+var authenticators = struct {
+	sync.RWMutex
+	factories map[string]AuthenticatorFactory
+}{
+	factories: map[string]AuthenticatorFactory{
+		AuthTypeApiKey: newApiKeyAuthenticator,
+		AuthTypeBasic:  newBasicAuthenticator,
+		AuthTypeHmac:   newHmacAuthenticator,
+		AuthTypeJwt:    newJwtAuthenticator,
+		AuthTypeMtls:   newMtlsAuthenticator,
+	},
+}
+
+// RegisterAuthenticator 注册自定义认证器，已经存在则覆盖
+func RegisterAuthenticator(authType string, factory AuthenticatorFactory) {
+	authenticators.Lock()
+	defer authenticators.Unlock()
+	authenticators.factories[authType] = factory
+}
+
+// Auth 认证和授权检查
+type Auth struct {
+	config        AuthConfig
+	authenticator Authenticator
+}
+
+// NewAuth 根据认证配置创建认证检查，Type 为空或者 none 返回 nil
+func NewAuth(config AuthConfig) (*Auth, error) {
+	if config.Type == "" || config.Type == AuthTypeNone {
+		return nil, nil
+	}
+	authenticators.RLock()
+	factory, ok := authenticators.factories[config.Type]
+	authenticators.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("authenticator type not found: %s", config.Type)
+	}
+	authenticator, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("init %s authenticator err: %w", config.Type, err)
+	}
+	return &Auth{config: config, authenticator: authenticator}, nil
+}
+
+// Config 认证配置
+func (a *Auth) Config() AuthConfig {
+	return a.config
+}
+
+// Authenticate 认证并授权，nil 表示不认证
+func (a *Auth) Authenticate(r *http.Request) (*Principal, error) {
+	if a == nil {
+		return nil, nil
+	}
+	principal, err := a.authenticator.Authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+	if principal == nil {
+		return nil, ErrUnauthorized
+	}
+	if len(a.config.Roles) > 0 && !principal.HasAnyRole(a.config.Roles...) {
+		return nil, fmt.Errorf("%w: principal %s has none of roles %v", ErrForbidden, principal.Name, a.config.Roles)
+	}
+	return principal, nil
+}
+
+// Check 认证并授权，失败则响应 401、403 或者 413，并返回错误
+func (a *Auth) Check(w http.ResponseWriter, r *http.Request) (*Principal, error) {
+	principal, err := a.Authenticate(r)
+	if err == nil {
+		return principal, nil
+	}
+	statusCode := http.StatusUnauthorized
+	if errors.Is(err, ErrForbidden) {
+		statusCode = http.StatusForbidden
+	} else if errors.Is(err, ErrRequestTooLarge) {
+		statusCode = http.StatusRequestEntityTooLarge
+	} else {
+		switch a.config.Type {
+		case AuthTypeBasic:
+			w.Header().Set("WWW-Authenticate", `Basic realm="rulego"`)
+		case AuthTypeJwt:
+			w.Header().Set("WWW-Authenticate", "Bearer")
+		}
+	}
+	http.Error(w, http.StatusText(statusCode), statusCode)
+	return nil, err
+}
+
+// RouterAuth 获取路由的认证检查，路由 from 配置了 auth 则使用路由的配置，否则使用端点的配置
+func (rest *Rest) RouterAuth(router endpoint.Router) (*Auth, error) {
+	if config, err := routerAuthConfig(router); err != nil {
+		return nil, err
+	} else if config != nil {
+		return NewAuth(*config)
+	}
+	return rest.auth, nil
+}
+
+// authConfig 获取路由生效的认证配置，不认证返回 nil
+func (rest *Rest) authConfig(router endpoint.Router) *AuthConfig {
+	config, err := routerAuthConfig(router)
+	if err != nil {
+		return nil
+	}
+	if config == nil {
+		config = rest.Config.Auth
+	}
+	if config == nil || config.Type == "" || config.Type == AuthTypeNone {
+		return nil
+	}
+	return config
+}
+
+// routerAuthConfig 获取路由 from 配置的认证配置，没有配置返回 nil
+func routerAuthConfig(router endpoint.Router) (*AuthConfig, error) {
+	if from, ok := router.GetFrom().(*impl.From); ok && from != nil {
+		if v, ok := from.Config[AuthConfigKey]; ok && v != nil {
+			var config AuthConfig
+			if err := maps.Map2Struct(v, &config); err != nil {
+				return nil, err
+			}
+			return &config, nil
+		}
+	}
+	return nil, nil
+}
+
+// apiKeyAuthenticator API Key 认证
+type apiKeyAuthenticator struct {
+	header string
+	query  string
+	keys   map[string]*Principal
+}
+
+func newApiKeyAuthenticator(config AuthConfig) (Authenticator, error) {
+	if len(config.Keys) == 0 {
+		return nil, errors.New("keys can not be empty")
+	}
+	a := &apiKeyAuthenticator{
+		header: config.Header,
+		query:  config.Query,
+		keys:   make(map[string]*Principal),
+	}
+	if a.header == "" && a.query == "" {
+		a.header = defaultApiKeyHeader
+	}
+	for key, value := range config.Keys {
+		a.keys[key] = parsePrincipal(value)
+	}
+	return a, nil
+}
+
+func (a *apiKeyAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	var key string
+	if a.header != "" {
+		key = r.Header.Get(a.header)
+	}
+	if key == "" && a.query != "" {
+		key = r.URL.Query().Get(a.query)
+	}
+	if key == "" {
+		return nil, fmt.Errorf("%w: api key is missing", ErrUnauthorized)
+	}
+	for k, principal := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			return principal, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: invalid api key", ErrUnauthorized)
+}
+
+// basicAuthenticator HTTP Basic 认证，密码使用 bcrypt 保存
+type basicAuthenticator struct {
+	users map[string]basicUser
+}
+
+type basicUser struct {
+	hash  []byte
+	roles []string
+}
+
+func newBasicAuthenticator(config AuthConfig) (Authenticator, error) {
+	if config.UsersFile == "" {
+		return nil, errors.New("usersFile can not be empty")
+	}
+	f, err := os.Open(config.UsersFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	a := &basicAuthenticator{users: make(map[string]basicUser)}
+	scanner := bufio.NewScanner(f)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		values := strings.SplitN(text, ":", 3)
+		if len(values) < 2 || values[0] == "" || values[1] == "" {
+			return nil, fmt.Errorf("invalid users file line %d", line)
+		}
+		user := basicUser{hash: []byte(values[1])}
+		if len(values) == 3 {
+			user.roles = splitRoles(values[2])
+		}
+		a.users[values[0]] = user
+	}
+	return a, scanner.Err()
+}
+
+func (a *basicAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, fmt.Errorf("%w: basic credentials are missing", ErrUnauthorized)
+	}
+	user, ok := a.users[username]
+	if !ok || bcrypt.CompareHashAndPassword(user.hash, []byte(password)) != nil {
+		return nil, fmt.Errorf("%w: invalid username or password", ErrUnauthorized)
+	}
+	return &Principal{Name: username, Roles: user.roles}, nil
+}
+
+// hmacAuthenticator HMAC 签名认证，签名请求头格式：hex 或者 algorithm=hex，例如：sha256=xxx
+type hmacAuthenticator struct {
+	secret          []byte
+	algorithm       string
+	newHash         func() hash.Hash
+	header          string
+	timestampHeader string
+	maxSkew         int
+	maxBodySize     int64
+}
+
+func newHmacAuthenticator(config AuthConfig) (Authenticator, error) {
+	if config.Secret == "" {
+		return nil, errors.New("secret can not be empty")
+	}
+	a := &hmacAuthenticator{
+		secret:          []byte(config.Secret),
+		algorithm:       strings.ToLower(config.Algorithm),
+		header:          config.Header,
+		timestampHeader: config.TimestampHeader,
+		maxSkew:         config.MaxSkew,
+		maxBodySize:     config.MaxBodySize,
+	}
+	switch a.algorithm {
+	case "", "sha256":
+		a.algorithm, a.newHash = "sha256", sha256.New
+	case "sha1":
+		a.newHash = sha1.New
+	case "sha512":
+		a.newHash = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported algorithm: %s", config.Algorithm)
+	}
+	if a.header == "" {
+		a.header = defaultHmacHeader
+	}
+	if a.maxSkew <= 0 {
+		a.maxSkew = defaultMaxSkew
+	}
+	if a.maxBodySize <= 0 {
+		a.maxBodySize = defaultMaxBodySize
+	}
+	return a, nil
+}
+
+func (a *hmacAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	signature := strings.TrimPrefix(r.Header.Get(a.header), a.algorithm+"=")
+	if signature == "" {
+		return nil, fmt.Errorf("%w: signature is missing", ErrUnauthorized)
+	}
+	expected, err := hex.DecodeString(signature)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid signature", ErrUnauthorized)
+	}
+	mac := hmac.New(a.newHash, a.secret)
+	var timestamp string
+	if a.timestampHeader != "" {
+		timestamp = r.Header.Get(a.timestampHeader)
+		ts, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil || math.Abs(float64(time.Now().Unix()-ts)) > float64(a.maxSkew) {
+			return nil, fmt.Errorf("%w: invalid timestamp", ErrUnauthorized)
+		}
+		mac.Write([]byte(timestamp + "."))
+	}
+	if r.Body != nil {
+		//多读一个字节判断是否超过限制
+		body, err := io.ReadAll(io.LimitReader(r.Body, a.maxBodySize+1))
+		_ = r.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		if int64(len(body)) > a.maxBodySize {
+			return nil, fmt.Errorf("%w: body exceeds %d bytes", ErrRequestTooLarge, a.maxBodySize)
+		}
+		//还原请求体，后续转换成消息
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		mac.Write(body)
+	}
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return nil, fmt.Errorf("%w: signature mismatch", ErrUnauthorized)
+	}
+	principal := &Principal{Name: AuthTypeHmac}
+	if timestamp != "" {
+		principal.Claims = map[string]string{"timestamp": timestamp}
+	}
+	return principal, nil
+}
+
+// mtlsAuthenticator 客户端证书认证，证书由服务端 Config.CaFile 校验
+type mtlsAuthenticator struct {
+	subjects []string
+}
+
+func newMtlsAuthenticator(config AuthConfig) (Authenticator, error) {
+	for _, pattern := range config.Subjects {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid subject pattern %s: %w", pattern, err)
+		}
+	}
+	return &mtlsAuthenticator{subjects: config.Subjects}, nil
+}
+
+func (a *mtlsAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, fmt.Errorf("%w: verified client certificate is missing", ErrUnauthorized)
+	}
+	cert := r.TLS.VerifiedChains[0][0]
+	cn, subject := cert.Subject.CommonName, cert.Subject.String()
+	if len(a.subjects) > 0 && !a.match(cn, subject) {
+		return nil, fmt.Errorf("%w: client certificate subject %s is not allowed", ErrForbidden, subject)
+	}
+	return &Principal{
+		Name:  cn,
+		Roles: cert.Subject.OrganizationalUnit,
+		Claims: map[string]string{
+			"subject": subject,
+			"serial":  cert.SerialNumber.String(),
+		},
+	}, nil
+}
+
+func (a *mtlsAuthenticator) match(values ...string) bool {
+	for _, pattern := range a.subjects {
+		for _, value := range values {
+			if ok, _ := path.Match(pattern, value); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parsePrincipal 解析 name[:role1,role2]
+func parsePrincipal(value string) *Principal {
+	values := strings.SplitN(value, ":", 2)
+	principal := &Principal{Name: values[0]}
+	if len(values) == 2 {
+		principal.Roles = splitRoles(values[1])
+	}
+	return principal
+}
+
+func splitRoles(value string) []string {
+	var roles []string
+	for _, role := range strings.Split(value, ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
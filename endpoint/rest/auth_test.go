@@ -0,0 +1,425 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// authStatus 发送请求，返回状态码
+func authStatus(t *testing.T, url string, setup func(r *http.Request)) int {
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(`{"temperature":41}`))
+	assert.Nil(t, err)
+	if setup != nil {
+		setup(req)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	return resp.StatusCode
+}
+
+func signJwt(t *testing.T, alg, kid string, claims map[string]interface{}, sign func(signed []byte) []byte) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign([]byte(signed)))
+}
+
+func TestAuthEndpoint(t *testing.T) {
+	config := types.NewConfig()
+	ep := &Endpoint{}
+	err := ep.Init(config, types.Configuration{
+		"server": ":9092",
+		"auth": map[string]interface{}{
+			"type":  AuthTypeApiKey,
+			"keys":  map[string]string{"key1": "device1:reader,writer", "key2": "device2:reader"},
+			"roles": []string{"writer"},
+		},
+	})
+	assert.Nil(t, err)
+
+	var metadata types.Metadata
+	capture := func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		metadata = exchange.In.GetMsg().Metadata
+		exchange.Out.SetStatusCode(http.StatusOK)
+		return false
+	}
+	_, err = ep.AddRouter(impl.NewRouter().From("/api/msg").Process(capture).End(), http.MethodPost)
+	assert.Nil(t, err)
+	//路由覆盖端点的认证配置
+	_, err = ep.AddRouter(impl.NewRouter().From("/api/health", types.Configuration{
+		AuthConfigKey: map[string]interface{}{"type": AuthTypeNone},
+	}).Process(capture).End(), http.MethodPost)
+	assert.Nil(t, err)
+	_, err = ep.AddRouter(impl.NewRouter().From("/api/query", types.Configuration{
+		AuthConfigKey: map[string]interface{}{"type": AuthTypeApiKey, "query": "token", "keys": map[string]string{"key3": "device3"}},
+	}).Process(capture).End(), http.MethodPost)
+	assert.Nil(t, err)
+	_, err = ep.AddRouter(impl.NewRouter().From("/api/err", types.Configuration{
+		AuthConfigKey: map[string]interface{}{"type": "notFound"},
+	}).Process(capture).End(), http.MethodPost)
+	assert.NotNil(t, err)
+
+	server := httptest.NewServer(ep.Router())
+	defer server.Close()
+
+	assert.Equal(t, http.StatusUnauthorized, authStatus(t, server.URL+"/api/msg", nil))
+	assert.Equal(t, http.StatusUnauthorized, authStatus(t, server.URL+"/api/msg", func(r *http.Request) {
+		r.Header.Set("X-API-Key", "bad")
+	}))
+	metadata = nil
+	assert.Equal(t, http.StatusForbidden, authStatus(t, server.URL+"/api/msg", func(r *http.Request) {
+		r.Header.Set("X-API-Key", "key2")
+	}))
+	assert.Equal(t, 0, len(metadata))
+
+	assert.Equal(t, http.StatusOK, authStatus(t, server.URL+"/api/msg?principal=fake", func(r *http.Request) {
+		r.Header.Set("X-API-Key", "key1")
+	}))
+	assert.Equal(t, "device1", metadata.GetValue(PrincipalKey))
+	assert.Equal(t, "reader,writer", metadata.GetValue(PrincipalRolesKey))
+
+	assert.Equal(t, http.StatusOK, authStatus(t, server.URL+"/api/health?principal=fake&principal_roles=admin", nil))
+	assert.False(t, metadata.Has(PrincipalKey))
+	assert.False(t, metadata.Has(PrincipalRolesKey))
+
+	assert.Equal(t, http.StatusUnauthorized, authStatus(t, server.URL+"/api/query", func(r *http.Request) {
+		r.Header.Set("X-API-Key", "key1")
+	}))
+	assert.Equal(t, http.StatusOK, authStatus(t, server.URL+"/api/query?token=key3", nil))
+	assert.Equal(t, "device3", metadata.GetValue(PrincipalKey))
+	//伪造 principal 角色和属性
+	assert.Equal(t, http.StatusOK, authStatus(t, server.URL+"/api/query?token=key3&principal_roles=admin&principal_tenant=t1", nil))
+	assert.Equal(t, "device3", metadata.GetValue(PrincipalKey))
+	assert.True(t, metadata.Has(PrincipalRolesKey))
+	assert.Equal(t, "", metadata.GetValue(PrincipalRolesKey))
+	assert.False(t, metadata.Has(PrincipalClaimPrefix+"tenant"))
+
+	//配置错误
+	assert.NotNil(t, (&Endpoint{}).Init(config, types.Configuration{
+		"server": ":9093",
+		"auth":   map[string]interface{}{"type": AuthTypeApiKey},
+	}))
+}
+
+func TestBasicAuth(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	assert.Nil(t, err)
+	usersFile := filepath.Join(t.TempDir(), "users")
+	assert.Nil(t, os.WriteFile(usersFile, []byte("#用户列表\nadmin:"+string(hash)+":admin,ops\n\nguest:"+string(hash)+"\n"), 0600))
+
+	auth, err := NewAuth(AuthConfig{Type: AuthTypeBasic, UsersFile: usersFile})
+	assert.Nil(t, err)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	_, err = auth.Authenticate(r)
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+
+	w := httptest.NewRecorder()
+	_, err = auth.Check(w, r)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Basic realm="rulego"`, w.Header().Get("WWW-Authenticate"))
+
+	r.SetBasicAuth("admin", "wrong")
+	_, err = auth.Authenticate(r)
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+
+	r.SetBasicAuth("admin", "secret")
+	principal, err := auth.Authenticate(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "admin", principal.Name)
+	assert.Equal(t, []string{"admin", "ops"}, principal.Roles)
+
+	r.SetBasicAuth("guest", "secret")
+	principal, err = auth.Authenticate(r)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(principal.Roles))
+
+	_, err = NewAuth(AuthConfig{Type: AuthTypeBasic, UsersFile: filepath.Join(t.TempDir(), "notFound")})
+	assert.NotNil(t, err)
+}
+
+func TestHmacAuth(t *testing.T) {
+	auth, err := NewAuth(AuthConfig{Type: AuthTypeHmac, Secret: "webhook-secret", TimestampHeader: "X-Timestamp"})
+	assert.Nil(t, err)
+	body := `{"event":"push"}`
+	sign := func(timestamp string) string {
+		mac := hmac.New(sha256.New, []byte("webhook-secret"))
+		mac.Write([]byte(timestamp + "." + body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	newRequest := func(timestamp, signature string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set("X-Timestamp", timestamp)
+		r.Header.Set("X-Signature", signature)
+		return r
+	}
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	r := newRequest(now, sign(now))
+	principal, err := auth.Authenticate(r)
+	assert.Nil(t, err)
+	assert.Equal(t, AuthTypeHmac, principal.Name)
+	assert.Equal(t, now, principal.Claims["timestamp"])
+	//请求体可以继续读取
+	request := &RequestMessage{request: r}
+	assert.Equal(t, body, string(request.Body()))
+
+	_, err = auth.Authenticate(newRequest(now, sign("1")))
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+	_, err = auth.Authenticate(newRequest(now, ""))
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+	//时间戳过期
+	expired := strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10)
+	_, err = auth.Authenticate(newRequest(expired, sign(expired)))
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+
+	//请求体超过限制
+	limited, err := NewAuth(AuthConfig{Type: AuthTypeHmac, Secret: "webhook-secret", TimestampHeader: "X-Timestamp", MaxBodySize: 8})
+	assert.Nil(t, err)
+	_, err = limited.Authenticate(newRequest(now, sign(now)))
+	assert.True(t, errors.Is(err, ErrRequestTooLarge))
+	w := httptest.NewRecorder()
+	_, _ = limited.Check(w, newRequest(now, sign(now)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+
+	_, err = NewAuth(AuthConfig{Type: AuthTypeHmac})
+	assert.NotNil(t, err)
+	_, err = NewAuth(AuthConfig{Type: AuthTypeHmac, Secret: "s", Algorithm: "md5"})
+	assert.NotNil(t, err)
+}
+
+func TestJwtAuth(t *testing.T) {
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	assert.Nil(t, err)
+	pemFile := filepath.Join(dir, "public.pem")
+	assert.Nil(t, os.WriteFile(pemFile, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600))
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	jwks, _ := json.Marshal(map[string]interface{}{"keys": []map[string]string{{
+		"kty": "EC",
+		"kid": "ec1",
+		"crv": "P-256",
+		"x":   base64.RawURLEncoding.EncodeToString(ecKey.X.FillBytes(make([]byte, 32))),
+		"y":   base64.RawURLEncoding.EncodeToString(ecKey.Y.FillBytes(make([]byte, 32))),
+	}}})
+	jwksFile := filepath.Join(dir, "jwks.json")
+	assert.Nil(t, os.WriteFile(jwksFile, jwks, 0600))
+
+	auth, err := NewAuth(AuthConfig{
+		Type:          AuthTypeJwt,
+		PublicKeyFile: pemFile,
+		JwksFile:      jwksFile,
+		Issuer:        "rulego",
+		Audience:      "api",
+		Query:         "access_token",
+		Roles:         []string{"admin"},
+	})
+	assert.Nil(t, err)
+
+	signRS256 := func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		signature, _ := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+		return signature
+	}
+	signES256 := func(signed []byte) []byte {
+		digest := sha256.Sum256(signed)
+		r, s, _ := ecdsa.Sign(rand.Reader, ecKey, digest[:])
+		return append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	claims := func(roles interface{}, exp time.Duration) map[string]interface{} {
+		return map[string]interface{}{
+			"sub":      "user1",
+			"iss":      "rulego",
+			"aud":      []string{"api", "web"},
+			"exp":      time.Now().Add(exp).Unix(),
+			"roles":    roles,
+			"tenantId": "t1",
+		}
+	}
+	authenticate := func(token string) (*Principal, error) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		return auth.Authenticate(r)
+	}
+
+	principal, err := authenticate(signJwt(t, "RS256", "", claims([]string{"admin"}, time.Hour), signRS256))
+	assert.Nil(t, err)
+	assert.Equal(t, "user1", principal.Name)
+	assert.Equal(t, []string{"admin"}, principal.Roles)
+	assert.Equal(t, "t1", principal.Claims["tenantId"])
+
+	//jwks 中的 EC 公钥，浏览器 websocket 使用url参数传递 token
+	token := signJwt(t, "ES256", "ec1", claims("admin ops", time.Hour), signES256)
+	principal, err = auth.Authenticate(httptest.NewRequest(http.MethodGet, "/?access_token="+token, nil))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"admin", "ops"}, principal.Roles)
+
+	_, err = authenticate(signJwt(t, "RS256", "", claims([]string{"ops"}, time.Hour), signRS256))
+	assert.True(t, errors.Is(err, ErrForbidden))
+	_, err = authenticate(signJwt(t, "RS256", "", claims([]string{"admin"}, -time.Hour), signRS256))
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+	//签名和算法不匹配
+	_, err = authenticate(signJwt(t, "ES256", "ec1", claims([]string{"admin"}, time.Hour), signRS256))
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+	//没有配置 secret 不允许 HS256
+	_, err = authenticate(signJwt(t, "HS256", "", claims([]string{"admin"}, time.Hour), func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, der)
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}))
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+	_, err = authenticate(signJwt(t, "none", "", claims([]string{"admin"}, time.Hour), func(signed []byte) []byte {
+		return nil
+	}))
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+	_, err = authenticate("bad.token")
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+
+	badAudience := claims([]string{"admin"}, time.Hour)
+	badAudience["aud"] = "web"
+	_, err = authenticate(signJwt(t, "RS256", "", badAudience, signRS256))
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+
+	w := httptest.NewRecorder()
+	_, err = auth.Check(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.NotNil(t, err)
+	assert.Equal(t, "Bearer", w.Header().Get("WWW-Authenticate"))
+
+	hsAuth, err := NewAuth(AuthConfig{Type: AuthTypeJwt, Secret: "jwt-secret"})
+	assert.Nil(t, err)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "Bearer "+signJwt(t, "HS256", "", map[string]interface{}{"sub": "user2"}, func(signed []byte) []byte {
+		mac := hmac.New(sha256.New, []byte("jwt-secret"))
+		mac.Write(signed)
+		return mac.Sum(nil)
+	}))
+	principal, err = hsAuth.Authenticate(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "user2", principal.Name)
+
+	_, err = NewAuth(AuthConfig{Type: AuthTypeJwt})
+	assert.NotNil(t, err)
+}
+
+func TestMtlsAuth(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	newCert := func(cn string) *x509.Certificate {
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(100),
+			Subject:      pkix.Name{CommonName: cn, OrganizationalUnit: []string{"device"}},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+		assert.Nil(t, err)
+		cert, err := x509.ParseCertificate(der)
+		assert.Nil(t, err)
+		return cert
+	}
+	newRequest := func(cert *x509.Certificate) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if cert != nil {
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		}
+		return r
+	}
+	auth, err := NewAuth(AuthConfig{Type: AuthTypeMtls, Subjects: []string{"device-*"}})
+	assert.Nil(t, err)
+
+	principal, err := auth.Authenticate(newRequest(newCert("device-01")))
+	assert.Nil(t, err)
+	assert.Equal(t, "device-01", principal.Name)
+	assert.Equal(t, []string{"device"}, principal.Roles)
+	assert.Equal(t, "100", principal.Claims["serial"])
+	metadata := types.NewMetadata()
+	principal.PutMetadata(metadata)
+	assert.Equal(t, "device-01", metadata.GetValue(PrincipalKey))
+	assert.Equal(t, "CN=device-01,OU=device", metadata.GetValue(PrincipalClaimPrefix+"subject"))
+
+	_, err = auth.Authenticate(newRequest(newCert("gateway-01")))
+	assert.True(t, errors.Is(err, ErrForbidden))
+	w := httptest.NewRecorder()
+	_, _ = auth.Check(w, newRequest(newCert("gateway-01")))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	_, err = auth.Authenticate(newRequest(nil))
+	assert.True(t, errors.Is(err, ErrUnauthorized))
+
+	_, err = NewAuth(AuthConfig{Type: AuthTypeMtls, Subjects: []string{"["}})
+	assert.NotNil(t, err)
+}
+
+func TestRegisterAuthenticator(t *testing.T) {
+	RegisterAuthenticator("test", func(config AuthConfig) (Authenticator, error) {
+		token := fmt.Sprint(config.Options["token"])
+		return AuthenticatorFunc(func(r *http.Request) (*Principal, error) {
+			if r.Header.Get("X-Token") != token {
+				return nil, ErrUnauthorized
+			}
+			return &Principal{Name: "custom"}, nil
+		}), nil
+	})
+	ep := &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{
+		"server": ":9094",
+		"auth":   map[string]interface{}{"type": "test", "options": map[string]interface{}{"token": "abc"}},
+	})
+	assert.Nil(t, err)
+	auth, err := ep.RouterAuth(impl.NewRouter().From("/api").End())
+	assert.Nil(t, err)
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("X-Token", "abc")
+	principal, err := auth.Authenticate(r)
+	assert.Nil(t, err)
+	assert.Equal(t, "custom", principal.Name)
+}
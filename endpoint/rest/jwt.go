@@ -0,0 +1,351 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rulego/rulego/utils/str"
+)
+
+// jwtAuthenticator JWT 认证，使用本地密钥校验签名
+// 支持 HS256/HS384/HS512、RS256/RS384/RS512、PS256/PS384/PS512、ES256/ES384/ES512
+type jwtAuthenticator struct {
+	secret []byte
+	//kid:公钥，PEM 公钥的 kid 为空
+	keys       map[string]crypto.PublicKey
+	query      string
+	issuer     string
+	audience   string
+	rolesClaim string
+}
+
+func newJwtAuthenticator(config AuthConfig) (Authenticator, error) {
+	a := &jwtAuthenticator{
+		secret:     []byte(config.Secret),
+		keys:       make(map[string]crypto.PublicKey),
+		query:      config.Query,
+		issuer:     config.Issuer,
+		audience:   config.Audience,
+		rolesClaim: config.RolesClaim,
+	}
+	if a.rolesClaim == "" {
+		a.rolesClaim = defaultRolesClaim
+	}
+	if config.PublicKeyFile != "" {
+		key, err := loadPemPublicKey(config.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		a.keys[""] = key
+	}
+	if config.JwksFile != "" {
+		if err := a.loadJwks(config.JwksFile); err != nil {
+			return nil, err
+		}
+	}
+	if len(a.secret) == 0 && len(a.keys) == 0 {
+		return nil, errors.New("one of secret, publicKeyFile or jwksFile is required")
+	}
+	return a, nil
+}
+
+func (a *jwtAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	token := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(token) > 7 && strings.EqualFold(token[:7], "Bearer ") {
+		token = strings.TrimSpace(token[7:])
+	} else {
+		token = ""
+	}
+	if token == "" && a.query != "" {
+		token = r.URL.Query().Get(a.query)
+	}
+	if token == "" {
+		return nil, fmt.Errorf("%w: bearer token is missing", ErrUnauthorized)
+	}
+	claims, err := a.verify(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnauthorized, err.Error())
+	}
+	principal := &Principal{Claims: make(map[string]string)}
+	for k, v := range claims {
+		switch k {
+		case "sub":
+			principal.Name = str.ToString(v)
+		case a.rolesClaim:
+			principal.Roles = jwtRoles(v)
+		default:
+			principal.Claims[k] = str.ToString(v)
+		}
+	}
+	return principal, nil
+}
+
+// verify 校验签名和 exp/nbf/iss/aud，返回 claims
+func (a *jwtAuthenticator) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJwtPart(parts[0], &header); err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.New("malformed signature")
+	}
+	if err := a.verifySignature(header.Alg, header.Kid, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+	var claims map[string]interface{}
+	decoder := json.NewDecoder(base64.NewDecoder(base64.RawURLEncoding, strings.NewReader(parts[1])))
+	decoder.UseNumber()
+	if err := decoder.Decode(&claims); err != nil {
+		return nil, errors.New("malformed claims")
+	}
+	now := time.Now().Unix()
+	if exp, ok := jwtTime(claims["exp"]); ok && now >= exp {
+		return nil, errors.New("token is expired")
+	}
+	if nbf, ok := jwtTime(claims["nbf"]); ok && now < nbf {
+		return nil, errors.New("token is not valid yet")
+	}
+	if a.issuer != "" && claims["iss"] != a.issuer {
+		return nil, errors.New("invalid issuer")
+	}
+	if a.audience != "" && !jwtAudience(claims["aud"], a.audience) {
+		return nil, errors.New("invalid audience")
+	}
+	return claims, nil
+}
+
+func (a *jwtAuthenticator) verifySignature(alg, kid string, signed, signature []byte) error {
+	hash, err := jwtHash(alg)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(alg, "HS") {
+		if len(a.secret) == 0 {
+			return fmt.Errorf("unsupported algorithm: %s", alg)
+		}
+		mac := hmac.New(hash.New, a.secret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	key, ok := a.keys[kid]
+	if !ok {
+		//jwks 没有找到则使用 PEM 公钥
+		key, ok = a.keys[""]
+	}
+	if !ok && len(a.keys) == 1 {
+		for _, v := range a.keys {
+			key, ok = v, true
+		}
+	}
+	if !ok {
+		return fmt.Errorf("key not found, kid=%s", kid)
+	}
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if strings.HasPrefix(alg, "RS") {
+			err = rsa.VerifyPKCS1v15(pub, hash, digest, signature)
+		} else if strings.HasPrefix(alg, "PS") {
+			err = rsa.VerifyPSS(pub, hash, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		} else {
+			err = fmt.Errorf("algorithm %s does not match rsa key", alg)
+		}
+	case *ecdsa.PublicKey:
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if !strings.HasPrefix(alg, "ES") || len(signature) != 2*size {
+			return errors.New("invalid signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			err = errors.New("invalid signature")
+		}
+	default:
+		err = fmt.Errorf("unsupported key type %T", key)
+	}
+	if err != nil {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+// loadJwks 加载本地 JWKS 文件，支持 RSA 和 EC 公钥
+func (a *jwtAuthenticator) loadJwks(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var jwks struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &jwks); err != nil {
+		return err
+	}
+	for _, item := range jwks.Keys {
+		switch item.Kty {
+		case "RSA":
+			n, err1 := base64.RawURLEncoding.DecodeString(item.N)
+			e, err2 := base64.RawURLEncoding.DecodeString(item.E)
+			if err1 != nil || err2 != nil {
+				return fmt.Errorf("invalid jwks rsa key, kid=%s", item.Kid)
+			}
+			a.keys[item.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch item.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				return fmt.Errorf("unsupported jwks curve %s, kid=%s", item.Crv, item.Kid)
+			}
+			x, err1 := base64.RawURLEncoding.DecodeString(item.X)
+			y, err2 := base64.RawURLEncoding.DecodeString(item.Y)
+			if err1 != nil || err2 != nil {
+				return fmt.Errorf("invalid jwks ec key, kid=%s", item.Kid)
+			}
+			a.keys[item.Kid] = &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	return nil
+}
+
+// loadPemPublicKey 加载 PEM 格式的公钥或者证书
+func loadPemPublicKey(file string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("invalid pem file: %s", file)
+	}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		return cert.PublicKey, nil
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+}
+
+func jwtHash(alg string) (crypto.Hash, error) {
+	if len(alg) == 5 {
+		switch alg[2:] {
+		case "256":
+			return crypto.SHA256, nil
+		case "384":
+			return crypto.SHA384, nil
+		case "512":
+			return crypto.SHA512, nil
+		}
+	}
+	return 0, fmt.Errorf("unsupported algorithm: %s", alg)
+}
+
+func decodeJwtPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return errors.New("malformed token")
+	}
+	if err = json.Unmarshal(data, v); err != nil {
+		return errors.New("malformed token")
+	}
+	return nil
+}
+
+func jwtTime(v interface{}) (int64, bool) {
+	if n, ok := v.(json.Number); ok {
+		if f, err := n.Float64(); err == nil {
+			return int64(f), true
+		}
+	}
+	return 0, false
+}
+
+func jwtAudience(v interface{}, audience string) bool {
+	switch aud := v.(type) {
+	case string:
+		return aud == audience
+	case []interface{}:
+		for _, item := range aud {
+			if item == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func jwtRoles(v interface{}) []string {
+	switch roles := v.(type) {
+	case string:
+		return splitRoles(strings.ReplaceAll(roles, " ", ","))
+	case []interface{}:
+		var result []string
+		for _, item := range roles {
+			result = append(result, str.ToString(item))
+		}
+		return result
+	}
+	return nil
+}
@@ -0,0 +1,265 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/utils/str"
+)
+
+// 路由定义 AdditionalInfo 中的 OpenAPI 字段
+const (
+	// OpenApiSummaryKey 接口摘要
+	OpenApiSummaryKey = "summary"
+	// OpenApiDescriptionKey 接口描述
+	OpenApiDescriptionKey = "description"
+	// OpenApiTagsKey 接口标签，字符串数组
+	OpenApiTagsKey = "tags"
+	// OpenApiRequestSchemaKey 请求体 JSON Schema
+	OpenApiRequestSchemaKey = "requestSchema"
+	// OpenApiResponseSchemaKey 响应体 JSON Schema
+	OpenApiResponseSchemaKey = "responseSchema"
+)
+
+const (
+	openApiVersion        = "3.1.0"
+	defaultOpenApiTitle   = "RuleGo API"
+	defaultOpenApiVersion = "1.0.0"
+)
+
+// OpenApiConfig OpenAPI 文档配置
+type OpenApiConfig struct {
+	// Path 文档访问路径，例如：/openapi.json，为空不提供文档服务
+	Path string
+	// Title 文档标题，默认：RuleGo API
+	Title string
+	// Version API 版本，默认：1.0.0
+	Version string
+	// Description API 描述
+	Description string
+	// ValidateRequest 是否使用路由定义的 requestSchema 校验请求体，校验失败返回 400，不会执行路由
+	ValidateRequest bool
+}
+
+// OpenApi 根据已经注册的路由生成 OpenAPI 3 文档
+// 路由的 summary、description、tags、requestSchema、responseSchema 从路由定义的 AdditionalInfo 获取
+func (rest *Rest) OpenApi() map[string]interface{} {
+	config := OpenApiConfig{}
+	if rest.Config.OpenApi != nil {
+		config = *rest.Config.OpenApi
+	}
+	if config.Title == "" {
+		config.Title = defaultOpenApiTitle
+	}
+	if config.Version == "" {
+		config.Version = defaultOpenApiVersion
+	}
+	info := map[string]interface{}{"title": config.Title, "version": config.Version}
+	if config.Description != "" {
+		info["description"] = config.Description
+	}
+
+	rest.RLock()
+	var routers []endpoint.Router
+	for _, router := range rest.RouterStorage {
+		if !router.IsDisable() {
+			routers = append(routers, router)
+		}
+	}
+	rest.RUnlock()
+	sort.Slice(routers, func(i, j int) bool {
+		return routers[i].GetId() < routers[j].GetId()
+	})
+
+	paths := make(map[string]interface{})
+	securitySchemes := make(map[string]interface{})
+	for _, router := range routers {
+		method := routerMethod(router)
+		if method == "" {
+			continue
+		}
+		path, params := openApiPath(strings.TrimSpace(router.FromToString()))
+		operation := rest.openApiOperation(router, method, params, securitySchemes)
+		item, ok := paths[path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[path] = item
+		}
+		item[strings.ToLower(method)] = operation
+	}
+	doc := map[string]interface{}{
+		"openapi": openApiVersion,
+		"info":    info,
+		"paths":   paths,
+	}
+	if len(securitySchemes) > 0 {
+		doc["components"] = map[string]interface{}{"securitySchemes": securitySchemes}
+	}
+	return doc
+}
+
+func (rest *Rest) openApiOperation(router endpoint.Router, method string, params []string, securitySchemes map[string]interface{}) map[string]interface{} {
+	operation := map[string]interface{}{"operationId": router.GetId()}
+	var additionalInfo map[string]interface{}
+	if def := router.Definition(); def != nil {
+		additionalInfo = def.AdditionalInfo
+	}
+	for _, key := range []string{OpenApiSummaryKey, OpenApiDescriptionKey, OpenApiTagsKey} {
+		if v, ok := additionalInfo[key]; ok {
+			operation[key] = v
+		}
+	}
+	if len(params) > 0 {
+		var parameters []interface{}
+		for _, name := range params {
+			parameters = append(parameters, map[string]interface{}{
+				"name":     name,
+				"in":       "path",
+				"required": true,
+				"schema":   map[string]interface{}{"type": "string"},
+			})
+		}
+		operation["parameters"] = parameters
+	}
+	if method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch {
+		schema, ok := additionalInfo[OpenApiRequestSchemaKey]
+		if !ok {
+			schema = map[string]interface{}{}
+		}
+		operation["requestBody"] = map[string]interface{}{
+			"required": ok,
+			"content":  map[string]interface{}{JsonContextType: map[string]interface{}{"schema": schema}},
+		}
+	}
+
+	success := map[string]interface{}{"description": http.StatusText(http.StatusOK)}
+	if stream, _ := routerStreamConfig(router); stream != nil {
+		//流式响应，responseSchema 描述每个事件的数据
+		contentType := ContentTypeEventStream
+		if stream.Mode == StreamModeChunked {
+			contentType = ContentTypeNdjson
+			if stream.ContentType != "" {
+				contentType = stream.ContentType
+			}
+		}
+		schema, ok := additionalInfo[OpenApiResponseSchemaKey]
+		if !ok {
+			schema = map[string]interface{}{}
+		}
+		success["content"] = map[string]interface{}{contentType: map[string]interface{}{"schema": schema}}
+	} else if schema, ok := additionalInfo[OpenApiResponseSchemaKey]; ok {
+		success["content"] = map[string]interface{}{JsonContextType: map[string]interface{}{"schema": schema}}
+	}
+	responses := map[string]interface{}{"200": success}
+	if _, ok := operation["requestBody"]; ok && rest.validateRequest() {
+		responses["400"] = map[string]interface{}{"description": http.StatusText(http.StatusBadRequest)}
+	}
+	if config := rest.authConfig(router); config != nil {
+		responses["401"] = map[string]interface{}{"description": http.StatusText(http.StatusUnauthorized)}
+		responses["403"] = map[string]interface{}{"description": http.StatusText(http.StatusForbidden)}
+		if name, scheme := securityScheme(*config); scheme != nil {
+			securitySchemes[name] = scheme
+			operation["security"] = []interface{}{map[string]interface{}{name: []string{}}}
+		}
+	}
+	operation["responses"] = responses
+	return operation
+}
+
+// requestValidator 路由的请求体校验器，没有开启校验或者没有定义 requestSchema 返回 nil
+func (rest *Rest) requestValidator(router endpoint.Router) (*SchemaValidator, error) {
+	if !rest.validateRequest() || router.Definition() == nil {
+		return nil, nil
+	}
+	schema, ok := router.Definition().AdditionalInfo[OpenApiRequestSchemaKey].(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	return NewSchemaValidator(schema)
+}
+
+func (rest *Rest) validateRequest() bool {
+	return rest.Config.OpenApi != nil && rest.Config.OpenApi.ValidateRequest
+}
+
+// openApiHandler 文档服务
+func (rest *Rest) openApiHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		data, err := json.Marshal(rest.OpenApi())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set(ContentTypeKey, JsonContextType)
+		_, _ = w.Write(data)
+	}
+}
+
+func routerMethod(router endpoint.Router) string {
+	if params := router.GetParams(); len(params) > 0 {
+		return strings.ToUpper(str.ToString(params[0]))
+	}
+	return ""
+}
+
+// openApiPath 把 httprouter 路径转换成 OpenAPI 路径，例如：/api/:id/*path 转换成 /api/{id}/{path}
+func openApiPath(path string) (string, []string) {
+	var params []string
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			name := segment[1:]
+			params = append(params, name)
+			segments[i] = "{" + name + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+// securityScheme 认证配置对应的 OpenAPI 安全方案，自定义认证器返回 nil
+func securityScheme(config AuthConfig) (string, map[string]interface{}) {
+	switch config.Type {
+	case AuthTypeApiKey:
+		if config.Header != "" || config.Query == "" {
+			header := config.Header
+			if header == "" {
+				header = defaultApiKeyHeader
+			}
+			return "apiKey_" + header, map[string]interface{}{"type": "apiKey", "in": "header", "name": header}
+		}
+		return "apiKey_" + config.Query, map[string]interface{}{"type": "apiKey", "in": "query", "name": config.Query}
+	case AuthTypeBasic:
+		return AuthTypeBasic, map[string]interface{}{"type": "http", "scheme": "basic"}
+	case AuthTypeJwt:
+		return AuthTypeJwt, map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"}
+	case AuthTypeHmac:
+		header := config.Header
+		if header == "" {
+			header = defaultHmacHeader
+		}
+		return "hmac_" + header, map[string]interface{}{"type": "apiKey", "in": "header", "name": header}
+	case AuthTypeMtls:
+		return AuthTypeMtls, map[string]interface{}{"type": "mutualTLS"}
+	}
+	return "", nil
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/utils/maps"
+)
+
+var deviceSchema = map[string]interface{}{
+	"type":     "object",
+	"required": []string{"deviceId", "temperature"},
+	"properties": map[string]interface{}{
+		"deviceId":    map[string]interface{}{"type": "string", "pattern": "^dev-[0-9]+$"},
+		"temperature": map[string]interface{}{"type": "number", "minimum": -40, "maximum": 85},
+		"tags":        map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}, "maxItems": 2},
+		"mode":        map[string]interface{}{"type": "string", "enum": []string{"auto", "manual"}},
+	},
+	"additionalProperties": false,
+}
+
+func newOpenApiEndpoint(t *testing.T) (*Endpoint, *httptest.Server) {
+	ep := &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{
+		"server": ":9096",
+		"openApi": map[string]interface{}{
+			"path":            "/openapi.json",
+			"title":           "Device API",
+			"version":         "2.0.0",
+			"validateRequest": true,
+		},
+		"auth": map[string]interface{}{"type": AuthTypeApiKey, "keys": map[string]string{"key1": "device1"}},
+	})
+	assert.Nil(t, err)
+	ok := func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.SetBody([]byte(exchange.In.GetMsg().Data))
+		return false
+	}
+	router := impl.NewRouter(endpoint.RouterOptions.WithDefinition(&types.RouterDsl{
+		AdditionalInfo: map[string]interface{}{
+			OpenApiSummaryKey:        "上报设备数据",
+			OpenApiTagsKey:           []string{"device"},
+			OpenApiRequestSchemaKey:  deviceSchema,
+			OpenApiResponseSchemaKey: map[string]interface{}{"type": "object"},
+		},
+	})).SetId("report").From("/api/v1/devices/:id/report").Process(ok).End()
+	_, err = ep.AddRouter(router, http.MethodPost)
+	assert.Nil(t, err)
+	_, err = ep.AddRouter(impl.NewRouter().From("/api/v1/devices/:id/files/*path", types.Configuration{
+		AuthConfigKey: map[string]interface{}{"type": AuthTypeNone},
+	}).Process(ok).End(), http.MethodGet)
+	assert.Nil(t, err)
+	_, err = ep.AddRouter(impl.NewRouter().From("/api/v1/devices/:id/report").Process(ok).End(), http.MethodPut)
+	assert.Nil(t, err)
+	return ep, httptest.NewServer(ep.Router())
+}
+
+func TestOpenApi(t *testing.T) {
+	ep, server := newOpenApiEndpoint(t)
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + "/openapi.json")
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, JsonContextType, resp.Header.Get(ContentTypeKey))
+	data, _ := io.ReadAll(resp.Body)
+	var doc map[string]interface{}
+	assert.Nil(t, json.Unmarshal(data, &doc))
+
+	assert.Equal(t, "3.1.0", doc["openapi"])
+	assert.Equal(t, "Device API", maps.Get(doc, "info.title"))
+	assert.Equal(t, "2.0.0", maps.Get(doc, "info.version"))
+	paths := doc["paths"].(map[string]interface{})
+	assert.Equal(t, 2, len(paths))
+
+	report := paths["/api/v1/devices/{id}/report"].(map[string]interface{})
+	post := report["post"].(map[string]interface{})
+	assert.Equal(t, "report", post["operationId"])
+	assert.Equal(t, "上报设备数据", post["summary"])
+	assert.Equal(t, []interface{}{"device"}, post["tags"])
+	assert.Equal(t, true, maps.Get(post, "requestBody.required"))
+	schema := maps.Get(post, "requestBody.content").(map[string]interface{})[JsonContextType].(map[string]interface{})["schema"]
+	assert.Equal(t, "object", maps.Get(schema, "type"))
+	parameters := post["parameters"].([]interface{})
+	assert.Equal(t, 1, len(parameters))
+	assert.Equal(t, "id", maps.Get(parameters[0], "name"))
+	assert.Equal(t, "path", maps.Get(parameters[0], "in"))
+	responses := post["responses"].(map[string]interface{})
+	for _, code := range []string{"200", "400", "401", "403"} {
+		_, ok := responses[code]
+		assert.True(t, ok)
+	}
+	assert.Equal(t, []interface{}{map[string]interface{}{"apiKey_X-API-Key": []interface{}{}}}, post["security"])
+	put := report["put"].(map[string]interface{})
+	assert.Equal(t, false, maps.Get(put, "requestBody.required"))
+
+	files := paths["/api/v1/devices/{id}/files/{path}"].(map[string]interface{})["get"].(map[string]interface{})
+	assert.Equal(t, 2, len(files["parameters"].([]interface{})))
+	assert.Nil(t, files["security"])
+	_, ok := files["responses"].(map[string]interface{})["401"]
+	assert.False(t, ok)
+
+	assert.Equal(t, "header", maps.Get(doc, "components.securitySchemes.apiKey_X-API-Key.in"))
+
+	//禁用的路由不输出
+	assert.Nil(t, ep.RemoveRouter("report"))
+	paths = ep.OpenApi()["paths"].(map[string]interface{})
+	_, ok = paths["/api/v1/devices/{id}/report"].(map[string]interface{})["post"]
+	assert.False(t, ok)
+}
+
+func TestOpenApiValidateRequest(t *testing.T) {
+	_, server := newOpenApiEndpoint(t)
+	defer server.Close()
+
+	post := func(body string) (int, string) {
+		req, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1/devices/1/report", strings.NewReader(body))
+		req.Header.Set("X-API-Key", "key1")
+		resp, err := http.DefaultClient.Do(req)
+		assert.Nil(t, err)
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, strings.TrimSpace(string(data))
+	}
+	code, body := post(`{"deviceId":"dev-1","temperature":21.5,"tags":["a"],"mode":"auto"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"deviceId":"dev-1","temperature":21.5,"tags":["a"],"mode":"auto"}`, body)
+
+	tests := []struct {
+		body string
+		err  string
+	}{
+		{`{"deviceId":"dev-1"}`, "$.temperature: is required"},
+		{`{"deviceId":"abc","temperature":1}`, "$.deviceId: must match pattern ^dev-[0-9]+$"},
+		{`{"deviceId":"dev-1","temperature":100}`, "$.temperature: must be <= 85"},
+		{`{"deviceId":"dev-1","temperature":"1"}`, "$.temperature: expected number"},
+		{`{"deviceId":"dev-1","temperature":1,"tags":["a",1]}`, "$.tags[1]: expected string"},
+		{`{"deviceId":"dev-1","temperature":1,"tags":["a","b","c"]}`, "$.tags: must have at most 2 items"},
+		{`{"deviceId":"dev-1","temperature":1,"mode":"off"}`, "$.mode: must be one of [auto manual]"},
+		{`{"deviceId":"dev-1","temperature":1,"other":1}`, "$.other: is not allowed"},
+		{`[1]`, "$: expected object"},
+	}
+	for _, item := range tests {
+		code, body = post(item.body)
+		assert.Equal(t, http.StatusBadRequest, code)
+		assert.Equal(t, item.err, body)
+	}
+	code, _ = post(`{bad`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	//认证先于校验
+	resp, err := http.Post(server.URL+"/api/v1/devices/1/report", JsonContextType, strings.NewReader(`{}`))
+	assert.Nil(t, err)
+	_ = resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	_, err = NewSchemaValidator(map[string]interface{}{"type": "string", "pattern": "["})
+	assert.NotNil(t, err)
+}
@@ -33,12 +33,15 @@ package rest
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"net/textproto"
+	"os"
 	"strings"
 
 	"github.com/julienschmidt/httprouter"
@@ -165,6 +168,10 @@ type ResponseMessage struct {
 	to       string
 	msg      *types.RuleMsg
 	err      error
+	//流式响应，不为空则响应体作为事件推送
+	stream *Stream
+	//下一个推送的事件是否是错误事件
+	streamErr bool
 }
 
 func (r *ResponseMessage) Body() []byte {
@@ -200,6 +207,11 @@ func (r *ResponseMessage) GetMsg() *types.RuleMsg {
 }
 
 func (r *ResponseMessage) SetStatusCode(statusCode int) {
+	if r.stream != nil {
+		//流式响应已经发送状态码，错误状态码标记下一个事件为错误事件
+		r.streamErr = statusCode >= http.StatusBadRequest
+		return
+	}
 	if r.response != nil {
 		r.response.WriteHeader(statusCode)
 	}
@@ -207,6 +219,16 @@ func (r *ResponseMessage) SetStatusCode(statusCode int) {
 
 func (r *ResponseMessage) SetBody(body []byte) {
 	r.body = body
+	if r.stream != nil {
+		var event string
+		if r.streamErr {
+			event, r.streamErr = StreamEventError, false
+		}
+		if err := r.stream.Write(endpoint.StreamEvent{Event: event, Data: body}); err != nil {
+			r.err = err
+		}
+		return
+	}
 	if r.response != nil {
 		_, _ = r.response.Write(body)
 	}
@@ -231,6 +253,12 @@ type Config struct {
 	CertKeyFile string
 	//是否允许跨域
 	AllowCors bool
+	//客户端证书CA文件，配置后校验客户端证书，用于 mtls 认证
+	CaFile string
+	//认证配置，为空不认证，路由可以通过 from 配置的 auth 字段覆盖
+	Auth *AuthConfig
+	//OpenAPI 文档配置，为空不提供文档服务和请求体校验
+	OpenApi *OpenApiConfig
 }
 
 // Rest 接收端端点
@@ -244,6 +272,8 @@ type Rest struct {
 	//http路由器
 	router  *httprouter.Router
 	started bool
+	//端点级别的认证
+	auth *Auth
 }
 
 // Type 组件类型
@@ -266,6 +296,11 @@ func (rest *Rest) Init(ruleConfig types.Config, configuration types.Configuratio
 		return err
 	}
 	rest.RuleConfig = ruleConfig
+	if rest.Config.Auth != nil {
+		if rest.auth, err = NewAuth(*rest.Config.Auth); err != nil {
+			return err
+		}
+	}
 	return rest.SharedNode.Init(rest.RuleConfig, rest.Type(), rest.Config.Server, false, func() (*Rest, error) {
 		return rest.initServer()
 	})
@@ -438,13 +473,11 @@ func (rest *Rest) addRouter(method string, routers ...endpoint.Router) error {
 			if rest.router == nil {
 				rest.newRouter()
 			}
-			isWait := false
-			if from := item.GetFrom(); from != nil {
-				if to := from.GetTo(); to != nil {
-					isWait = to.IsWait()
-				}
+			opts, err := rest.newHandlerOptions(item)
+			if err != nil {
+				return err
 			}
-			rest.router.Handle(method, path, rest.handler(item, isWait))
+			rest.router.Handle(method, path, rest.handler(item, opts))
 		}
 
 	}
@@ -491,6 +524,12 @@ func (rest *Rest) GlobalOPTIONS(handler http.Handler) *Rest {
 	return rest
 }
 
+// Handle 注册原生的 http.Handler，例如：rest.Handle(http.MethodGet, "/metrics", registry.Handler())
+func (rest *Rest) Handle(method, path string, handler http.Handler) *Rest {
+	rest.Router().Handler(method, path, handler)
+	return rest
+}
+
 func (rest *Rest) checkIsInitSharedNode() error {
 	if !rest.SharedNode.IsInit() {
 		err := rest.SharedNode.Init(rest.RuleConfig, rest.Type(), rest.Config.Server, false, func() (*Rest, error) {
@@ -518,7 +557,43 @@ func (rest *Rest) routerKey(method string, from string) string {
 	return method + ":" + from
 }
 
-func (rest *Rest) handler(router endpoint.Router, isWait bool) httprouter.Handle {
+// handlerOptions 路由处理器选项
+type handlerOptions struct {
+	//是否同步执行
+	isWait bool
+	//认证，nil 不认证
+	auth *Auth
+	//请求体校验，nil 不校验
+	validator *SchemaValidator
+	//流式响应配置，nil 不使用流式响应
+	stream *StreamConfig
+}
+
+func (rest *Rest) newHandlerOptions(router endpoint.Router) (handlerOptions, error) {
+	var opts handlerOptions
+	var err error
+	if opts.auth, err = rest.RouterAuth(router); err != nil {
+		return opts, err
+	}
+	if opts.validator, err = rest.requestValidator(router); err != nil {
+		return opts, err
+	}
+	if opts.stream, err = routerStreamConfig(router); err != nil {
+		return opts, err
+	}
+	if from := router.GetFrom(); from != nil {
+		if to := from.GetTo(); to != nil {
+			//流式响应需要同步执行规则链
+			if opts.stream != nil && !to.IsWait() {
+				to.Wait()
+			}
+			opts.isWait = to.IsWait()
+		}
+	}
+	return opts, nil
+}
+
+func (rest *Rest) handler(router endpoint.Router, opts handlerOptions) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
 		defer func() {
 			//捕捉异常
@@ -531,6 +606,12 @@ func (rest *Rest) handler(router endpoint.Router, isWait bool) httprouter.Handle
 			//w.WriteHeader(http.NotFound())
 			return
 		}
+		//认证失败不执行路由
+		principal, err := opts.auth.Check(w, r)
+		if err != nil {
+			rest.Printf("http endpoint auth err :%v", err)
+			return
+		}
 		exchange := &endpoint.Exchange{
 			In: &RequestMessage{
 				request: r,
@@ -542,6 +623,14 @@ func (rest *Rest) handler(router endpoint.Router, isWait bool) httprouter.Handle
 			},
 		}
 
+		//校验请求体，失败不执行路由
+		if opts.validator != nil && r.Method != http.MethodGet && r.Method != http.MethodHead {
+			if err := opts.validator.Validate(exchange.In.Body()); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
 		msg := exchange.In.GetMsg()
 		//把路径参数放到msg元数据中
 		for _, param := range params {
@@ -557,8 +646,14 @@ func (rest *Rest) handler(router endpoint.Router, isWait bool) httprouter.Handle
 			}
 
 		}
+		//把认证主体放到msg元数据中，覆盖同名的请求参数
+		principal.PutMetadata(msg.Metadata)
+		if opts.stream != nil {
+			rest.doStream(w, r, router, exchange, *opts.stream)
+			return
+		}
 		var ctx = r.Context()
-		if !isWait {
+		if !opts.isWait {
 			//异步不能使用request context，否则后续执行会取消
 			ctx = context.Background()
 		}
@@ -597,6 +692,10 @@ func (rest *Rest) newRouter() *httprouter.Router {
 			return true
 		})
 	}
+	//OpenAPI 文档服务
+	if rest.Config.OpenApi != nil && rest.Config.OpenApi.Path != "" {
+		rest.router.GET(rest.Config.OpenApi.Path, rest.openApiHandler())
+	}
 	return rest.router
 }
 func (rest *Rest) initServer() (*Rest, error) {
@@ -612,6 +711,11 @@ func (rest *Rest) startServer() error {
 	}
 	var err error
 	rest.Server = &http.Server{Addr: rest.Config.Server, Handler: rest.router}
+	if rest.Config.CaFile != "" {
+		if rest.Server.TLSConfig, err = rest.clientCaTLSConfig(); err != nil {
+			return err
+		}
+	}
 	ln, err := rest.Listen()
 	if err != nil {
 		return err
@@ -644,3 +748,16 @@ func (rest *Rest) startServer() error {
 	}
 	return err
 }
+
+// clientCaTLSConfig 使用 CaFile 校验客户端证书，没有提供证书的请求由认证器决定是否拒绝
+func (rest *Rest) clientCaTLSConfig() (*tls.Config, error) {
+	ca, err := os.ReadFile(rest.Config.CaFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("invalid ca file: %s", rest.Config.CaFile)
+	}
+	return &tls.Config{ClientCAs: pool, ClientAuth: tls.VerifyClientCertIfGiven}, nil
+}
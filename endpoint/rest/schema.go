@@ -0,0 +1,209 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/rulego/rulego/utils/str"
+)
+
+// SchemaValidator 请求体 JSON Schema 校验器
+// 支持 OpenAPI 常用的关键字：type、properties、required、additionalProperties、items、enum、
+// minimum、maximum、minLength、maxLength、pattern、minItems、maxItems
+type SchemaValidator struct {
+	schema map[string]interface{}
+}
+
+// NewSchemaValidator 创建校验器，会预先检查 pattern 是否合法
+func NewSchemaValidator(schema map[string]interface{}) (*SchemaValidator, error) {
+	//统一转换成 json 解码后的类型，例如：[]string 转换成 []interface{}
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	var normalized map[string]interface{}
+	if err = json.Unmarshal(data, &normalized); err != nil {
+		return nil, err
+	}
+	if err = checkSchemaPattern(normalized); err != nil {
+		return nil, err
+	}
+	return &SchemaValidator{schema: normalized}, nil
+}
+
+// Validate 校验 JSON 数据
+func (v *SchemaValidator) Validate(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("request body is not valid json: %s", err.Error())
+	}
+	return validateSchema(v.schema, value, "$")
+}
+
+func validateSchema(schema map[string]interface{}, value interface{}, path string) error {
+	if schema == nil {
+		return nil
+	}
+	if t, ok := schema["type"].(string); ok && !matchSchemaType(t, value) {
+		if value == nil && schema["nullable"] == true {
+			return nil
+		}
+		return fmt.Errorf("%s: expected %s", path, t)
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, item := range enum {
+			if str.ToString(item) == str.ToString(value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: must be one of %v", path, enum)
+		}
+	}
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return validateObject(schema, v, path)
+	case []interface{}:
+		if min, ok := schemaNumber(schema, "minItems"); ok && float64(len(v)) < min {
+			return fmt.Errorf("%s: must have at least %v items", path, min)
+		}
+		if max, ok := schemaNumber(schema, "maxItems"); ok && float64(len(v)) > max {
+			return fmt.Errorf("%s: must have at most %v items", path, max)
+		}
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				if err := validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if min, ok := schemaNumber(schema, "minLength"); ok && length < min {
+			return fmt.Errorf("%s: length must be at least %v", path, min)
+		}
+		if max, ok := schemaNumber(schema, "maxLength"); ok && length > max {
+			return fmt.Errorf("%s: length must be at most %v", path, max)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if matched, _ := regexp.MatchString(pattern, v); !matched {
+				return fmt.Errorf("%s: must match pattern %s", path, pattern)
+			}
+		}
+	case float64:
+		if min, ok := schemaNumber(schema, "minimum"); ok && v < min {
+			return fmt.Errorf("%s: must be >= %v", path, min)
+		}
+		if max, ok := schemaNumber(schema, "maximum"); ok && v > max {
+			return fmt.Errorf("%s: must be <= %v", path, max)
+		}
+	}
+	return nil
+}
+
+func validateObject(schema map[string]interface{}, value map[string]interface{}, path string) error {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, item := range required {
+			if _, ok := value[str.ToString(item)]; !ok {
+				return fmt.Errorf("%s.%v: is required", path, item)
+			}
+		}
+	}
+	properties, _ := schema["properties"].(map[string]interface{})
+	//按字段名排序，保证错误信息稳定
+	keys := make([]string, 0, len(value))
+	for k := range value {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if property, ok := properties[k].(map[string]interface{}); ok {
+			if err := validateSchema(property, value[k], path+"."+k); err != nil {
+				return err
+			}
+		} else if additional, ok := schema["additionalProperties"]; ok {
+			switch additional := additional.(type) {
+			case bool:
+				if !additional {
+					return fmt.Errorf("%s.%s: is not allowed", path, k)
+				}
+			case map[string]interface{}:
+				if err := validateSchema(additional, value[k], path+"."+k); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func matchSchemaType(t string, value interface{}) bool {
+	switch t {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		v, ok := value.(float64)
+		return ok && v == math.Trunc(v)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return true
+}
+
+func schemaNumber(schema map[string]interface{}, key string) (float64, bool) {
+	v, ok := schema[key].(float64)
+	return v, ok
+}
+
+func checkSchemaPattern(schema map[string]interface{}) error {
+	for k, v := range schema {
+		switch v := v.(type) {
+		case string:
+			if k == "pattern" {
+				if _, err := regexp.Compile(v); err != nil {
+					return fmt.Errorf("invalid schema pattern %s: %w", v, err)
+				}
+			}
+		case map[string]interface{}:
+			if err := checkSchemaPattern(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
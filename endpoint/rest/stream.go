@@ -0,0 +1,230 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/utils/maps"
+)
+
+const (
+	// StreamConfigKey 路由 from 配置中流式响应配置的key
+	StreamConfigKey = "stream"
+	// StreamModeSse Server-Sent Events
+	StreamModeSse = "sse"
+	// StreamModeChunked 分块传输，每个事件一行
+	StreamModeChunked = "chunked"
+	// StreamEventError 规则链以错误结束时的 SSE 事件名称
+	StreamEventError = "error"
+	// StreamEventEnd 规则链执行结束时的 SSE 事件名称
+	StreamEventEnd = "end"
+
+	ContentTypeEventStream = "text/event-stream"
+	ContentTypeNdjson      = "application/x-ndjson"
+
+	defaultStreamHeartbeat = time.Second * 15
+)
+
+// StreamConfig 路由流式响应配置，配置在路由 from 配置的 stream 字段，例如：{"mode":"sse","heartbeat":"15s"}
+// 流式响应的路由同步执行规则链(等同于 To.Wait())，规则链每个分支结束时，to 端处理器(例如 responseToBody)
+// 设置的响应体作为一个事件推送给客户端，节点也可以通过 endpoint.StreamWriterFromContext 推送部分输出
+// 客户端断开连接会取消规则链的 context.Context
+type StreamConfig struct {
+	// Mode 流式响应模式：sse/chunked
+	Mode string
+	// Heartbeat 心跳间隔，例如：15s，默认15s，小于0不发送心跳
+	// sse 模式发送注释行，chunked 模式发送空行
+	Heartbeat time.Duration
+	// ContentType chunked 模式的响应类型，默认 application/x-ndjson
+	ContentType string
+}
+
+// Stream 流式响应，实现 endpoint.StreamWriter
+type Stream struct {
+	config  StreamConfig
+	ctx     context.Context
+	w       http.ResponseWriter
+	flusher http.Flusher
+	lock    sync.Mutex
+	//事件ID
+	id     int64
+	closed bool
+}
+
+var _ endpoint.StreamWriter = (*Stream)(nil)
+
+// sseLineReplacer 删除 SSE 字段值中的行结束符
+var sseLineReplacer = strings.NewReplacer("\r", "", "\n", "")
+
+// newStream 创建流式响应，ctx 取消后不能再写入
+func newStream(ctx context.Context, w http.ResponseWriter, config StreamConfig) (*Stream, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, errors.New("response writer does not support flush")
+	}
+	return &Stream{config: config, ctx: ctx, w: w, flusher: flusher}, nil
+}
+
+// Write 推送一个事件
+func (s *Stream) Write(event endpoint.StreamEvent) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed || s.ctx.Err() != nil {
+		return endpoint.ErrStreamClosed
+	}
+	var buf bytes.Buffer
+	if s.config.Mode == StreamModeSse {
+		s.id++
+		buf.WriteString("id: " + strconv.FormatInt(s.id, 10) + "\n")
+		//事件名称不能包含换行，否则可以注入其他字段或者事件
+		if name := sseLineReplacer.Replace(event.Event); name != "" {
+			buf.WriteString("event: " + name + "\n")
+		}
+		//\r\n、\r、\n 都是 SSE 的行结束符，每行数据单独输出为 data 字段
+		data := bytes.ReplaceAll(bytes.ReplaceAll(event.Data, []byte("\r\n"), []byte("\n")), []byte("\r"), []byte("\n"))
+		for _, line := range bytes.Split(data, []byte("\n")) {
+			buf.WriteString("data: ")
+			buf.Write(line)
+			buf.WriteString("\n")
+		}
+		buf.WriteString("\n")
+	} else {
+		buf.Write(event.Data)
+		buf.WriteString("\n")
+	}
+	return s.write(buf.Bytes())
+}
+
+func (s *Stream) start() {
+	header := s.w.Header()
+	if s.config.Mode == StreamModeSse {
+		header.Set(ContentTypeKey, ContentTypeEventStream)
+	} else if s.config.ContentType != "" {
+		header.Set(ContentTypeKey, s.config.ContentType)
+	} else {
+		header.Set(ContentTypeKey, ContentTypeNdjson)
+	}
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	//禁止 nginx 缓冲
+	header.Set("X-Accel-Buffering", "no")
+	s.w.WriteHeader(http.StatusOK)
+	s.flusher.Flush()
+}
+
+// heartbeat 定时发送心跳，直到 ctx 取消
+func (s *Stream) heartbeat(ctx context.Context) {
+	interval := s.config.Heartbeat
+	if interval == 0 {
+		interval = defaultStreamHeartbeat
+	}
+	if interval < 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	data := []byte("\n")
+	if s.config.Mode == StreamModeSse {
+		data = []byte(": heartbeat\n\n")
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.lock.Lock()
+			if !s.closed {
+				_ = s.write(data)
+			}
+			s.lock.Unlock()
+		}
+	}
+}
+
+// close 结束流式响应，sse 模式发送结束事件
+func (s *Stream) close() {
+	if s.config.Mode == StreamModeSse {
+		_ = s.Write(endpoint.StreamEvent{Event: StreamEventEnd, Data: []byte(StreamEventEnd)})
+	}
+	s.lock.Lock()
+	s.closed = true
+	s.lock.Unlock()
+}
+
+func (s *Stream) write(data []byte) error {
+	if _, err := s.w.Write(data); err != nil {
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// doStream 以流式响应执行路由，阻塞直到规则链执行结束或者客户端断开连接
+func (rest *Rest) doStream(w http.ResponseWriter, r *http.Request, router endpoint.Router, exchange *endpoint.Exchange, config StreamConfig) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	stream, err := newStream(ctx, w, config)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if out, ok := exchange.Out.(*ResponseMessage); ok {
+		out.stream = stream
+	}
+	stream.start()
+	go stream.heartbeat(ctx)
+	rest.DoProcess(endpoint.WithStreamWriter(ctx, stream), router, exchange)
+	stream.close()
+}
+
+// routerStreamConfig 获取路由 from 配置的流式响应配置，没有配置返回 nil
+func routerStreamConfig(router endpoint.Router) (*StreamConfig, error) {
+	from, ok := router.GetFrom().(*impl.From)
+	if !ok || from == nil {
+		return nil, nil
+	}
+	v, ok := from.Config[StreamConfigKey]
+	if !ok || v == nil {
+		return nil, nil
+	}
+	var config StreamConfig
+	if mode, ok := v.(string); ok {
+		//简写，例如："stream": "sse"
+		config.Mode = mode
+	} else if err := maps.Map2Struct(v, &config); err != nil {
+		return nil, err
+	}
+	switch config.Mode {
+	case "":
+		return nil, nil
+	case StreamModeSse, StreamModeChunked:
+		return &config, nil
+	default:
+		return nil, fmt.Errorf("unsupported stream mode: %s", config.Mode)
+	}
+}
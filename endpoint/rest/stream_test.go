@@ -0,0 +1,203 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package rest
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/engine"
+	"github.com/rulego/rulego/test/assert"
+)
+
+// 遍历 msg.items，每次迭代推送一个 progress 事件
+var streamChain = `
+{
+  "ruleChain": {
+    "id": "testStream",
+    "name": "测试流式响应"
+  },
+  "metadata": {
+    "nodes": [
+      {
+        "id": "s1",
+        "type": "for",
+        "configuration": {
+          "range": "msg.items",
+          "do": "s2"
+        }
+      },
+      {
+        "id": "s2",
+        "type": "streamEmit",
+        "configuration": {
+          "event": "${metadata.event}"
+        }
+      }
+    ],
+    "connections": []
+  }
+}
+`
+
+func newStreamEndpoint(t *testing.T, stream interface{}, onEnd func()) *httptest.Server {
+	config := engine.NewConfig(types.WithDefaultPool())
+	_, err := engine.New("testStream", []byte(streamChain), engine.WithConfig(config))
+	assert.Nil(t, err)
+
+	ep := &Endpoint{}
+	err = ep.Init(config, types.Configuration{"server": ":9097"})
+	assert.Nil(t, err)
+	router := impl.NewRouter().From("/api/v1/stream", types.Configuration{StreamConfigKey: stream}).
+		Transform(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			exchange.In.GetMsg().Metadata.PutValue("event", "progress")
+			return true
+		}).
+		To("chain:testStream").
+		Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+			if err := exchange.Out.GetError(); err != nil {
+				exchange.Out.SetStatusCode(http.StatusInternalServerError)
+				exchange.Out.SetBody([]byte(err.Error()))
+			} else {
+				exchange.Out.SetBody([]byte(`{"done":true}`))
+			}
+			if onEnd != nil {
+				onEnd()
+			}
+			return true
+		}).End()
+	_, err = ep.AddRouter(router, http.MethodPost)
+	assert.Nil(t, err)
+	return httptest.NewServer(ep.Router())
+}
+
+func TestStreamSse(t *testing.T) {
+	server := newStreamEndpoint(t, map[string]interface{}{"mode": StreamModeSse, "heartbeat": "-1s"}, nil)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/api/v1/stream", JsonContextType, strings.NewReader(`{"items":["a","b","c"]}`))
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, ContentTypeEventStream, resp.Header.Get(ContentTypeKey))
+	data, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "id: 1\nevent: progress\ndata: a\n\n"+
+		"id: 2\nevent: progress\ndata: b\n\n"+
+		"id: 3\nevent: progress\ndata: c\n\n"+
+		"id: 4\ndata: {\"done\":true}\n\n"+
+		"id: 5\nevent: end\ndata: end\n\n", string(data))
+}
+
+func TestStreamChunked(t *testing.T) {
+	server := newStreamEndpoint(t, StreamModeChunked, nil)
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+"/api/v1/stream", JsonContextType, strings.NewReader(`{"items":["{\"i\":1}","{\"i\":2}"]}`))
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, ContentTypeNdjson, resp.Header.Get(ContentTypeKey))
+	data, _ := io.ReadAll(resp.Body)
+	assert.Equal(t, "{\"i\":1}\n{\"i\":2}\n{\"done\":true}\n", string(data))
+}
+
+func TestStreamHeartbeatAndDisconnect(t *testing.T) {
+	end := make(chan struct{}, 1)
+	server := newStreamEndpoint(t, map[string]interface{}{"mode": StreamModeSse, "heartbeat": "20ms"}, func() {
+		end <- struct{}{}
+	})
+	defer server.Close()
+
+	//客户端读取第一个事件后断开连接，规则链提前结束
+	var items []string
+	for i := 0; i < 100000; i++ {
+		items = append(items, `"x"`)
+	}
+	body := `{"items":[` + strings.Join(items, ",") + `]}`
+	resp, err := http.Post(server.URL+"/api/v1/stream", JsonContextType, strings.NewReader(body))
+	assert.Nil(t, err)
+	reader := bufio.NewReader(resp.Body)
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		assert.Nil(t, err)
+		lines = append(lines, line)
+		if line == "data: x\n" {
+			break
+		}
+	}
+	assert.True(t, strings.Contains(strings.Join(lines, ""), "id: 1\nevent: progress\n"))
+	_ = resp.Body.Close()
+
+	select {
+	case <-end:
+	case <-time.After(time.Second * 5):
+		t.Fatal("chain not cancelled after client disconnected")
+	}
+}
+
+func TestStreamHeartbeat(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*70)
+	defer cancel()
+	w := httptest.NewRecorder()
+	stream, err := newStream(ctx, w, StreamConfig{Mode: StreamModeSse, Heartbeat: time.Millisecond * 20})
+	assert.Nil(t, err)
+	stream.start()
+	stream.heartbeat(ctx)
+	assert.True(t, strings.Contains(w.Body.String(), ": heartbeat\n\n"))
+	assert.Equal(t, "no-cache", w.Header().Get("Cache-Control"))
+
+	stream.close()
+	assert.Equal(t, endpoint.ErrStreamClosed, stream.Write(endpoint.StreamEvent{Data: []byte("a")}))
+}
+
+func TestStreamSseInjection(t *testing.T) {
+	w := httptest.NewRecorder()
+	stream, err := newStream(context.Background(), w, StreamConfig{Mode: StreamModeSse})
+	assert.Nil(t, err)
+	stream.start()
+	assert.Nil(t, stream.Write(endpoint.StreamEvent{Event: "progress\ndata: fake\r\n\nevent: end", Data: []byte("a\rb\r\nc")}))
+	assert.Equal(t, "id: 1\nevent: progressdata: fakeevent: end\ndata: a\ndata: b\ndata: c\n\n", w.Body.String())
+}
+
+func TestStreamConfig(t *testing.T) {
+	ep := &Endpoint{}
+	err := ep.Init(types.NewConfig(), types.Configuration{"server": ":9097"})
+	assert.Nil(t, err)
+	ok := func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		return true
+	}
+	_, err = ep.AddRouter(impl.NewRouter().From("/a", types.Configuration{StreamConfigKey: "ws"}).Process(ok).End(), http.MethodGet)
+	assert.NotNil(t, err)
+
+	router := impl.NewRouter().From("/b", types.Configuration{StreamConfigKey: map[string]interface{}{"mode": StreamModeChunked, "contentType": "text/plain"}}).Process(ok).End()
+	config, err := routerStreamConfig(router)
+	assert.Nil(t, err)
+	assert.Equal(t, StreamConfig{Mode: StreamModeChunked, ContentType: "text/plain"}, *config)
+
+	config, err = routerStreamConfig(impl.NewRouter().From("/c").Process(ok).End())
+	assert.Nil(t, err)
+	assert.True(t, config == nil)
+}
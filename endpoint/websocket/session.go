@@ -0,0 +1,353 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package websocket
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/gorilla/websocket"
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+)
+
+const (
+	// SessionConfigKey endpoint 配置中会话配置的key
+	SessionConfigKey = "session"
+	// KeySessionId 会话ID在msg元数据中的key
+	KeySessionId = "sessionId"
+
+	defaultSendBufferSize = 256
+	defaultWriteTimeout   = time.Second * 10
+)
+
+// SessionConfig 会话配置，配置在 endpoint 配置的 session 字段，例如：{"sendBufferSize":256,"writeTimeout":"10s","roomKeys":["deviceId"]}
+type SessionConfig struct {
+	// SendBufferSize 每个会话的发送缓冲区大小，默认256。缓冲区满的会话视为慢消费者，断开连接
+	SendBufferSize int
+	// WriteTimeout 写超时，默认10s，超时的会话视为慢消费者，断开连接
+	WriteTimeout time.Duration
+	// RoomKeys 连接时自动加入的房间，从连接元数据(路径参数、url参数、认证主体)中获取，多个值用逗号分隔
+	// 例如：["deviceId"]，/ws/:deviceId 连接 /ws/d1 加入房间 deviceId:d1
+	RoomKeys []string
+}
+
+// outFrame 待发送的帧
+type outFrame struct {
+	messageType int
+	data        []byte
+}
+
+// Session websocket 会话，一个连接对应一个会话
+type Session struct {
+	id       string
+	conn     *websocket.Conn
+	request  *http.Request
+	metadata types.Metadata
+	registry *SessionRegistry
+	//房间，由 registry 锁保护
+	rooms     map[string]struct{}
+	send      chan outFrame
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// Id 会话ID
+func (s *Session) Id() string {
+	return s.id
+}
+
+// Request 升级前的http请求
+func (s *Session) Request() *http.Request {
+	return s.request
+}
+
+// Metadata 连接元数据，包括路径参数、url参数和认证主体，不能修改
+func (s *Session) Metadata() types.Metadata {
+	return s.metadata
+}
+
+// Rooms 会话已经加入的房间
+func (s *Session) Rooms() []string {
+	s.registry.lock.RLock()
+	defer s.registry.lock.RUnlock()
+	var rooms []string
+	for room := range s.rooms {
+		rooms = append(rooms, room)
+	}
+	sort.Strings(rooms)
+	return rooms
+}
+
+// Send 把消息放入发送缓冲区，messageType: websocket.TextMessage/websocket.BinaryMessage
+// 缓冲区满则断开连接并返回 endpoint.ErrSlowConsumer
+func (s *Session) Send(messageType int, data []byte) error {
+	select {
+	case <-s.done:
+		return endpoint.ErrStreamClosed
+	default:
+	}
+	select {
+	case s.send <- outFrame{messageType: messageType, data: data}:
+		return nil
+	case <-s.done:
+		return endpoint.ErrStreamClosed
+	default:
+		s.registry.evict(s, endpoint.ErrSlowConsumer)
+		return endpoint.ErrSlowConsumer
+	}
+}
+
+// Close 断开连接
+func (s *Session) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		_ = s.conn.Close()
+	})
+}
+
+// writeLoop 串行发送缓冲区中的帧，连接只能有一个并发写
+func (s *Session) writeLoop() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case frame := <-s.send:
+			_ = s.conn.SetWriteDeadline(time.Now().Add(s.registry.config.WriteTimeout))
+			if err := s.conn.WriteMessage(frame.messageType, frame.data); err != nil {
+				s.registry.evict(s, err)
+				return
+			}
+		}
+	}
+}
+
+// SessionRegistry 会话注册表，实现 endpoint.SessionManager
+// 规则链可以通过 wsPush 节点向会话、房间推送消息或者广播
+type SessionRegistry struct {
+	config   SessionConfig
+	lock     sync.RWMutex
+	sessions map[string]*Session
+	rooms    map[string]map[string]*Session
+	//会话被驱逐回调
+	onEvict func(session *Session, err error)
+}
+
+var _ endpoint.SessionManager = (*SessionRegistry)(nil)
+
+// NewSessionRegistry 创建会话注册表
+func NewSessionRegistry(config SessionConfig) *SessionRegistry {
+	if config.SendBufferSize <= 0 {
+		config.SendBufferSize = defaultSendBufferSize
+	}
+	if config.WriteTimeout <= 0 {
+		config.WriteTimeout = defaultWriteTimeout
+	}
+	return &SessionRegistry{
+		config:   config,
+		sessions: make(map[string]*Session),
+		rooms:    make(map[string]map[string]*Session),
+	}
+}
+
+// Get 获取会话
+func (r *SessionRegistry) Get(sessionId string) (*Session, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	s, ok := r.sessions[sessionId]
+	return s, ok
+}
+
+// Len 会话数量
+func (r *SessionRegistry) Len() int {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return len(r.sessions)
+}
+
+// RoomSessions 房间中的会话ID
+func (r *SessionRegistry) RoomSessions(room string) []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	var ids []string
+	for id := range r.rooms[room] {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// Join 会话加入房间
+func (r *SessionRegistry) Join(sessionId string, rooms ...string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	s, ok := r.sessions[sessionId]
+	if !ok {
+		return endpoint.ErrSessionNotFound
+	}
+	for _, room := range rooms {
+		s.rooms[room] = struct{}{}
+		members, ok := r.rooms[room]
+		if !ok {
+			members = make(map[string]*Session)
+			r.rooms[room] = members
+		}
+		members[sessionId] = s
+	}
+	return nil
+}
+
+// Leave 会话离开房间
+func (r *SessionRegistry) Leave(sessionId string, rooms ...string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	s, ok := r.sessions[sessionId]
+	if !ok {
+		return endpoint.ErrSessionNotFound
+	}
+	for _, room := range rooms {
+		r.leave(s, room)
+	}
+	return nil
+}
+
+// PushToSession 向会话推送消息
+func (r *SessionRegistry) PushToSession(sessionId string, msg endpoint.PushMessage) error {
+	s, ok := r.Get(sessionId)
+	if !ok {
+		return endpoint.ErrSessionNotFound
+	}
+	return s.Send(pushMessageType(msg), msg.Data)
+}
+
+// PushToRoom 向房间所有会话推送消息，慢消费者被驱逐，不影响其他会话
+func (r *SessionRegistry) PushToRoom(room string, msg endpoint.PushMessage) (int, error) {
+	r.lock.RLock()
+	var sessions []*Session
+	for _, s := range r.rooms[room] {
+		sessions = append(sessions, s)
+	}
+	r.lock.RUnlock()
+	return pushAll(sessions, msg), nil
+}
+
+// Broadcast 向所有会话推送消息
+func (r *SessionRegistry) Broadcast(msg endpoint.PushMessage) (int, error) {
+	r.lock.RLock()
+	var sessions []*Session
+	for _, s := range r.sessions {
+		sessions = append(sessions, s)
+	}
+	r.lock.RUnlock()
+	return pushAll(sessions, msg), nil
+}
+
+// CloseAll 断开所有会话
+func (r *SessionRegistry) CloseAll() {
+	r.lock.RLock()
+	var sessions []*Session
+	for _, s := range r.sessions {
+		sessions = append(sessions, s)
+	}
+	r.lock.RUnlock()
+	for _, s := range sessions {
+		s.Close()
+	}
+}
+
+// add 注册新连接，并根据 RoomKeys 加入房间
+func (r *SessionRegistry) add(conn *websocket.Conn, request *http.Request, metadata types.Metadata) *Session {
+	id, _ := uuid.NewV4()
+	s := &Session{
+		id:       id.String(),
+		conn:     conn,
+		request:  request,
+		metadata: metadata,
+		registry: r,
+		rooms:    make(map[string]struct{}),
+		send:     make(chan outFrame, r.config.SendBufferSize),
+		done:     make(chan struct{}),
+	}
+	r.lock.Lock()
+	r.sessions[s.id] = s
+	r.lock.Unlock()
+	var rooms []string
+	for _, key := range r.config.RoomKeys {
+		for _, v := range strings.Split(metadata.GetValue(key), ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				rooms = append(rooms, key+":"+v)
+			}
+		}
+	}
+	_ = r.Join(s.id, rooms...)
+	go s.writeLoop()
+	return s
+}
+
+// remove 注销会话并断开连接，返回会话是否还在注册表中
+func (r *SessionRegistry) remove(s *Session) bool {
+	r.lock.Lock()
+	removed := r.sessions[s.id] == s
+	if removed {
+		delete(r.sessions, s.id)
+		for room := range s.rooms {
+			r.leave(s, room)
+		}
+	}
+	r.lock.Unlock()
+	s.Close()
+	return removed
+}
+
+// evict 驱逐慢消费者或者写失败的会话
+func (r *SessionRegistry) evict(s *Session, err error) {
+	if r.remove(s) && r.onEvict != nil {
+		r.onEvict(s, err)
+	}
+}
+
+func (r *SessionRegistry) leave(s *Session, room string) {
+	delete(s.rooms, room)
+	if members, ok := r.rooms[room]; ok {
+		delete(members, s.id)
+		if len(members) == 0 {
+			delete(r.rooms, room)
+		}
+	}
+}
+
+func pushAll(sessions []*Session, msg endpoint.PushMessage) int {
+	messageType := pushMessageType(msg)
+	count := 0
+	for _, s := range sessions {
+		if s.Send(messageType, msg.Data) == nil {
+			count++
+		}
+	}
+	return count
+}
+
+func pushMessageType(msg endpoint.PushMessage) int {
+	if msg.Binary {
+		return websocket.BinaryMessage
+	}
+	return websocket.TextMessage
+}
@@ -0,0 +1,200 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package websocket
+
+import (
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/components/external"
+	"github.com/rulego/rulego/endpoint/impl"
+	"github.com/rulego/rulego/test"
+	"github.com/rulego/rulego/test/assert"
+)
+
+func newSessionEndpoint(t *testing.T, server string, session map[string]interface{}) (*Endpoint, string) {
+	wsEndpoint := &Endpoint{}
+	err := wsEndpoint.Init(types.NewConfig(), types.Configuration{
+		"server":         server,
+		SessionConfigKey: session,
+	})
+	assert.Nil(t, err)
+	//回复会话ID
+	router := impl.NewRouter().From("/ws/:deviceId").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		exchange.Out.SetBody([]byte(exchange.In.GetMsg().Metadata.GetValue(KeySessionId)))
+		return false
+	}).End()
+	_, err = wsEndpoint.AddRouter(router)
+	assert.Nil(t, err)
+	wsEndpoint.registerSessions()
+	httpServer := httptest.NewServer(wsEndpoint.Router())
+	t.Cleanup(func() {
+		wsEndpoint.Sessions.CloseAll()
+		endpoint.UnregisterSessionManager(wsEndpoint.sessionKey, wsEndpoint.Sessions)
+		httpServer.Close()
+	})
+	return wsEndpoint, "ws" + strings.TrimPrefix(httpServer.URL, "http")
+}
+
+// dialSession 连接并返回会话ID
+func dialSession(t *testing.T, url string) (*websocket.Conn, string) {
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.Nil(t, err)
+	assert.Nil(t, conn.WriteMessage(websocket.TextMessage, []byte("id")))
+	_, p, err := conn.ReadMessage()
+	assert.Nil(t, err)
+	return conn, string(p)
+}
+
+func pushMsg(t *testing.T, configuration types.Configuration, msg types.RuleMsg) (string, error) {
+	node, err := test.CreateAndInitNode("wsPush", configuration, external.Registry)
+	assert.Nil(t, err)
+	var count string
+	var pushErr error
+	ctx := test.NewRuleContext(types.NewConfig(), func(msg types.RuleMsg, relationType string, err error) {
+		count = msg.Metadata.GetValue(external.KeyPushCount)
+		pushErr = err
+	})
+	node.OnMsg(ctx, msg)
+	return count, pushErr
+}
+
+func readMessage(t *testing.T, conn *websocket.Conn) (int, string) {
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second * 3))
+	mt, p, err := conn.ReadMessage()
+	assert.Nil(t, err)
+	return mt, string(p)
+}
+
+func TestSessionPush(t *testing.T) {
+	server := ":9098"
+	var events []string
+	var lock sync.Mutex
+	wsEndpoint, url := newSessionEndpoint(t, server, map[string]interface{}{"roomKeys": []string{"deviceId"}})
+	wsEndpoint.OnEvent = func(eventName string, params ...interface{}) {
+		exchange := params[0].(*endpoint.Exchange)
+		lock.Lock()
+		defer lock.Unlock()
+		events = append(events, eventName+":"+exchange.In.GetMsg().Metadata.GetValue("deviceId"))
+		if eventName == endpoint.EventConnect {
+			assert.NotNil(t, exchange.Out.(*ResponseMessage).Session())
+			assert.True(t, exchange.In.GetMsg().Metadata.GetValue(KeySessionId) != "")
+		}
+	}
+
+	c1, _ := dialSession(t, url+"/ws/d1")
+	defer c1.Close()
+	c2, _ := dialSession(t, url+"/ws/d1?deviceId=d1,d3")
+	defer c2.Close()
+	c3, id3 := dialSession(t, url+"/ws/d2")
+	assert.Equal(t, 3, wsEndpoint.Sessions.Len())
+	assert.Equal(t, 2, len(wsEndpoint.Sessions.RoomSessions("deviceId:d1")))
+	assert.Equal(t, 1, len(wsEndpoint.Sessions.RoomSessions("deviceId:d3")))
+	session3, ok := wsEndpoint.Sessions.Get(id3)
+	assert.True(t, ok)
+	assert.Equal(t, []string{"deviceId:d2"}, session3.Rooms())
+	assert.Equal(t, "d2", session3.Metadata().GetValue("deviceId"))
+
+	metadata := types.NewMetadata()
+	metadata.PutValue("deviceId", "d1")
+	metadata.PutValue(KeySessionId, id3)
+	msg := types.NewMsg(0, "TEST", types.JSON, metadata, `{"temperature":41}`)
+
+	//房间
+	count, err := pushMsg(t, types.Configuration{"server": server, "mode": external.WsPushModeRoom, "target": "deviceId:${metadata.deviceId}"}, msg)
+	assert.Nil(t, err)
+	assert.Equal(t, "2", count)
+	for _, conn := range []*websocket.Conn{c1, c2} {
+		mt, data := readMessage(t, conn)
+		assert.Equal(t, websocket.TextMessage, mt)
+		assert.Equal(t, `{"temperature":41}`, data)
+	}
+
+	//会话，默认推送给 metadata.sessionId
+	count, err = pushMsg(t, types.Configuration{"server": server}, msg)
+	assert.Nil(t, err)
+	assert.Equal(t, "1", count)
+	_, data := readMessage(t, c3)
+	assert.Equal(t, `{"temperature":41}`, data)
+
+	//广播二进制消息
+	binMsg := types.NewMsg(0, "TEST", types.BINARY, types.NewMetadata(), "\x01\x02")
+	count, err = pushMsg(t, types.Configuration{"server": server, "mode": external.WsPushModeBroadcast}, binMsg)
+	assert.Nil(t, err)
+	assert.Equal(t, "3", count)
+	for _, conn := range []*websocket.Conn{c1, c2, c3} {
+		mt, data := readMessage(t, conn)
+		assert.Equal(t, websocket.BinaryMessage, mt)
+		assert.Equal(t, "\x01\x02", data)
+	}
+
+	//离开房间
+	assert.Nil(t, wsEndpoint.Sessions.Leave(id3, "deviceId:d2"))
+	assert.Equal(t, 0, len(wsEndpoint.Sessions.RoomSessions("deviceId:d2")))
+	assert.Nil(t, wsEndpoint.Sessions.Join(id3, "dashboard"))
+	assert.Equal(t, []string{"dashboard"}, session3.Rooms())
+
+	//断开连接
+	_ = c3.Close()
+	time.Sleep(time.Millisecond * 200)
+	assert.Equal(t, 2, wsEndpoint.Sessions.Len())
+	assert.Equal(t, 0, len(wsEndpoint.Sessions.RoomSessions("dashboard")))
+	_, err = pushMsg(t, types.Configuration{"server": server}, msg)
+	assert.Equal(t, endpoint.ErrSessionNotFound, err)
+	assert.Equal(t, endpoint.ErrSessionNotFound, wsEndpoint.Sessions.Join(id3, "dashboard"))
+
+	lock.Lock()
+	assert.Equal(t, []string{"Connect:d1", "Connect:d1,d3", "Connect:d2", "Disconnect:d2"}, events)
+	lock.Unlock()
+
+	_, err = pushMsg(t, types.Configuration{"server": ":9199", "mode": external.WsPushModeBroadcast}, msg)
+	assert.NotNil(t, err)
+}
+
+func TestSessionSlowConsumer(t *testing.T) {
+	wsEndpoint, url := newSessionEndpoint(t, ":9099", map[string]interface{}{"sendBufferSize": 2, "writeTimeout": "5s"})
+	slow, id := dialSession(t, url+"/ws/d1")
+	defer slow.Close()
+	fast, fastId := dialSession(t, url+"/ws/d2")
+	defer fast.Close()
+
+	//慢消费者不读取消息，发送缓冲区满后被驱逐
+	data := make([]byte, 256*1024)
+	var err error
+	for i := 0; i < 400 && err == nil; i++ {
+		err = wsEndpoint.Sessions.PushToSession(id, endpoint.PushMessage{Data: data, Binary: true})
+	}
+	assert.Equal(t, endpoint.ErrSlowConsumer, err)
+	_, ok := wsEndpoint.Sessions.Get(id)
+	assert.False(t, ok)
+	assert.Equal(t, endpoint.ErrSessionNotFound, wsEndpoint.Sessions.PushToSession(id, endpoint.PushMessage{Data: data}))
+
+	//不影响其他会话
+	count, err := wsEndpoint.Sessions.Broadcast(endpoint.PushMessage{Data: []byte("hello")})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, count)
+	_, msg := readMessage(t, fast)
+	assert.Equal(t, "hello", msg)
+	_, ok = wsEndpoint.Sessions.Get(fastId)
+	assert.True(t, ok)
+}
@@ -22,6 +22,7 @@
 // - Endpoint (alias Websocket): Implements the WebSocket server and message handling
 // - RequestMessage: Represents an incoming WebSocket message
 // - ResponseMessage: Represents the WebSocket message to be sent back
+// - SessionRegistry: Tracks connected sessions and rooms, and pushes messages to them (see the wsPush node)
 //
 // The WebSocket endpoint supports dynamic routing configuration, allowing users to
 // define message patterns and their corresponding rule chain or component destinations.
@@ -140,11 +141,13 @@ type ResponseMessage struct {
 	log         func(format string, v ...interface{})
 	request     *http.Request
 	conn        *websocket.Conn
-	body        []byte
-	to          string
-	msg         *types.RuleMsg
-	err         error
-	locker      sync.RWMutex
+	//会话，不为空则通过会话发送缓冲区发送
+	session *Session
+	body    []byte
+	to      string
+	msg     *types.RuleMsg
+	err     error
+	locker  sync.RWMutex
 }
 
 func (r *ResponseMessage) Body() []byte {
@@ -186,7 +189,14 @@ func (r *ResponseMessage) SetStatusCode(statusCode int) {
 
 func (r *ResponseMessage) SetBody(body []byte) {
 	r.body = body
-	if r.conn != nil {
+	if r.session != nil {
+		if r.messageType == 0 {
+			r.messageType = websocket.TextMessage
+		}
+		if err := r.session.Send(r.messageType, body); err != nil {
+			r.SetError(err)
+		}
+	} else if r.conn != nil {
 		if r.messageType == 0 {
 			r.messageType = websocket.TextMessage
 		}
@@ -208,6 +218,11 @@ func (r *ResponseMessage) GetError() error {
 	return r.err
 }
 
+// Session 当前连接的会话
+func (r *ResponseMessage) Session() *Session {
+	return r.session
+}
+
 // Config Websocket 服务配置
 type Config = rest.Config
 
@@ -218,6 +233,12 @@ type Websocket struct {
 	Config   Config
 	Upgrader websocket.Upgrader
 	OnEvent  endpoint.OnEvent
+	//会话配置
+	SessionConfig SessionConfig
+	//会话注册表，启动后以服务地址注册到 endpoint.RegisterSessionManager，供 wsPush 节点推送消息
+	Sessions *SessionRegistry
+	//会话注册表注册的key
+	sessionKey string
 }
 
 // Type 组件类型
@@ -243,9 +264,23 @@ func (ws *Websocket) Init(ruleConfig types.Config, configuration types.Configura
 	if err = ws.Rest.Init(ruleConfig, configuration); err != nil {
 		return err
 	}
+	if v, ok := configuration[SessionConfigKey]; ok && v != nil {
+		if err = maps.Map2Struct(v, &ws.SessionConfig); err != nil {
+			return err
+		}
+	}
+	ws.initSessions()
 	return err
 }
 
+// initSessions 创建会话注册表
+func (ws *Websocket) initSessions() {
+	ws.Sessions = NewSessionRegistry(ws.SessionConfig)
+	ws.Sessions.onEvict = func(session *Session, err error) {
+		ws.Printf("ws endpoint evict session=%s err :%v", session.Id(), err)
+	}
+}
+
 func (ws *Websocket) Id() string {
 	return ws.Config.Server
 }
@@ -259,7 +294,7 @@ func (ws *Websocket) AddRouter(router endpoint.Router, params ...interface{}) (i
 				err = fmt.Errorf("addRouter err :%v", e)
 			}
 		}()
-		ws.addRouter(router)
+		err = ws.addRouter(router)
 		return router.GetId(), err
 	}
 }
@@ -274,6 +309,7 @@ func (ws *Websocket) Start() error {
 	if ws.OnEvent != nil {
 		ws.OnEvent(endpoint.EventInitServer, ws.Rest.Server)
 	}
+	ws.registerSessions()
 	if ws.Rest.Started() {
 		return nil
 	}
@@ -283,32 +319,96 @@ func (ws *Websocket) Start() error {
 	return nil
 }
 
+// Destroy 断开所有会话并关闭服务
+func (ws *Websocket) Destroy() {
+	if ws.Rest == nil {
+		return
+	}
+	if ws.Sessions != nil {
+		endpoint.UnregisterSessionManager(ws.sessionKey, ws.Sessions)
+		ws.Sessions.CloseAll()
+	}
+	ws.Rest.Destroy()
+}
+
+// registerSessions 以服务地址注册会话注册表，引用共享服务(ref://)的 endpoint 使用共享服务地址
+// 同一个服务地址的多个 endpoint 共享会话注册表
+func (ws *Websocket) registerSessions() {
+	if ws.sessionKey != "" {
+		return
+	}
+	if ws.Sessions == nil {
+		ws.initSessions()
+	}
+	ws.sessionKey = ws.Rest.Config.Server
+	if ws.Rest.SharedNode.InstanceId != "" {
+		if shared, err := ws.Rest.SharedNode.Get(); err == nil {
+			ws.sessionKey = shared.Config.Server
+			if registry, ok := endpoint.GetSessionManager(ws.sessionKey); ok {
+				if sessions, ok := registry.(*SessionRegistry); ok {
+					ws.Sessions = sessions
+					return
+				}
+			}
+		}
+	}
+	endpoint.RegisterSessionManager(ws.sessionKey, ws.Sessions)
+}
+
 // addRouter 注册1个或者多个路由
-func (ws *Websocket) addRouter(routers ...endpoint.Router) *Websocket {
+func (ws *Websocket) addRouter(routers ...endpoint.Router) error {
 	ws.Lock()
 	defer ws.Unlock()
 
 	if ws.RouterStorage == nil {
 		ws.RouterStorage = make(map[string]endpoint.Router)
 	}
+	if ws.Sessions == nil {
+		ws.initSessions()
+	}
 	for _, item := range routers {
+		auth, err := ws.RouterAuth(item)
+		if err != nil {
+			return err
+		}
 		ws.CheckAndSetRouterId(item)
 		//存储路由
 		ws.RouterStorage[item.GetId()] = item
 		//添加到http路由器
-		ws.Router().Handle("GET", item.FromToString(), ws.handler(item))
+		ws.Router().Handle("GET", item.FromToString(), ws.handler(item, auth))
 	}
 
-	return ws
+	return nil
 }
 
-func (ws *Websocket) handler(router endpoint.Router) httprouter.Handle {
+func (ws *Websocket) handler(router endpoint.Router, auth *rest.Auth) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, params httprouter.Params) {
+		//升级前认证，失败响应 401/403
+		principal, err := auth.Check(w, r)
+		if err != nil {
+			ws.Printf("ws endpoint auth err :%v", err)
+			return
+		}
 		c, err := ws.Upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			ws.Printf("upgrade:", err)
 			return
 		}
+		//连接元数据：路径参数、url参数和认证主体
+		metadata := types.NewMetadata()
+		for _, param := range params {
+			metadata.PutValue(param.Key, param.Value)
+		}
+		for key, value := range r.URL.Query() {
+			if len(value) > 1 {
+				metadata.PutValue(key, str.ToString(value))
+			} else {
+				metadata.PutValue(key, value[0])
+			}
+		}
+		principal.PutMetadata(metadata)
+		session := ws.Sessions.add(c, r, metadata)
+
 		connectExchange := &endpoint.Exchange{
 			In: &RequestMessage{
 				request: r,
@@ -321,12 +421,18 @@ func (ws *Websocket) handler(router endpoint.Router) httprouter.Handle {
 				},
 				request: r,
 				conn:    c,
+				session: session,
 			}}
+		connectMsg := connectExchange.In.GetMsg()
+		for key, value := range metadata.Values() {
+			connectMsg.Metadata.PutValue(key, value)
+		}
+		connectMsg.Metadata.PutValue(KeySessionId, session.Id())
 		if ws.OnEvent != nil {
 			ws.OnEvent(endpoint.EventConnect, connectExchange)
 		}
 		defer func() {
-			_ = c.Close()
+			ws.Sessions.remove(session)
 			//捕捉异常
 			if e := recover(); e != nil {
 				if ws.OnEvent != nil {
@@ -369,26 +475,17 @@ func (ws *Websocket) handler(router endpoint.Router) httprouter.Handle {
 					},
 					request:     r,
 					conn:        c,
+					session:     session,
 					messageType: mt,
 				}}
 
 			msg := exchange.In.GetMsg()
-			//把路径参数放到msg元数据中
-			for _, param := range params {
-				msg.Metadata.PutValue(param.Key, param.Value)
+			//把连接元数据放到msg元数据中
+			for key, value := range metadata.Values() {
+				msg.Metadata.PutValue(key, value)
 			}
-
 			msg.Metadata.PutValue("messageType", strconv.Itoa(mt))
-
-			//把url?参数放到msg元数据中
-			for key, value := range r.URL.Query() {
-				if len(value) > 1 {
-					msg.Metadata.PutValue(key, str.ToString(value))
-				} else {
-					msg.Metadata.PutValue(key, value[0])
-				}
-
-			}
+			msg.Metadata.PutValue(KeySessionId, session.Id())
 			ws.DoProcess(r.Context(), router, exchange)
 		}
 	}
@@ -12,8 +12,10 @@ import (
 	"github.com/rulego/rulego/test/assert"
 	"github.com/rulego/rulego/utils/maps"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"reflect"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -302,3 +304,45 @@ func newWebsocketServe(t *testing.T, restEndpoint *rest.Rest) endpoint.Endpoint
 	assert.NotNil(t, wsEndpoint.Router())
 	return wsEndpoint
 }
+
+// 测试升级前认证
+func TestWsAuth(t *testing.T) {
+	wsEndpoint := &Endpoint{}
+	err := wsEndpoint.Init(types.NewConfig(), types.Configuration{
+		"server": ":9095",
+		"auth": map[string]interface{}{
+			"type":  rest.AuthTypeApiKey,
+			"query": "token",
+			"keys":  map[string]string{"key1": "device1:writer", "key2": "device2"},
+			"roles": []string{"writer"},
+		},
+	})
+	assert.Nil(t, err)
+	router := impl.NewRouter().From("/ws").Process(func(router endpoint.Router, exchange *endpoint.Exchange) bool {
+		msg := exchange.In.GetMsg()
+		exchange.Out.SetBody([]byte(msg.Metadata.GetValue(rest.PrincipalKey) + "|" + msg.Metadata.GetValue(rest.PrincipalRolesKey) +
+			"|" + msg.Metadata.GetValue(rest.PrincipalClaimPrefix+"tenant")))
+		return false
+	}).End()
+	_, err = wsEndpoint.AddRouter(router)
+	assert.Nil(t, err)
+	server := httptest.NewServer(wsEndpoint.Router())
+	defer server.Close()
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws"
+
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	_, resp, err = websocket.DefaultDialer.Dial(url+"?token=key2", nil)
+	assert.NotNil(t, err)
+	assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+
+	//url参数伪造的 principal 字段会被删除
+	conn, _, err := websocket.DefaultDialer.Dial(url+"?token=key1&principal=fake&principal_roles=admin&principal_tenant=t1", nil)
+	assert.Nil(t, err)
+	defer conn.Close()
+	assert.Nil(t, conn.WriteMessage(websocket.TextMessage, []byte("hello")))
+	_, p, err := conn.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, "device1|writer|", string(p))
+}
@@ -347,6 +347,9 @@ func (rc *RuleChainCtx) ReloadChild(ruleNodeId types.RuleNodeId, def []byte) err
 	if node, ok := rc.GetNodeById(ruleNodeId); ok {
 		// Update child node
 		err := node.ReloadSelf(def)
+		if err == nil {
+			rc.updateNodeDefinition(ruleNodeId, node)
+		}
 		// Execute reload aspects
 		for _, aop := range rc.afterReloadAspects {
 			if err := aop.OnReload(rc, node); err != nil {
@@ -358,6 +361,22 @@ func (rc *RuleChainCtx) ReloadChild(ruleNodeId types.RuleNodeId, def []byte) err
 	return nil
 }
 
+// updateNodeDefinition replaces the definition of a reloaded child node in the rule chain definition,
+// so that DSL returns the latest configuration
+func (rc *RuleChainCtx) updateNodeDefinition(ruleNodeId types.RuleNodeId, node types.NodeCtx) {
+	nodeCtx, ok := node.(*RuleNodeCtx)
+	if !ok || rc.SelfDefinition == nil {
+		return
+	}
+	rc.Lock()
+	defer rc.Unlock()
+	for i, item := range rc.SelfDefinition.Metadata.Nodes {
+		if item != nil && item.Id == ruleNodeId.Id {
+			rc.SelfDefinition.Metadata.Nodes[i] = nodeCtx.SelfDefinition
+		}
+	}
+}
+
 // DSL returns the rule chain definition as a byte slice
 func (rc *RuleChainCtx) DSL() []byte {
 	v, _ := rc.config.Parser.EncodeRuleChain(rc.SelfDefinition)
@@ -0,0 +1,132 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/rulego/rulego/api/types"
+)
+
+// saveCheckpoint persists the message that is about to be processed by nextNode.
+// It returns the checkpoint ID, or an empty string if no message store is configured.
+func (ctx *DefaultRuleContext) saveCheckpoint(msg types.RuleMsg, nextNode types.NodeCtx, relationType string) string {
+	store := ctx.config.MessageStore
+	if store == nil || ctx.ruleChainCtx == nil || nextNode == nil {
+		return ""
+	}
+	// Sub-rule chain connections are executed by the sub-rule chain itself
+	if nextNode.GetNodeId().Type == types.CHAIN {
+		return ""
+	}
+	uid, _ := uuid.NewV4()
+	checkpoint := types.MessageCheckpoint{
+		Id:           uid.String(),
+		RuleChainId:  ctx.ruleChainCtx.Id.Id,
+		NodeId:       nextNode.GetNodeId().Id,
+		RelationType: relationType,
+		Msg:          msg,
+		Ts:           time.Now().UnixMilli(),
+	}
+	if ctx.self != nil && !ctx.isFirst {
+		checkpoint.FromNodeId = ctx.self.GetNodeId().Id
+	}
+	if err := store.Save(checkpoint); err != nil {
+		ctx.config.Logger.Printf("save checkpoint error:%s", err)
+		return ""
+	}
+	return checkpoint.Id
+}
+
+// releaseCheckpoint removes the checkpoint of the current node. Only the first call takes effect.
+func (ctx *DefaultRuleContext) releaseCheckpoint() {
+	if ctx.checkpointId == "" || ctx.config.MessageStore == nil || ctx.ruleChainCtx == nil {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&ctx.checkpointDone, 0, 1) {
+		if err := ctx.config.MessageStore.Delete(ctx.ruleChainCtx.Id.Id, ctx.checkpointId); err != nil {
+			ctx.config.Logger.Printf("delete checkpoint error:%s", err)
+		}
+	}
+}
+
+// withRecoverCheckpoint marks the execution as recovered from the checkpoint.
+func withRecoverCheckpoint(checkpoint types.MessageCheckpoint) types.RuleContextOption {
+	return func(rc types.RuleContext) {
+		if ctx, ok := rc.(*DefaultRuleContext); ok {
+			ctx.recoverCheckpoint = &checkpoint
+		}
+	}
+}
+
+// releaseRecoverCheckpoint removes the checkpoint the execution is recovered from once the execution has started.
+// It is removed immediately if the new checkpoint has been saved, otherwise after all nodes have completed.
+func (ctx *DefaultRuleContext) releaseRecoverCheckpoint() {
+	checkpoint := ctx.recoverCheckpoint
+	if checkpoint == nil || ctx.config.MessageStore == nil {
+		return
+	}
+	release := func() {
+		if err := ctx.config.MessageStore.Delete(checkpoint.RuleChainId, checkpoint.Id); err != nil {
+			ctx.config.Logger.Printf("delete checkpoint error:%s", err)
+		}
+	}
+	if ctx.checkpointId != "" {
+		release()
+		return
+	}
+	onAllNodeCompleted := ctx.onAllNodeCompleted
+	ctx.onAllNodeCompleted = func() {
+		if onAllNodeCompleted != nil {
+			onAllNodeCompleted()
+		}
+		release()
+	}
+}
+
+// Recover resumes the unfinished executions of the rule chain from the checkpoints persisted in `Config.MessageStore`.
+// Each message is executed again starting from the node it was waiting for, so nodes may process a message more than once.
+// It is typically called once after the rule engine has been created on startup.
+// Checkpoints whose node no longer exists in the rule chain are kept and logged.
+// A checkpoint is removed only after the recovered execution has saved its own checkpoint or completed,
+// so it is kept if the execution is rejected by a start aspect, e.g. a rate limiter or an open circuit breaker.
+func (e *RuleEngine) Recover(opts ...types.RuleContextOption) error {
+	store := e.Config.MessageStore
+	if store == nil {
+		return nil
+	}
+	if !e.Initialized() {
+		return errors.New("recover error.RuleEngine not initialized")
+	}
+	checkpoints, err := store.List(e.rootRuleChainCtx.Id.Id)
+	if err != nil {
+		return err
+	}
+	for _, item := range checkpoints {
+		if _, ok := e.rootRuleChainCtx.GetNodeById(types.RuleNodeId{Id: item.NodeId}); !ok {
+			e.Config.Logger.Printf("recover checkpoint id=%s error:node id=%s not found", item.Id, item.NodeId)
+			continue
+		}
+		var recoverOpts = []types.RuleContextOption{types.WithStartNode(item.NodeId), withRecoverCheckpoint(item)}
+		recoverOpts = append(recoverOpts, opts...)
+		e.OnMsg(item.Msg, recoverOpts...)
+	}
+	return nil
+}
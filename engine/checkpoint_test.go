@@ -0,0 +1,205 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/builtin/store"
+	"github.com/rulego/rulego/components/action"
+	"github.com/rulego/rulego/test/assert"
+)
+
+var checkpointChainFile = `{
+  "ruleChain": {
+    "id": "test_checkpoint"
+  },
+  "metadata": {
+    "nodes": [
+      {
+        "id": "s1",
+        "type": "functions",
+        "configuration": {
+          "functionName": "checkpointPass"
+        }
+      },
+      {
+        "id": "s2",
+        "type": "functions",
+        "configuration": {
+          "functionName": "checkpointCrash"
+        }
+      }
+    ],
+    "connections": [
+      {
+        "fromId": "s1",
+        "toId": "s2",
+        "type": "Success"
+      }
+    ]
+  }
+}`
+
+// 测试进程崩溃后从检查点恢复执行
+func TestRecoverFromCheckpoint(t *testing.T) {
+	var crashed int32 = 1
+	var s1Count int32
+	action.Functions.Register("checkpointPass", func(ctx types.RuleContext, msg types.RuleMsg) {
+		atomic.AddInt32(&s1Count, 1)
+		msg.Metadata.PutValue("s1", "done")
+		ctx.TellSuccess(msg)
+	})
+	action.Functions.Register("checkpointCrash", func(ctx types.RuleContext, msg types.RuleMsg) {
+		//模拟进程崩溃，消息在内存中丢失
+		if atomic.LoadInt32(&crashed) == 1 {
+			return
+		}
+		ctx.TellSuccess(msg)
+	})
+	messageStore, err := store.NewFileMessageStore(t.TempDir())
+	assert.Nil(t, err)
+	config := NewConfig(types.WithMessageStore(messageStore))
+
+	pool1 := NewPool()
+	ruleEngine, err := pool1.New("", []byte(checkpointChainFile), WithConfig(config))
+	assert.Nil(t, err)
+
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), "{\"temperature\":41}")
+	ruleEngine.OnMsg(msg)
+	time.Sleep(time.Millisecond * 200)
+
+	checkpoints, err := messageStore.List("test_checkpoint")
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(checkpoints))
+	assert.Equal(t, "s2", checkpoints[0].NodeId)
+	assert.Equal(t, "s1", checkpoints[0].FromNodeId)
+	assert.Equal(t, types.Success, checkpoints[0].RelationType)
+	assert.Equal(t, msg.Id, checkpoints[0].Msg.Id)
+	assert.Equal(t, "done", checkpoints[0].Msg.Metadata.GetValue("s1"))
+	pool1.Stop()
+
+	//重启后恢复
+	atomic.StoreInt32(&crashed, 0)
+	pool2 := NewPool()
+	defer pool2.Stop()
+	ruleEngine, err = pool2.New("", []byte(checkpointChainFile), WithConfig(config))
+	assert.Nil(t, err)
+
+	var endCount int32
+	err = ruleEngine.Recover(types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+		atomic.AddInt32(&endCount, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, types.Success, relationType)
+		assert.Equal(t, "done", msg.Metadata.GetValue("s1"))
+	}))
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 200)
+
+	assert.Equal(t, int32(1), atomic.LoadInt32(&endCount))
+	//s1 不会重复执行
+	assert.Equal(t, int32(1), atomic.LoadInt32(&s1Count))
+	checkpoints, err = messageStore.List("test_checkpoint")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(checkpoints))
+
+	//正常执行完成，不遗留检查点
+	ruleEngine.OnMsgAndWait(msg)
+	checkpoints, _ = messageStore.List("test_checkpoint")
+	assert.Equal(t, 0, len(checkpoints))
+}
+
+// rejectStartAspect 拒绝执行的开始切面，模拟限流或者熔断
+type rejectStartAspect struct {
+	reject *int32
+}
+
+func (a *rejectStartAspect) Order() int {
+	return 1
+}
+
+func (a *rejectStartAspect) New() types.Aspect {
+	return &rejectStartAspect{reject: a.reject}
+}
+
+func (a *rejectStartAspect) PointCut(ctx types.RuleContext, msg types.RuleMsg, relationType string) bool {
+	return true
+}
+
+func (a *rejectStartAspect) Start(ctx types.RuleContext, msg types.RuleMsg) (types.RuleMsg, error) {
+	if atomic.LoadInt32(a.reject) == 1 {
+		return msg, errors.New("rejected")
+	}
+	return msg, nil
+}
+
+// 测试恢复执行被拒绝时保留检查点
+func TestRecoverRejected(t *testing.T) {
+	var crashed int32 = 1
+	action.Functions.Register("checkpointPass", func(ctx types.RuleContext, msg types.RuleMsg) {
+		ctx.TellSuccess(msg)
+	})
+	action.Functions.Register("checkpointCrash", func(ctx types.RuleContext, msg types.RuleMsg) {
+		if atomic.LoadInt32(&crashed) == 1 {
+			return
+		}
+		ctx.TellSuccess(msg)
+	})
+	messageStore, err := store.NewFileMessageStore(t.TempDir())
+	assert.Nil(t, err)
+	config := NewConfig(types.WithMessageStore(messageStore))
+	var reject int32
+	pool := NewPool()
+	defer pool.Stop()
+	ruleEngine, err := pool.New("", []byte(checkpointChainFile), WithConfig(config), types.WithAspects(&rejectStartAspect{reject: &reject}))
+	assert.Nil(t, err)
+	ruleEngine.OnMsg(types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), "{}"))
+	time.Sleep(time.Millisecond * 200)
+	checkpoints, _ := messageStore.List("test_checkpoint")
+	assert.Equal(t, 1, len(checkpoints))
+
+	atomic.StoreInt32(&crashed, 0)
+	atomic.StoreInt32(&reject, 1)
+	var rejected int32
+	err = ruleEngine.Recover(types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+		if err != nil {
+			atomic.AddInt32(&rejected, 1)
+		}
+	}))
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 200)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&rejected))
+	recovered, _ := messageStore.List("test_checkpoint")
+	assert.Equal(t, 1, len(recovered))
+	assert.Equal(t, checkpoints[0].Id, recovered[0].Id)
+
+	//再次恢复成功后删除
+	atomic.StoreInt32(&reject, 0)
+	var completed int32
+	err = ruleEngine.Recover(types.WithOnAllNodeCompleted(func() {
+		atomic.AddInt32(&completed, 1)
+	}))
+	assert.Nil(t, err)
+	time.Sleep(time.Millisecond * 200)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&completed))
+	recovered, _ = messageStore.List("test_checkpoint")
+	assert.Equal(t, 0, len(recovered))
+}
@@ -0,0 +1,297 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/builtin/aspect"
+	"github.com/rulego/rulego/components/action"
+	"github.com/rulego/rulego/test/assert"
+)
+
+var circuitBreakerChainFile = `{
+  "ruleChain": {
+    "id": "test_circuit_breaker_a"
+  },
+  "metadata": {
+    "nodes": [
+      {
+        "id": "s1",
+        "type": "functions",
+        "configuration": {
+          "functionName": "circuitCall",
+          "server": "ref://shared_db"
+        }
+      }
+    ]
+  }
+}`
+
+// 测试熔断器打开、半开探测、关闭，以及跨规则链共享状态
+func TestCircuitBreakerAspect(t *testing.T) {
+	var failed int32 = 1
+	var sleep int64
+	var calls int32
+	action.Functions.Register("circuitCall", func(ctx types.RuleContext, msg types.RuleMsg) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(time.Duration(atomic.LoadInt64(&sleep)))
+		if atomic.LoadInt32(&failed) == 1 {
+			ctx.TellFailure(msg, errors.New("db unavailable"))
+		} else {
+			ctx.TellSuccess(msg)
+		}
+	})
+	var lock sync.Mutex
+	var events []string
+	config := NewConfig(types.WithDefaultPool())
+	config.OnDebug = func(ruleChainId string, flowType string, nodeId string, msg types.RuleMsg, relationType string, err error) {
+		if flowType == types.CircuitBreaker {
+			lock.Lock()
+			defer lock.Unlock()
+			events = append(events, msg.Metadata.GetValue(aspect.KeyCircuitBreaker)+":"+msg.Metadata.GetValue(aspect.KeyCircuitFromState)+"->"+relationType)
+		}
+	}
+	getEvents := func() []string {
+		lock.Lock()
+		defer lock.Unlock()
+		result := events
+		events = nil
+		return result
+	}
+
+	breakers := aspect.NewCircuitBreakers()
+	cbAspect := aspect.NewCircuitBreakerAspect(aspect.CircuitBreakerConfig{
+		WindowSize:       4,
+		MinimumCalls:     4,
+		OpenDuration:     time.Millisecond * 100,
+		HalfOpenMaxCalls: 1,
+	}, breakers)
+	chainA, err := New("test_circuit_breaker_a", []byte(circuitBreakerChainFile), WithConfig(config), types.WithAspects(cbAspect))
+	assert.Nil(t, err)
+	defer Del("test_circuit_breaker_a")
+	chainB, err := New("test_circuit_breaker_b", []byte(strings.Replace(circuitBreakerChainFile, "test_circuit_breaker_a", "test_circuit_breaker_b", 1)),
+		WithConfig(config), types.WithAspects(cbAspect))
+	assert.Nil(t, err)
+	defer Del("test_circuit_breaker_b")
+	chainC, err := New("test_circuit_breaker_c", []byte(strings.Replace(circuitBreakerChainFile, "ref://shared_db", "127.0.0.1:3306", 1)),
+		WithConfig(config), types.WithAspects(cbAspect))
+	assert.Nil(t, err)
+	defer Del("test_circuit_breaker_c")
+
+	execute := func(ruleEngine types.RuleEngine) error {
+		var result error
+		msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), "{\"temperature\":41}")
+		ruleEngine.OnMsgAndWait(msg, types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+			result = err
+		}))
+		return result
+	}
+	const sharedKey = "functions/shared_db"
+
+	t.Run("Open", func(t *testing.T) {
+		//两个规则链引用同一个共享资源，共享熔断器
+		for i := 0; i < 2; i++ {
+			assert.Equal(t, "db unavailable", execute(chainA).Error())
+			assert.Equal(t, "db unavailable", execute(chainB).Error())
+		}
+		assert.Equal(t, []string{sharedKey + ":CLOSED->OPEN"}, getEvents())
+		breaker, ok := breakers.Get(sharedKey)
+		assert.True(t, ok)
+		assert.Equal(t, aspect.CircuitOpen, breaker.State())
+
+		//打开状态拒绝执行
+		assert.Equal(t, aspect.ErrCircuitOpen, execute(chainA))
+		assert.Equal(t, aspect.ErrCircuitOpen, execute(chainB))
+		assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+
+		//没有引用共享资源的节点使用独立的熔断器
+		assert.Equal(t, "db unavailable", execute(chainC).Error())
+		assert.Equal(t, int32(5), atomic.LoadInt32(&calls))
+		breaker, ok = breakers.Get("test_circuit_breaker_c/s1")
+		assert.True(t, ok)
+		assert.Equal(t, aspect.CircuitClosed, breaker.State())
+	})
+
+	t.Run("HalfOpen", func(t *testing.T) {
+		//半开探测失败，重新打开
+		time.Sleep(time.Millisecond * 120)
+		assert.Equal(t, "db unavailable", execute(chainA).Error())
+		assert.Equal(t, []string{sharedKey + ":OPEN->HALF_OPEN", sharedKey + ":HALF_OPEN->OPEN"}, getEvents())
+		assert.Equal(t, aspect.ErrCircuitOpen, execute(chainA))
+
+		//半开探测成功，关闭
+		atomic.StoreInt32(&failed, 0)
+		time.Sleep(time.Millisecond * 120)
+		assert.Nil(t, execute(chainB))
+		assert.Equal(t, []string{sharedKey + ":OPEN->HALF_OPEN", sharedKey + ":HALF_OPEN->CLOSED"}, getEvents())
+		assert.Nil(t, execute(chainA))
+	})
+
+	t.Run("Force", func(t *testing.T) {
+		breaker, _ := breakers.Get(sharedKey)
+		breaker.ForceOpen()
+		time.Sleep(time.Millisecond * 120)
+		//强制打开不会进入半开状态
+		assert.Equal(t, aspect.ErrCircuitOpen, execute(chainA))
+		status := breaker.Status()
+		assert.Equal(t, aspect.CircuitOpen, status.State)
+		assert.True(t, status.Forced)
+
+		breaker.ForceClosed()
+		atomic.StoreInt32(&failed, 1)
+		for i := 0; i < 5; i++ {
+			assert.Equal(t, "db unavailable", execute(chainA).Error())
+		}
+		assert.Equal(t, aspect.CircuitClosed, breaker.State())
+
+		breaker.Reset()
+		atomic.StoreInt32(&failed, 0)
+		assert.Nil(t, execute(chainA))
+		assert.False(t, breaker.Status().Forced)
+
+		list := breakers.List()
+		assert.Equal(t, 2, len(list))
+		assert.Equal(t, sharedKey, list[0].Key)
+		assert.Equal(t, 1, list[0].Calls)
+		assert.Equal(t, "test_circuit_breaker_c/s1", list[1].Key)
+		assert.Equal(t, float64(100), list[1].FailureRate)
+		getEvents()
+	})
+
+	t.Run("SlowCall", func(t *testing.T) {
+		slowBreakers := aspect.NewCircuitBreakers()
+		slowChain, err := New("test_circuit_breaker_slow", []byte(circuitBreakerChainFile), WithConfig(config),
+			types.WithAspects(aspect.NewCircuitBreakerAspect(aspect.CircuitBreakerConfig{
+				WindowSize:            2,
+				SlowCallDuration:      time.Millisecond * 10,
+				SlowCallRateThreshold: 100,
+			}, slowBreakers)))
+		assert.Nil(t, err)
+		defer Del("test_circuit_breaker_slow")
+
+		atomic.StoreInt64(&sleep, int64(time.Millisecond*20))
+		defer atomic.StoreInt64(&sleep, 0)
+		assert.Nil(t, execute(slowChain))
+		assert.Nil(t, execute(slowChain))
+		assert.Equal(t, aspect.ErrCircuitOpen, execute(slowChain))
+		breaker, _ := slowBreakers.Get(sharedKey)
+		assert.Equal(t, aspect.CircuitOpen, breaker.State())
+	})
+
+	t.Run("WithRetry", func(t *testing.T) {
+		//熔断器拒绝后，重试切面不再执行节点，只结束一次
+		retryDsl := strings.Replace(circuitBreakerChainFile, `"type": "functions",`,
+			`"type": "functions", "additionalInfo": {"retry": {"maxAttempts": 3, "initialInterval": 10}},`, 1)
+		retryBreakers := aspect.NewCircuitBreakers()
+		retryChain, err := New("test_circuit_breaker_retry", []byte(retryDsl), WithConfig(config),
+			types.WithAspects(aspect.NewCircuitBreakerAspect(aspect.CircuitBreakerConfig{}, retryBreakers)))
+		assert.Nil(t, err)
+		defer Del("test_circuit_breaker_retry")
+		assert.Nil(t, execute(retryChain))
+		breaker, _ := retryBreakers.Get(sharedKey)
+		breaker.ForceOpen()
+
+		before := atomic.LoadInt32(&calls)
+		var ends int32
+		msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), "{\"temperature\":41}")
+		retryChain.OnMsgAndWait(msg, types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+			atomic.AddInt32(&ends, 1)
+			assert.Equal(t, aspect.ErrCircuitOpen, err)
+		}))
+		time.Sleep(time.Millisecond * 50)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&ends))
+		assert.Equal(t, before, atomic.LoadInt32(&calls))
+	})
+	t.Run("StaleAndProbeTimeout", func(t *testing.T) {
+		release := make(chan struct{}, 2)
+		action.Functions.Register("circuitProbeCall", func(ctx types.RuleContext, msg types.RuleMsg) {
+			if msg.Metadata.GetValue("hang") == "true" {
+				<-release
+			}
+			if msg.Metadata.GetValue("fail") == "true" {
+				ctx.TellFailure(msg, errors.New("db unavailable"))
+			} else {
+				ctx.TellSuccess(msg)
+			}
+		})
+		probeBreakers := aspect.NewCircuitBreakers()
+		probeChain, err := New("test_circuit_breaker_probe", []byte(strings.Replace(circuitBreakerChainFile, "circuitCall", "circuitProbeCall", 1)),
+			WithConfig(config), types.WithAspects(aspect.NewCircuitBreakerAspect(aspect.CircuitBreakerConfig{
+				WindowSize:       2,
+				MinimumCalls:     2,
+				OpenDuration:     time.Millisecond * 50,
+				HalfOpenMaxCalls: 1,
+				ProbeTimeout:     time.Millisecond * 100,
+			}, probeBreakers)))
+		assert.Nil(t, err)
+		defer Del("test_circuit_breaker_probe")
+		newMsg := func(hang, fail bool) types.RuleMsg {
+			metadata := types.NewMetadata()
+			metadata.PutValue("hang", strconv.FormatBool(hang))
+			metadata.PutValue("fail", strconv.FormatBool(fail))
+			return types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, metadata, "{\"temperature\":41}")
+		}
+		executeMsg := func(msg types.RuleMsg) error {
+			var result error
+			probeChain.OnMsgAndWait(msg, types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+				result = err
+			}))
+			return result
+		}
+
+		//关闭状态放行，一直未输出
+		probeChain.OnMsg(newMsg(true, false))
+		time.Sleep(time.Millisecond * 20)
+		assert.NotNil(t, executeMsg(newMsg(false, true)))
+		assert.NotNil(t, executeMsg(newMsg(false, true)))
+		breaker, _ := probeBreakers.Get(sharedKey)
+		assert.Equal(t, aspect.CircuitOpen, breaker.State())
+
+		//半开探测一直未输出，占用名额
+		time.Sleep(time.Millisecond * 60)
+		probeChain.OnMsg(newMsg(true, false))
+		time.Sleep(time.Millisecond * 20)
+		assert.Equal(t, aspect.CircuitHalfOpen, breaker.State())
+		assert.Equal(t, aspect.ErrCircuitOpen, executeMsg(newMsg(false, false)))
+
+		//关闭状态放行的执行在半开状态完成，不作为探测结果
+		release <- struct{}{}
+		time.Sleep(time.Millisecond * 20)
+		assert.Equal(t, aspect.CircuitHalfOpen, breaker.State())
+
+		//探测超时释放名额
+		time.Sleep(time.Millisecond * 100)
+		assert.Nil(t, executeMsg(newMsg(false, false)))
+		assert.Equal(t, aspect.CircuitClosed, breaker.State())
+
+		//超时的探测完成后不再统计
+		release <- struct{}{}
+		time.Sleep(time.Millisecond * 20)
+		status := breaker.Status()
+		assert.Equal(t, aspect.CircuitClosed, status.State)
+		assert.Equal(t, 0, status.Calls)
+		getEvents()
+	})
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/gofrs/uuid/v5"
+	"github.com/rulego/rulego/api/types"
+)
+
+// ErrDeadLetterQueueNotConfigured is returned by the dead letter API when `Config.DeadLetterQueue` is not configured.
+var ErrDeadLetterQueueNotConfigured = errors.New("dead letter queue not configured")
+
+// putDeadLetter captures the message that the current node failed to process and that has no `Failure` connection.
+func (ctx *DefaultRuleContext) putDeadLetter(msg types.RuleMsg, err error) {
+	queue := ctx.config.DeadLetterQueue
+	if queue == nil || ctx.ruleChainCtx == nil || ctx.self == nil {
+		return
+	}
+	uid, _ := uuid.NewV4()
+	now := time.Now().UnixMilli()
+	letter := types.DeadLetter{
+		Id:          uid.String(),
+		RuleChainId: ctx.ruleChainCtx.Id.Id,
+		NodeId:      ctx.self.GetNodeId().Id,
+		Msg:         msg.Copy(),
+		Ts:          now,
+	}
+	if err != nil {
+		letter.Err = err.Error()
+	}
+	if ctx.runSnapshot != nil {
+		letter.Snapshot = ctx.runSnapshot.snapshot(now)
+	}
+	if err := queue.Put(letter); err != nil {
+		ctx.config.Logger.Printf("put dead letter error:%s", err)
+		if ctx.replay != nil {
+			atomic.StoreInt32(&ctx.replay.putFailed, 1)
+		}
+	}
+}
+
+// deadLetterReplay is the dead letter an execution replays.
+type deadLetterReplay struct {
+	letter types.DeadLetter
+	// Indicates if the execution failed again and the new dead letter could not be captured.
+	putFailed int32
+}
+
+// withReplayDeadLetter marks the execution as a replay of the dead letter.
+func withReplayDeadLetter(letter types.DeadLetter) types.RuleContextOption {
+	return func(rc types.RuleContext) {
+		if ctx, ok := rc.(*DefaultRuleContext); ok {
+			ctx.replay = &deadLetterReplay{letter: letter}
+		}
+	}
+}
+
+// releaseReplayedDeadLetter removes the replayed dead letter after all nodes have completed,
+// unless a failure of the execution could not be captured as a new dead letter.
+func (ctx *DefaultRuleContext) releaseReplayedDeadLetter() {
+	replay := ctx.replay
+	if replay == nil || ctx.config.DeadLetterQueue == nil {
+		return
+	}
+	onAllNodeCompleted := ctx.onAllNodeCompleted
+	ctx.onAllNodeCompleted = func() {
+		if atomic.LoadInt32(&replay.putFailed) == 0 {
+			if err := ctx.config.DeadLetterQueue.Delete(replay.letter.RuleChainId, replay.letter.Id); err != nil {
+				ctx.config.Logger.Printf("delete dead letter error:%s", err)
+			}
+		}
+		if onAllNodeCompleted != nil {
+			onAllNodeCompleted()
+		}
+	}
+}
+
+// snapshot returns the run snapshot collected so far.
+func (r *RunSnapshot) snapshot(endTs int64) types.RuleChainRunSnapshot {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.createRuleChainRunLog(endTs)
+}
+
+// DeadLetters returns the dead letters of the rule chain captured in `Config.DeadLetterQueue`, ordered by creation time.
+func (e *RuleEngine) DeadLetters() ([]types.DeadLetter, error) {
+	if e.Config.DeadLetterQueue == nil {
+		return nil, ErrDeadLetterQueueNotConfigured
+	}
+	if !e.Initialized() {
+		return nil, errors.New("list dead letters error.RuleEngine not initialized")
+	}
+	return e.Config.DeadLetterQueue.List(e.rootRuleChainCtx.Id.Id)
+}
+
+// GetDeadLetter returns a dead letter of the rule chain by its ID.
+func (e *RuleEngine) GetDeadLetter(id string) (types.DeadLetter, error) {
+	if e.Config.DeadLetterQueue == nil {
+		return types.DeadLetter{}, ErrDeadLetterQueueNotConfigured
+	}
+	if !e.Initialized() {
+		return types.DeadLetter{}, errors.New("get dead letter error.RuleEngine not initialized")
+	}
+	return e.Config.DeadLetterQueue.Get(e.rootRuleChainCtx.Id.Id, id)
+}
+
+// ReplayDeadLetter executes the message of a dead letter again, starting from the node that failed to process it.
+// The dead letter is removed from the queue after the execution has completed. If the execution fails again,
+// a new dead letter is captured, and the replayed one is kept if the new one can not be captured.
+// It is also kept if the execution is rejected by a start aspect or interrupted, e.g. by a crash.
+func (e *RuleEngine) ReplayDeadLetter(id string, opts ...types.RuleContextOption) error {
+	queue := e.Config.DeadLetterQueue
+	if queue == nil {
+		return ErrDeadLetterQueueNotConfigured
+	}
+	if !e.Initialized() {
+		return errors.New("replay dead letter error.RuleEngine not initialized")
+	}
+	letter, err := queue.Get(e.rootRuleChainCtx.Id.Id, id)
+	if err != nil {
+		return err
+	}
+	if _, ok := e.rootRuleChainCtx.GetNodeById(types.RuleNodeId{Id: letter.NodeId}); !ok {
+		return errors.New("replay dead letter error.node id=" + letter.NodeId + " not found")
+	}
+	var replayOpts = []types.RuleContextOption{types.WithStartNode(letter.NodeId), withReplayDeadLetter(letter)}
+	replayOpts = append(replayOpts, opts...)
+	e.OnMsg(letter.Msg, replayOpts...)
+	return nil
+}
@@ -0,0 +1,189 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"errors"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/builtin/store"
+	"github.com/rulego/rulego/components/action"
+	"github.com/rulego/rulego/test/assert"
+)
+
+var deadLetterChainFile = `{
+  "ruleChain": {
+    "id": "test_dead_letter"
+  },
+  "metadata": {
+    "nodes": [
+      {
+        "id": "s1",
+        "type": "functions",
+        "configuration": {
+          "functionName": "deadLetterPass"
+        }
+      },
+      {
+        "id": "s2",
+        "type": "functions",
+        "configuration": {
+          "functionName": "deadLetterFail"
+        }
+      }
+    ],
+    "connections": [
+      {
+        "fromId": "s1",
+        "toId": "s2",
+        "type": "Success"
+      }
+    ]
+  }
+}`
+
+// 测试没有Failure连接的失败消息进入死信队列，并从失败节点重放
+func TestDeadLetter(t *testing.T) {
+	var failed int32 = 1
+	var s1Count int32
+	action.Functions.Register("deadLetterPass", func(ctx types.RuleContext, msg types.RuleMsg) {
+		atomic.AddInt32(&s1Count, 1)
+		msg.Metadata.PutValue("s1", "done")
+		ctx.TellSuccess(msg)
+	})
+	action.Functions.Register("deadLetterFail", func(ctx types.RuleContext, msg types.RuleMsg) {
+		if atomic.LoadInt32(&failed) == 1 {
+			ctx.TellFailure(msg, errors.New("downstream unavailable"))
+			return
+		}
+		ctx.TellSuccess(msg)
+	})
+
+	ruleEngine, err := New("", []byte(deadLetterChainFile), WithConfig(NewConfig()))
+	assert.Nil(t, err)
+	_, err = ruleEngine.DeadLetters()
+	assert.Equal(t, ErrDeadLetterQueueNotConfigured, err)
+	assert.Equal(t, ErrDeadLetterQueueNotConfigured, ruleEngine.ReplayDeadLetter("notFound"))
+	Del(ruleEngine.Id())
+
+	fileQueue, err := store.NewFileDeadLetterQueue(t.TempDir())
+	assert.Nil(t, err)
+	queue := &failPutDeadLetterQueue{DeadLetterQueue: fileQueue}
+	var reject int32
+	ruleEngine, err = New("", []byte(deadLetterChainFile), WithConfig(NewConfig(types.WithDeadLetterQueue(queue))),
+		types.WithAspects(&rejectStartAspect{reject: &reject}))
+	assert.Nil(t, err)
+	defer Del(ruleEngine.Id())
+
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), "{\"temperature\":41}")
+	ruleEngine.OnMsgAndWait(msg)
+
+	letters, err := ruleEngine.DeadLetters()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(letters))
+	letter, err := ruleEngine.GetDeadLetter(letters[0].Id)
+	assert.Nil(t, err)
+	assert.Equal(t, "test_dead_letter", letter.RuleChainId)
+	assert.Equal(t, "s2", letter.NodeId)
+	assert.Equal(t, "downstream unavailable", letter.Err)
+	assert.Equal(t, msg.Id, letter.Msg.Id)
+	assert.Equal(t, "done", letter.Msg.Metadata.GetValue("s1"))
+	//执行快照
+	assert.Equal(t, msg.Id, letter.Snapshot.Id)
+	assert.Equal(t, 2, len(letter.Snapshot.Logs))
+	for _, item := range letter.Snapshot.Logs {
+		if item.Id == "s2" {
+			assert.Equal(t, "downstream unavailable", item.Err)
+			assert.Equal(t, types.Failure, item.RelationType)
+		} else {
+			assert.Equal(t, types.Success, item.RelationType)
+		}
+	}
+
+	_, err = ruleEngine.GetDeadLetter("notFound")
+	assert.True(t, errors.Is(err, store.ErrDeadLetterNotFound))
+
+	replay := func(id string) {
+		done := make(chan struct{})
+		assert.Nil(t, ruleEngine.ReplayDeadLetter(id, types.WithOnAllNodeCompleted(func() {
+			close(done)
+		})))
+		<-done
+	}
+	//重放被拒绝，保留死信
+	atomic.StoreInt32(&reject, 1)
+	replay(letter.Id)
+	_, err = ruleEngine.GetDeadLetter(letter.Id)
+	assert.Nil(t, err)
+	atomic.StoreInt32(&reject, 0)
+
+	//重放再次失败，新的死信保存失败，保留原死信
+	atomic.StoreInt32(&queue.failPut, 1)
+	replay(letter.Id)
+	atomic.StoreInt32(&queue.failPut, 0)
+	letters, err = ruleEngine.DeadLetters()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(letters))
+	assert.Equal(t, letter.Id, letters[0].Id)
+
+	//重放再次失败，新的死信替换原死信
+	replay(letter.Id)
+	letters, err = ruleEngine.DeadLetters()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(letters))
+	assert.True(t, letters[0].Id != letter.Id)
+	assert.Equal(t, "s2", letters[0].NodeId)
+	letter = letters[0]
+
+	//修复后重放
+	atomic.StoreInt32(&failed, 0)
+	done := make(chan struct{})
+	var endCount int32
+	err = ruleEngine.ReplayDeadLetter(letter.Id, types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+		atomic.AddInt32(&endCount, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, types.Success, relationType)
+		assert.Equal(t, "done", msg.Metadata.GetValue("s1"))
+	}), types.WithOnAllNodeCompleted(func() {
+		close(done)
+	}))
+	assert.Nil(t, err)
+	<-done
+	assert.Equal(t, int32(1), atomic.LoadInt32(&endCount))
+	//s1 不会重复执行
+	assert.Equal(t, int32(1), atomic.LoadInt32(&s1Count))
+	letters, err = ruleEngine.DeadLetters()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(letters))
+
+	assert.True(t, errors.Is(ruleEngine.ReplayDeadLetter(letter.Id), store.ErrDeadLetterNotFound))
+}
+
+// failPutDeadLetterQueue 可以模拟保存死信失败的死信队列
+type failPutDeadLetterQueue struct {
+	types.DeadLetterQueue
+	failPut int32
+}
+
+func (q *failPutDeadLetterQueue) Put(letter types.DeadLetter) error {
+	if atomic.LoadInt32(&q.failPut) == 1 {
+		return errors.New("put failed")
+	}
+	return q.DeadLetterQueue.Put(letter)
+}
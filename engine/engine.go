@@ -53,7 +53,7 @@ var _ types.RuleEngine = (*RuleEngine)(nil)
 var ErrDisabled = errors.New("the rule chain has been disabled")
 
 // BuiltinsAspects holds a list of built-in aspects for the rule engine.
-var BuiltinsAspects = []types.Aspect{&aspect.Debug{}, &aspect.MetricsAspect{}}
+var BuiltinsAspects = []types.Aspect{&aspect.Debug{}, &aspect.MetricsAspect{}, &aspect.RetryAspect{}, &aspect.RateLimiterAspect{}}
 
 // ContextObserver tracks the execution state of nodes in the rule chain.
 type ContextObserver struct {
@@ -201,6 +201,14 @@ type DefaultRuleContext struct {
 	out types.RuleMsg
 	// IN or OUT err
 	err error
+	// ID of the checkpoint persisted for the message being processed by the current node.
+	checkpointId string
+	// Indicates if the checkpoint of the current node has been released.
+	checkpointDone int32
+	// Checkpoint the execution is recovered from.
+	recoverCheckpoint *types.MessageCheckpoint
+	// Dead letter the execution replays.
+	replay *deadLetterReplay
 }
 
 // NewRuleContext creates a new instance of the default rule engine message processing context.
@@ -271,7 +279,8 @@ func NewRunSnapshot(msgId string, chainCtx *RuleChainCtx, startTs int64) *RunSna
 
 // needCollectRunSnapshot determines if there is a need to collect a snapshot of the rule chain execution.
 func (r *RunSnapshot) needCollectRunSnapshot() bool {
-	return r.onRuleChainCompletedFunc != nil || r.onNodeCompletedFunc != nil
+	// Dead letters carry the snapshot collected up to the failure.
+	return r.onRuleChainCompletedFunc != nil || r.onNodeCompletedFunc != nil || (r.chainCtx != nil && r.chainCtx.config.DeadLetterQueue != nil)
 }
 
 // collectRunSnapshot collects a snapshot of the rule node's execution state.
@@ -311,6 +320,16 @@ func (r *RunSnapshot) collectRunSnapshot(ctx types.RuleContext, flowType string,
 	if flowType == types.Log {
 		nodeLog.LogItems = append(nodeLog.LogItems, msg.Data)
 	}
+	// If the flow type is 'Retry', count the attempt and record the error of the failed attempt.
+	if flowType == types.Retry {
+		if nodeLog.Attempts == 0 {
+			nodeLog.Attempts = 1
+		}
+		nodeLog.Attempts++
+		if err != nil {
+			nodeLog.LogItems = append(nodeLog.LogItems, err.Error())
+		}
+	}
 }
 
 // onDebugCustom invokes the custom debug function with the provided parameters.
@@ -363,6 +382,7 @@ func (ctx *DefaultRuleContext) NewNextNodeRuleContext(nextNode types.NodeCtx) *D
 		runSnapshot:   ctx.runSnapshot,
 		observer:      ctx.observer,
 		err:           ctx.err,
+		replay:        ctx.replay,
 	}
 }
 
@@ -558,6 +578,11 @@ func (ctx *DefaultRuleContext) SetOnAllNodeCompleted(onAllNodeCompleted func())
 	ctx.onAllNodeCompleted = onAllNodeCompleted
 }
 
+// GetOnAllNodeCompleted 获取所有节点执行完回调
+func (ctx *DefaultRuleContext) GetOnAllNodeCompleted() func() {
+	return ctx.onAllNodeCompleted
+}
+
 // DoOnEnd  结束规则链分支执行，触发 OnEnd 回调函数
 func (ctx *DefaultRuleContext) DoOnEnd(msg types.RuleMsg, err error, relationType string) {
 	//全局回调
@@ -702,8 +727,9 @@ func (ctx *DefaultRuleContext) tellSelf(msg types.RuleMsg, err error, relationTy
 	msgCopy := msg.Copy()
 	ctx.SubmitTack(func() {
 		if ctx.self != nil {
-			ctx.tellNext(msgCopy, ctx.self, "")
+			ctx.tellNext(msgCopy, ctx.self, "", ctx.checkpointId)
 		} else {
+			ctx.releaseCheckpoint()
 			ctx.DoOnEnd(msgCopy, err, "")
 		}
 	})
@@ -744,17 +770,25 @@ func (ctx *DefaultRuleContext) tellOrElse(msg types.RuleMsg, err error, defaultR
 						//增加一个待执行的子节点
 						ctx.childReady()
 						msgCopy := msg.Copy()
+						//持久化待执行的子节点消息
+						checkpointId := ctx.saveCheckpoint(msgCopy, tmp, relationType)
 						//通知执行子节点
 						ctx.SubmitTack(func() {
-							ctx.tellNext(msgCopy, tmp, relationType)
+							ctx.tellNext(msgCopy, tmp, relationType, checkpointId)
 						})
 					}
 				} else {
+					//失败并且没有Failure连接，记录到死信队列
+					if relationType == types.Failure && err != nil && !ctx.skipTellNext {
+						ctx.putDeadLetter(msg, err)
+					}
 					//找不到子节点，则执行结束回调
 					ctx.DoOnEnd(msg, err, relationType)
 				}
 			}
 		}
+		//子节点消息已经持久化，释放当前节点的检查点
+		ctx.releaseCheckpoint()
 	}
 }
 
@@ -795,19 +829,21 @@ func (ctx *DefaultRuleContext) executeAfterAop(msg types.RuleMsg, err error, rel
 }
 
 // 执行下一个节点
-func (ctx *DefaultRuleContext) tellNext(msg types.RuleMsg, nextNode types.NodeCtx, relationType string) {
+func (ctx *DefaultRuleContext) tellNext(msg types.RuleMsg, nextNode types.NodeCtx, relationType string, checkpointId string) {
+
+	nextCtx := ctx.NewNextNodeRuleContext(nextNode)
+	nextCtx.checkpointId = checkpointId
 
 	defer func() {
 		//捕捉异常
 		if e := recover(); e != nil {
 			//执行After aop
 			msg = ctx.executeAfterAop(msg, fmt.Errorf("%v", e), relationType)
+			nextCtx.releaseCheckpoint()
 			ctx.childDone()
 		}
 	}()
 
-	nextCtx := ctx.NewNextNodeRuleContext(nextNode)
-
 	//环绕aop
 	if !nextCtx.executeAroundAop(msg, relationType) {
 		return
@@ -963,6 +999,9 @@ func (e *RuleEngine) ReloadSelf(dsl []byte, opts ...types.RuleEngineOption) erro
 		err = e.rootRuleChainCtx.ReloadSelf(dsl)
 		//设置子规则链池
 		e.rootRuleChainCtx.SetRuleEnginePool(e.ruleChainPool)
+		if err == nil {
+			e.recordVersion()
+		}
 	} else {
 		//初始化内置切面
 		e.initBuiltinsAspects()
@@ -995,7 +1034,18 @@ func (e *RuleEngine) ReloadChild(ruleNodeId string, dsl []byte) error {
 		return e.ReloadSelf(dsl)
 	} else {
 		//更新根规则链子节点
-		return e.rootRuleChainCtx.ReloadChild(types.RuleNodeId{Id: ruleNodeId}, dsl)
+		err := e.rootRuleChainCtx.ReloadChild(types.RuleNodeId{Id: ruleNodeId}, dsl)
+		if err == nil {
+			e.recordVersion()
+		}
+		return err
+	}
+}
+
+// recordVersion 规则链更新后，在规则引擎池记录新的版本
+func (e *RuleEngine) recordVersion() {
+	if pool, ok := e.ruleChainPool.(*Pool); ok {
+		pool.recordVersion(e)
 	}
 }
 
@@ -1115,13 +1165,19 @@ func (e *RuleEngine) doOnAllNodeCompleted(rootCtxCopy *DefaultRuleContext, msg t
 // onErrHandler handles the scenario where the rule chain has no nodes or fails to process the message.
 // It logs an error and triggers the end-of-chain callbacks.
 func (e *RuleEngine) onErrHandler(msg types.RuleMsg, rootCtxCopy *DefaultRuleContext, err error) {
+	relationType := types.Failure
+	// The message is discarded silently, for example, by rate limiting.
+	if errors.Is(err, types.ErrMsgDropped) {
+		relationType = types.Dropped
+		err = nil
+	}
 	// Trigger the configured OnEnd callback with the error.
 	if rootCtxCopy.config.OnEnd != nil {
 		rootCtxCopy.config.OnEnd(msg, err)
 	}
-	// Trigger the onEnd callback with the error and Failure relation type.
+	// Trigger the onEnd callback with the error and Failure or Dropped relation type.
 	if rootCtxCopy.onEnd != nil {
-		rootCtxCopy.onEnd(rootCtxCopy, msg, err, types.Failure)
+		rootCtxCopy.onEnd(rootCtxCopy, msg, err, relationType)
 	}
 	// Execute the onAllNodeCompleted callback if it exists.
 	if rootCtxCopy.onAllNodeCompleted != nil {
@@ -1158,6 +1214,14 @@ func (e *RuleEngine) onMsgAndWait(msg types.RuleMsg, wait bool, opts ...types.Ru
 			e.onErrHandler(msg, rootCtxCopy, err)
 			return
 		}
+		// Persist the message of the first node so that the execution can be recovered after a restart.
+		if rootCtxCopy.isFirst {
+			rootCtxCopy.checkpointId = rootCtxCopy.saveCheckpoint(msg, rootCtxCopy.self, "")
+		}
+		// Remove the checkpoint the execution is recovered from.
+		rootCtxCopy.releaseRecoverCheckpoint()
+		// Remove the replayed dead letter once the execution has completed.
+		rootCtxCopy.releaseReplayedDeadLetter()
 		// Set up a custom end callback function.
 		customOnEndFunc := rootCtxCopy.onEnd
 		rootCtxCopy.onEnd = func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
@@ -1255,3 +1319,14 @@ func WithConfig(config types.Config) types.RuleEngineOption {
 		return nil
 	}
 }
+
+// WithParser is an option that sets the Parser of the RuleEngine's Config.
+// It must be placed after WithConfig, otherwise it will be overwritten.
+func WithParser(parser types.Parser) types.RuleEngineOption {
+	return func(re types.RuleEngine) error {
+		if e, ok := re.(*RuleEngine); ok {
+			e.Config.Parser = parser
+		}
+		return nil
+	}
+}
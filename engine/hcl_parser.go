@@ -0,0 +1,405 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/utils/json"
+	"github.com/zclconf/go-cty/cty"
+	ctyjson "github.com/zclconf/go-cty/cty/json"
+	"gopkg.in/yaml.v3"
+)
+
+// hclIdentifier 可以不加引号的对象 key
+var hclIdentifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*$`)
+
+// hclKeywords 作为对象 key 需要加引号的关键字
+var hclKeywords = map[string]bool{"for": true, "in": true, "if": true, "null": true, "true": true, "false": true}
+
+// HclParser Hcl
+// 使用属性和对象、数组表达式描述 DSL，字段名称和 Json DSL 一致，例如：
+//
+//	ruleChain = {
+//	  id   = "rule01"
+//	  name = "测试规则链"
+//	}
+//	metadata = {
+//	  nodes = [
+//	    # 过滤温度
+//	    {
+//	      id   = "s1"
+//	      type = "jsFilter"
+//	      configuration = {
+//	        jsScript = <<-EOT
+//	          return msg.temperature > 50;
+//	        EOT
+//	      }
+//	    },
+//	  ]
+//	}
+//
+// 多行字符串使用 heredoc，不需要转义，`${` 和 `%{` 需要写成 `$${` 和 `%%{`。
+// 规则链、节点、endpoint、router 上方的注释保存在 additionalInfo.comment 中，编码时还原成注释
+type HclParser struct {
+}
+
+// DecodeRuleChain 通过hcl解析规则链结构体
+func (p *HclParser) DecodeRuleChain(rootRuleChain []byte) (types.RuleChain, error) {
+	var def types.RuleChain
+	err := p.decode(rootRuleChain, chainCommentPaths, &def)
+	return def, err
+}
+
+// DecodeRuleNode 通过hcl解析节点结构体
+func (p *HclParser) DecodeRuleNode(rootRuleChain []byte) (types.RuleNode, error) {
+	var def types.RuleNode
+	err := p.decode(rootRuleChain, nodeCommentPaths, &def)
+	return def, err
+}
+
+func (p *HclParser) EncodeRuleChain(def interface{}) ([]byte, error) {
+	return p.encode(def, chainCommentPaths)
+}
+
+func (p *HclParser) EncodeRuleNode(def interface{}) ([]byte, error) {
+	return p.encode(def, nodeCommentPaths)
+}
+
+func (p *HclParser) decode(data []byte, commentPaths [][]string, def interface{}) error {
+	file, diags := hclsyntax.ParseConfig(data, "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return diags
+	}
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return errors.New("invalid hcl body")
+	}
+	if len(body.Blocks) > 0 {
+		return errors.New("hcl blocks are not supported, use attributes: " + body.Blocks[0].Type)
+	}
+	d := newHclDecoder(data, commentPaths)
+	//按照源码顺序，第一个属性上方的注释作为根对象的注释
+	var attrs []*hclsyntax.Attribute
+	for _, attr := range body.Attributes {
+		attrs = append(attrs, attr)
+	}
+	sort.Slice(attrs, func(i, j int) bool {
+		return attrs[i].SrcRange.Start.Byte < attrs[j].SrcRange.Start.Byte
+	})
+	root := make(map[string]interface{}, len(attrs))
+	for _, attr := range attrs {
+		v, err := d.value(attr.Expr, []string{attr.Name}, d.commentBefore(attr.SrcRange.Start.Byte))
+		if err != nil {
+			return err
+		}
+		root[attr.Name] = v
+	}
+	if len(attrs) > 0 && matchCommentPath(commentPaths, nil) {
+		setComment(root, d.commentBefore(attrs[0].SrcRange.Start.Byte))
+	}
+	return decodeByJson(root, def)
+}
+
+func (p *HclParser) encode(def interface{}, commentPaths [][]string) ([]byte, error) {
+	node, err := orderedNode(def)
+	if err != nil {
+		return nil, err
+	}
+	if node.Kind != yaml.MappingNode {
+		return nil, errors.New("hcl root must be an object")
+	}
+	e := &hclEncoder{commentPaths: commentPaths}
+	if matchCommentPath(commentPaths, nil) {
+		e.writeComment(popYamlComment(node), 0)
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		path := []string{key.Value}
+		if value.Kind == yaml.MappingNode && matchCommentPath(commentPaths, path) {
+			e.writeComment(popYamlComment(value), 0)
+		}
+		e.buf.WriteString(key.Value)
+		e.buf.WriteString(" = ")
+		e.writeValue(value, path, 0)
+		e.buf.WriteString("\n")
+	}
+	return hclwrite.Format(e.buf.Bytes()), nil
+}
+
+// hclDecoder 把 hcl 表达式转换成通用结构，并把注释保存到 additionalInfo.comment
+type hclDecoder struct {
+	src          []byte
+	commentPaths [][]string
+	//注释，key:注释结束位置
+	comments map[int]hclsyntax.Token
+}
+
+func newHclDecoder(src []byte, commentPaths [][]string) *hclDecoder {
+	d := &hclDecoder{src: src, commentPaths: commentPaths, comments: make(map[int]hclsyntax.Token)}
+	tokens, _ := hclsyntax.LexConfig(src, "", hcl.InitialPos)
+	for _, token := range tokens {
+		if token.Type == hclsyntax.TokenComment {
+			d.comments[token.Range.End.Byte] = token
+		}
+	}
+	return d
+}
+
+func (d *hclDecoder) value(expr hclsyntax.Expression, path []string, comment string) (interface{}, error) {
+	switch e := expr.(type) {
+	case *hclsyntax.ObjectConsExpr:
+		m := make(map[string]interface{}, len(e.Items))
+		for _, item := range e.Items {
+			keyValue, diags := item.KeyExpr.Value(nil)
+			if diags.HasErrors() {
+				return nil, diags
+			}
+			if keyValue.IsNull() || !keyValue.Type().Equals(cty.String) {
+				return nil, errors.New("hcl object key must be a string")
+			}
+			key := keyValue.AsString()
+			v, err := d.value(item.ValueExpr, appendPath(path, key), d.commentBefore(item.KeyExpr.Range().Start.Byte))
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+		}
+		if matchCommentPath(d.commentPaths, path) {
+			if c := d.commentBefore(e.SrcRange.Start.Byte); c != "" {
+				comment = c
+			}
+			setComment(m, comment)
+		}
+		return m, nil
+	case *hclsyntax.TupleConsExpr:
+		list := make([]interface{}, 0, len(e.Exprs))
+		for i, item := range e.Exprs {
+			v, err := d.value(item, appendPath(path, strconv.Itoa(i)), "")
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	default:
+		value, diags := expr.Value(nil)
+		if diags.HasErrors() {
+			return nil, diags
+		}
+		b, err := ctyjson.SimpleJSONValue{Value: value}.MarshalJSON()
+		if err != nil {
+			return nil, err
+		}
+		var v interface{}
+		err = json.Unmarshal(b, &v)
+		return v, err
+	}
+}
+
+// commentBefore 获取紧挨着 pos 上方的连续注释
+func (d *hclDecoder) commentBefore(pos int) string {
+	var lines []string
+	for {
+		for pos > 0 && (d.src[pos-1] == ' ' || d.src[pos-1] == '\t') {
+			pos--
+		}
+		token, ok := d.comments[pos]
+		if !ok {
+			break
+		}
+		lines = append([]string{trimHclComment(string(token.Bytes))}, lines...)
+		pos = token.Range.Start.Byte
+	}
+	return strings.Join(lines, "\n")
+}
+
+func trimHclComment(comment string) string {
+	comment = strings.TrimRight(comment, "\r\n")
+	if strings.HasPrefix(comment, "/*") {
+		comment = strings.TrimSuffix(strings.TrimPrefix(comment, "/*"), "*/")
+		return strings.TrimSpace(comment)
+	}
+	if strings.HasPrefix(comment, "//") {
+		comment = strings.TrimPrefix(comment, "//")
+	} else {
+		comment = strings.TrimPrefix(comment, "#")
+	}
+	return strings.TrimPrefix(comment, " ")
+}
+
+// hclEncoder 把保持字段顺序的节点树写成 hcl
+type hclEncoder struct {
+	buf          bytes.Buffer
+	commentPaths [][]string
+}
+
+func (e *hclEncoder) writeValue(n *yaml.Node, path []string, indent int) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		if len(n.Content) == 0 {
+			e.buf.WriteString("{}")
+			return
+		}
+		e.buf.WriteString("{\n")
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			childPath := appendPath(path, key.Value)
+			if value.Kind == yaml.MappingNode && matchCommentPath(e.commentPaths, childPath) {
+				e.writeComment(popYamlComment(value), indent+1)
+			}
+			e.writeIndent(indent + 1)
+			e.writeKey(key.Value)
+			e.buf.WriteString(" = ")
+			e.writeValue(value, childPath, indent+1)
+			e.buf.WriteString("\n")
+		}
+		e.writeIndent(indent)
+		e.buf.WriteString("}")
+	case yaml.SequenceNode:
+		if len(n.Content) == 0 {
+			e.buf.WriteString("[]")
+			return
+		}
+		e.buf.WriteString("[\n")
+		for i, item := range n.Content {
+			childPath := appendPath(path, strconv.Itoa(i))
+			if item.Kind == yaml.MappingNode && matchCommentPath(e.commentPaths, childPath) {
+				e.writeComment(popYamlComment(item), indent+1)
+			}
+			e.writeIndent(indent + 1)
+			e.writeValue(item, childPath, indent+1)
+			e.buf.WriteString(",\n")
+		}
+		e.writeIndent(indent)
+		e.buf.WriteString("]")
+	default:
+		if n.Tag == "!!str" {
+			e.writeString(n.Value, indent)
+		} else if n.Tag == "!!null" {
+			e.buf.WriteString("null")
+		} else {
+			e.buf.WriteString(n.Value)
+		}
+	}
+}
+
+func (e *hclEncoder) writeKey(key string) {
+	if hclIdentifier.MatchString(key) && !hclKeywords[key] {
+		e.buf.WriteString(key)
+	} else {
+		e.writeQuoted(key)
+	}
+}
+
+// writeString 多行字符串使用 heredoc，不以换行结尾的在最后一行加上 `${""~}` 去掉 heredoc 末尾的换行
+func (e *hclEncoder) writeString(value string, indent int) {
+	if !strings.Contains(value, "\n") {
+		e.writeQuoted(value)
+		return
+	}
+	value = escapeHclTemplate(value)
+	content := value
+	if strings.HasSuffix(content, "\n") {
+		content = strings.TrimSuffix(content, "\n")
+	} else {
+		content = content + `${""~}`
+	}
+	lines := strings.Split(content, "\n")
+	//<<- 会去掉所有行共同的缩进，只有原内容存在没有缩进的行才能增加缩进，否则原样输出
+	flush := false
+	for _, line := range lines {
+		if line != "" && line[0] != ' ' && line[0] != '\t' {
+			flush = true
+			break
+		}
+	}
+	if flush {
+		e.buf.WriteString("<<-EOT\n")
+	} else {
+		e.buf.WriteString("<<EOT\n")
+	}
+	for _, line := range lines {
+		if flush && line != "" {
+			e.writeIndent(indent + 1)
+		}
+		e.buf.WriteString(line)
+		e.buf.WriteString("\n")
+	}
+	if flush {
+		e.writeIndent(indent)
+	}
+	e.buf.WriteString("EOT")
+}
+
+func (e *hclEncoder) writeQuoted(value string) {
+	e.buf.WriteByte('"')
+	for _, r := range escapeHclTemplate(value) {
+		switch r {
+		case '"':
+			e.buf.WriteString(`\"`)
+		case '\\':
+			e.buf.WriteString(`\\`)
+		case '\n':
+			e.buf.WriteString(`\n`)
+		case '\r':
+			e.buf.WriteString(`\r`)
+		case '\t':
+			e.buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				e.buf.WriteString(`\u`)
+				e.buf.WriteString(strings.Repeat("0", 4-len(strconv.FormatInt(int64(r), 16))))
+				e.buf.WriteString(strconv.FormatInt(int64(r), 16))
+			} else {
+				e.buf.WriteRune(r)
+			}
+		}
+	}
+	e.buf.WriteByte('"')
+}
+
+func (e *hclEncoder) writeComment(comment string, indent int) {
+	if comment == "" {
+		return
+	}
+	for _, line := range strings.Split(comment, "\n") {
+		e.writeIndent(indent)
+		e.buf.WriteString("# ")
+		e.buf.WriteString(line)
+		e.buf.WriteString("\n")
+	}
+}
+
+func (e *hclEncoder) writeIndent(indent int) {
+	e.buf.WriteString(strings.Repeat("  ", indent))
+}
+
+// escapeHclTemplate 转义模板语法
+func escapeHclTemplate(value string) string {
+	value = strings.ReplaceAll(value, "${", "$${")
+	return strings.ReplaceAll(value, "%{", "%%{")
+}
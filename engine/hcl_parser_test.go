@@ -0,0 +1,68 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"github.com/rulego/rulego/test/assert"
+	"strings"
+	"testing"
+)
+
+func TestHclParser(t *testing.T) {
+	parser := &HclParser{}
+	out := testTextParser(t, parser, "../testdata/rule/hcl_chain.hcl", "hcl-TEST_MSG_TYPE")
+	assert.True(t, strings.Contains(string(out), "# hcl 格式的规则链\nruleChain = {\n"))
+	assert.True(t, strings.Contains(string(out), "    # 过滤温度大于10的消息\n    {\n      id "))
+	assert.True(t, strings.Contains(string(out), "jsScript = <<-EOT\n          var temperature = msg.temperature;\n"))
+	assert.True(t, strings.Contains(string(out), "`hcl-$${msgType}`"))
+
+	node, err := parser.DecodeRuleNode([]byte(`// 转换
+id = "s2"
+type = "jsTransform"
+configuration = {
+  jsScript = "return {'msg':msg};"
+  "Content-Type" = "text/plain"
+  "for" = 1
+}
+`))
+	assert.Nil(t, err)
+	assert.Equal(t, "转换", node.AdditionalInfo[CommentKey])
+	assert.Equal(t, "return {'msg':msg};", node.Configuration["jsScript"])
+	assert.Equal(t, float64(1), node.Configuration["for"])
+
+	//多行字符串不以换行结尾，缩进不一致
+	node.Configuration["jsScript"] = "  var a = 1;\n  return {'msg':msg};"
+	node.Configuration["text"] = "line1\n  line2 \"%{a}\"\\"
+	nodeHcl, err := parser.EncodeRuleNode(node)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(nodeHcl), "# 转换\nid "))
+	assert.True(t, strings.Contains(string(nodeHcl), `"for"`))
+	node2, err := parser.DecodeRuleNode(nodeHcl)
+	assert.Nil(t, err)
+	assert.Equal(t, node.Configuration["jsScript"], node2.Configuration["jsScript"])
+	assert.Equal(t, node.Configuration["text"], node2.Configuration["text"])
+	assert.Equal(t, "text/plain", node2.Configuration["Content-Type"])
+
+	_, err = parser.DecodeRuleChain([]byte("ruleChain = {"))
+	assert.NotNil(t, err)
+	_, err = parser.DecodeRuleChain([]byte("ruleChain {\n}\n"))
+	assert.NotNil(t, err)
+	_, err = parser.DecodeRuleNode([]byte("id = var.id"))
+	assert.NotNil(t, err)
+	_, err = parser.EncodeRuleNode([]string{"a"})
+	assert.NotNil(t, err)
+}
@@ -18,10 +18,16 @@ package engine
 
 import (
 	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/api/types/metrics"
+	"github.com/rulego/rulego/builtin/aspect"
 	"github.com/rulego/rulego/components/action"
 	"github.com/rulego/rulego/test/assert"
 )
@@ -82,3 +88,76 @@ func TestMetricsAspect(t *testing.T) {
 	assert.Equal(t, int64(4), metrics.Success)
 
 }
+
+func TestMetricsAspectRegistry(t *testing.T) {
+	ruleFile := loadFile("./test_metrics_chain.json")
+	action.Functions.Register("doErr", func(ctx types.RuleContext, msg types.RuleMsg) {
+		time.Sleep(time.Millisecond * 100)
+		ctx.TellFailure(msg, errors.New("error"))
+	})
+	action.Functions.Register("doSuccess", func(ctx types.RuleContext, msg types.RuleMsg) {
+		time.Sleep(time.Millisecond * 100)
+		ctx.TellNext(msg, types.Success)
+	})
+	registry := metrics.NewRegistry(0.05, 0.5)
+	config := NewConfig(types.WithDefaultPool())
+	ruleEngine, err := New("testMetricsAspectRegistry", ruleFile, WithConfig(config),
+		types.WithAspects(aspect.NewMetricsAspectWithRegistry(nil, registry)))
+	assert.Nil(t, err)
+	defer Del("testMetricsAspectRegistry")
+
+	msg := types.NewMsg(0, "TEST_MSG_TYPE1", types.JSON, types.NewMetadata(), "{\"temperature\":41}")
+	ruleEngine.OnMsgAndWait(msg)
+	ruleEngine.OnMsgAndWait(msg)
+
+	chainMetrics := registry.Chain("testMetricsAspectRegistry")
+	assert.Equal(t, int64(2), chainMetrics.Get().Total)
+	assert.Equal(t, int64(0), chainMetrics.Get().Current)
+	assert.Equal(t, int64(2), chainMetrics.Get().Failed)
+	assert.Equal(t, int64(4), chainMetrics.Get().Success)
+	assert.Equal(t, uint64(2), chainMetrics.Latency.Get().Count)
+	//耗时大于100ms
+	assert.Equal(t, uint64(0), chainMetrics.Latency.Get().Counts[0])
+
+	assert.Equal(t, 4, len(registry.Nodes()))
+	s1 := registry.Node("testMetricsAspectRegistry", "s1", "")
+	assert.Equal(t, "jsFilter", s1.NodeType)
+	assert.Equal(t, int64(2), s1.Total)
+	assert.Equal(t, int64(2), s1.Relations()[types.True])
+	assert.Equal(t, uint64(2), s1.Latency.Get().Counts[0])
+
+	s2 := registry.Node("testMetricsAspectRegistry", "s2", "")
+	assert.Equal(t, int64(2), s2.Total)
+	assert.Equal(t, int64(2), s2.Errors)
+	assert.Equal(t, int64(2), s2.Relations()[types.Failure])
+	snapshot := s2.Latency.Get()
+	assert.Equal(t, uint64(0), snapshot.Counts[0])
+	assert.Equal(t, uint64(2), snapshot.Counts[1])
+	assert.True(t, snapshot.Sum >= 0.2)
+
+	//Prometheus格式
+	server := httptest.NewServer(registry.Handler())
+	defer server.Close()
+	resp, err := http.Get(server.URL)
+	assert.Nil(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, metrics.PrometheusContentType, resp.Header.Get("Content-Type"))
+	body, _ := io.ReadAll(resp.Body)
+	text := string(body)
+	for _, line := range []string{
+		`rulego_chain_total{chain_id="testMetricsAspectRegistry"} 2`,
+		`rulego_chain_branch_total{chain_id="testMetricsAspectRegistry",result="failure"} 2`,
+		`rulego_node_relations_total{chain_id="testMetricsAspectRegistry",node_id="s2",node_type="functions",relation_type="Failure"} 2`,
+		`rulego_node_errors_total{chain_id="testMetricsAspectRegistry",node_id="s2",node_type="functions"} 2`,
+		`rulego_node_duration_seconds_bucket{chain_id="testMetricsAspectRegistry",node_id="s2",node_type="functions",le="0.05"} 0`,
+		`rulego_node_duration_seconds_bucket{chain_id="testMetricsAspectRegistry",node_id="s2",node_type="functions",le="0.5"} 2`,
+		`rulego_node_duration_seconds_bucket{chain_id="testMetricsAspectRegistry",node_id="s2",node_type="functions",le="+Inf"} 2`,
+		`rulego_node_duration_seconds_count{chain_id="testMetricsAspectRegistry",node_id="s2",node_type="functions"} 2`,
+		`rulego_pool_max_workers{pool="ruleEngine"} `,
+		"# TYPE rulego_node_duration_seconds histogram",
+	} {
+		if !strings.Contains(text, line) {
+			t.Errorf("metrics not contains: %s\n%s", line, text)
+		}
+	}
+}
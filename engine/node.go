@@ -155,6 +155,11 @@ func (rn *RuleNodeCtx) DSL() []byte {
 	return v
 }
 
+// NodeDefinition returns the definition of the node.
+func (rn *RuleNodeCtx) NodeDefinition() *types.RuleNode {
+	return rn.SelfDefinition
+}
+
 // Copy copies the contents of a new RuleNodeCtx into this one.
 func (rn *RuleNodeCtx) Copy(newCtx *RuleNodeCtx) {
 	rn.Node = newCtx.Node
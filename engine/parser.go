@@ -17,10 +17,26 @@
 package engine
 
 import (
+	"path/filepath"
+	"strings"
+
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/utils/json"
 )
 
+// GetParserByFileExt 根据文件扩展名获取规则链解析器：.yaml/.yml 使用 YamlParser，.hcl 使用 HclParser，
+// 其他扩展名返回nil，使用配置的解析器
+func GetParserByFileExt(path string) types.Parser {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return &YamlParser{}
+	case ".hcl":
+		return &HclParser{}
+	default:
+		return nil
+	}
+}
+
 // JsonParser Json
 type JsonParser struct {
 }
@@ -56,3 +72,67 @@ func (p *JsonParser) EncodeRuleNode(def interface{}) ([]byte, error) {
 		return json.Format(v)
 	}
 }
+
+// CommentKey 规则链、节点、endpoint 的注释保存在 additionalInfo 的该字段中，YAML/HCL 编码时还原成注释
+const CommentKey = "comment"
+
+// chainCommentPaths 规则链 DSL 中可以携带注释的对象路径，`*` 匹配数组的任意元素
+var chainCommentPaths = [][]string{
+	{"ruleChain"},
+	{"metadata", "nodes", "*"},
+	{"metadata", "endpoints", "*"},
+	{"metadata", "endpoints", "*", "routers", "*"},
+}
+
+// nodeCommentPaths 节点 DSL 中可以携带注释的对象路径
+var nodeCommentPaths = [][]string{{}}
+
+// matchCommentPath 路径是否可以携带注释
+func matchCommentPath(patterns [][]string, path []string) bool {
+	for _, pattern := range patterns {
+		if len(pattern) != len(path) {
+			continue
+		}
+		matched := true
+		for i, item := range pattern {
+			if item != "*" && item != path[i] {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeByJson 把 YAML/HCL 解析出的通用结构通过 json 转换成 DSL 结构体，复用 DSL 的 json 标签
+func decodeByJson(v interface{}, def interface{}) error {
+	if b, err := json.Marshal(v); err != nil {
+		return err
+	} else {
+		return json.Unmarshal(b, def)
+	}
+}
+
+// setComment 把注释保存到 additionalInfo.comment，已经存在则不覆盖
+func setComment(m map[string]interface{}, comment string) {
+	if comment == "" {
+		return
+	}
+	info, ok := m["additionalInfo"].(map[string]interface{})
+	if !ok {
+		info = make(map[string]interface{})
+		m["additionalInfo"] = info
+	}
+	if _, ok := info[CommentKey]; !ok {
+		info[CommentKey] = comment
+	}
+}
+
+func appendPath(path []string, item string) []string {
+	newPath := make([]string, len(path), len(path)+1)
+	copy(newPath, path)
+	return append(newPath, item)
+}
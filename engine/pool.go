@@ -20,6 +20,7 @@ import (
 	"github.com/rulego/rulego/api/types"
 	"github.com/rulego/rulego/utils/fs"
 	"log"
+	"path/filepath"
 	"strings"
 	"sync"
 )
@@ -32,6 +33,14 @@ var DefaultPool = &Pool{}
 type Pool struct {
 	// A concurrent map to store rule engine instances.
 	entries sync.Map
+	// versions stores the version history of each rule chain, see Versions.
+	versions sync.Map
+	// maxVersions is the number of versions kept for each rule chain, see SetMaxVersions.
+	maxVersions int
+	// splits stores the traffic splits of logical rule chains, see SetSplit.
+	splits sync.Map
+	// shadows stores the shadow executions of primary rule chains, see SetShadow.
+	shadows sync.Map
 }
 
 // NewPool creates a new instance of a rule engine pool.
@@ -39,29 +48,42 @@ func NewPool() *Pool {
 	return &Pool{}
 }
 
+// ruleChainFileExts 未指定文件匹配模式时加载的规则链文件扩展名
+var ruleChainFileExts = map[string]bool{".json": true, ".yaml": true, ".yml": true, ".hcl": true}
+
 // Load loads all rule chain configurations from a specified folder and its subfolders into the rule engine instance pool.
 // The rule chain ID is taken from the configuration file's ruleChain.id.
+// If folderPath has no file pattern, *.json, *.yaml, *.yml and *.hcl files are loaded,
+// and the parser is selected by the file extension, see GetParserByFileExt.
 func (g *Pool) Load(folderPath string, opts ...types.RuleEngineOption) error {
-	// Ensure the folder path ends with a pattern that matches JSON files.
-	if !strings.HasSuffix(folderPath, "*.json") && !strings.HasSuffix(folderPath, "*.JSON") {
+	pattern := folderPath
+	allExts := !strings.Contains(filepath.Base(folderPath), "*")
+	if allExts {
 		if strings.HasSuffix(folderPath, "/") || strings.HasSuffix(folderPath, "\\") {
-			folderPath = folderPath + "*.json"
+			pattern = folderPath + "*"
 		} else if folderPath == "" {
-			folderPath = "./*.json"
+			pattern = "./*"
 		} else {
-			folderPath = folderPath + "/*.json"
+			pattern = folderPath + "/*"
 		}
 	}
 	// Get all file paths that match the pattern.
-	paths, err := fs.GetFilePaths(folderPath)
+	paths, err := fs.GetFilePaths(pattern)
 	if err != nil {
 		return err
 	}
 	// Load each file and create a new rule engine instance from its contents.
 	for _, path := range paths {
+		if allExts && !ruleChainFileExts[strings.ToLower(filepath.Ext(path))] {
+			continue
+		}
 		b := fs.LoadFile(path)
 		if b != nil {
-			if _, err = g.New("", b, opts...); err != nil {
+			fileOpts := opts
+			if parser := GetParserByFileExt(path); parser != nil {
+				fileOpts = append(append([]types.RuleEngineOption{}, opts...), WithParser(parser))
+			}
+			if _, err = g.New("", b, fileOpts...); err != nil {
 				log.Println("Load rule chain error:", err)
 			}
 		}
@@ -84,6 +106,7 @@ func (g *Pool) New(id string, rootRuleChainSrc []byte, opts ...types.RuleEngineO
 			// Store the new rule engine instance in the pool.
 			if ruleEngine.Id() != "" {
 				g.entries.Store(ruleEngine.Id(), ruleEngine)
+				g.recordVersion(ruleEngine)
 			}
 			return ruleEngine, err
 		}
@@ -91,22 +114,48 @@ func (g *Pool) New(id string, rootRuleChainSrc []byte, opts ...types.RuleEngineO
 	}
 }
 
-// Get retrieves a rule engine instance by its ID.
+// Get retrieves a rule engine instance by its ID for message dispatch.
+// If the ID is a logical rule chain with a traffic split, the SplitEngine is returned.
+// If the rule chain has a shadow execution, the ShadowEngine is returned.
+// Use GetEngine for management operations such as reload and rollback.
 func (g *Pool) Get(id string) (types.RuleEngine, bool) {
+	if split, ok := g.GetSplit(id); ok {
+		return split, true
+	}
+	return g.getEngine(id)
+}
+
+// GetEngine retrieves the rule engine instance of the rule chain by its ID,
+// ignoring traffic splits and shadow executions.
+func (g *Pool) GetEngine(id string) (*RuleEngine, bool) {
 	v, ok := g.entries.Load(id)
-	if ok {
-		return v.(*RuleEngine), ok
-	} else {
+	if !ok {
 		return nil, false
 	}
+	return v.(*RuleEngine), true
+}
+
+// getEngine retrieves a rule engine instance by its ID, ignoring traffic splits.
+func (g *Pool) getEngine(id string) (types.RuleEngine, bool) {
+	if shadow, ok := g.GetShadow(id); ok {
+		return shadow, true
+	}
+	if ruleEngine, ok := g.GetEngine(id); ok {
+		return ruleEngine, true
+	}
+	return nil, false
 }
 
 // Del deletes a rule engine instance by its ID.
+// The traffic split and the shadow execution with the same ID are also deleted.
 func (g *Pool) Del(id string) {
+	g.splits.Delete(id)
+	g.shadows.Delete(id)
 	v, ok := g.entries.Load(id)
 	if ok {
 		v.(*RuleEngine).Stop()
 		g.entries.Delete(id)
+		g.versions.Delete(id)
 	}
 }
 
@@ -117,6 +166,15 @@ func (g *Pool) Stop() {
 			item.Stop()
 		}
 		g.entries.Delete(key)
+		g.versions.Delete(key)
+		return true
+	})
+	g.splits.Range(func(key, value any) bool {
+		g.splits.Delete(key)
+		return true
+	})
+	g.shadows.Range(func(key, value any) bool {
+		g.shadows.Delete(key)
 		return true
 	})
 }
@@ -57,6 +57,17 @@ func TestRuleGo(t *testing.T) {
 	err = myRuleGo.Load("../testdata/rule/*.json", WithConfig(config))
 	assert.Nil(t, err)
 
+	//不指定文件匹配模式，根据扩展名选择解析器
+	textRuleGo := NewPool()
+	err = textRuleGo.Load("../testdata/rule", WithConfig(config))
+	assert.Nil(t, err)
+	_, ok := textRuleGo.Get("yaml_chain")
+	assert.Equal(t, true, ok)
+	_, ok = textRuleGo.Get("hcl_chain")
+	assert.Equal(t, true, ok)
+	_, ok = textRuleGo.Get("sub_chain")
+	assert.Equal(t, true, ok)
+
 	var i = 0
 	myRuleGo.Range(func(key, value any) bool {
 		i++
@@ -69,7 +80,7 @@ func TestRuleGo(t *testing.T) {
 		return true
 	})
 	assert.True(t, i > 0)
-	_, ok := myRuleGo.Get("chain_call_rest_api")
+	_, ok = myRuleGo.Get("chain_call_rest_api")
 	assert.Equal(t, true, ok)
 
 	_, ok = myRuleGo.Get("chain_has_sub_chain_node")
@@ -0,0 +1,195 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/builtin/aspect"
+	"github.com/rulego/rulego/components/action"
+	"github.com/rulego/rulego/test/assert"
+)
+
+var rateLimitChainFile = `{
+  "ruleChain": {
+    "id": "test_rate_limit",
+    "additionalInfo": {
+      "rateLimit": {
+        "rate": 10,
+        "algorithm": "slidingWindow",
+        "window": 200
+      }
+    }
+  },
+  "metadata": {
+    "nodes": [
+      {
+        "id": "s1",
+        "type": "functions",
+        "additionalInfo": {
+          "rateLimit": {
+            "rate": 1,
+            "burst": 2,
+            "key": "${metadata.deviceId}",
+            "action": "reject"
+          }
+        },
+        "configuration": {
+          "functionName": "rateLimitCall"
+        }
+      }
+    ]
+  }
+}`
+
+// 测试规则链、节点以及按key限流
+func TestRateLimiterAspect(t *testing.T) {
+	var calls int32
+	action.Functions.Register("rateLimitCall", func(ctx types.RuleContext, msg types.RuleMsg) {
+		atomic.AddInt32(&calls, 1)
+		ctx.TellSuccess(msg)
+	})
+	execute := func(ruleEngine types.RuleEngine, deviceId string) (string, error) {
+		var relationType string
+		var result error
+		metadata := types.NewMetadata()
+		metadata.PutValue("deviceId", deviceId)
+		msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, metadata, "{\"temperature\":41}")
+		ruleEngine.OnMsgAndWait(msg, types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, r string) {
+			relationType = r
+			result = err
+		}))
+		return relationType, result
+	}
+	config := NewConfig(types.WithDefaultPool())
+
+	t.Run("NodeKey", func(t *testing.T) {
+		dsl := strings.Replace(rateLimitChainFile, `"rate": 10,`, `"rate": 100,`, 1)
+		ruleEngine, err := New("test_rate_limit_node", []byte(dsl), WithConfig(config))
+		assert.Nil(t, err)
+		defer Del("test_rate_limit_node")
+		atomic.StoreInt32(&calls, 0)
+
+		//每个设备允许突发2个请求
+		for i := 0; i < 2; i++ {
+			relationType, err := execute(ruleEngine, "dev01")
+			assert.Equal(t, types.Success, relationType)
+			assert.Nil(t, err)
+		}
+		relationType, err := execute(ruleEngine, "dev01")
+		assert.Equal(t, types.Failure, relationType)
+		assert.Equal(t, types.ErrRateLimitExceeded, err)
+		//其他设备不受影响
+		relationType, _ = execute(ruleEngine, "dev02")
+		assert.Equal(t, types.Success, relationType)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("NodeDrop", func(t *testing.T) {
+		dsl := strings.Replace(rateLimitChainFile, `"rate": 10,`, `"rate": 100,`, 1)
+		dsl = strings.Replace(dsl, `"reject"`, `"drop"`, 1)
+		ruleEngine, err := New("test_rate_limit_drop", []byte(dsl), WithConfig(config))
+		assert.Nil(t, err)
+		defer Del("test_rate_limit_drop")
+		atomic.StoreInt32(&calls, 0)
+
+		for i := 0; i < 2; i++ {
+			assert.Nil(t, endErr(execute(ruleEngine, "dev01")))
+		}
+		//丢弃消息，不返回错误
+		relationType, err := execute(ruleEngine, "dev01")
+		assert.Equal(t, types.Dropped, relationType)
+		assert.Nil(t, err)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	})
+
+	t.Run("NodeDelay", func(t *testing.T) {
+		dsl := strings.Replace(rateLimitChainFile, `"rate": 10,`, `"rate": 100,`, 1)
+		dsl = strings.Replace(dsl, `"rate": 1,
+            "burst": 2,`, `"rate": 20,
+            "burst": 1,
+            "maxDelay": 30,`, 1)
+		dsl = strings.Replace(dsl, `"reject"`, `"delay"`, 1)
+		ruleEngine, err := New("test_rate_limit_delay", []byte(dsl), WithConfig(config))
+		assert.Nil(t, err)
+		defer Del("test_rate_limit_delay")
+
+		start := time.Now()
+		relationType, _ := execute(ruleEngine, "dev01")
+		assert.Equal(t, types.Success, relationType)
+		//等待50毫秒获得令牌，超过最长等待时间
+		relationType, err = execute(ruleEngine, "dev01")
+		assert.Equal(t, types.ErrRateLimitExceeded, err)
+		time.Sleep(time.Millisecond * 25)
+		//等待约25毫秒获得令牌
+		relationType, _ = execute(ruleEngine, "dev01")
+		assert.Equal(t, types.Success, relationType)
+		assert.True(t, time.Since(start) >= time.Millisecond*50)
+	})
+
+	t.Run("ChainSlidingWindow", func(t *testing.T) {
+		dsl := strings.Replace(rateLimitChainFile, `"rate": 1,`, `"rate": 100,`, 1)
+		ruleEngine, err := New("test_rate_limit_chain", []byte(dsl), WithConfig(config))
+		assert.Nil(t, err)
+		defer Del("test_rate_limit_chain")
+		atomic.StoreInt32(&calls, 0)
+
+		//200毫秒窗口内最多2个请求，不区分设备
+		assert.Nil(t, endErr(execute(ruleEngine, "dev01")))
+		assert.Nil(t, endErr(execute(ruleEngine, "dev02")))
+		relationType, err := execute(ruleEngine, "dev03")
+		assert.Equal(t, types.Failure, relationType)
+		assert.Equal(t, types.ErrRateLimitExceeded, err)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+
+		time.Sleep(time.Millisecond * 210)
+		assert.Nil(t, endErr(execute(ruleEngine, "dev03")))
+	})
+
+	t.Run("DefaultChainLimit", func(t *testing.T) {
+		dsl := strings.Replace(rateLimitChainFile, `"rateLimit"`, `"noRateLimit"`, -1)
+		ruleEngine, err := New("test_rate_limit_default", []byte(dsl), WithConfig(config),
+			types.WithAspects(aspect.NewRateLimiterAspect(&aspect.RateLimit{Rate: 1, Action: aspect.RateLimitDrop})))
+		assert.Nil(t, err)
+		defer Del("test_rate_limit_default")
+
+		relationType, _ := execute(ruleEngine, "dev01")
+		assert.Equal(t, types.Success, relationType)
+		relationType, err = execute(ruleEngine, "dev01")
+		assert.Equal(t, types.Dropped, relationType)
+		assert.Nil(t, err)
+	})
+
+	t.Run("NoLimit", func(t *testing.T) {
+		dsl := strings.Replace(rateLimitChainFile, `"rateLimit"`, `"noRateLimit"`, -1)
+		ruleEngine, err := New("test_rate_limit_none", []byte(dsl), WithConfig(config))
+		assert.Nil(t, err)
+		defer Del("test_rate_limit_none")
+		for i := 0; i < 10; i++ {
+			assert.Nil(t, endErr(execute(ruleEngine, "dev01")))
+		}
+	})
+}
+
+// endErr 返回规则链执行结束的错误
+func endErr(_ string, err error) error {
+	return err
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/rulego/rulego/components/external"
 	"github.com/rulego/rulego/components/filter"
 	"github.com/rulego/rulego/components/flow"
+	externalPlugin "github.com/rulego/rulego/components/plugin"
 	"github.com/rulego/rulego/components/transform"
 	"github.com/rulego/rulego/utils/reflect"
 	"plugin"
@@ -58,6 +59,8 @@ type RuleComponentRegistry struct {
 	components map[string]types.Node
 	// plugins is a map of plugin components.
 	plugins map[string][]types.Node
+	// externalPlugins is a map of out-of-process plugin clients.
+	externalPlugins map[string]*externalPlugin.Client
 	// endpointComponents is a map of endpoint components.
 	endpointComponents map[string]types.Node
 	// RWMutex is a read/write mutex lock.
@@ -106,11 +109,50 @@ func (r *RuleComponentRegistry) RegisterPlugin(name string, file string) error {
 	return nil
 }
 
+// RegisterExternalPlugin launches an out-of-process plugin and registers the components it advertises.
+// The plugin process is supervised and restarted on crash, and stopped by Unregister(name).
+func (r *RuleComponentRegistry) RegisterExternalPlugin(name string, config externalPlugin.Config) error {
+	r.RLock()
+	_, ok := r.plugins[name]
+	r.RUnlock()
+	if ok {
+		return errors.New("the plugin already exists. name=" + name)
+	}
+	client, err := externalPlugin.Start(config)
+	if err != nil {
+		return err
+	}
+	components := client.Components()
+	r.Lock()
+	defer r.Unlock()
+	for _, node := range components {
+		if _, ok := r.components[node.Type()]; ok {
+			_ = client.Close()
+			return errors.New("the component already exists. componentType=" + node.Type())
+		}
+	}
+	if r.components == nil {
+		r.components = make(map[string]types.Node)
+	}
+	for _, node := range components {
+		r.components[node.Type()] = node
+	}
+	if r.plugins == nil {
+		r.plugins = make(map[string][]types.Node)
+	}
+	if r.externalPlugins == nil {
+		r.externalPlugins = make(map[string]*externalPlugin.Client)
+	}
+	r.plugins[name] = components
+	r.externalPlugins[name] = client
+	return nil
+}
+
 // Unregister removes a component from the registry by its type.
 func (r *RuleComponentRegistry) Unregister(componentType string) error {
-	r.RLock()
-	defer r.RUnlock()
+	r.Lock()
 	var removed = false
+	var client *externalPlugin.Client
 	// Check if the plugin exists
 	if nodes, ok := r.plugins[componentType]; ok {
 		for _, node := range nodes {
@@ -118,6 +160,8 @@ func (r *RuleComponentRegistry) Unregister(componentType string) error {
 			delete(r.components, node.Type())
 		}
 		delete(r.plugins, componentType)
+		client = r.externalPlugins[componentType]
+		delete(r.externalPlugins, componentType)
 		removed = true
 	}
 
@@ -127,6 +171,12 @@ func (r *RuleComponentRegistry) Unregister(componentType string) error {
 		delete(r.components, componentType)
 		removed = true
 	}
+	r.Unlock()
+
+	// Stop the plugin process outside the lock, closing waits for the process to exit
+	if client != nil {
+		_ = client.Close()
+	}
 
 	if !removed {
 		return fmt.Errorf("component not found. componentType=%s", componentType)
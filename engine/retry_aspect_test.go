@@ -0,0 +1,240 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/builtin/aspect"
+	"github.com/rulego/rulego/components/action"
+	"github.com/rulego/rulego/test/assert"
+)
+
+var retryChainYaml = `# yaml 格式的重试规则链
+ruleChain:
+  id: test_retry_yaml
+metadata:
+  nodes:
+    - id: s1
+      type: functions
+      additionalInfo:
+        retry:
+          maxAttempts: 3
+          initialInterval: 10
+          retryOn: [unavailable]
+      configuration:
+        functionName: retryFlaky
+    - id: s2
+      type: functions
+      configuration:
+        functionName: retryEnd
+  connections:
+    - fromId: s1
+      toId: s2
+      type: Success
+`
+
+var retryChainFile = `{
+  "ruleChain": {
+    "id": "test_retry"
+  },
+  "metadata": {
+    "nodes": [
+      {
+        "id": "s1",
+        "type": "functions",
+        "additionalInfo": {
+          "retry": {
+            "maxAttempts": 3,
+            "initialInterval": 10,
+            "jitter": 0.1,
+            "timeout": 100,
+            "retryOn": ["unavailable", "attempt timeout"]
+          }
+        },
+        "configuration": {
+          "functionName": "retryFlaky"
+        }
+      },
+      {
+        "id": "s2",
+        "type": "functions",
+        "configuration": {
+          "functionName": "retryEnd"
+        }
+      }
+    ],
+    "connections": [
+      {
+        "fromId": "s1",
+        "toId": "s2",
+        "type": "Success"
+      }
+    ]
+  }
+}`
+
+// 测试节点失败重试
+func TestRetryAspect(t *testing.T) {
+	//每次执行的行为 fail/timeout/badRequest/success
+	var behaviors atomic.Value
+	var attempts int32
+	var s2Count int32
+	action.Functions.Register("retryFlaky", func(ctx types.RuleContext, msg types.RuleMsg) {
+		n := atomic.AddInt32(&attempts, 1)
+		list := behaviors.Load().([]string)
+		behavior := list[len(list)-1]
+		if int(n) <= len(list) {
+			behavior = list[n-1]
+		}
+		//每次执行使用原始消息副本
+		assert.Equal(t, "", msg.Metadata.GetValue("attempt"))
+		msg.Metadata.PutValue("attempt", behavior)
+		switch behavior {
+		case "fail":
+			ctx.TellFailure(msg, errors.New("service unavailable"))
+		case "badRequest":
+			ctx.TellFailure(msg, errors.New("bad request"))
+		case "timeout":
+			//等待超时，超时后的结果会被丢弃
+			<-ctx.GetContext().Done()
+			ctx.TellSuccess(msg)
+		default:
+			ctx.TellSuccess(msg)
+		}
+	})
+	action.Functions.Register("retryEnd", func(ctx types.RuleContext, msg types.RuleMsg) {
+		atomic.AddInt32(&s2Count, 1)
+		ctx.TellSuccess(msg)
+	})
+
+	ruleEngine, err := New("test_retry", []byte(retryChainFile), WithConfig(NewConfig(types.WithDefaultPool())))
+	assert.Nil(t, err)
+	defer Del("test_retry")
+
+	execute := func(list ...string) (string, error, types.RuleNodeRunLog) {
+		behaviors.Store(list)
+		atomic.StoreInt32(&attempts, 0)
+		atomic.StoreInt32(&s2Count, 0)
+		var relationType string
+		var endErr error
+		var nodeLog types.RuleNodeRunLog
+		msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), "{\"temperature\":41}")
+		ruleEngine.OnMsgAndWait(msg, types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, r string) {
+			relationType = r
+			endErr = err
+		}), types.WithOnRuleChainCompleted(func(ctx types.RuleContext, snapshot types.RuleChainRunSnapshot) {
+			for _, item := range snapshot.Logs {
+				if item.Id == "s1" {
+					nodeLog = item
+				}
+			}
+		}))
+		return relationType, endErr, nodeLog
+	}
+
+	t.Run("RetrySuccess", func(t *testing.T) {
+		relationType, err, nodeLog := execute("fail", "fail", "success")
+		assert.Equal(t, types.Success, relationType)
+		assert.Nil(t, err)
+		assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+		assert.Equal(t, int32(1), atomic.LoadInt32(&s2Count))
+		assert.Equal(t, 3, nodeLog.Attempts)
+		assert.Equal(t, []string{"service unavailable", "service unavailable"}, nodeLog.LogItems)
+		assert.Equal(t, "success", nodeLog.OutMsg.Metadata.GetValue("attempt"))
+	})
+
+	t.Run("Exhausted", func(t *testing.T) {
+		relationType, err, nodeLog := execute("fail")
+		assert.Equal(t, types.Failure, relationType)
+		assert.Equal(t, "service unavailable", err.Error())
+		assert.Equal(t, int32(3), atomic.LoadInt32(&attempts))
+		assert.Equal(t, int32(0), atomic.LoadInt32(&s2Count))
+		assert.Equal(t, 3, nodeLog.Attempts)
+		assert.Equal(t, types.Failure, nodeLog.RelationType)
+	})
+
+	t.Run("NotRetryable", func(t *testing.T) {
+		relationType, err, nodeLog := execute("badRequest")
+		assert.Equal(t, types.Failure, relationType)
+		assert.Equal(t, "bad request", err.Error())
+		assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+		assert.Equal(t, 0, nodeLog.Attempts)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		relationType, err, nodeLog := execute("timeout", "success")
+		assert.Equal(t, types.Success, relationType)
+		assert.Nil(t, err)
+		assert.Equal(t, 2, nodeLog.Attempts)
+		assert.Equal(t, []string{aspect.ErrAttemptTimeout.Error()}, nodeLog.LogItems)
+		//超时的执行结果被丢弃
+		time.Sleep(time.Millisecond * 50)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&s2Count))
+	})
+
+	t.Run("NoPolicy", func(t *testing.T) {
+		dsl := strings.Replace(retryChainFile, `"retry"`, `"noRetry"`, 1)
+		assert.Nil(t, ruleEngine.ReloadSelf([]byte(dsl)))
+		defer func() {
+			_ = ruleEngine.ReloadSelf([]byte(retryChainFile))
+		}()
+		relationType, _, nodeLog := execute("fail", "success")
+		assert.Equal(t, types.Failure, relationType)
+		assert.Equal(t, int32(1), atomic.LoadInt32(&attempts))
+		assert.Equal(t, 0, nodeLog.Attempts)
+	})
+
+	//yaml 格式的规则链，重试策略同样生效
+	t.Run("Yaml", func(t *testing.T) {
+		yamlEngine, err := New("test_retry_yaml", []byte(retryChainYaml), WithConfig(NewConfig(types.WithDefaultPool(), types.WithParser(&YamlParser{}))))
+		assert.Nil(t, err)
+		defer Del("test_retry_yaml")
+		behaviors.Store([]string{"fail", "success"})
+		atomic.StoreInt32(&attempts, 0)
+		var relationType string
+		yamlEngine.OnMsgAndWait(types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), "{}"), types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, r string) {
+			relationType = r
+		}))
+		assert.Equal(t, types.Success, relationType)
+		assert.Equal(t, int32(2), atomic.LoadInt32(&attempts))
+	})
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := aspect.RetryPolicy{InitialInterval: 100, MaxInterval: 300, Multiplier: 2}
+	assert.Equal(t, time.Millisecond*100, policy.Backoff(1))
+	assert.Equal(t, time.Millisecond*200, policy.Backoff(2))
+	assert.Equal(t, time.Millisecond*300, policy.Backoff(3))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 10; i++ {
+		backoff := policy.Backoff(1)
+		assert.True(t, backoff >= time.Millisecond*50 && backoff <= time.Millisecond*150)
+	}
+
+	assert.True(t, policy.IsRetryable(errors.New("any")))
+	policy.RetryOn = []string{"timeout"}
+	assert.True(t, policy.IsRetryable(errors.New("i/o timeout")))
+	assert.False(t, policy.IsRetryable(errors.New("bad request")))
+	assert.False(t, policy.IsRetryable(nil))
+}
@@ -0,0 +1,415 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+// DefaultShadowStubNodeTypes 影子规则链默认替换成桩的有副作用的组件类型
+var DefaultShadowStubNodeTypes = []string{"restApiCall", "dbClient", "mqttClient", "sendEmail", "exec", "ssh"}
+
+// DefaultMaxDivergences 默认保留的差异记录数量
+const DefaultMaxDivergences = 100
+
+// ShadowConfig 影子执行配置
+type ShadowConfig struct {
+	// CandidateId 候选规则链ID，规则链需要先加载到规则引擎池
+	CandidateId string `json:"candidateId"`
+	// StubNodeTypes 候选规则链中替换成桩的组件类型，为空使用 DefaultShadowStubNodeTypes
+	// 桩节点不会执行，而是回放主规则链相同ID节点的输出，主规则链没有该节点则原样输出到`Success`链
+	StubNodeTypes []string `json:"stubNodeTypes"`
+	// SampleRate 镜像的消息比例，取值 0~1，0 表示镜像全部消息
+	SampleRate float64 `json:"sampleRate"`
+	// MaxDivergences 保留的最近差异记录数量，0 使用 DefaultMaxDivergences
+	MaxDivergences int `json:"maxDivergences"`
+	// OnDivergence 发现差异回调
+	OnDivergence func(divergence ShadowDivergence) `json:"-"`
+}
+
+// ShadowOutput 规则链一个分支的结束输出
+type ShadowOutput struct {
+	RelationType string `json:"relationType"`
+	MsgType      string `json:"msgType"`
+	Data         string `json:"data"`
+	Err          string `json:"err,omitempty"`
+}
+
+// ShadowDivergence 主规则链和候选规则链处理同一条消息的差异
+type ShadowDivergence struct {
+	// MsgId 消息ID
+	MsgId string `json:"msgId"`
+	// Ts 比较时间，毫秒
+	Ts int64 `json:"ts"`
+	// OutputDiverged 分支结束输出是否不一致
+	OutputDiverged bool `json:"outputDiverged"`
+	// PathDiverged 执行的节点和关系是否不一致
+	PathDiverged     bool           `json:"pathDiverged"`
+	PrimaryOutputs   []ShadowOutput `json:"primaryOutputs"`
+	CandidateOutputs []ShadowOutput `json:"candidateOutputs"`
+	// PrimaryPath 主规则链执行的节点和关系，格式：nodeId:relationType，按字母排序
+	PrimaryPath   []string `json:"primaryPath"`
+	CandidatePath []string `json:"candidatePath"`
+	// PrimarySnapshot 主规则链的执行快照
+	PrimarySnapshot   types.RuleChainRunSnapshot `json:"primarySnapshot"`
+	CandidateSnapshot types.RuleChainRunSnapshot `json:"candidateSnapshot"`
+}
+
+// ShadowStats 影子执行统计
+type ShadowStats struct {
+	// Mirrored 镜像到候选规则链的消息数
+	Mirrored int64 `json:"mirrored"`
+	// Compared 完成比较的消息数
+	Compared int64 `json:"compared"`
+	// Diverged 存在差异的消息数
+	Diverged int64 `json:"diverged"`
+}
+
+// ShadowEngine 影子执行的主规则链，消息正常由主规则链处理，处理完成后镜像到候选规则链，并比较两者的输出和执行路径
+// 通过 Pool.Get 获取主规则链ID时返回该实例，除 OnMsg/OnMsgAndWait 外的方法作用于主规则链
+type ShadowEngine struct {
+	types.RuleEngine
+	pool        *Pool
+	config      ShadowConfig
+	mirrored    int64
+	compared    int64
+	diverged    int64
+	lock        sync.Mutex
+	divergences []ShadowDivergence
+	random      *rand.Rand
+}
+
+var _ types.RuleEngine = (*ShadowEngine)(nil)
+
+// SetShadow 为主规则链设置影子执行，已经存在则替换并重置差异记录
+// 候选规则链会重新加载，加入 ShadowStubAspect 切面替换有副作用的节点，只对镜像的消息生效，
+// 候选规则链自身的消息正常执行
+// 注意：候选规则链通过`flow`节点调用的子规则链不会替换成桩
+func (g *Pool) SetShadow(primaryId string, config ShadowConfig) error {
+	primary, ok := g.entries.Load(primaryId)
+	if !ok {
+		return fmt.Errorf("%w: id=%s", ErrChainNotFound, primaryId)
+	}
+	if config.CandidateId == "" || config.CandidateId == primaryId {
+		return errors.New("shadow candidate id can not be empty or the same as the primary id")
+	}
+	v, ok := g.entries.Load(config.CandidateId)
+	if !ok {
+		return fmt.Errorf("%w: id=%s", ErrChainNotFound, config.CandidateId)
+	}
+	if len(config.StubNodeTypes) == 0 {
+		config.StubNodeTypes = DefaultShadowStubNodeTypes
+	}
+	if config.MaxDivergences <= 0 {
+		config.MaxDivergences = DefaultMaxDivergences
+	}
+	candidate := v.(*RuleEngine)
+	stub := &ShadowStubAspect{NodeTypes: config.StubNodeTypes}
+	var aspects types.AspectList
+	for _, item := range candidate.GetAspects() {
+		if _, ok := item.(*ShadowStubAspect); !ok {
+			aspects = append(aspects, item)
+		}
+	}
+	if err := candidate.ReloadSelf(candidate.DSL(), types.WithAspects(append(aspects, stub)...)); err != nil {
+		return err
+	}
+	g.shadows.Store(primaryId, &ShadowEngine{
+		RuleEngine: primary.(*RuleEngine),
+		pool:       g,
+		config:     config,
+		random:     rand.New(rand.NewSource(rand.Int63())),
+	})
+	return nil
+}
+
+// GetShadow 获取主规则链的影子执行
+func (g *Pool) GetShadow(primaryId string) (*ShadowEngine, bool) {
+	if v, ok := g.shadows.Load(primaryId); ok {
+		return v.(*ShadowEngine), true
+	}
+	return nil, false
+}
+
+// DelShadow 停止主规则链的影子执行，不会删除候选规则链
+func (g *Pool) DelShadow(primaryId string) {
+	g.shadows.Delete(primaryId)
+}
+
+// Config 影子执行配置
+func (s *ShadowEngine) Config() ShadowConfig {
+	return s.config
+}
+
+// OnMsg 主规则链处理消息，处理完成后镜像到候选规则链
+func (s *ShadowEngine) OnMsg(msg types.RuleMsg, opts ...types.RuleContextOption) {
+	s.RuleEngine.OnMsg(msg, s.withShadow(msg, opts)...)
+}
+
+// OnMsgAndWait 主规则链处理消息，并等待主规则链处理完成，候选规则链异步执行
+func (s *ShadowEngine) OnMsgAndWait(msg types.RuleMsg, opts ...types.RuleContextOption) {
+	s.RuleEngine.OnMsgAndWait(msg, s.withShadow(msg, opts)...)
+}
+
+// Stats 影子执行统计
+func (s *ShadowEngine) Stats() ShadowStats {
+	return ShadowStats{
+		Mirrored: atomic.LoadInt64(&s.mirrored),
+		Compared: atomic.LoadInt64(&s.compared),
+		Diverged: atomic.LoadInt64(&s.diverged),
+	}
+}
+
+// Divergences 最近的差异记录，按时间升序
+func (s *ShadowEngine) Divergences() []ShadowDivergence {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]ShadowDivergence{}, s.divergences...)
+}
+
+// GetDivergence 根据消息ID获取差异记录
+func (s *ShadowEngine) GetDivergence(msgId string) (ShadowDivergence, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, item := range s.divergences {
+		if item.MsgId == msgId {
+			return item, true
+		}
+	}
+	return ShadowDivergence{}, false
+}
+
+// ClearDivergences 清除差异记录和统计
+func (s *ShadowEngine) ClearDivergences() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.divergences = nil
+	atomic.StoreInt64(&s.mirrored, 0)
+	atomic.StoreInt64(&s.compared, 0)
+	atomic.StoreInt64(&s.diverged, 0)
+}
+
+// withShadow 采样命中则收集主规则链的执行快照和输出，处理完成后镜像到候选规则链
+func (s *ShadowEngine) withShadow(msg types.RuleMsg, opts []types.RuleContextOption) []types.RuleContextOption {
+	if !s.sample() {
+		return opts
+	}
+	candidateMsg := msg.Copy()
+	run := &shadowRun{}
+	return append(opts, withRunCollector(run, func() {
+		//异步执行，不影响主规则链
+		go s.mirror(candidateMsg, run)
+	}))
+}
+
+func (s *ShadowEngine) sample() bool {
+	if s.config.SampleRate <= 0 || s.config.SampleRate >= 1 {
+		return true
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.random.Float64() < s.config.SampleRate
+}
+
+// mirror 候选规则链处理消息，桩节点通过 context 获取主规则链的执行快照
+func (s *ShadowEngine) mirror(msg types.RuleMsg, primary *shadowRun) {
+	v, ok := s.pool.entries.Load(s.config.CandidateId)
+	if !ok {
+		return
+	}
+	atomic.AddInt64(&s.mirrored, 1)
+	candidate := &shadowRun{}
+	ctx := context.WithValue(context.Background(), shadowSnapshotKey{}, primary.snapshot)
+	v.(*RuleEngine).OnMsg(msg, types.WithContext(ctx), withRunCollector(candidate, func() {
+		s.compare(msg.Id, primary, candidate)
+	}))
+}
+
+func (s *ShadowEngine) compare(msgId string, primary, candidate *shadowRun) {
+	atomic.AddInt64(&s.compared, 1)
+	divergence := ShadowDivergence{
+		MsgId:             msgId,
+		Ts:                time.Now().UnixMilli(),
+		PrimaryOutputs:    primary.sortedOutputs(),
+		CandidateOutputs:  candidate.sortedOutputs(),
+		PrimaryPath:       snapshotPath(primary.snapshot),
+		CandidatePath:     snapshotPath(candidate.snapshot),
+		PrimarySnapshot:   primary.snapshot,
+		CandidateSnapshot: candidate.snapshot,
+	}
+	divergence.OutputDiverged = !reflect.DeepEqual(divergence.PrimaryOutputs, divergence.CandidateOutputs)
+	divergence.PathDiverged = !reflect.DeepEqual(divergence.PrimaryPath, divergence.CandidatePath)
+	if !divergence.OutputDiverged && !divergence.PathDiverged {
+		return
+	}
+	atomic.AddInt64(&s.diverged, 1)
+	s.lock.Lock()
+	s.divergences = append(s.divergences, divergence)
+	if len(s.divergences) > s.config.MaxDivergences {
+		s.divergences = append([]ShadowDivergence{}, s.divergences[len(s.divergences)-s.config.MaxDivergences:]...)
+	}
+	s.lock.Unlock()
+	if s.config.OnDivergence != nil {
+		s.config.OnDivergence(divergence)
+	}
+}
+
+// shadowRun 一次执行的快照和分支结束输出
+type shadowRun struct {
+	lock     sync.Mutex
+	outputs  []ShadowOutput
+	snapshot types.RuleChainRunSnapshot
+}
+
+func (r *shadowRun) addOutput(msg types.RuleMsg, err error, relationType string) {
+	output := ShadowOutput{RelationType: relationType, MsgType: msg.Type, Data: msg.Data}
+	if err != nil {
+		output.Err = err.Error()
+	}
+	r.lock.Lock()
+	r.outputs = append(r.outputs, output)
+	r.lock.Unlock()
+}
+
+func (r *shadowRun) sortedOutputs() []ShadowOutput {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	outputs := append([]ShadowOutput{}, r.outputs...)
+	sort.Slice(outputs, func(i, j int) bool {
+		return fmt.Sprint(outputs[i]) < fmt.Sprint(outputs[j])
+	})
+	return outputs
+}
+
+// snapshotPath 执行的节点和关系，并行分支的执行顺序不确定，所以按字母排序
+func snapshotPath(snapshot types.RuleChainRunSnapshot) []string {
+	var path []string
+	for _, item := range snapshot.Logs {
+		path = append(path, item.Id+":"+item.RelationType)
+	}
+	sort.Strings(path)
+	return path
+}
+
+// withRunCollector 收集执行快照和分支结束输出，执行完成后调用 onCompleted
+// 必须作为最后一个选项，包装调用方已经设置的回调
+func withRunCollector(run *shadowRun, onCompleted func()) types.RuleContextOption {
+	return func(rc types.RuleContext) {
+		ctx, ok := rc.(*DefaultRuleContext)
+		if !ok || ctx.runSnapshot == nil {
+			return
+		}
+		onEnd := ctx.onEnd
+		ctx.onEnd = func(ruleCtx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+			run.addOutput(msg, err, relationType)
+			if onEnd != nil {
+				onEnd(ruleCtx, msg, err, relationType)
+			}
+		}
+		onRuleChainCompleted := ctx.runSnapshot.onRuleChainCompletedFunc
+		ctx.runSnapshot.onRuleChainCompletedFunc = func(ruleCtx types.RuleContext, snapshot types.RuleChainRunSnapshot) {
+			if onRuleChainCompleted != nil {
+				onRuleChainCompleted(ruleCtx, snapshot)
+			}
+			run.snapshot = snapshot
+			onCompleted()
+		}
+	}
+}
+
+// shadowSnapshotKey context 中保存主规则链执行快照的key
+type shadowSnapshotKey struct{}
+
+// isShadowRun 是否是镜像到候选规则链的执行
+func isShadowRun(ctx types.RuleContext) bool {
+	c := ctx.GetContext()
+	if c == nil {
+		return false
+	}
+	_, ok := c.Value(shadowSnapshotKey{}).(types.RuleChainRunSnapshot)
+	return ok
+}
+
+// Compile-time check ShadowStubAspect implements types.AroundAspect.
+var _ types.AroundAspect = (*ShadowStubAspect)(nil)
+
+// ShadowStubAspect 影子执行的桩切面，镜像消息在候选规则链中指定类型的节点不会执行，避免产生副作用
+// 回放主规则链相同ID节点的输出，主规则链没有执行该节点则原样输出到`Success`链
+// 不会作用于`flow`节点调用的子规则链，子规则链中有副作用的节点仍然会执行
+type ShadowStubAspect struct {
+	// NodeTypes 替换成桩的组件类型
+	NodeTypes []string
+}
+
+func (aspect *ShadowStubAspect) Order() int {
+	//优先于其他环绕切面执行，例如重试、熔断
+	return 1
+}
+
+func (aspect *ShadowStubAspect) New() types.Aspect {
+	return &ShadowStubAspect{NodeTypes: aspect.NodeTypes}
+}
+
+func (aspect *ShadowStubAspect) Type() string {
+	return "shadowStub"
+}
+
+// PointCut 镜像的消息并且节点类型在 NodeTypes 中
+func (aspect *ShadowStubAspect) PointCut(ctx types.RuleContext, msg types.RuleMsg, relationType string) bool {
+	if ctx.Self() == nil || !isShadowRun(ctx) {
+		return false
+	}
+	nodeType := ctx.Self().Type()
+	for _, item := range aspect.NodeTypes {
+		if item == nodeType {
+			return true
+		}
+	}
+	return false
+}
+
+// Around 不执行节点，回放主规则链的输出
+func (aspect *ShadowStubAspect) Around(ctx types.RuleContext, msg types.RuleMsg, relationType string) (types.RuleMsg, bool) {
+	if c := ctx.GetContext(); c != nil {
+		if snapshot, ok := c.Value(shadowSnapshotKey{}).(types.RuleChainRunSnapshot); ok {
+			for _, item := range snapshot.Logs {
+				if item.Id != ctx.GetSelfId() {
+					continue
+				}
+				out := item.OutMsg.Copy()
+				if item.Err != "" {
+					ctx.TellFailure(out, errors.New(item.Err))
+				} else {
+					ctx.TellNext(out, item.RelationType)
+				}
+				return msg, false
+			}
+		}
+	}
+	ctx.TellSuccess(msg)
+	return msg, false
+}
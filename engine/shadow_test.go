@@ -0,0 +1,214 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test/assert"
+)
+
+// shadowChain 调用 rest 接口后转换结果，candidate 使用不同的脚本或者增加过滤节点
+func shadowChain(id, url, script string, withFilter bool) []byte {
+	filterNode, filterConnection := "", ""
+	if withFilter {
+		filterNode = `{"id": "f1", "type": "jsFilter", "configuration": {"jsScript": "return msg.ok == true;"}},`
+		filterConnection = `{"fromId": "s2", "toId": "f1", "type": "Success"},{"fromId": "f1", "toId": "s3", "type": "True"}`
+	} else {
+		filterConnection = `{"fromId": "s2", "toId": "s3", "type": "Success"}`
+	}
+	return []byte(fmt.Sprintf(`{
+	  "ruleChain": {"id": "%s"},
+	  "metadata": {
+		"nodes": [
+		  {"id": "s1", "type": "jsTransform", "configuration": {"jsScript": "msg.step='s1';return {'msg':msg,'metadata':metadata,'msgType':msgType};"}},
+		  {"id": "s2", "type": "restApiCall", "configuration": {"restEndpointUrlPattern": "%s", "requestMethod": "POST"}},
+		  %s
+		  {"id": "s3", "type": "jsTransform", "configuration": {"jsScript": "%s"}}
+		],
+		"connections": [
+		  {"fromId": "s1", "toId": "s2", "type": "Success"},
+		  %s
+		]
+	  }
+	}`, id, url, filterNode, script, filterConnection))
+}
+
+const shadowScript = "msg.result='ok';return {'msg':msg,'metadata':metadata,'msgType':msgType};"
+
+func newShadowServer(calls *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(calls, 1)
+		_, _ = w.Write([]byte(`{"ok":true}`))
+	}))
+}
+
+func waitShadowCompared(shadow *ShadowEngine, compared int64) {
+	for i := 0; i < 100 && shadow.Stats().Compared < compared; i++ {
+		time.Sleep(time.Millisecond * 20)
+	}
+}
+
+func TestShadow(t *testing.T) {
+	var calls int32
+	server := newShadowServer(&calls)
+	defer server.Close()
+
+	pool := NewPool()
+	defer pool.Stop()
+	_, err := pool.New("test_shadow", shadowChain("test_shadow", server.URL, shadowScript, false))
+	assert.Nil(t, err)
+	_, err = pool.New("test_shadow_candidate", shadowChain("test_shadow_candidate", server.URL, shadowScript, false))
+	assert.Nil(t, err)
+	assert.Nil(t, pool.SetShadow("test_shadow", ShadowConfig{CandidateId: "test_shadow_candidate"}))
+
+	ruleEngine, ok := pool.Get("test_shadow")
+	assert.True(t, ok)
+	shadow := ruleEngine.(*ShadowEngine)
+	var result string
+	for i := 0; i < 5; i++ {
+		ruleEngine.OnMsgAndWait(types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}"), types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+			result = msg.Data
+		}))
+	}
+	assert.Equal(t, "{\"ok\":true,\"result\":\"ok\"}", result)
+	waitShadowCompared(shadow, 5)
+
+	//候选规则链的 rest 节点不会调用接口
+	assert.Equal(t, int32(5), atomic.LoadInt32(&calls))
+	stats := shadow.Stats()
+	assert.Equal(t, int64(5), stats.Mirrored)
+	assert.Equal(t, int64(5), stats.Compared)
+	assert.Equal(t, int64(0), stats.Diverged)
+	assert.Equal(t, 0, len(shadow.Divergences()))
+
+	//候选规则链自身的消息不会替换成桩
+	candidate, ok := pool.Get("test_shadow_candidate")
+	assert.True(t, ok)
+	candidate.OnMsgAndWait(types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}"))
+	assert.Equal(t, int32(6), atomic.LoadInt32(&calls))
+}
+
+func TestShadowDivergence(t *testing.T) {
+	var calls int32
+	server := newShadowServer(&calls)
+	defer server.Close()
+
+	pool := NewPool()
+	defer pool.Stop()
+	_, _ = pool.New("test_shadow", shadowChain("test_shadow", server.URL, shadowScript, false))
+	_, _ = pool.New("test_shadow_output", shadowChain("test_shadow_output", server.URL, "msg.result='changed';return {'msg':msg,'metadata':metadata,'msgType':msgType};", false))
+	_, _ = pool.New("test_shadow_path", shadowChain("test_shadow_path", server.URL, shadowScript, true))
+
+	var divergences int32
+	assert.Nil(t, pool.SetShadow("test_shadow", ShadowConfig{
+		CandidateId:    "test_shadow_output",
+		MaxDivergences: 2,
+		OnDivergence: func(divergence ShadowDivergence) {
+			atomic.AddInt32(&divergences, 1)
+		},
+	}))
+	ruleEngine, _ := pool.Get("test_shadow")
+	shadow := ruleEngine.(*ShadowEngine)
+	for i := 0; i < 3; i++ {
+		ruleEngine.OnMsg(types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}"))
+	}
+	waitShadowCompared(shadow, 3)
+	assert.Equal(t, int64(3), shadow.Stats().Diverged)
+	assert.Equal(t, int32(3), atomic.LoadInt32(&divergences))
+	//只保留最近的差异记录
+	assert.Equal(t, 2, len(shadow.Divergences()))
+	msgId := shadow.Divergences()[1].MsgId
+	divergence, ok := shadow.GetDivergence(msgId)
+	assert.True(t, ok)
+	assert.True(t, divergence.OutputDiverged)
+	assert.False(t, divergence.PathDiverged)
+	assert.Equal(t, "{\"ok\":true,\"result\":\"ok\"}", divergence.PrimaryOutputs[0].Data)
+	assert.Equal(t, "{\"ok\":true,\"result\":\"changed\"}", divergence.CandidateOutputs[0].Data)
+	assert.Equal(t, []string{"s1:Success", "s2:Success", "s3:Success"}, divergence.PrimaryPath)
+	assert.Equal(t, msgId, divergence.CandidateSnapshot.Id)
+
+	//替换候选规则链，增加了过滤节点
+	assert.Nil(t, pool.SetShadow("test_shadow", ShadowConfig{CandidateId: "test_shadow_path"}))
+	ruleEngine, _ = pool.Get("test_shadow")
+	shadow = ruleEngine.(*ShadowEngine)
+	ruleEngine.OnMsg(types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}"))
+	waitShadowCompared(shadow, 1)
+	divergences2 := shadow.Divergences()
+	assert.Equal(t, 1, len(divergences2))
+	assert.False(t, divergences2[0].OutputDiverged)
+	assert.True(t, divergences2[0].PathDiverged)
+	assert.Equal(t, []string{"f1:True", "s1:Success", "s2:Success", "s3:Success"}, divergences2[0].CandidatePath)
+	assert.Equal(t, int32(4), atomic.LoadInt32(&calls))
+
+	shadow.ClearDivergences()
+	assert.Equal(t, 0, len(shadow.Divergences()))
+	assert.Equal(t, int64(0), shadow.Stats().Compared)
+
+	pool.DelShadow("test_shadow")
+	ruleEngine, _ = pool.Get("test_shadow")
+	_, ok = ruleEngine.(*RuleEngine)
+	assert.True(t, ok)
+}
+
+func TestShadowStubWithoutPrimaryNode(t *testing.T) {
+	var calls int32
+	server := newShadowServer(&calls)
+	defer server.Close()
+
+	pool := NewPool()
+	defer pool.Stop()
+	_, _ = pool.New("test_shadow", []byte(`{
+	  "ruleChain": {"id": "test_shadow"},
+	  "metadata": {
+		"nodes": [
+		  {"id": "s1", "type": "jsTransform", "configuration": {"jsScript": "return {'msg':msg,'metadata':metadata,'msgType':msgType};"}}
+		]
+	  }
+	}`))
+	//候选规则链新增的 rest 节点，主规则链没有对应的输出，原样输出
+	_, _ = pool.New("test_shadow_candidate", shadowChain("test_shadow_candidate", server.URL, shadowScript, false))
+	assert.Nil(t, pool.SetShadow("test_shadow", ShadowConfig{CandidateId: "test_shadow_candidate"}))
+
+	ruleEngine, _ := pool.Get("test_shadow")
+	shadow := ruleEngine.(*ShadowEngine)
+	ruleEngine.OnMsg(types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}"))
+	waitShadowCompared(shadow, 1)
+	divergences := shadow.Divergences()
+	assert.Equal(t, 1, len(divergences))
+	assert.Equal(t, "{\"result\":\"ok\",\"step\":\"s1\"}", divergences[0].CandidateOutputs[0].Data)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+}
+
+func TestShadowError(t *testing.T) {
+	pool := NewPool()
+	defer pool.Stop()
+	_, _ = pool.New("test_shadow", splitChain("test_shadow", "v1", false))
+	err := pool.SetShadow("notFound", ShadowConfig{CandidateId: "test_shadow"})
+	assert.True(t, errors.Is(err, ErrChainNotFound))
+	err = pool.SetShadow("test_shadow", ShadowConfig{CandidateId: "notFound"})
+	assert.True(t, errors.Is(err, ErrChainNotFound))
+	assert.NotNil(t, pool.SetShadow("test_shadow", ShadowConfig{}))
+	assert.NotNil(t, pool.SetShadow("test_shadow", ShadowConfig{CandidateId: "test_shadow"}))
+}
@@ -0,0 +1,305 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+// SplitRoute 逻辑规则链的一个版本
+type SplitRoute struct {
+	// ChainId 版本对应的规则链ID，规则链需要先加载到规则引擎池
+	ChainId string `json:"chainId"`
+	// Weight 流量权重，例如 90 和 10 表示 90% 和 10% 的流量
+	Weight int `json:"weight"`
+}
+
+// RollbackPolicy 灰度版本自动回滚策略
+type RollbackPolicy struct {
+	// FailureRate 灰度版本失败率超过该阈值时自动回滚，取值 0~1
+	// 消息任意一个分支以错误或者 Failure 关系结束，则认为该消息处理失败
+	FailureRate float64 `json:"failureRate"`
+	// MinRequests 灰度版本处理完成的消息数达到该值才开始计算失败率，避免少量消息误判
+	MinRequests int64 `json:"minRequests"`
+	// OnRollback 自动回滚回调，metrics 是触发回滚的版本统计
+	OnRollback func(id string, metrics RouteMetrics) `json:"-"`
+}
+
+// SplitConfig 流量拆分配置，第一个路由是稳定版本，其他路由是灰度版本
+type SplitConfig struct {
+	// Routes 版本列表
+	Routes []SplitRoute `json:"routes"`
+	// StickyKey 粘性分流的元数据key，相同值的消息总是发送到同一个版本，例如 deviceId
+	// 为空或者消息没有该元数据则随机分流
+	StickyKey string `json:"stickyKey"`
+	// Rollback 自动回滚策略，nil 不自动回滚
+	Rollback *RollbackPolicy `json:"rollback"`
+}
+
+// RouteMetrics 版本的流量统计
+type RouteMetrics struct {
+	ChainId string `json:"chainId"`
+	// Weight 当前生效的权重，回滚后灰度版本权重为0
+	Weight int `json:"weight"`
+	// Requests 分发到该版本的消息数
+	Requests int64 `json:"requests"`
+	// Completed 处理完成的消息数
+	Completed int64 `json:"completed"`
+	// Failures 处理失败的消息数
+	Failures int64 `json:"failures"`
+}
+
+// FailureRate 失败率
+func (m RouteMetrics) FailureRate() float64 {
+	if m.Completed == 0 {
+		return 0
+	}
+	return float64(m.Failures) / float64(m.Completed)
+}
+
+type splitRoute struct {
+	SplitRoute
+	requests  int64
+	completed int64
+	failures  int64
+}
+
+// SplitEngine 逻辑规则链，按权重把消息分发到多个版本的规则链
+// 通过 Pool.Get 获取逻辑规则链ID时返回该实例，endpoint 和子规则链节点不需要修改即可分流
+// 除 OnMsg/OnMsgAndWait 外的方法作用于稳定版本
+type SplitEngine struct {
+	types.RuleEngine
+	id     string
+	pool   *Pool
+	config SplitConfig
+	routes []*splitRoute
+	total  int
+	//rolledBack 是否已经回滚，回滚后所有流量发送到稳定版本
+	rolledBack int32
+	lock       sync.Mutex
+	random     *rand.Rand
+}
+
+var _ types.RuleEngine = (*SplitEngine)(nil)
+
+// SetSplit 设置逻辑规则链的流量拆分，已经存在则替换并重置统计
+// 逻辑规则链ID可以和其中一个版本的规则链ID相同，这样原有的调用方不需要修改
+func (g *Pool) SetSplit(id string, config SplitConfig) error {
+	if id == "" {
+		return errors.New("split id can not be empty")
+	}
+	if len(config.Routes) == 0 {
+		return errors.New("split routes can not be empty")
+	}
+	split := &SplitEngine{
+		id:     id,
+		pool:   g,
+		config: config,
+		random: rand.New(rand.NewSource(rand.Int63())),
+	}
+	for _, route := range config.Routes {
+		if route.Weight < 0 {
+			return fmt.Errorf("split route weight can not be negative, chainId=%s", route.ChainId)
+		}
+		if _, ok := g.entries.Load(route.ChainId); !ok {
+			return fmt.Errorf("%w: id=%s", ErrChainNotFound, route.ChainId)
+		}
+		split.routes = append(split.routes, &splitRoute{SplitRoute: route})
+		split.total += route.Weight
+	}
+	if split.total == 0 {
+		return errors.New("split routes total weight must be greater than 0")
+	}
+	primary, _ := g.entries.Load(config.Routes[0].ChainId)
+	split.RuleEngine = primary.(*RuleEngine)
+	g.splits.Store(id, split)
+	return nil
+}
+
+// GetSplit 获取逻辑规则链的流量拆分
+func (g *Pool) GetSplit(id string) (*SplitEngine, bool) {
+	if v, ok := g.splits.Load(id); ok {
+		return v.(*SplitEngine), true
+	}
+	return nil, false
+}
+
+// DelSplit 删除逻辑规则链的流量拆分，不会删除版本的规则链
+func (g *Pool) DelSplit(id string) {
+	g.splits.Delete(id)
+}
+
+// Id 逻辑规则链ID
+func (s *SplitEngine) Id() string {
+	return s.id
+}
+
+// Config 流量拆分配置
+func (s *SplitEngine) Config() SplitConfig {
+	return s.config
+}
+
+// OnMsg 选择一个版本处理消息
+func (s *SplitEngine) OnMsg(msg types.RuleMsg, opts ...types.RuleContextOption) {
+	s.onMsg(msg, false, opts...)
+}
+
+// OnMsgAndWait 选择一个版本处理消息，并等待处理完成
+func (s *SplitEngine) OnMsgAndWait(msg types.RuleMsg, opts ...types.RuleContextOption) {
+	s.onMsg(msg, true, opts...)
+}
+
+// Metrics 各个版本的流量统计
+func (s *SplitEngine) Metrics() []RouteMetrics {
+	var result []RouteMetrics
+	for i := range s.routes {
+		result = append(result, s.metrics(i))
+	}
+	return result
+}
+
+// RolledBack 是否已经回滚到稳定版本
+func (s *SplitEngine) RolledBack() bool {
+	return atomic.LoadInt32(&s.rolledBack) == 1
+}
+
+// Rollback 回滚到稳定版本，所有流量发送到第一个路由
+func (s *SplitEngine) Rollback() {
+	atomic.StoreInt32(&s.rolledBack, 1)
+}
+
+func (s *SplitEngine) onMsg(msg types.RuleMsg, wait bool, opts ...types.RuleContextOption) {
+	index := s.pick(msg)
+	route := s.routes[index]
+	ruleEngine, ok := s.pool.getEngine(route.ChainId)
+	if !ok {
+		ruleEngine = s.RuleEngine
+		//版本已经被删除，使用稳定版本
+		index, route = 0, s.routes[0]
+	}
+	atomic.AddInt64(&route.requests, 1)
+	opts = append(opts, withOnCompleted(func(failed bool) {
+		atomic.AddInt64(&route.completed, 1)
+		if failed {
+			atomic.AddInt64(&route.failures, 1)
+		}
+		if index > 0 {
+			s.checkRollback(index)
+		}
+	}))
+	if wait {
+		ruleEngine.OnMsgAndWait(msg, opts...)
+	} else {
+		ruleEngine.OnMsg(msg, opts...)
+	}
+}
+
+// pick 选择版本，返回路由索引
+func (s *SplitEngine) pick(msg types.RuleMsg) int {
+	if s.RolledBack() {
+		return 0
+	}
+	var bucket int
+	if value := s.stickyValue(msg); value != "" {
+		h := fnv.New32a()
+		_, _ = h.Write([]byte(value))
+		bucket = int(h.Sum32() % uint32(s.total))
+	} else {
+		s.lock.Lock()
+		bucket = s.random.Intn(s.total)
+		s.lock.Unlock()
+	}
+	for i, route := range s.routes {
+		if bucket < route.Weight {
+			return i
+		}
+		bucket -= route.Weight
+	}
+	return 0
+}
+
+func (s *SplitEngine) stickyValue(msg types.RuleMsg) string {
+	if s.config.StickyKey == "" || msg.Metadata == nil {
+		return ""
+	}
+	return msg.Metadata.GetValue(s.config.StickyKey)
+}
+
+// checkRollback 灰度版本失败率超过阈值则回滚
+func (s *SplitEngine) checkRollback(index int) {
+	policy := s.config.Rollback
+	if policy == nil || s.RolledBack() {
+		return
+	}
+	metrics := s.metrics(index)
+	if metrics.Completed < policy.MinRequests || metrics.FailureRate() <= policy.FailureRate {
+		return
+	}
+	if atomic.CompareAndSwapInt32(&s.rolledBack, 0, 1) && policy.OnRollback != nil {
+		policy.OnRollback(s.id, metrics)
+	}
+}
+
+func (s *SplitEngine) metrics(index int) RouteMetrics {
+	route := s.routes[index]
+	weight := route.Weight
+	if s.RolledBack() && index > 0 {
+		weight = 0
+	}
+	return RouteMetrics{
+		ChainId:   route.ChainId,
+		Weight:    weight,
+		Requests:  atomic.LoadInt64(&route.requests),
+		Completed: atomic.LoadInt64(&route.completed),
+		Failures:  atomic.LoadInt64(&route.failures),
+	}
+}
+
+// withOnCompleted 规则链执行完成后回调，failed 表示是否有分支以错误或者 Failure 关系结束
+// 必须作为最后一个选项，包装调用方已经设置的 onEnd 和 onAllNodeCompleted 回调
+func withOnCompleted(onCompleted func(failed bool)) types.RuleContextOption {
+	return func(rc types.RuleContext) {
+		ctx, ok := rc.(*DefaultRuleContext)
+		if !ok {
+			return
+		}
+		var failed int32
+		onEnd := ctx.onEnd
+		ctx.onEnd = func(ruleCtx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+			if err != nil || relationType == types.Failure {
+				atomic.StoreInt32(&failed, 1)
+			}
+			if onEnd != nil {
+				onEnd(ruleCtx, msg, err, relationType)
+			}
+		}
+		onAllNodeCompleted := ctx.onAllNodeCompleted
+		ctx.onAllNodeCompleted = func() {
+			if onAllNodeCompleted != nil {
+				onAllNodeCompleted()
+			}
+			onCompleted(atomic.LoadInt32(&failed) == 1)
+		}
+	}
+}
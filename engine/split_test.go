@@ -0,0 +1,211 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test/assert"
+)
+
+// splitChain 测试版本的规则链，把版本写入元数据，fail=true 则处理失败
+func splitChain(id, version string, fail bool) []byte {
+	script := fmt.Sprintf("metadata['version']='%s';return {'msg':msg,'metadata':metadata,'msgType':msgType};", version)
+	if fail {
+		script = "throw 'canary error';"
+	}
+	return []byte(fmt.Sprintf(`{
+	  "ruleChain": {"id": "%s"},
+	  "metadata": {
+		"nodes": [
+		  {"id": "s1", "type": "jsTransform", "configuration": {"jsScript": "%s"}}
+		]
+	  }
+	}`, id, script))
+}
+
+func splitOnMsg(ruleEngine types.RuleEngine, deviceId string) (string, error) {
+	metadata := types.NewMetadata()
+	if deviceId != "" {
+		metadata.PutValue("deviceId", deviceId)
+	}
+	var version string
+	var resultErr error
+	ruleEngine.OnMsgAndWait(types.NewMsg(0, "TEST", types.JSON, metadata, "{}"), types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+		version = msg.Metadata.GetValue("version")
+		resultErr = err
+	}))
+	return version, resultErr
+}
+
+func TestSplit(t *testing.T) {
+	pool := NewPool()
+	defer pool.Stop()
+	_, err := pool.New("test_split", splitChain("test_split", "v1", false))
+	assert.Nil(t, err)
+	_, err = pool.New("test_split_v2", splitChain("test_split_v2", "v2", false))
+	assert.Nil(t, err)
+
+	//逻辑规则链ID和稳定版本ID相同
+	err = pool.SetSplit("test_split", SplitConfig{Routes: []SplitRoute{
+		{ChainId: "test_split", Weight: 80},
+		{ChainId: "test_split_v2", Weight: 20},
+	}})
+	assert.Nil(t, err)
+	ruleEngine, ok := pool.Get("test_split")
+	assert.True(t, ok)
+	assert.Equal(t, "test_split", ruleEngine.Id())
+	_, ok = ruleEngine.(*SplitEngine)
+	assert.True(t, ok)
+
+	counts := make(map[string]int)
+	for i := 0; i < 500; i++ {
+		version, err := splitOnMsg(ruleEngine, "")
+		assert.Nil(t, err)
+		counts[version]++
+	}
+	assert.Equal(t, 500, counts["v1"]+counts["v2"])
+	assert.True(t, counts["v1"] > 300)
+	assert.True(t, counts["v2"] > 50)
+
+	split, _ := pool.GetSplit("test_split")
+	metrics := split.Metrics()
+	assert.Equal(t, 2, len(metrics))
+	assert.Equal(t, int64(counts["v1"]), metrics[0].Requests)
+	assert.Equal(t, int64(counts["v2"]), metrics[1].Completed)
+	assert.Equal(t, int64(0), metrics[1].Failures)
+
+	//删除拆分后恢复原来的规则链
+	pool.DelSplit("test_split")
+	ruleEngine, _ = pool.Get("test_split")
+	_, ok = ruleEngine.(*RuleEngine)
+	assert.True(t, ok)
+}
+
+func TestSplitSticky(t *testing.T) {
+	pool := NewPool()
+	defer pool.Stop()
+	_, _ = pool.New("test_split_v1", splitChain("test_split_v1", "v1", false))
+	_, _ = pool.New("test_split_v2", splitChain("test_split_v2", "v2", false))
+	err := pool.SetSplit("test_sticky", SplitConfig{
+		StickyKey: "deviceId",
+		Routes: []SplitRoute{
+			{ChainId: "test_split_v1", Weight: 50},
+			{ChainId: "test_split_v2", Weight: 50},
+		},
+	})
+	assert.Nil(t, err)
+	ruleEngine, _ := pool.Get("test_sticky")
+
+	//相同设备总是发送到同一个版本
+	versions := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		deviceId := fmt.Sprintf("device%d", i)
+		first, _ := splitOnMsg(ruleEngine, deviceId)
+		versions[first] = true
+		for j := 0; j < 5; j++ {
+			version, _ := splitOnMsg(ruleEngine, deviceId)
+			assert.Equal(t, first, version)
+		}
+	}
+	assert.Equal(t, 2, len(versions))
+}
+
+func TestSplitAutoRollback(t *testing.T) {
+	pool := NewPool()
+	defer pool.Stop()
+	_, _ = pool.New("test_split_v1", splitChain("test_split_v1", "v1", false))
+	_, _ = pool.New("test_split_v2", splitChain("test_split_v2", "v2", true))
+
+	var rollbackCount int32
+	var rollbackMetrics RouteMetrics
+	err := pool.SetSplit("test_canary", SplitConfig{
+		Routes: []SplitRoute{
+			{ChainId: "test_split_v1", Weight: 50},
+			{ChainId: "test_split_v2", Weight: 50},
+		},
+		Rollback: &RollbackPolicy{
+			FailureRate: 0.5,
+			MinRequests: 5,
+			OnRollback: func(id string, metrics RouteMetrics) {
+				assert.Equal(t, "test_canary", id)
+				rollbackMetrics = metrics
+				atomic.AddInt32(&rollbackCount, 1)
+			},
+		},
+	})
+	assert.Nil(t, err)
+	ruleEngine, _ := pool.Get("test_canary")
+	split := ruleEngine.(*SplitEngine)
+
+	for i := 0; i < 200 && !split.RolledBack(); i++ {
+		_, _ = splitOnMsg(ruleEngine, "")
+	}
+	assert.True(t, split.RolledBack())
+	assert.Equal(t, int32(1), atomic.LoadInt32(&rollbackCount))
+	assert.Equal(t, "test_split_v2", rollbackMetrics.ChainId)
+	assert.Equal(t, int64(5), rollbackMetrics.Completed)
+	assert.Equal(t, float64(1), rollbackMetrics.FailureRate())
+
+	//回滚后所有流量发送到稳定版本
+	for i := 0; i < 20; i++ {
+		version, err := splitOnMsg(ruleEngine, "")
+		assert.Nil(t, err)
+		assert.Equal(t, "v1", version)
+	}
+	assert.Equal(t, 0, split.Metrics()[1].Weight)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&rollbackCount))
+}
+
+func TestSplitSubChain(t *testing.T) {
+	pool := NewPool()
+	defer pool.Stop()
+	_, _ = pool.New("test_split_v1", splitChain("test_split_v1", "v1", false))
+	_, _ = pool.New("test_split_v2", splitChain("test_split_v2", "v2", false))
+	assert.Nil(t, pool.SetSplit("test_sub", SplitConfig{Routes: []SplitRoute{
+		{ChainId: "test_split_v1", Weight: 0},
+		{ChainId: "test_split_v2", Weight: 100},
+	}}))
+	ruleEngine, err := pool.New("test_split_main", []byte(`{
+	  "ruleChain": {"id": "test_split_main"},
+	  "metadata": {
+		"nodes": [
+		  {"id": "s1", "type": "flow", "configuration": {"targetId": "test_sub"}}
+		]
+	  }
+	}`))
+	assert.Nil(t, err)
+	version, err := splitOnMsg(ruleEngine, "")
+	assert.Nil(t, err)
+	assert.Equal(t, "v2", version)
+}
+
+func TestSplitError(t *testing.T) {
+	pool := NewPool()
+	defer pool.Stop()
+	_, _ = pool.New("test_split_v1", splitChain("test_split_v1", "v1", false))
+	assert.NotNil(t, pool.SetSplit("", SplitConfig{Routes: []SplitRoute{{ChainId: "test_split_v1", Weight: 1}}}))
+	assert.NotNil(t, pool.SetSplit("test", SplitConfig{}))
+	assert.NotNil(t, pool.SetSplit("test", SplitConfig{Routes: []SplitRoute{{ChainId: "test_split_v1", Weight: 0}}}))
+	assert.NotNil(t, pool.SetSplit("test", SplitConfig{Routes: []SplitRoute{{ChainId: "test_split_v1", Weight: -1}}}))
+	err := pool.SetSplit("test", SplitConfig{Routes: []SplitRoute{{ChainId: "notFound", Weight: 1}}})
+	assert.True(t, errors.Is(err, ErrChainNotFound))
+}
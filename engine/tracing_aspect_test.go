@@ -0,0 +1,139 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/builtin/aspect"
+	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/utils/trace"
+)
+
+var tracingSubChain = `{
+  "ruleChain": {"id": "testTracingSub"},
+  "metadata": {
+    "nodes": [
+      {"id": "sub1", "type": "jsTransform", "configuration": {"jsScript": "return {'msg':msg,'metadata':metadata,'msgType':msgType};"}}
+    ]
+  }
+}`
+
+var tracingChain = `{
+  "ruleChain": {"id": "testTracing"},
+  "metadata": {
+    "nodes": [
+      {"id": "s1", "type": "jsTransform", "configuration": {"jsScript": "return {'msg':msg,'metadata':metadata,'msgType':msgType};"}},
+      {"id": "s2", "type": "restApiCall", "configuration": {"restEndpointUrlPattern": "${metadata.url}", "requestMethod": "POST"}},
+      {"id": "s3", "type": "flow", "configuration": {"targetId": "testTracingSub"}}
+    ],
+    "connections": [
+      {"fromId": "s1", "toId": "s2", "type": "Success"},
+      {"fromId": "s2", "toId": "s3", "type": "Success"}
+    ]
+  }
+}`
+
+func TestTracingAspect(t *testing.T) {
+	var lock sync.Mutex
+	var spans []trace.OtlpSpan
+	//OTLP/HTTP 接收服务
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/traces", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		body, _ := io.ReadAll(r.Body)
+		items, err := trace.ParseOtlpRequest(body)
+		assert.Nil(t, err)
+		lock.Lock()
+		spans = append(spans, items...)
+		lock.Unlock()
+	}))
+	defer collector.Close()
+
+	//下游服务
+	var downstreamTraceParent string
+	downstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		downstreamTraceParent = r.Header.Get(trace.TraceParentKey)
+		lock.Unlock()
+		_, _ = w.Write([]byte("{}"))
+	}))
+	defer downstream.Close()
+
+	exporter := trace.NewOtlpHttpExporter(collector.URL)
+	config := NewConfig(types.WithDefaultPool())
+	_, err := New("testTracingSub", []byte(tracingSubChain), WithConfig(config), types.WithAspects(aspect.NewTracingAspect(exporter)))
+	assert.Nil(t, err)
+	defer Del("testTracingSub")
+	ruleEngine, err := New("testTracing", []byte(tracingChain), WithConfig(config), types.WithAspects(aspect.NewTracingAspect(exporter)))
+	assert.Nil(t, err)
+	defer Del("testTracing")
+
+	incoming := trace.SpanContext{TraceId: trace.NewTraceId(), SpanId: trace.NewSpanId(), Sampled: true}
+	metaData := types.NewMetadata()
+	metaData.PutValue("url", downstream.URL)
+	metaData.PutValue(trace.TraceParentKey, incoming.TraceParent())
+	msg := types.NewMsg(0, "TEST_MSG_TYPE1", types.JSON, metaData, "{\"temperature\":41}")
+	ruleEngine.OnMsgAndWait(msg)
+	//调用方元数据不被修改
+	assert.Equal(t, incoming.TraceParent(), metaData.GetValue(trace.TraceParentKey))
+
+	//等待异步导出
+	var byName = make(map[string]trace.OtlpSpan)
+	for i := 0; i < 50; i++ {
+		lock.Lock()
+		count := len(spans)
+		lock.Unlock()
+		if count >= 6 {
+			break
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	assert.Equal(t, 6, len(spans))
+	for _, span := range spans {
+		byName[span.Name] = span
+		assert.Equal(t, incoming.TraceId, span.TraceId)
+		assert.True(t, span.EndTimeUnixNano != "0")
+	}
+	chainSpan := byName["testTracing"]
+	assert.Equal(t, incoming.SpanId, chainSpan.ParentSpanId)
+	assert.Equal(t, "testTracing", chainSpan.Attribute(aspect.AttrChainId))
+	for _, nodeId := range []string{"s1", "s2", "s3"} {
+		assert.Equal(t, chainSpan.SpanId, byName[nodeId].ParentSpanId)
+		assert.Equal(t, nodeId, byName[nodeId].Attribute(aspect.AttrNodeId))
+		assert.Equal(t, types.Success, byName[nodeId].Attribute(aspect.AttrRelationType))
+	}
+	assert.Equal(t, "restApiCall", byName["s2"].Attribute(aspect.AttrNodeType))
+	//restApiCall 把节点span传递给下游服务
+	sc, ok := trace.ParseTraceParent(downstreamTraceParent)
+	assert.True(t, ok)
+	assert.Equal(t, byName["s2"].SpanId, sc.SpanId)
+	//子规则链span是flow节点span的子span
+	subChainSpan := byName["testTracingSub"]
+	assert.Equal(t, byName["s3"].SpanId, subChainSpan.ParentSpanId)
+	assert.Equal(t, subChainSpan.SpanId, byName["sub1"].ParentSpanId)
+	assert.Equal(t, 1, len(chainSpan.Events))
+	assert.Equal(t, aspect.EventBranchEnd, chainSpan.Events[0].Name)
+}
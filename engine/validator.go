@@ -0,0 +1,552 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+)
+
+// Severity is the severity of a validation diagnostic.
+type Severity string
+
+const (
+	// SeverityError means the rule chain can not be loaded or will not work as defined.
+	SeverityError Severity = "error"
+	// SeverityWarning means the rule chain can be loaded but is probably defined incorrectly.
+	SeverityWarning Severity = "warning"
+)
+
+// Diagnostic codes reported by Validate.
+const (
+	CodeDuplicateNodeId      = "duplicate_node_id"
+	CodeEmptyNodeId          = "empty_node_id"
+	CodeEmptyNodeType        = "empty_node_type"
+	CodeComponentNotFound    = "component_not_found"
+	CodeFirstNodeIndex       = "first_node_index_out_of_range"
+	CodeNodeNotFound         = "node_not_found"
+	CodeEmptyRelationType    = "empty_relation_type"
+	CodeUnknownRelationType  = "unknown_relation_type"
+	CodeUnreachableNode      = "unreachable_node"
+	CodeCycle                = "cycle"
+	CodeRequiredField        = "required_field"
+	CodeInvalidFieldType     = "invalid_field_type"
+	CodeDuplicateConnection  = "duplicate_connection"
+	CodeSubChainNotSpecified = "sub_chain_not_specified"
+)
+
+// loopBreakerNodeTypes are the component types that make a cycle in the rule chain safe,
+// because they either iterate a bounded number of times or delay the message.
+var loopBreakerNodeTypes = map[string]bool{
+	"for":   true,
+	"delay": true,
+}
+
+// Diagnostic is a problem found in a rule chain definition.
+type Diagnostic struct {
+	// Severity is the severity of the problem.
+	Severity Severity `json:"severity"`
+	// Code is a stable identifier of the kind of problem.
+	Code string `json:"code"`
+	// NodeId is the ID of the node the problem relates to, if any.
+	NodeId string `json:"nodeId,omitempty"`
+	// Path is the JSON path of the definition element with the problem, e.g. $.metadata.nodes[0].configuration.jsScript
+	Path string `json:"path"`
+	// Message is a human-readable description of the problem.
+	Message string `json:"message"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s (%s)", d.Severity, d.Message, d.Path)
+}
+
+// Diagnostics is a list of validation diagnostics.
+type Diagnostics []Diagnostic
+
+// HasError returns true if any of the diagnostics is an error.
+func (list Diagnostics) HasError() bool {
+	for _, item := range list {
+		if item.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// Errors returns only the diagnostics with error severity.
+func (list Diagnostics) Errors() Diagnostics {
+	var result Diagnostics
+	for _, item := range list {
+		if item.Severity == SeverityError {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// ValidationError is returned when a rule chain definition has validation errors.
+type ValidationError struct {
+	Diagnostics Diagnostics
+}
+
+func (e *ValidationError) Error() string {
+	var messages []string
+	for _, item := range e.Diagnostics.Errors() {
+		messages = append(messages, item.String())
+	}
+	return "invalid rule chain: " + strings.Join(messages, "; ")
+}
+
+// Validate statically checks a rule chain definition and reports all problems found at once, without initializing any node.
+// It checks:
+//   - node IDs are unique and node types are registered in the registry
+//   - firstNodeIndex points to an existing node
+//   - connections reference existing nodes and use relation types the source component can emit
+//   - all nodes are reachable from the first node
+//   - cycles contain a node that breaks the loop, such as `for` or `delay`
+//   - node configurations match the fields of the component, including `validate:"required"` rules
+//
+// If registry is nil, the default registry is used.
+func Validate(def types.RuleChain, registry types.ComponentRegistry) Diagnostics {
+	if registry == nil {
+		registry = Registry
+	}
+	v := &validator{
+		def:        def,
+		forms:      registry.GetComponentForms(),
+		nodeIndex:  make(map[string]int),
+		components: registry.GetComponents(),
+	}
+	v.validate()
+	return v.diagnostics
+}
+
+// validator holds the state of a single validation run.
+type validator struct {
+	def         types.RuleChain
+	forms       types.ComponentFormList
+	components  map[string]types.Node
+	nodeIndex   map[string]int
+	edges       map[string][]string
+	diagnostics Diagnostics
+}
+
+func (v *validator) add(severity Severity, code, nodeId, path, format string, args ...interface{}) {
+	v.diagnostics = append(v.diagnostics, Diagnostic{
+		Severity: severity,
+		Code:     code,
+		NodeId:   nodeId,
+		Path:     path,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) validate() {
+	v.validateNodes()
+	v.validateFirstNodeIndex()
+	v.validateConnections()
+	v.validateReachability()
+	v.validateCycles()
+}
+
+func (v *validator) validateNodes() {
+	for index, node := range v.def.Metadata.Nodes {
+		path := fmt.Sprintf("$.metadata.nodes[%d]", index)
+		if node == nil {
+			v.add(SeverityError, CodeEmptyNodeType, "", path, "node is null")
+			continue
+		}
+		if node.Id == "" {
+			if len(v.def.Metadata.Nodes) > 1 {
+				v.add(SeverityWarning, CodeEmptyNodeId, "", path+".id", "node id is empty, it can not be referenced by connections")
+			}
+		} else if firstIndex, ok := v.nodeIndex[node.Id]; ok {
+			v.add(SeverityError, CodeDuplicateNodeId, node.Id, path+".id", "node id=%s is duplicated with $.metadata.nodes[%d]", node.Id, firstIndex)
+		} else {
+			v.nodeIndex[node.Id] = index
+		}
+		if node.Type == "" {
+			v.add(SeverityError, CodeEmptyNodeType, node.Id, path+".type", "node type is empty")
+			continue
+		}
+		if _, ok := v.components[node.Type]; !ok {
+			v.add(SeverityError, CodeComponentNotFound, node.Id, path+".type", "component not found. componentType=%s", node.Type)
+			continue
+		}
+		if form, ok := v.forms[node.Type]; ok {
+			v.validateFields(node.Id, path+".configuration", form.Fields, node.Configuration)
+		}
+	}
+}
+
+func (v *validator) validateFirstNodeIndex() {
+	index := v.def.Metadata.FirstNodeIndex
+	nodeLen := len(v.def.Metadata.Nodes)
+	if nodeLen == 0 && index == 0 {
+		return
+	}
+	if index < 0 || index >= nodeLen {
+		v.add(SeverityError, CodeFirstNodeIndex, "", "$.metadata.firstNodeIndex", "firstNodeIndex=%d is out of range, the rule chain has %d nodes", index, nodeLen)
+	}
+}
+
+func (v *validator) validateConnections() {
+	v.edges = make(map[string][]string)
+	type connectionKey struct {
+		fromId, toId, relationType string
+	}
+	connections := make(map[connectionKey]int)
+	for index, conn := range v.def.Metadata.Connections {
+		path := fmt.Sprintf("$.metadata.connections[%d]", index)
+		_, fromOk := v.nodeIndex[conn.FromId]
+		_, toOk := v.nodeIndex[conn.ToId]
+		if !fromOk {
+			v.add(SeverityError, CodeNodeNotFound, conn.FromId, path+".fromId", "connection source node id=%s not found", conn.FromId)
+		}
+		if !toOk {
+			v.add(SeverityError, CodeNodeNotFound, conn.ToId, path+".toId", "connection target node id=%s not found", conn.ToId)
+		}
+		if conn.Type == "" {
+			v.add(SeverityError, CodeEmptyRelationType, conn.FromId, path+".type", "connection relation type is empty")
+		} else if fromOk {
+			v.validateRelationType(conn.FromId, path+".type", conn.Type)
+		}
+		key := connectionKey{fromId: conn.FromId, toId: conn.ToId, relationType: conn.Type}
+		if firstIndex, ok := connections[key]; ok {
+			v.add(SeverityWarning, CodeDuplicateConnection, conn.FromId, path, "connection is duplicated with $.metadata.connections[%d], the target node will be executed twice", firstIndex)
+		} else {
+			connections[key] = index
+		}
+		if fromOk && toOk {
+			v.edges[conn.FromId] = append(v.edges[conn.FromId], conn.ToId)
+		}
+	}
+	for index, conn := range v.def.Metadata.RuleChainConnections {
+		path := fmt.Sprintf("$.metadata.ruleChainConnections[%d]", index)
+		if _, ok := v.nodeIndex[conn.FromId]; !ok {
+			v.add(SeverityError, CodeNodeNotFound, conn.FromId, path+".fromId", "connection source node id=%s not found", conn.FromId)
+		}
+		if conn.ToId == "" {
+			v.add(SeverityError, CodeSubChainNotSpecified, conn.FromId, path+".toId", "sub rule chain id is empty")
+		}
+		if conn.Type == "" {
+			v.add(SeverityError, CodeEmptyRelationType, conn.FromId, path+".type", "connection relation type is empty")
+		}
+	}
+}
+
+// validateRelationType checks the relation type against the relation types declared by the source component.
+// An empty declared list means the component allows custom relation types.
+func (v *validator) validateRelationType(fromId, path, relationType string) {
+	node := v.def.Metadata.Nodes[v.nodeIndex[fromId]]
+	form, ok := v.forms[node.Type]
+	if !ok || form.RelationTypes == nil || len(*form.RelationTypes) == 0 {
+		return
+	}
+	for _, item := range *form.RelationTypes {
+		if item == relationType {
+			return
+		}
+	}
+	v.add(SeverityWarning, CodeUnknownRelationType, fromId, path, "component %s never emits relation type %s, expected one of %s",
+		node.Type, relationType, strings.Join(*form.RelationTypes, ","))
+}
+
+// referencedNodeIds returns the node IDs referenced by configuration values of the node,
+// such as the `do` node of the for component or the `nodeIds` of group components,
+// which are executed through RuleContext.TellNode instead of connections.
+func (v *validator) referencedNodeIds(node *types.RuleNode) []string {
+	var ids []string
+	var collect func(value interface{})
+	collect = func(value interface{}) {
+		switch item := value.(type) {
+		case string:
+			for _, id := range strings.Split(item, ",") {
+				id = strings.TrimSpace(id)
+				if _, ok := v.nodeIndex[id]; ok && id != node.Id {
+					ids = append(ids, id)
+				}
+			}
+		case []interface{}:
+			for _, sub := range item {
+				collect(sub)
+			}
+		case []string:
+			for _, sub := range item {
+				collect(sub)
+			}
+		}
+	}
+	for _, value := range node.Configuration {
+		collect(value)
+	}
+	return ids
+}
+
+func (v *validator) validateReachability() {
+	nodes := v.def.Metadata.Nodes
+	firstIndex := v.def.Metadata.FirstNodeIndex
+	if firstIndex < 0 || firstIndex >= len(nodes) || nodes[firstIndex] == nil {
+		return
+	}
+	visited := make(map[string]bool)
+	queue := []string{nodes[firstIndex].Id}
+	visited[nodes[firstIndex].Id] = true
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		next := append([]string{}, v.edges[id]...)
+		if index, ok := v.nodeIndex[id]; ok {
+			next = append(next, v.referencedNodeIds(nodes[index])...)
+		}
+		for _, nextId := range next {
+			if !visited[nextId] {
+				visited[nextId] = true
+				queue = append(queue, nextId)
+			}
+		}
+	}
+	for index, node := range nodes {
+		if node == nil || node.Id == "" || visited[node.Id] {
+			continue
+		}
+		v.add(SeverityWarning, CodeUnreachableNode, node.Id, fmt.Sprintf("$.metadata.nodes[%d]", index), "node id=%s is not reachable from the first node", node.Id)
+	}
+}
+
+// validateCycles finds the strongly connected components of the connection graph (Tarjan's algorithm)
+// and reports each cycle that does not contain a loop breaker node.
+func (v *validator) validateCycles() {
+	var (
+		index   int
+		stack   []string
+		onStack = make(map[string]bool)
+		indexes = make(map[string]int)
+		lowLink = make(map[string]int)
+		visit   func(id string)
+	)
+	visit = func(id string) {
+		indexes[id] = index
+		lowLink[id] = index
+		index++
+		stack = append(stack, id)
+		onStack[id] = true
+		for _, next := range v.edges[id] {
+			if _, ok := indexes[next]; !ok {
+				visit(next)
+				if lowLink[next] < lowLink[id] {
+					lowLink[id] = lowLink[next]
+				}
+			} else if onStack[next] && indexes[next] < lowLink[id] {
+				lowLink[id] = indexes[next]
+			}
+		}
+		if lowLink[id] == indexes[id] {
+			var component []string
+			for {
+				last := stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+				onStack[last] = false
+				component = append(component, last)
+				if last == id {
+					break
+				}
+			}
+			v.checkCycle(component)
+		}
+	}
+	// Visit in definition order to produce stable results
+	for _, node := range v.def.Metadata.Nodes {
+		if node == nil {
+			continue
+		}
+		if _, ok := indexes[node.Id]; !ok {
+			if _, exists := v.nodeIndex[node.Id]; exists {
+				visit(node.Id)
+			}
+		}
+	}
+}
+
+func (v *validator) checkCycle(component []string) {
+	if len(component) == 1 {
+		selfLoop := false
+		for _, next := range v.edges[component[0]] {
+			if next == component[0] {
+				selfLoop = true
+				break
+			}
+		}
+		if !selfLoop {
+			return
+		}
+	}
+	for _, id := range component {
+		if loopBreakerNodeTypes[v.def.Metadata.Nodes[v.nodeIndex[id]].Type] {
+			return
+		}
+	}
+	sort.Slice(component, func(i, j int) bool {
+		return v.nodeIndex[component[i]] < v.nodeIndex[component[j]]
+	})
+	first := component[0]
+	v.add(SeverityWarning, CodeCycle, first, fmt.Sprintf("$.metadata.nodes[%d]", v.nodeIndex[first]),
+		"nodes [%s] form a cycle without a for or delay node, the message may loop forever", strings.Join(component, ","))
+}
+
+// validateFields checks the configuration against the reflected component form fields.
+func (v *validator) validateFields(nodeId, path string, fields types.ComponentFormFieldList, configuration map[string]interface{}) {
+	for _, field := range fields {
+		fieldPath := path + "." + field.Name
+		value, ok := lookupField(configuration, field.Name)
+		if isRequired(field.Validate) && (!ok || isEmptyValue(value)) {
+			v.add(SeverityError, CodeRequiredField, nodeId, fieldPath, "field %s is required", field.Name)
+			continue
+		}
+		if !ok || value == nil {
+			continue
+		}
+		if !isCompatibleType(field.Type, value) {
+			v.add(SeverityError, CodeInvalidFieldType, nodeId, fieldPath, "field %s expects type %s, got %v", field.Name, field.Type, value)
+			continue
+		}
+		if field.Type == "struct" && len(field.Fields) > 0 {
+			if sub, ok := toStringMap(value); ok {
+				v.validateFields(nodeId, fieldPath, field.Fields, sub)
+			}
+		}
+	}
+}
+
+// lookupField finds the configuration value of a field, matching names case-insensitively as mapstructure does.
+func lookupField(configuration map[string]interface{}, name string) (interface{}, bool) {
+	if value, ok := configuration[name]; ok {
+		return value, true
+	}
+	for key, value := range configuration {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
+func isRequired(validate string) bool {
+	for _, rule := range strings.Split(validate, ",") {
+		if strings.TrimSpace(rule) == "required" {
+			return true
+		}
+	}
+	return false
+}
+
+func isEmptyValue(value interface{}) bool {
+	switch item := value.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(item) == ""
+	case []interface{}:
+		return len(item) == 0
+	case map[string]interface{}:
+		return len(item) == 0
+	}
+	return false
+}
+
+func toStringMap(value interface{}) (map[string]interface{}, bool) {
+	switch item := value.(type) {
+	case map[string]interface{}:
+		return item, true
+	case types.Configuration:
+		return item, true
+	}
+	return nil, false
+}
+
+// isCompatibleType reports whether the configuration value can be decoded into the field type.
+// Decoding is weakly typed (see maps.Map2Struct), so strings holding numbers or booleans are accepted,
+// as are values with variable placeholders like ${vars.xx}, which are replaced before the node is initialized.
+func isCompatibleType(fieldType string, value interface{}) bool {
+	if s, ok := value.(string); ok && strings.Contains(s, "${") {
+		return true
+	}
+	switch fieldType {
+	case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64":
+		switch item := value.(type) {
+		case string:
+			_, err := strconv.ParseFloat(strings.TrimSpace(item), 64)
+			return err == nil || strings.TrimSpace(item) == ""
+		case bool:
+			return true
+		}
+		return isNumber(value)
+	case "float32", "float64":
+		if s, ok := value.(string); ok {
+			_, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+			return err == nil || strings.TrimSpace(s) == ""
+		}
+		return isNumber(value)
+	case "bool":
+		switch item := value.(type) {
+		case bool:
+			return true
+		case string:
+			_, err := strconv.ParseBool(item)
+			return err == nil || item == ""
+		}
+		return isNumber(value)
+	case "string":
+		switch value.(type) {
+		case map[string]interface{}, []interface{}:
+			return false
+		}
+		return true
+	case "Duration":
+		if s, ok := value.(string); ok {
+			_, err := time.ParseDuration(s)
+			return err == nil || s == ""
+		}
+		return isNumber(value)
+	case "map", "struct":
+		if _, ok := toStringMap(value); ok {
+			return true
+		}
+		_, ok := value.(map[string]string)
+		return ok
+	case "array":
+		switch value.(type) {
+		case map[string]interface{}:
+			return false
+		}
+		return true
+	}
+	return true
+}
+
+func isNumber(value interface{}) bool {
+	switch value.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return true
+	}
+	return false
+}
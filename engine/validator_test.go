@@ -0,0 +1,212 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test/assert"
+)
+
+var invalidChainFile = `{
+  "ruleChain": {
+    "id": "test_validate"
+  },
+  "metadata": {
+    "firstNodeIndex": 0,
+    "nodes": [
+      {
+        "id": "s1",
+        "type": "jsFilter",
+        "configuration": {
+          "jsScript": "return msg.temperature>10;"
+        }
+      },
+      {
+        "id": "s2",
+        "type": "jsTransform",
+        "configuration": {
+          "jsScript": "return {'msg':msg,'metadata':metadata,'msgType':msgType};"
+        }
+      },
+      {
+        "id": "s2",
+        "type": "notFoundType"
+      },
+      {
+        "id": "s3",
+        "type": "log",
+        "configuration": {
+          "jsScript": {"a": 1}
+        }
+      },
+      {
+        "id": "s4",
+        "type": "delay",
+        "configuration": {
+          "periodInSeconds": "abc",
+          "maxPendingMsgs": "${vars.max}"
+        }
+      },
+      {
+        "id": "s5",
+        "type": "test/validate"
+      }
+    ],
+    "connections": [
+      {
+        "fromId": "s1",
+        "toId": "s2",
+        "type": "True"
+      },
+      {
+        "fromId": "s1",
+        "toId": "s9",
+        "type": "False"
+      },
+      {
+        "fromId": "s2",
+        "toId": "s1",
+        "type": "Success"
+      },
+      {
+        "fromId": "s2",
+        "toId": "s3",
+        "type": "Done"
+      },
+      {
+        "fromId": "s2",
+        "toId": "s3",
+        "type": ""
+      }
+    ]
+  }
+}`
+
+// validateNode 用于测试必填字段
+type validateNode struct {
+	Config validateNodeConfiguration
+}
+
+type validateNodeConfiguration struct {
+	Server string `label:"服务器地址" validate:"required"`
+	Port   int
+}
+
+func (n *validateNode) Type() string {
+	return "test/validate"
+}
+func (n *validateNode) New() types.Node {
+	return &validateNode{}
+}
+func (n *validateNode) Init(ruleConfig types.Config, configuration types.Configuration) error {
+	return nil
+}
+func (n *validateNode) OnMsg(ctx types.RuleContext, msg types.RuleMsg) {
+	ctx.TellSuccess(msg)
+}
+func (n *validateNode) Destroy() {
+}
+
+func TestValidate(t *testing.T) {
+	registry := new(RuleComponentRegistry)
+	for _, node := range Registry.GetComponents() {
+		_ = registry.Register(node)
+	}
+	_ = registry.Register(&validateNode{})
+
+	def, err := (&JsonParser{}).DecodeRuleChain([]byte(invalidChainFile))
+	assert.Nil(t, err)
+	diagnostics := Validate(def, registry)
+
+	find := func(code, path string) (Diagnostic, bool) {
+		for _, item := range diagnostics {
+			if item.Code == code && item.Path == path {
+				return item, true
+			}
+		}
+		return Diagnostic{}, false
+	}
+	assertFound := func(code, path string, severity Severity) {
+		item, ok := find(code, path)
+		if !ok {
+			t.Errorf("diagnostic code=%s path=%s not found in %v", code, path, diagnostics)
+			return
+		}
+		assert.Equal(t, severity, item.Severity)
+	}
+
+	assertFound(CodeDuplicateNodeId, "$.metadata.nodes[2].id", SeverityError)
+	assertFound(CodeComponentNotFound, "$.metadata.nodes[2].type", SeverityError)
+	assertFound(CodeInvalidFieldType, "$.metadata.nodes[3].configuration.jsScript", SeverityError)
+	assertFound(CodeInvalidFieldType, "$.metadata.nodes[4].configuration.periodInSeconds", SeverityError)
+	assertFound(CodeRequiredField, "$.metadata.nodes[5].configuration.server", SeverityError)
+	assertFound(CodeNodeNotFound, "$.metadata.connections[1].toId", SeverityError)
+	assertFound(CodeUnknownRelationType, "$.metadata.connections[3].type", SeverityWarning)
+	assertFound(CodeEmptyRelationType, "$.metadata.connections[4].type", SeverityError)
+	assertFound(CodeCycle, "$.metadata.nodes[0]", SeverityWarning)
+	assertFound(CodeUnreachableNode, "$.metadata.nodes[4]", SeverityWarning)
+	assertFound(CodeUnreachableNode, "$.metadata.nodes[5]", SeverityWarning)
+	//变量占位符不校验类型
+	_, ok := find(CodeInvalidFieldType, "$.metadata.nodes[4].configuration.maxPendingMsgs")
+	assert.False(t, ok)
+	//s3 通过s2可达
+	_, ok = find(CodeUnreachableNode, "$.metadata.nodes[3]")
+	assert.False(t, ok)
+
+	item, _ := find(CodeCycle, "$.metadata.nodes[0]")
+	assert.Equal(t, "s1", item.NodeId)
+	assert.True(t, diagnostics.HasError())
+
+	var validationErr error = &ValidationError{Diagnostics: diagnostics}
+	var target *ValidationError
+	assert.True(t, errors.As(validationErr, &target))
+	assert.Equal(t, len(diagnostics.Errors()), len(target.Diagnostics.Errors()))
+
+	//firstNodeIndex 越界
+	def.Metadata.FirstNodeIndex = 10
+	diagnostics = Validate(def, registry)
+	assertFound(CodeFirstNodeIndex, "$.metadata.firstNodeIndex", SeverityError)
+}
+
+func TestValidateValidChain(t *testing.T) {
+	def, err := (&JsonParser{}).DecodeRuleChain([]byte(ruleChainFile))
+	assert.Nil(t, err)
+	diagnostics := Validate(def, nil)
+	assert.Equal(t, 0, len(diagnostics))
+
+	//for 节点打破循环，do 引用的节点可达
+	def, err = (&JsonParser{}).DecodeRuleChain([]byte(`{
+	  "ruleChain": {"id": "test_validate_for"},
+	  "metadata": {
+		"nodes": [
+		  {"id": "s1", "type": "for", "configuration": {"range": "1..3", "do": "s3"}},
+		  {"id": "s2", "type": "jsTransform", "configuration": {"jsScript": "return {'msg':msg,'metadata':metadata,'msgType':msgType};"}},
+		  {"id": "s3", "type": "jsTransform", "configuration": {"jsScript": "return {'msg':msg,'metadata':metadata,'msgType':msgType};"}}
+		],
+		"connections": [
+		  {"fromId": "s1", "toId": "s2", "type": "Success"},
+		  {"fromId": "s2", "toId": "s1", "type": "Success"}
+		]
+	  }
+	}`))
+	assert.Nil(t, err)
+	diagnostics = Validate(def, nil)
+	assert.Equal(t, 0, len(diagnostics))
+}
@@ -0,0 +1,265 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/utils/json"
+	"github.com/rulego/rulego/utils/str"
+)
+
+// DefaultMaxVersions 每个规则链默认保留的历史版本数量
+const DefaultMaxVersions = 10
+
+// AuthorKey 规则链 additionalInfo 中记录修改人的字段
+const AuthorKey = "author"
+
+var (
+	// ErrChainNotFound 规则链不存在
+	ErrChainNotFound = errors.New("rule chain not found")
+	// ErrVersionNotFound 版本不存在，或者已经超出保留的历史版本数量被清除
+	ErrVersionNotFound = errors.New("rule chain version not found")
+)
+
+// ChainVersion 规则链的一个历史版本
+type ChainVersion struct {
+	// Version 版本号，每个规则链从1开始递增
+	Version int `json:"version"`
+	// Hash 规则链定义的sha256值，内容相同的版本hash相同
+	Hash string `json:"hash"`
+	// Timestamp 生效时间，毫秒
+	Timestamp int64 `json:"timestamp"`
+	// Author 修改人，取自规则链 additionalInfo.author
+	Author string `json:"author,omitempty"`
+	// DSL 规则链配置，格式和规则引擎的解析器一致
+	DSL []byte `json:"-"`
+	// definition 用于比较版本差异
+	definition types.RuleChain
+}
+
+// Definition 版本的规则链定义
+func (v ChainVersion) Definition() types.RuleChain {
+	return v.definition
+}
+
+// NodeChange 修改的节点
+type NodeChange struct {
+	Id   string          `json:"id"`
+	From *types.RuleNode `json:"from"`
+	To   *types.RuleNode `json:"to"`
+}
+
+// ChainDiff 两个版本之间节点和连接的差异
+type ChainDiff struct {
+	// From 旧版本号
+	From int `json:"from"`
+	// To 新版本号
+	To int `json:"to"`
+	// RuleChainChanged 规则链基础信息(名称、配置等)是否有修改
+	RuleChainChanged   bool                   `json:"ruleChainChanged"`
+	AddedNodes         []*types.RuleNode      `json:"addedNodes,omitempty"`
+	RemovedNodes       []*types.RuleNode      `json:"removedNodes,omitempty"`
+	ModifiedNodes      []NodeChange           `json:"modifiedNodes,omitempty"`
+	AddedConnections   []types.NodeConnection `json:"addedConnections,omitempty"`
+	RemovedConnections []types.NodeConnection `json:"removedConnections,omitempty"`
+}
+
+// IsEmpty 两个版本是否没有差异
+func (d ChainDiff) IsEmpty() bool {
+	return !d.RuleChainChanged && len(d.AddedNodes) == 0 && len(d.RemovedNodes) == 0 && len(d.ModifiedNodes) == 0 &&
+		len(d.AddedConnections) == 0 && len(d.RemovedConnections) == 0
+}
+
+// versionHistory 一个规则链的历史版本，按版本号升序
+type versionHistory struct {
+	sync.Mutex
+	versions []ChainVersion
+	latest   int
+}
+
+// SetMaxVersions 设置每个规则链保留的历史版本数量，0 使用 DefaultMaxVersions，小于0不记录历史版本
+func (g *Pool) SetMaxVersions(max int) {
+	g.maxVersions = max
+}
+
+// Versions 获取规则链保留的历史版本，按版本号升序，最后一个是当前生效的版本
+func (g *Pool) Versions(id string) []ChainVersion {
+	v, ok := g.versions.Load(id)
+	if !ok {
+		return nil
+	}
+	history := v.(*versionHistory)
+	history.Lock()
+	defer history.Unlock()
+	return append([]ChainVersion{}, history.versions...)
+}
+
+// Version 获取规则链指定版本
+func (g *Pool) Version(id string, version int) (ChainVersion, error) {
+	for _, item := range g.Versions(id) {
+		if item.Version == version {
+			return item, nil
+		}
+	}
+	return ChainVersion{}, fmt.Errorf("%w: id=%s, version=%d", ErrVersionNotFound, id, version)
+}
+
+// Diff 比较规则链两个版本节点和连接的差异
+func (g *Pool) Diff(id string, v1, v2 int) (ChainDiff, error) {
+	from, err := g.Version(id, v1)
+	if err != nil {
+		return ChainDiff{}, err
+	}
+	to, err := g.Version(id, v2)
+	if err != nil {
+		return ChainDiff{}, err
+	}
+	diff := DiffRuleChain(from.definition, to.definition)
+	diff.From = v1
+	diff.To = v2
+	return diff, nil
+}
+
+// Rollback 把规则链回滚到指定版本，回滚会原子地重新加载规则链，加载失败则保持当前版本
+// 回滚成功后记录为一个新的版本。回滚的是该ID的规则链本身，不受流量拆分和影子执行影响
+func (g *Pool) Rollback(id string, version int) error {
+	ruleEngine, ok := g.GetEngine(id)
+	if !ok {
+		return fmt.Errorf("%w: id=%s", ErrChainNotFound, id)
+	}
+	target, err := g.Version(id, version)
+	if err != nil {
+		return err
+	}
+	return ruleEngine.ReloadSelf(target.DSL)
+}
+
+// recordVersion 记录规则引擎当前的规则链定义，内容和最新版本相同则不记录
+func (g *Pool) recordVersion(ruleEngine *RuleEngine) {
+	if g.maxVersions < 0 || ruleEngine.Id() == "" || ruleEngine.rootRuleChainCtx == nil {
+		return
+	}
+	b, err := json.Marshal(ruleEngine.Definition())
+	if err != nil {
+		return
+	}
+	//保存定义的副本，避免和规则引擎共享节点
+	var def types.RuleChain
+	if err = json.Unmarshal(b, &def); err != nil {
+		return
+	}
+	sum := sha256.Sum256(b)
+	hash := hex.EncodeToString(sum[:])
+
+	v, _ := g.versions.LoadOrStore(ruleEngine.Id(), &versionHistory{})
+	history := v.(*versionHistory)
+	history.Lock()
+	defer history.Unlock()
+	if n := len(history.versions); n > 0 && history.versions[n-1].Hash == hash {
+		return
+	}
+	history.latest++
+	version := ChainVersion{
+		Version:    history.latest,
+		Hash:       hash,
+		Timestamp:  time.Now().UnixMilli(),
+		DSL:        ruleEngine.DSL(),
+		definition: def,
+	}
+	if author, ok := def.RuleChain.GetAdditionalInfo(AuthorKey); ok {
+		version.Author = str.ToString(author)
+	}
+	history.versions = append(history.versions, version)
+	max := g.maxVersions
+	if max == 0 {
+		max = DefaultMaxVersions
+	}
+	if len(history.versions) > max {
+		history.versions = append([]ChainVersion{}, history.versions[len(history.versions)-max:]...)
+	}
+}
+
+// DiffRuleChain 比较两个规则链定义节点和连接的差异，节点通过ID匹配
+func DiffRuleChain(from, to types.RuleChain) ChainDiff {
+	var diff ChainDiff
+	diff.RuleChainChanged = !jsonEqual(from.RuleChain, to.RuleChain)
+
+	fromNodes := make(map[string]*types.RuleNode)
+	for _, node := range from.Metadata.Nodes {
+		if node != nil {
+			fromNodes[node.Id] = node
+		}
+	}
+	toNodes := make(map[string]*types.RuleNode)
+	for _, node := range to.Metadata.Nodes {
+		if node == nil {
+			continue
+		}
+		toNodes[node.Id] = node
+		if old, ok := fromNodes[node.Id]; !ok {
+			diff.AddedNodes = append(diff.AddedNodes, node)
+		} else if !jsonEqual(old, node) {
+			diff.ModifiedNodes = append(diff.ModifiedNodes, NodeChange{Id: node.Id, From: old, To: node})
+		}
+	}
+	for _, node := range from.Metadata.Nodes {
+		if node == nil {
+			continue
+		}
+		if _, ok := toNodes[node.Id]; !ok {
+			diff.RemovedNodes = append(diff.RemovedNodes, node)
+		}
+	}
+
+	fromConnections := make(map[types.NodeConnection]bool)
+	for _, item := range from.Metadata.Connections {
+		fromConnections[item] = true
+	}
+	toConnections := make(map[types.NodeConnection]bool)
+	for _, item := range to.Metadata.Connections {
+		toConnections[item] = true
+		if !fromConnections[item] {
+			diff.AddedConnections = append(diff.AddedConnections, item)
+		}
+	}
+	for _, item := range from.Metadata.Connections {
+		if !toConnections[item] {
+			diff.RemovedConnections = append(diff.RemovedConnections, item)
+		}
+	}
+	return diff
+}
+
+func jsonEqual(a, b interface{}) bool {
+	aBytes, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	bBytes, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(aBytes, bBytes)
+}
@@ -0,0 +1,199 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test/assert"
+)
+
+// versionChain 测试版本的规则链，author 和 s1 脚本按版本变化
+func versionChain(author, script string, withS2 bool) []byte {
+	s2Node, s2Connection := "", ""
+	if withS2 {
+		s2Node = `,{"id": "s2", "type": "jsTransform", "configuration": {"jsScript": "return {'msg':msg,'metadata':metadata,'msgType':msgType};"}}`
+		s2Connection = `{"fromId": "s1", "toId": "s2", "type": "Success"}`
+	}
+	return []byte(fmt.Sprintf(`{
+	  "ruleChain": {"id": "test_version", "name": "版本测试", "additionalInfo": {"author": "%s"}},
+	  "metadata": {
+		"nodes": [
+		  {"id": "s1", "type": "jsTransform", "configuration": {"jsScript": "metadata['version']='%s';return {'msg':msg,'metadata':metadata,'msgType':msgType};"}}%s
+		],
+		"connections": [%s]
+	  }
+	}`, author, script, s2Node, s2Connection))
+}
+
+func TestPoolVersions(t *testing.T) {
+	pool := NewPool()
+	defer pool.Stop()
+	ruleEngine, err := pool.New("test_version", versionChain("alice", "v1", false))
+	assert.Nil(t, err)
+
+	versions := pool.Versions("test_version")
+	assert.Equal(t, 1, len(versions))
+	assert.Equal(t, 1, versions[0].Version)
+	assert.Equal(t, "alice", versions[0].Author)
+	assert.True(t, versions[0].Timestamp > 0)
+	assert.Equal(t, 64, len(versions[0].Hash))
+
+	//内容相同不记录新版本
+	assert.Nil(t, ruleEngine.Reload())
+	assert.Equal(t, 1, len(pool.Versions("test_version")))
+
+	assert.Nil(t, ruleEngine.ReloadSelf(versionChain("bob", "v2", true)))
+	//加载失败不记录新版本
+	assert.NotNil(t, ruleEngine.ReloadSelf([]byte(`{"ruleChain": {"id": "test_version"},"metadata": {"nodes": [{"id": "s1", "type": "notFound"}]}}`)))
+	versions = pool.Versions("test_version")
+	assert.Equal(t, 2, len(versions))
+	assert.Equal(t, 2, versions[1].Version)
+	assert.Equal(t, "bob", versions[1].Author)
+	assert.True(t, versions[0].Hash != versions[1].Hash)
+
+	diff, err := pool.Diff("test_version", 1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, diff.From)
+	assert.Equal(t, 2, diff.To)
+	assert.True(t, diff.RuleChainChanged)
+	assert.Equal(t, 1, len(diff.AddedNodes))
+	assert.Equal(t, "s2", diff.AddedNodes[0].Id)
+	assert.Equal(t, 1, len(diff.ModifiedNodes))
+	assert.Equal(t, "s1", diff.ModifiedNodes[0].Id)
+	assert.True(t, strings.Contains(diff.ModifiedNodes[0].From.Configuration["jsScript"].(string), "'v1'"))
+	assert.True(t, strings.Contains(diff.ModifiedNodes[0].To.Configuration["jsScript"].(string), "'v2'"))
+	assert.Equal(t, 0, len(diff.RemovedNodes))
+	assert.Equal(t, []types.NodeConnection{{FromId: "s1", ToId: "s2", Type: types.Success}}, diff.AddedConnections)
+
+	reverse, err := pool.Diff("test_version", 2, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, "s2", reverse.RemovedNodes[0].Id)
+	assert.Equal(t, 1, len(reverse.RemovedConnections))
+
+	same, err := pool.Diff("test_version", 2, 2)
+	assert.Nil(t, err)
+	assert.True(t, same.IsEmpty())
+
+	_, err = pool.Diff("test_version", 1, 9)
+	assert.True(t, errors.Is(err, ErrVersionNotFound))
+}
+
+func TestPoolRollback(t *testing.T) {
+	pool := NewPool()
+	defer pool.Stop()
+	ruleEngine, err := pool.New("test_version", versionChain("alice", "v1", false))
+	assert.Nil(t, err)
+	assert.Nil(t, ruleEngine.ReloadSelf(versionChain("bob", "v2", true)))
+
+	assert.Nil(t, pool.Rollback("test_version", 1))
+	versions := pool.Versions("test_version")
+	//回滚记录为新的版本
+	assert.Equal(t, 3, len(versions))
+	assert.Equal(t, 3, versions[2].Version)
+	assert.Equal(t, versions[0].Hash, versions[2].Hash)
+	assert.Equal(t, 1, len(ruleEngine.Definition().Metadata.Nodes))
+
+	msg := types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}")
+	var version string
+	ruleEngine.OnMsgAndWait(msg, types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+		version = msg.Metadata.GetValue("version")
+	}))
+	assert.Equal(t, "v1", version)
+
+	err = pool.Rollback("test_version", 9)
+	assert.True(t, errors.Is(err, ErrVersionNotFound))
+	err = pool.Rollback("notFound", 1)
+	assert.True(t, errors.Is(err, ErrChainNotFound))
+
+	pool.Del("test_version")
+	assert.Equal(t, 0, len(pool.Versions("test_version")))
+}
+
+// 逻辑规则链ID和拆分的非首个路由ID相同，回滚的是该ID的规则链
+func TestPoolRollbackWithSplit(t *testing.T) {
+	pool := NewPool()
+	defer pool.Stop()
+	_, err := pool.New("test_version_stable", versionChain("alice", "stable", false))
+	assert.Nil(t, err)
+	canary, err := pool.New("test_version", versionChain("alice", "v1", false))
+	assert.Nil(t, err)
+	assert.Nil(t, canary.ReloadSelf(versionChain("bob", "v2", true)))
+	assert.Nil(t, pool.SetSplit("test_version", SplitConfig{Routes: []SplitRoute{
+		{ChainId: "test_version_stable", Weight: 50},
+		{ChainId: "test_version", Weight: 50},
+	}}))
+
+	assert.Nil(t, pool.Rollback("test_version", 1))
+	assert.Equal(t, 1, len(canary.Definition().Metadata.Nodes))
+	assert.Equal(t, 3, len(pool.Versions("test_version")))
+	stable, ok := pool.GetEngine("test_version_stable")
+	assert.True(t, ok)
+	assert.Equal(t, 1, len(pool.Versions("test_version_stable")))
+	var version string
+	stable.OnMsgAndWait(types.NewMsg(0, "TEST", types.JSON, types.NewMetadata(), "{}"), types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+		version = msg.Metadata.GetValue("version")
+	}))
+	assert.Equal(t, "stable", version)
+
+	//消息分发仍然使用拆分
+	ruleEngine, _ := pool.Get("test_version")
+	_, ok = ruleEngine.(*SplitEngine)
+	assert.True(t, ok)
+}
+
+func TestPoolVersionsReloadChild(t *testing.T) {
+	pool := NewPool()
+	defer pool.Stop()
+	ruleEngine, err := pool.New("test_version", versionChain("alice", "v1", false))
+	assert.Nil(t, err)
+	err = ruleEngine.ReloadChild("s1", []byte(`{"id": "s1", "type": "jsTransform", "configuration": {"jsScript": "metadata['version']='child';return {'msg':msg,'metadata':metadata,'msgType':msgType};"}}`))
+	assert.Nil(t, err)
+	assert.True(t, strings.Contains(string(ruleEngine.DSL()), "'child'"))
+
+	versions := pool.Versions("test_version")
+	assert.Equal(t, 2, len(versions))
+	diff, err := pool.Diff("test_version", 1, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(diff.ModifiedNodes))
+	//历史版本不受之后的修改影响
+	assert.True(t, strings.Contains(versions[0].Definition().Metadata.Nodes[0].Configuration["jsScript"].(string), "'v1'"))
+}
+
+func TestPoolMaxVersions(t *testing.T) {
+	pool := NewPool()
+	defer pool.Stop()
+	pool.SetMaxVersions(2)
+	ruleEngine, err := pool.New("test_version", versionChain("alice", "v1", false))
+	assert.Nil(t, err)
+	for i := 2; i <= 4; i++ {
+		assert.Nil(t, ruleEngine.ReloadSelf(versionChain("alice", fmt.Sprintf("v%d", i), false)))
+	}
+	versions := pool.Versions("test_version")
+	assert.Equal(t, 2, len(versions))
+	assert.Equal(t, 3, versions[0].Version)
+	assert.Equal(t, 4, versions[1].Version)
+	assert.True(t, errors.Is(pool.Rollback("test_version", 1), ErrVersionNotFound))
+
+	pool.SetMaxVersions(-1)
+	assert.Nil(t, ruleEngine.ReloadSelf(versionChain("alice", "v5", false)))
+	assert.Equal(t, 2, len(pool.Versions("test_version")))
+}
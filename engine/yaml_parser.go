@@ -0,0 +1,211 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/utils/json"
+	"gopkg.in/yaml.v3"
+)
+
+// YamlParser Yaml
+// 字段名称和 Json DSL 一致，多行字符串(例如js脚本)使用 `|` 块格式，不需要转义。
+// 规则链、节点、endpoint、router 上方的注释保存在 additionalInfo.comment 中，编码时还原成注释
+type YamlParser struct {
+}
+
+// DecodeRuleChain 通过yaml解析规则链结构体
+func (p *YamlParser) DecodeRuleChain(rootRuleChain []byte) (types.RuleChain, error) {
+	var def types.RuleChain
+	err := p.decode(rootRuleChain, chainCommentPaths, &def)
+	return def, err
+}
+
+// DecodeRuleNode 通过yaml解析节点结构体
+func (p *YamlParser) DecodeRuleNode(rootRuleChain []byte) (types.RuleNode, error) {
+	var def types.RuleNode
+	err := p.decode(rootRuleChain, nodeCommentPaths, &def)
+	return def, err
+}
+
+func (p *YamlParser) EncodeRuleChain(def interface{}) ([]byte, error) {
+	return p.encode(def, chainCommentPaths)
+}
+
+func (p *YamlParser) EncodeRuleNode(def interface{}) ([]byte, error) {
+	return p.encode(def, nodeCommentPaths)
+}
+
+func (p *YamlParser) decode(data []byte, commentPaths [][]string, def interface{}) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	v, err := yamlNodeToValue(&doc, nil, "", commentPaths)
+	if err != nil {
+		return err
+	}
+	return decodeByJson(v, def)
+}
+
+func (p *YamlParser) encode(def interface{}, commentPaths [][]string) ([]byte, error) {
+	node, err := orderedNode(def)
+	if err != nil {
+		return nil, err
+	}
+	formatYamlNode(node, nil, commentPaths)
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err = encoder.Encode(node); err != nil {
+		return nil, err
+	}
+	if err = encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// orderedNode 把结构体转换成保持 json 字段顺序的节点树，Json 是 Yaml 的子集，所以可以直接用 yaml 解析
+func orderedNode(def interface{}) (*yaml.Node, error) {
+	b, err := json.Marshal(def)
+	if err != nil {
+		return nil, err
+	}
+	var doc yaml.Node
+	if err = yaml.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	return doc.Content[0], nil
+}
+
+// yamlNodeToValue 转换成通用结构，并把注释保存到 additionalInfo.comment
+func yamlNodeToValue(n *yaml.Node, path []string, comment string, commentPaths [][]string) (interface{}, error) {
+	switch n.Kind {
+	case yaml.DocumentNode:
+		if len(n.Content) == 0 {
+			return nil, nil
+		}
+		return yamlNodeToValue(n.Content[0], path, n.HeadComment, commentPaths)
+	case yaml.AliasNode:
+		return yamlNodeToValue(n.Alias, path, comment, commentPaths)
+	case yaml.MappingNode:
+		m := make(map[string]interface{}, len(n.Content)/2)
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			v, err := yamlNodeToValue(value, appendPath(path, key.Value), key.HeadComment, commentPaths)
+			if err != nil {
+				return nil, err
+			}
+			m[key.Value] = v
+		}
+		if matchCommentPath(commentPaths, path) {
+			if n.HeadComment != "" {
+				comment = n.HeadComment
+			} else if comment == "" && len(path) == 0 && len(n.Content) > 0 {
+				//根对象的注释解析在第一个key上
+				comment = n.Content[0].HeadComment
+			}
+			setComment(m, trimYamlComment(comment))
+		}
+		return m, nil
+	case yaml.SequenceNode:
+		list := make([]interface{}, 0, len(n.Content))
+		for i, item := range n.Content {
+			v, err := yamlNodeToValue(item, appendPath(path, strconv.Itoa(i)), "", commentPaths)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		return list, nil
+	default:
+		var v interface{}
+		err := n.Decode(&v)
+		return v, err
+	}
+}
+
+// formatYamlNode 使用块格式，多行字符串使用 `|`，并把 additionalInfo.comment 还原成注释
+func formatYamlNode(n *yaml.Node, path []string, commentPaths [][]string) {
+	switch n.Kind {
+	case yaml.MappingNode:
+		n.Style = 0
+		if matchCommentPath(commentPaths, path) {
+			n.HeadComment = popYamlComment(n)
+		}
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			key, value := n.Content[i], n.Content[i+1]
+			key.Style = 0
+			formatYamlNode(value, appendPath(path, key.Value), commentPaths)
+			//对象的注释写在key的上方
+			if value.Kind == yaml.MappingNode && value.HeadComment != "" {
+				key.HeadComment = value.HeadComment
+				value.HeadComment = ""
+			}
+		}
+	case yaml.SequenceNode:
+		n.Style = 0
+		for i, item := range n.Content {
+			formatYamlNode(item, appendPath(path, strconv.Itoa(i)), commentPaths)
+		}
+	case yaml.ScalarNode:
+		if n.Tag == "!!str" && strings.Contains(n.Value, "\n") {
+			n.Style = yaml.LiteralStyle
+		} else {
+			n.Style = 0
+		}
+	}
+}
+
+// popYamlComment 取出并删除 additionalInfo.comment，additionalInfo 为空则一起删除
+func popYamlComment(n *yaml.Node) string {
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		if n.Content[i].Value != "additionalInfo" || n.Content[i+1].Kind != yaml.MappingNode {
+			continue
+		}
+		info := n.Content[i+1]
+		for j := 0; j+1 < len(info.Content); j += 2 {
+			if info.Content[j].Value == CommentKey && info.Content[j+1].Kind == yaml.ScalarNode {
+				comment := info.Content[j+1].Value
+				info.Content = append(info.Content[:j], info.Content[j+2:]...)
+				if len(info.Content) == 0 {
+					n.Content = append(n.Content[:i], n.Content[i+2:]...)
+				}
+				return comment
+			}
+		}
+	}
+	return ""
+}
+
+// trimYamlComment 去掉注释每行开头的 `#`
+func trimYamlComment(comment string) string {
+	if comment == "" {
+		return ""
+	}
+	lines := strings.Split(comment, "\n")
+	for i, line := range lines {
+		line = strings.TrimPrefix(strings.TrimSpace(line), "#")
+		lines[i] = strings.TrimPrefix(line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package engine
+
+import (
+	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/test/assert"
+	"github.com/rulego/rulego/utils/fs"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestYamlParser(t *testing.T) {
+	parser := &YamlParser{}
+	out := testTextParser(t, parser, "../testdata/rule/yaml_chain.yaml", "yaml-TEST_MSG_TYPE")
+	assert.True(t, strings.Contains(string(out), "# yaml 格式的规则链\nruleChain:\n"))
+	assert.True(t, strings.Contains(string(out), "    # 过滤温度大于10的消息\n    - id: s1\n"))
+	assert.True(t, strings.Contains(string(out), "jsScript: |\n          var temperature = msg.temperature;\n"))
+	assert.True(t, strings.Contains(string(out), "type: \"True\""))
+
+	node, err := parser.DecodeRuleNode([]byte("# 转换\nid: s2\ntype: jsTransform\nconfiguration:\n  jsScript: |-\n    return {'msg':msg};\n    // end\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "转换", node.AdditionalInfo[CommentKey])
+	assert.Equal(t, "return {'msg':msg};\n// end", node.Configuration["jsScript"])
+	nodeYaml, err := parser.EncodeRuleNode(node)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(nodeYaml), "# 转换\nid: s2\n"))
+	assert.True(t, strings.Contains(string(nodeYaml), "jsScript: |-\n    return {'msg':msg};\n    // end\n"))
+
+	_, err = parser.DecodeRuleChain([]byte("ruleChain: ["))
+	assert.NotNil(t, err)
+	_, err = parser.DecodeRuleNode([]byte("id: \"s1"))
+	assert.NotNil(t, err)
+	_, err = parser.EncodeRuleChain(make(chan int))
+	assert.NotNil(t, err)
+}
+
+// testTextParser 测试解析、编码往返一致，并且使用该解析器运行规则链
+func testTextParser(t *testing.T, parser types.Parser, file string, expectName string) []byte {
+	def, err := parser.DecodeRuleChain(fs.LoadFile(file))
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(def.Metadata.Nodes))
+	assert.True(t, strings.HasSuffix(def.RuleChain.AdditionalInfo[CommentKey].(string), "格式的规则链"))
+	assert.Equal(t, "过滤温度大于10的消息", def.Metadata.Nodes[0].AdditionalInfo[CommentKey])
+	assert.Equal(t, 0, len(def.Metadata.Nodes[1].AdditionalInfo))
+	assert.Equal(t, "var temperature = msg.temperature;\nreturn temperature > 10;\n", def.Metadata.Nodes[0].Configuration["jsScript"])
+	assert.Equal(t, types.True, def.Metadata.Connections[0].Type)
+
+	out, err := parser.EncodeRuleChain(def)
+	assert.Nil(t, err)
+	def2, err := parser.DecodeRuleChain(out)
+	assert.Nil(t, err)
+	jsonParser := &JsonParser{}
+	expected, _ := jsonParser.EncodeRuleChain(def)
+	actual, _ := jsonParser.EncodeRuleChain(def2)
+	assert.Equal(t, string(expected), string(actual))
+
+	config := NewConfig(types.WithParser(parser))
+	ruleEngine, err := New(def.RuleChain.ID, fs.LoadFile(file), WithConfig(config))
+	assert.Nil(t, err)
+	defer Del(def.RuleChain.ID)
+	dsl := ruleEngine.DSL()
+	def3, err := parser.DecodeRuleChain(dsl)
+	assert.Nil(t, err)
+	assert.Equal(t, "过滤温度大于10的消息", def3.Metadata.Nodes[0].AdditionalInfo[CommentKey])
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	msg := types.NewMsg(0, "TEST_MSG_TYPE", types.JSON, types.NewMetadata(), "{\"temperature\":41}")
+	ruleEngine.OnMsg(msg, types.WithOnEnd(func(ctx types.RuleContext, msg types.RuleMsg, err error, relationType string) {
+		assert.Nil(t, err)
+		assert.Equal(t, expectName, msg.Metadata.GetValue("name"))
+		wg.Done()
+	}))
+	wg.Wait()
+	return out
+}
@@ -6,6 +6,8 @@ const (
 	DirLocales       = "locales"
 	DirWorkflowsRun  = "runs"
 	DirWorkflowsRule = "rules"
+	// DirWorkflowsDeadLetter 死信队列目录
+	DirWorkflowsDeadLetter = "dlq"
 	// FileNameIndex 索引文件名
 	FileNameIndex = "index"
 )
@@ -21,6 +23,7 @@ const (
 	KeySize            = "size"
 	KeyPage            = "page"
 	KeyId              = "id"
+	KeyDeadLetterId    = "dlqId"
 	KeyKeywords        = "keywords"
 	KeyType            = "type"
 	KeyLang            = "lang"
@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"examples/server/config"
+	"examples/server/internal/constants"
+	"examples/server/internal/service"
+	"github.com/rulego/rulego/api/types"
+	endpointApi "github.com/rulego/rulego/api/types/endpoint"
+	"github.com/rulego/rulego/endpoint"
+	"github.com/rulego/rulego/utils/json"
+	"net/http"
+)
+
+var DeadLetter = &deadLetter{}
+
+type deadLetter struct {
+}
+
+// List 获取规则链死信列表
+func (c *deadLetter) List(url string) endpointApi.Router {
+	return endpoint.NewRouter().From(url).Process(AuthProcess).Process(func(router endpointApi.Router, exchange *endpointApi.Exchange) bool {
+		msg := exchange.In.GetMsg()
+		chainId := msg.Metadata.GetValue(constants.KeyId)
+		username := msg.Metadata.GetValue(constants.KeyUsername)
+		if s, ok := service.UserRuleEngineServiceImpl.Get(username); ok {
+			if list, err := s.DeadLetters(chainId); err != nil {
+				exchange.Out.SetStatusCode(http.StatusNotFound)
+				exchange.Out.SetBody([]byte(err.Error()))
+				return false
+			} else {
+				result := map[string]interface{}{
+					"total": len(list),
+					"items": list,
+				}
+				return writeJson(exchange, result)
+			}
+		} else {
+			return userNotFound(username, exchange)
+		}
+	}).End()
+}
+
+// Get 获取死信详情，包括失败时的规则链运行快照
+func (c *deadLetter) Get(url string) endpointApi.Router {
+	return endpoint.NewRouter().From(url).Process(AuthProcess).Process(func(router endpointApi.Router, exchange *endpointApi.Exchange) bool {
+		msg := exchange.In.GetMsg()
+		chainId := msg.Metadata.GetValue(constants.KeyId)
+		id := msg.Metadata.GetValue(constants.KeyDeadLetterId)
+		username := msg.Metadata.GetValue(constants.KeyUsername)
+		if s, ok := service.UserRuleEngineServiceImpl.Get(username); ok {
+			if letter, err := s.GetDeadLetter(chainId, id); err != nil {
+				exchange.Out.SetStatusCode(http.StatusNotFound)
+				exchange.Out.SetBody([]byte(err.Error()))
+				return false
+			} else {
+				return writeJson(exchange, letter)
+			}
+		} else {
+			return userNotFound(username, exchange)
+		}
+	}).End()
+}
+
+// Replay 从失败节点重放死信，不等待规则引擎处理结果
+func (c *deadLetter) Replay(url string) endpointApi.Router {
+	var opts []types.RuleContextOption
+	if config.C.SaveRunLog {
+		opts = append(opts, types.WithOnRuleChainCompleted(func(ctx types.RuleContext, snapshot types.RuleChainRunSnapshot) {
+			_ = service.EventServiceImpl.SaveRunLog(ctx, snapshot)
+		}))
+	}
+	return endpoint.NewRouter().From(url).Process(AuthProcess).Process(func(router endpointApi.Router, exchange *endpointApi.Exchange) bool {
+		msg := exchange.In.GetMsg()
+		chainId := msg.Metadata.GetValue(constants.KeyId)
+		id := msg.Metadata.GetValue(constants.KeyDeadLetterId)
+		username := msg.Metadata.GetValue(constants.KeyUsername)
+		if s, ok := service.UserRuleEngineServiceImpl.Get(username); ok {
+			if err := s.ReplayDeadLetter(chainId, id, opts...); err != nil {
+				exchange.Out.SetStatusCode(http.StatusBadRequest)
+				exchange.Out.SetBody([]byte(err.Error()))
+				return false
+			}
+		} else {
+			return userNotFound(username, exchange)
+		}
+		return true
+	}).End()
+}
+
+func writeJson(exchange *endpointApi.Exchange, v interface{}) bool {
+	if data, err := json.Marshal(v); err != nil {
+		exchange.Out.SetStatusCode(http.StatusInternalServerError)
+		exchange.Out.SetBody([]byte(err.Error()))
+		return false
+	} else {
+		exchange.Out.SetBody(data)
+		return true
+	}
+}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"errors"
 	"examples/server/config"
 	"examples/server/config/logger"
 	"examples/server/internal/constants"
@@ -8,6 +9,7 @@ import (
 	"github.com/rulego/rulego/api/types"
 	endpointApi "github.com/rulego/rulego/api/types/endpoint"
 	"github.com/rulego/rulego/endpoint"
+	"github.com/rulego/rulego/engine"
 	"github.com/rulego/rulego/utils/json"
 	"net/http"
 	"path"
@@ -71,7 +73,15 @@ func (c *rule) Save(url string) endpointApi.Router {
 			} else {
 				logger.Logger.Println(err)
 				exchange.Out.SetStatusCode(http.StatusBadRequest)
-				exchange.Out.SetBody([]byte(err.Error()))
+				var validationErr *engine.ValidationError
+				if errors.As(err, &validationErr) {
+					//返回结构化的校验结果
+					body, _ := json.Marshal(validationErr.Diagnostics)
+					exchange.Out.Headers().Set("Content-Type", "application/json")
+					exchange.Out.SetBody(body)
+				} else {
+					exchange.Out.SetBody([]byte(err.Error()))
+				}
 			}
 		} else {
 			return userNotFound(username, exchange)
@@ -83,6 +83,13 @@ func NewRestServe(config config.Config) *rest.Endpoint {
 	//部署或者下线规则链
 	restEndpoint.POST(controller.Rule.Operate(apiBasePath + "/" + moduleFlows + "/:id/operate/:type"))
 
+	//获取规则链死信列表
+	restEndpoint.GET(controller.DeadLetter.List(apiBasePath + "/" + moduleFlows + "/:id/dlq"))
+	//获取死信详情
+	restEndpoint.GET(controller.DeadLetter.Get(apiBasePath + "/" + moduleFlows + "/:id/dlq/:dlqId"))
+	//从失败节点重放死信
+	restEndpoint.POST(controller.DeadLetter.Replay(apiBasePath + "/" + moduleFlows + "/:id/dlq/:dlqId/replay"))
+
 	//获取节点调试日志列表
 	restEndpoint.GET(controller.Log.GetDebugLogs(apiBasePath + "/" + moduleLogs + "/debug"))
 	//获取规则链运行日志列表
@@ -11,7 +11,9 @@ import (
 	"github.com/rulego/rulego"
 	luaEngine "github.com/rulego/rulego-components/pkg/lua_engine"
 	"github.com/rulego/rulego/api/types"
+	"github.com/rulego/rulego/builtin/store"
 	"github.com/rulego/rulego/components/action"
+	"github.com/rulego/rulego/engine"
 	"github.com/rulego/rulego/node_pool"
 	"github.com/rulego/rulego/utils/fs"
 	"github.com/rulego/rulego/utils/json"
@@ -170,6 +172,10 @@ func (s *RuleEngineService) SaveAndLoad(chainId string, def []byte) error {
 	if err != nil {
 		return err
 	}
+	//静态校验DSL，存在错误则不保存
+	if diagnostics := engine.Validate(ruleChain, s.ruleConfig.ComponentsRegistry); diagnostics.HasError() {
+		return &engine.ValidationError{Diagnostics: diagnostics}
+	}
 	//修改更新时间
 	s.fillAdditionalInfo(&ruleChain)
 
@@ -387,6 +393,30 @@ func (s *RuleEngineService) GetEngine(chainId string) (types.RuleEngine, bool) {
 	return s.Pool.Get(chainId)
 }
 
+// DeadLetters 获取规则链死信列表
+func (s *RuleEngineService) DeadLetters(chainId string) ([]types.DeadLetter, error) {
+	if ruleEngine, ok := s.Pool.Get(chainId); ok {
+		return ruleEngine.DeadLetters()
+	}
+	return nil, fmt.Errorf("not found chainId=%s", chainId)
+}
+
+// GetDeadLetter 获取规则链死信详情
+func (s *RuleEngineService) GetDeadLetter(chainId string, id string) (types.DeadLetter, error) {
+	if ruleEngine, ok := s.Pool.Get(chainId); ok {
+		return ruleEngine.GetDeadLetter(id)
+	}
+	return types.DeadLetter{}, fmt.Errorf("not found chainId=%s", chainId)
+}
+
+// ReplayDeadLetter 从失败节点重放死信
+func (s *RuleEngineService) ReplayDeadLetter(chainId string, id string, opts ...types.RuleContextOption) error {
+	if ruleEngine, ok := s.Pool.Get(chainId); ok {
+		return ruleEngine.ReplayDeadLetter(id, opts...)
+	}
+	return fmt.Errorf("not found chainId=%s", chainId)
+}
+
 // OnDebug 调试日志
 func (s *RuleEngineService) OnDebug(chainId, flowType string, nodeId string, msg types.RuleMsg, relationType string, err error) {
 	s.locker.RLock()
@@ -463,6 +493,13 @@ func (s *RuleEngineService) InitRuleGo(logger *log.Logger, workspacePath string,
 		})
 		s.OnDebug(chainId, flowType, nodeId, msg, relationType, err)
 	}
+	//失败消息记录到死信队列
+	dlqPath := path.Join(workspacePath, constants.DirWorkflows, username, constants.DirWorkflowsDeadLetter)
+	if queue, err := store.NewFileDeadLetterQueue(dlqPath); err != nil {
+		logger.Printf("init dead letter queue error:%s", err)
+	} else {
+		ruleConfig.DeadLetterQueue = queue
+	}
 	s.ruleConfig = ruleConfig
 
 	//加载js
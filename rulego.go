@@ -170,6 +170,12 @@ func (g *RuleGo) Get(id string) (types.RuleEngine, bool) {
 	return g.pool.Get(id)
 }
 
+// GetEngine retrieves the rule engine instance of the rule chain by its ID, ignoring traffic splits and shadow executions.
+// Use it for management operations such as reload and rollback.
+func (g *RuleGo) GetEngine(id string) (*engine.RuleEngine, bool) {
+	return g.pool.GetEngine(id)
+}
+
 // Del removes a rule engine instance by its ID.
 func (g *RuleGo) Del(id string) {
 	g.pool.Del(id)
@@ -259,3 +265,8 @@ func NewConfig(opts ...types.Option) types.Config {
 func WithConfig(config types.Config) types.RuleEngineOption {
 	return engine.WithConfig(config)
 }
+
+// WithParser is an option that sets the Parser of the RuleEngine, it must be placed after WithConfig.
+func WithParser(parser types.Parser) types.RuleEngineOption {
+	return engine.WithParser(parser)
+}
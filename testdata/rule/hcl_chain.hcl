@@ -0,0 +1,39 @@
+# hcl 格式的规则链
+ruleChain = {
+  id   = "hcl_chain"
+  name = "hcl测试规则链"
+}
+metadata = {
+  nodes = [
+    # 过滤温度大于10的消息
+    {
+      id   = "s1"
+      type = "jsFilter"
+      name = "过滤"
+      configuration = {
+        jsScript = <<-EOT
+          var temperature = msg.temperature;
+          return temperature > 10;
+        EOT
+      }
+    },
+    {
+      id   = "s2"
+      type = "jsTransform"
+      name = "转换"
+      configuration = {
+        jsScript = <<-EOT
+          metadata['name'] = `hcl-$${msgType}`;
+          return {'msg':msg,'metadata':metadata,'msgType':msgType};
+        EOT
+      }
+    },
+  ]
+  connections = [
+    {
+      fromId = "s1"
+      toId   = "s2"
+      type   = "True"
+    },
+  ]
+}
@@ -0,0 +1,459 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package codec provides framing codecs for stream protocols such as TCP.
+// A codec splits a byte stream into frames and encodes outgoing data into frames.
+// It is used by the net endpoint and the net node.
+//
+// Built-in codecs:
+// - line: newline delimited text frames
+// - delimiter: frames with optional start delimiter, end delimiter and checksum
+// - lengthField: frames with a length field at a configurable offset, size and byte order
+// - fixedLength: frames with a fixed length
+//
+// Custom codecs can be registered with Register and selected by type name.
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 编解码器类型
+const (
+	TypeLine        = "line"
+	TypeDelimiter   = "delimiter"
+	TypeLengthField = "lengthField"
+	TypeFixedLength = "fixedLength"
+)
+
+// 校验和类型
+const (
+	ChecksumSum8  = "sum8"
+	ChecksumXor8  = "xor8"
+	ChecksumCrc16 = "crc16"
+)
+
+// 帧头部字段
+const (
+	// HeaderLength 长度字段的值
+	HeaderLength = "length"
+	// HeaderPrefix 长度字段前面的字节，十六进制
+	HeaderPrefix = "prefix"
+)
+
+const (
+	ByteOrderBig    = "big"
+	ByteOrderLittle = "little"
+
+	defaultMaxFrameLength = 1024 * 1024
+)
+
+var (
+	// ErrFrameTooLarge 帧超过最大长度
+	ErrFrameTooLarge = errors.New("frame too large")
+	// ErrChecksum 校验和错误，只丢弃当前帧
+	ErrChecksum = errors.New("checksum mismatch")
+)
+
+// Config 编解码器配置
+type Config struct {
+	// Type 编解码器类型：line/delimiter/lengthField/fixedLength，或者通过 Register 注册的自定义类型，默认 line
+	Type string
+	// MaxFrameLength 最大帧长度，默认1MB
+	MaxFrameLength int
+	// Start delimiter 起始符，为空没有起始符，起始符之前的数据被丢弃。0x 开头表示十六进制，例如：0x7E
+	Start string
+	// End delimiter 结束符，默认 \n。0x 开头表示十六进制，例如：0x0D0A
+	End string
+	// Checksum delimiter 校验和类型：sum8/xor8/crc16(modbus，低字节在前)，位于数据和结束符之间，为空不校验
+	Checksum string
+	// LengthFieldOffset lengthField 长度字段偏移
+	LengthFieldOffset int
+	// LengthFieldSize lengthField 长度字段字节数：1/2/4/8，默认2
+	LengthFieldSize int
+	// ByteOrder lengthField 长度字段字节序：big/little，默认 big
+	ByteOrder string
+	// LengthAdjustment lengthField 长度字段之后的字节数 = 长度字段值 + LengthAdjustment
+	LengthAdjustment int
+	// InitialBytesToStrip lengthField 解码后从帧开头去掉的字节数，例如去掉长度字段前面的头部和长度字段
+	InitialBytesToStrip int
+	// FrameLength fixedLength 帧长度
+	FrameLength int
+	// Options 自定义编解码器配置
+	Options map[string]interface{}
+}
+
+// Frame 解码后的帧
+type Frame struct {
+	// Data 帧数据
+	Data []byte
+	// Headers 解码出的头部字段，可用于路由匹配
+	Headers map[string]string
+}
+
+// Codec 编解码器
+type Codec interface {
+	// Decode 从流中读取一帧
+	Decode(reader *bufio.Reader) (*Frame, error)
+	// Encode 把数据编码成一帧
+	Encode(data []byte) ([]byte, error)
+}
+
+// Factory 根据配置创建编解码器
+type Factory func(config Config) (Codec, error)
+
+var factories = struct {
+	sync.RWMutex
+	m map[string]Factory
+}{m: map[string]Factory{
+	TypeLine:        newLineCodec,
+	TypeDelimiter:   newDelimiterCodec,
+	TypeLengthField: newLengthFieldCodec,
+	TypeFixedLength: newFixedLengthCodec,
+}}
+
+// Register 注册自定义编解码器，同名覆盖
+func Register(codecType string, factory Factory) {
+	factories.Lock()
+	defer factories.Unlock()
+	factories.m[codecType] = factory
+}
+
+// New 根据配置创建编解码器
+func New(config Config) (Codec, error) {
+	if config.Type == "" {
+		config.Type = TypeLine
+	}
+	if config.MaxFrameLength <= 0 {
+		config.MaxFrameLength = defaultMaxFrameLength
+	}
+	factories.RLock()
+	factory, ok := factories.m[config.Type]
+	factories.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("codec type not found: %s", config.Type)
+	}
+	return factory(config)
+}
+
+// ParseBytes 解析分隔符，0x 开头表示十六进制，否则是原始字符串
+func ParseBytes(s string) ([]byte, error) {
+	if strings.HasPrefix(s, "0x") || strings.HasPrefix(s, "0X") {
+		return hex.DecodeString(s[2:])
+	}
+	return []byte(s), nil
+}
+
+// lineCodec 换行符分隔的文本帧，去掉行尾的 \r
+type lineCodec struct {
+	maxFrameLength int
+}
+
+func newLineCodec(config Config) (Codec, error) {
+	return &lineCodec{maxFrameLength: config.MaxFrameLength}, nil
+}
+
+func (c *lineCodec) Decode(reader *bufio.Reader) (*Frame, error) {
+	var line []byte
+	for {
+		data, isPrefix, err := reader.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, data...)
+		if len(line) > c.maxFrameLength {
+			return nil, ErrFrameTooLarge
+		}
+		if !isPrefix {
+			return &Frame{Data: line}, nil
+		}
+	}
+}
+
+func (c *lineCodec) Encode(data []byte) ([]byte, error) {
+	return append(append([]byte{}, data...), '\n'), nil
+}
+
+// delimiterCodec 起始符、结束符分隔的帧，可选校验和
+type delimiterCodec struct {
+	start          []byte
+	end            []byte
+	checksum       string
+	maxFrameLength int
+}
+
+func newDelimiterCodec(config Config) (Codec, error) {
+	c := &delimiterCodec{checksum: config.Checksum, maxFrameLength: config.MaxFrameLength}
+	var err error
+	if c.start, err = ParseBytes(config.Start); err != nil {
+		return nil, err
+	}
+	if config.End == "" {
+		c.end = []byte("\n")
+	} else if c.end, err = ParseBytes(config.End); err != nil {
+		return nil, err
+	}
+	if len(c.end) == 0 {
+		return nil, errors.New("end delimiter can not empty")
+	}
+	if c.checksum != "" && checksumSize(c.checksum) == 0 {
+		return nil, fmt.Errorf("unsupported checksum: %s", c.checksum)
+	}
+	return c, nil
+}
+
+func (c *delimiterCodec) Decode(reader *bufio.Reader) (*Frame, error) {
+	if len(c.start) > 0 {
+		//丢弃起始符之前的数据
+		if _, err := readUntil(reader, c.start, c.maxFrameLength, true); err != nil {
+			return nil, err
+		}
+	}
+	data, err := readUntil(reader, c.end, c.maxFrameLength+checksumSize(c.checksum), false)
+	if err != nil {
+		return nil, err
+	}
+	if c.checksum != "" {
+		size := checksumSize(c.checksum)
+		if len(data) < size {
+			return nil, ErrChecksum
+		}
+		data, sum := data[:len(data)-size], data[len(data)-size:]
+		if !bytes.Equal(sum, computeChecksum(c.checksum, data)) {
+			return nil, ErrChecksum
+		}
+		return &Frame{Data: data}, nil
+	}
+	return &Frame{Data: data}, nil
+}
+
+func (c *delimiterCodec) Encode(data []byte) ([]byte, error) {
+	if len(data) > c.maxFrameLength {
+		return nil, ErrFrameTooLarge
+	}
+	var buf bytes.Buffer
+	buf.Write(c.start)
+	buf.Write(data)
+	if c.checksum != "" {
+		buf.Write(computeChecksum(c.checksum, data))
+	}
+	buf.Write(c.end)
+	return buf.Bytes(), nil
+}
+
+// readUntil 读取直到遇到分隔符，返回不包括分隔符的数据。discard=true 超过最大长度的数据被丢弃而不是返回错误
+func readUntil(reader *bufio.Reader, delimiter []byte, maxLength int, discard bool) ([]byte, error) {
+	var buf []byte
+	last := delimiter[len(delimiter)-1]
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, b)
+		if b == last && bytes.HasSuffix(buf, delimiter) {
+			return buf[:len(buf)-len(delimiter)], nil
+		}
+		if len(buf) > maxLength+len(delimiter) {
+			if !discard {
+				return nil, ErrFrameTooLarge
+			}
+			buf = append(buf[:0], buf[len(buf)-len(delimiter)+1:]...)
+		}
+	}
+}
+
+func checksumSize(checksum string) int {
+	switch checksum {
+	case ChecksumSum8, ChecksumXor8:
+		return 1
+	case ChecksumCrc16:
+		return 2
+	}
+	return 0
+}
+
+func computeChecksum(checksum string, data []byte) []byte {
+	switch checksum {
+	case ChecksumSum8:
+		var sum byte
+		for _, b := range data {
+			sum += b
+		}
+		return []byte{sum}
+	case ChecksumXor8:
+		var sum byte
+		for _, b := range data {
+			sum ^= b
+		}
+		return []byte{sum}
+	case ChecksumCrc16:
+		crc := uint16(0xFFFF)
+		for _, b := range data {
+			crc ^= uint16(b)
+			for i := 0; i < 8; i++ {
+				if crc&1 != 0 {
+					crc = crc>>1 ^ 0xA001
+				} else {
+					crc >>= 1
+				}
+			}
+		}
+		return []byte{byte(crc), byte(crc >> 8)}
+	}
+	return nil
+}
+
+// lengthFieldCodec 长度字段帧：[前缀][长度字段][数据]
+type lengthFieldCodec struct {
+	config Config
+	order  binary.ByteOrder
+}
+
+func newLengthFieldCodec(config Config) (Codec, error) {
+	if config.LengthFieldSize == 0 {
+		config.LengthFieldSize = 2
+	}
+	switch config.LengthFieldSize {
+	case 1, 2, 4, 8:
+	default:
+		return nil, fmt.Errorf("unsupported length field size: %d", config.LengthFieldSize)
+	}
+	if config.LengthFieldOffset < 0 || config.InitialBytesToStrip < 0 {
+		return nil, errors.New("length field offset and initial bytes to strip can not be negative")
+	}
+	c := &lengthFieldCodec{config: config, order: binary.BigEndian}
+	switch config.ByteOrder {
+	case "", ByteOrderBig:
+	case ByteOrderLittle:
+		c.order = binary.LittleEndian
+	default:
+		return nil, fmt.Errorf("unsupported byte order: %s", config.ByteOrder)
+	}
+	return c, nil
+}
+
+func (c *lengthFieldCodec) Decode(reader *bufio.Reader) (*Frame, error) {
+	headerLength := c.config.LengthFieldOffset + c.config.LengthFieldSize
+	header := make([]byte, headerLength)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	length := c.readLength(header[c.config.LengthFieldOffset:])
+	remaining := int64(length) + int64(c.config.LengthAdjustment)
+	if length > uint64(c.config.MaxFrameLength) || remaining < 0 || remaining+int64(headerLength) > int64(c.config.MaxFrameLength) {
+		return nil, ErrFrameTooLarge
+	}
+	frame := make([]byte, headerLength+int(remaining))
+	copy(frame, header)
+	if _, err := io.ReadFull(reader, frame[headerLength:]); err != nil {
+		return nil, err
+	}
+	headers := map[string]string{HeaderLength: strconv.FormatUint(length, 10)}
+	if c.config.LengthFieldOffset > 0 {
+		headers[HeaderPrefix] = hex.EncodeToString(header[:c.config.LengthFieldOffset])
+	}
+	strip := c.config.InitialBytesToStrip
+	if strip > len(frame) {
+		strip = len(frame)
+	}
+	return &Frame{Data: frame[strip:], Headers: headers}, nil
+}
+
+// Encode 在 LengthFieldOffset 处插入长度字段，data 前 LengthFieldOffset 个字节作为前缀
+func (c *lengthFieldCodec) Encode(data []byte) ([]byte, error) {
+	offset := c.config.LengthFieldOffset
+	if len(data) < offset {
+		return nil, fmt.Errorf("data length %d is less than length field offset %d", len(data), offset)
+	}
+	length := len(data) - offset - c.config.LengthAdjustment
+	if length < 0 || len(data)+c.config.LengthFieldSize > c.config.MaxFrameLength {
+		return nil, ErrFrameTooLarge
+	}
+	if c.config.LengthFieldSize < 8 && uint64(length) >= 1<<(8*uint(c.config.LengthFieldSize)) {
+		return nil, ErrFrameTooLarge
+	}
+	frame := make([]byte, len(data)+c.config.LengthFieldSize)
+	copy(frame, data[:offset])
+	c.writeLength(frame[offset:], uint64(length))
+	copy(frame[offset+c.config.LengthFieldSize:], data[offset:])
+	return frame, nil
+}
+
+func (c *lengthFieldCodec) readLength(b []byte) uint64 {
+	switch c.config.LengthFieldSize {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(c.order.Uint16(b))
+	case 4:
+		return uint64(c.order.Uint32(b))
+	default:
+		return c.order.Uint64(b)
+	}
+}
+
+func (c *lengthFieldCodec) writeLength(b []byte, length uint64) {
+	switch c.config.LengthFieldSize {
+	case 1:
+		b[0] = byte(length)
+	case 2:
+		c.order.PutUint16(b, uint16(length))
+	case 4:
+		c.order.PutUint32(b, uint32(length))
+	default:
+		c.order.PutUint64(b, length)
+	}
+}
+
+// fixedLengthCodec 固定长度帧
+type fixedLengthCodec struct {
+	frameLength int
+}
+
+func newFixedLengthCodec(config Config) (Codec, error) {
+	if config.FrameLength <= 0 {
+		return nil, errors.New("frame length must be greater than 0")
+	}
+	if config.FrameLength > config.MaxFrameLength {
+		return nil, ErrFrameTooLarge
+	}
+	return &fixedLengthCodec{frameLength: config.FrameLength}, nil
+}
+
+func (c *fixedLengthCodec) Decode(reader *bufio.Reader) (*Frame, error) {
+	data := make([]byte, c.frameLength)
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	return &Frame{Data: data}, nil
+}
+
+func (c *fixedLengthCodec) Encode(data []byte) ([]byte, error) {
+	if len(data) != c.frameLength {
+		return nil, fmt.Errorf("data length %d is not equal to frame length %d", len(data), c.frameLength)
+	}
+	return data, nil
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package codec
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/rulego/rulego/test/assert"
+)
+
+func decodeAll(t *testing.T, c Codec, data []byte) []*Frame {
+	reader := bufio.NewReader(bytes.NewReader(data))
+	var frames []*Frame
+	for {
+		frame, err := c.Decode(reader)
+		if err == io.EOF {
+			return frames
+		}
+		assert.Nil(t, err)
+		frames = append(frames, frame)
+	}
+}
+
+func TestLineCodec(t *testing.T) {
+	c, err := New(Config{})
+	assert.Nil(t, err)
+	frames := decodeAll(t, c, []byte("aa\r\nbb\n"))
+	assert.Equal(t, 2, len(frames))
+	assert.Equal(t, "aa", string(frames[0].Data))
+	assert.Equal(t, "bb", string(frames[1].Data))
+	data, _ := c.Encode([]byte("aa"))
+	assert.Equal(t, "aa\n", string(data))
+
+	c, _ = New(Config{Type: TypeLine, MaxFrameLength: 4})
+	_, err = c.Decode(bufio.NewReaderSize(bytes.NewReader([]byte("aaaaaaaaaaaaaaaaaaaaaaaa\n")), 16))
+	assert.Equal(t, ErrFrameTooLarge, err)
+}
+
+func TestDelimiterCodec(t *testing.T) {
+	c, err := New(Config{Type: TypeDelimiter, Start: "0x02", End: "0x03", Checksum: ChecksumXor8})
+	assert.Nil(t, err)
+	frame1, _ := c.Encode([]byte{0x10, 0x20})
+	assert.Equal(t, []byte{0x02, 0x10, 0x20, 0x30, 0x03}, frame1)
+	frame2, _ := c.Encode([]byte("ok"))
+	//起始符之前的数据被丢弃
+	frames := decodeAll(t, c, append(append([]byte{0xFF, 0xFE}, frame1...), frame2...))
+	assert.Equal(t, 2, len(frames))
+	assert.Equal(t, []byte{0x10, 0x20}, frames[0].Data)
+	assert.Equal(t, "ok", string(frames[1].Data))
+
+	_, err = c.Decode(bufio.NewReader(bytes.NewReader([]byte{0x02, 0x10, 0x20, 0x31, 0x03})))
+	assert.Equal(t, ErrChecksum, err)
+
+	c, _ = New(Config{Type: TypeDelimiter, End: "\r\n", Checksum: ChecksumCrc16})
+	data, _ := c.Encode([]byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01})
+	//modbus crc16
+	assert.Equal(t, []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01, 0x84, 0x0A, '\r', '\n'}, data)
+	frames = decodeAll(t, c, data)
+	assert.Equal(t, []byte{0x01, 0x03, 0x00, 0x00, 0x00, 0x01}, frames[0].Data)
+
+	c, _ = New(Config{Type: TypeDelimiter, Checksum: ChecksumSum8})
+	data, _ = c.Encode([]byte{0xFF, 0x02})
+	assert.Equal(t, []byte{0xFF, 0x02, 0x01, '\n'}, data)
+
+	_, err = New(Config{Type: TypeDelimiter, Checksum: "md5"})
+	assert.NotNil(t, err)
+	_, err = New(Config{Type: TypeDelimiter, End: "0xZZ"})
+	assert.NotNil(t, err)
+}
+
+func TestLengthFieldCodec(t *testing.T) {
+	//[0xAA 0x01][长度 2字节 大端][数据]
+	c, err := New(Config{Type: TypeLengthField, LengthFieldOffset: 2, LengthFieldSize: 2, InitialBytesToStrip: 4})
+	assert.Nil(t, err)
+	data, err := c.Encode([]byte{0xAA, 0x01, 'h', 'i'})
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{0xAA, 0x01, 0x00, 0x02, 'h', 'i'}, data)
+	frames := decodeAll(t, c, append(data, 0xAA, 0x02, 0x00, 0x00))
+	assert.Equal(t, 2, len(frames))
+	assert.Equal(t, "hi", string(frames[0].Data))
+	assert.Equal(t, "2", frames[0].Headers[HeaderLength])
+	assert.Equal(t, "aa01", frames[0].Headers[HeaderPrefix])
+	assert.Equal(t, 0, len(frames[1].Data))
+	assert.Equal(t, "aa02", frames[1].Headers[HeaderPrefix])
+
+	//长度包括长度字段本身，小端
+	c, _ = New(Config{Type: TypeLengthField, LengthFieldSize: 4, ByteOrder: ByteOrderLittle, LengthAdjustment: -4})
+	data, _ = c.Encode([]byte("abc"))
+	assert.Equal(t, []byte{0x07, 0x00, 0x00, 0x00, 'a', 'b', 'c'}, data)
+	frames = decodeAll(t, c, data)
+	assert.Equal(t, data, frames[0].Data)
+
+	c, _ = New(Config{Type: TypeLengthField, LengthFieldSize: 1, MaxFrameLength: 8})
+	_, err = c.Decode(bufio.NewReader(bytes.NewReader([]byte{0x10})))
+	assert.Equal(t, ErrFrameTooLarge, err)
+	_, err = c.Encode(make([]byte, 8))
+	assert.Equal(t, ErrFrameTooLarge, err)
+	_, err = c.Decode(bufio.NewReader(bytes.NewReader([]byte{0x05, 0x01})))
+	assert.Equal(t, io.ErrUnexpectedEOF, err)
+
+	_, err = New(Config{Type: TypeLengthField, LengthFieldSize: 3})
+	assert.NotNil(t, err)
+	_, err = New(Config{Type: TypeLengthField, ByteOrder: "middle"})
+	assert.NotNil(t, err)
+}
+
+func TestFixedLengthCodec(t *testing.T) {
+	c, err := New(Config{Type: TypeFixedLength, FrameLength: 3})
+	assert.Nil(t, err)
+	frames := decodeAll(t, c, []byte("abcdef"))
+	assert.Equal(t, 2, len(frames))
+	assert.Equal(t, "def", string(frames[1].Data))
+	_, err = c.Encode([]byte("ab"))
+	assert.NotNil(t, err)
+	_, err = New(Config{Type: TypeFixedLength})
+	assert.NotNil(t, err)
+}
+
+type cmdCodec struct{}
+
+// Decode [命令 1字节][数据长度 1字节][数据]
+func (c *cmdCodec) Decode(reader *bufio.Reader) (*Frame, error) {
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return nil, err
+	}
+	data := make([]byte, header[1])
+	if _, err := io.ReadFull(reader, data); err != nil {
+		return nil, err
+	}
+	return &Frame{Data: data, Headers: map[string]string{"cmd": string('0' + header[0])}}, nil
+}
+
+func (c *cmdCodec) Encode(data []byte) ([]byte, error) {
+	return append([]byte{0, byte(len(data))}, data...), nil
+}
+
+func TestRegister(t *testing.T) {
+	_, err := New(Config{Type: "cmd"})
+	assert.NotNil(t, err)
+	Register("cmd", func(config Config) (Codec, error) {
+		return &cmdCodec{}, nil
+	})
+	c, err := New(Config{Type: "cmd"})
+	assert.Nil(t, err)
+	frames := decodeAll(t, c, []byte{1, 2, 'o', 'k'})
+	assert.Equal(t, "ok", string(frames[0].Data))
+	assert.Equal(t, "1", frames[0].Headers["cmd"])
+}
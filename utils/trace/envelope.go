@@ -0,0 +1,67 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trace
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Envelope 负荷信封，用于在不支持消息头的传输协议（例如：MQTT 3.1.1）中传递链路上下文
+// 格式：{"traceparent":"00-...","tracestate":"...","payload":"<base64编码的原始负荷>"}
+type Envelope struct {
+	TraceParent string `json:"traceparent"`
+	TraceState  string `json:"tracestate,omitempty"`
+	Payload     []byte `json:"payload"`
+}
+
+// WrapEnvelope 把链路上下文和原始负荷封装成信封，链路上下文无效则返回原始负荷
+func WrapEnvelope(sc SpanContext, payload []byte) []byte {
+	if !sc.IsValid() {
+		return payload
+	}
+	if payload == nil {
+		payload = []byte{}
+	}
+	data, err := json.Marshal(Envelope{TraceParent: sc.TraceParent(), TraceState: sc.TraceState, Payload: payload})
+	if err != nil {
+		return payload
+	}
+	return data
+}
+
+// UnwrapEnvelope 解析信封，返回链路上下文和原始负荷
+// 如果数据不是信封或者traceparent无效，返回false，调用方应该使用原始数据
+func UnwrapEnvelope(data []byte) (SpanContext, []byte, bool) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '{' || !bytes.Contains(trimmed, []byte(`"`+TraceParentKey+`"`)) {
+		return SpanContext{}, nil, false
+	}
+	var envelope Envelope
+	decoder := json.NewDecoder(bytes.NewReader(trimmed))
+	//包含其他字段的JSON是业务数据，不是信封
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&envelope); err != nil || envelope.Payload == nil {
+		return SpanContext{}, nil, false
+	}
+	sc, ok := ParseTraceParent(envelope.TraceParent)
+	if !ok {
+		return SpanContext{}, nil, false
+	}
+	sc.TraceState = envelope.TraceState
+	return sc, envelope.Payload, true
+}
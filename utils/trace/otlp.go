@@ -0,0 +1,264 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trace
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rulego/rulego/utils/json"
+)
+
+const (
+	// DefaultServiceName 默认服务名
+	DefaultServiceName = "rulego"
+	// ScopeName 链路instrumentation scope名称
+	ScopeName = "github.com/rulego/rulego"
+	// otlpTracesPath OTLP/HTTP traces 默认路径
+	otlpTracesPath = "/v1/traces"
+)
+
+var _ SpanExporter = (*OtlpHttpExporter)(nil)
+
+// OtlpHttpExporter 通过 OTLP/JSON over HTTP 协议导出span，
+// 兼容 OpenTelemetry Collector、Jaeger、Tempo 等支持 OTLP/HTTP 的服务
+type OtlpHttpExporter struct {
+	// Endpoint 服务地址，例如：http://127.0.0.1:4318 ，如果没有指定路径，则使用 /v1/traces
+	Endpoint string
+	// ServiceName 资源属性 service.name
+	ServiceName string
+	// Headers 附加的请求头，例如认证信息
+	Headers map[string]string
+	// Client http客户端
+	Client *http.Client
+}
+
+// NewOtlpHttpExporter 创建OTLP/HTTP导出器
+func NewOtlpHttpExporter(endpoint string) *OtlpHttpExporter {
+	if !strings.Contains(strings.TrimPrefix(strings.TrimPrefix(endpoint, "http://"), "https://"), "/") {
+		endpoint = strings.TrimSuffix(endpoint, "/") + otlpTracesPath
+	}
+	return &OtlpHttpExporter{
+		Endpoint:    endpoint,
+		ServiceName: DefaultServiceName,
+		Client:      &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (e *OtlpHttpExporter) Export(spans []*Span) error {
+	if len(spans) == 0 {
+		return nil
+	}
+	body, err := json.Marshal(e.toOtlp(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.Headers {
+		req.Header.Set(k, v)
+	}
+	client := e.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("export spans error, status=%d body=%s", resp.StatusCode, string(b))
+	}
+	return nil
+}
+
+// toOtlp 转换成 OTLP/JSON ExportTraceServiceRequest 结构
+func (e *OtlpHttpExporter) toOtlp(spans []*Span) OtlpTracesRequest {
+	serviceName := e.ServiceName
+	if serviceName == "" {
+		serviceName = DefaultServiceName
+	}
+	var otlpSpans []OtlpSpan
+	for _, span := range spans {
+		otlpSpans = append(otlpSpans, ToOtlpSpan(span))
+	}
+	return OtlpTracesRequest{
+		ResourceSpans: []OtlpResourceSpans{
+			{
+				Resource: OtlpResource{Attributes: []OtlpKeyValue{stringKeyValue("service.name", serviceName)}},
+				ScopeSpans: []OtlpScopeSpans{
+					{
+						Scope: OtlpScope{Name: ScopeName},
+						Spans: otlpSpans,
+					},
+				},
+			},
+		},
+	}
+}
+
+// ToOtlpSpan 转换成OTLP/JSON span
+func ToOtlpSpan(span *Span) OtlpSpan {
+	span.lock.Lock()
+	defer span.lock.Unlock()
+	item := OtlpSpan{
+		TraceId:           span.TraceId,
+		SpanId:            span.SpanId,
+		TraceState:        span.TraceState,
+		ParentSpanId:      span.ParentSpanId,
+		Name:              span.Name,
+		Kind:              int(span.Kind),
+		StartTimeUnixNano: unixNano(span.StartTime),
+		EndTimeUnixNano:   unixNano(span.EndTime),
+		Attributes:        toKeyValues(span.Attributes),
+		Status:            OtlpStatus{Code: int(span.Status), Message: span.StatusMessage},
+	}
+	for _, event := range span.Events {
+		item.Events = append(item.Events, OtlpEvent{
+			TimeUnixNano: unixNano(event.Time),
+			Name:         event.Name,
+			Attributes:   toKeyValues(event.Attributes),
+		})
+	}
+	return item
+}
+
+// ParseOtlpRequest 解析OTLP/JSON请求体，返回所有span
+func ParseOtlpRequest(body []byte) ([]OtlpSpan, error) {
+	var req OtlpTracesRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		return nil, err
+	}
+	if len(req.ResourceSpans) == 0 {
+		return nil, errors.New("resourceSpans is empty")
+	}
+	var spans []OtlpSpan
+	for _, resourceSpans := range req.ResourceSpans {
+		for _, scopeSpans := range resourceSpans.ScopeSpans {
+			spans = append(spans, scopeSpans.Spans...)
+		}
+	}
+	return spans, nil
+}
+
+func unixNano(t time.Time) string {
+	if t.IsZero() {
+		return "0"
+	}
+	return strconv.FormatInt(t.UnixNano(), 10)
+}
+
+func toKeyValues(attributes map[string]string) []OtlpKeyValue {
+	if len(attributes) == 0 {
+		return nil
+	}
+	var keys []string
+	for k := range attributes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var list []OtlpKeyValue
+	for _, k := range keys {
+		list = append(list, stringKeyValue(k, attributes[k]))
+	}
+	return list
+}
+
+func stringKeyValue(key, value string) OtlpKeyValue {
+	return OtlpKeyValue{Key: key, Value: OtlpAnyValue{StringValue: value}}
+}
+
+// OtlpTracesRequest OTLP/JSON ExportTraceServiceRequest
+type OtlpTracesRequest struct {
+	ResourceSpans []OtlpResourceSpans `json:"resourceSpans"`
+}
+
+type OtlpResourceSpans struct {
+	Resource   OtlpResource     `json:"resource"`
+	ScopeSpans []OtlpScopeSpans `json:"scopeSpans"`
+}
+
+type OtlpResource struct {
+	Attributes []OtlpKeyValue `json:"attributes,omitempty"`
+}
+
+type OtlpScopeSpans struct {
+	Scope OtlpScope  `json:"scope"`
+	Spans []OtlpSpan `json:"spans"`
+}
+
+type OtlpScope struct {
+	Name    string `json:"name"`
+	Version string `json:"version,omitempty"`
+}
+
+// OtlpSpan OTLP/JSON span，traceId和spanId使用十六进制编码，时间使用字符串表示的纳秒
+type OtlpSpan struct {
+	TraceId           string         `json:"traceId"`
+	SpanId            string         `json:"spanId"`
+	TraceState        string         `json:"traceState,omitempty"`
+	ParentSpanId      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []OtlpKeyValue `json:"attributes,omitempty"`
+	Events            []OtlpEvent    `json:"events,omitempty"`
+	Status            OtlpStatus     `json:"status"`
+}
+
+// Attribute 获取属性值
+func (s OtlpSpan) Attribute(key string) string {
+	for _, item := range s.Attributes {
+		if item.Key == key {
+			return item.Value.StringValue
+		}
+	}
+	return ""
+}
+
+type OtlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []OtlpKeyValue `json:"attributes,omitempty"`
+}
+
+type OtlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type OtlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value OtlpAnyValue `json:"value"`
+}
+
+type OtlpAnyValue struct {
+	StringValue string `json:"stringValue"`
+}
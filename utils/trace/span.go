@@ -0,0 +1,144 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trace
+
+import (
+	"sync"
+	"time"
+)
+
+// SpanKind 与OpenTelemetry SpanKind取值一致
+type SpanKind int
+
+const (
+	SpanKindUnspecified SpanKind = 0
+	SpanKindInternal    SpanKind = 1
+	SpanKindServer      SpanKind = 2
+	SpanKindClient      SpanKind = 3
+	SpanKindProducer    SpanKind = 4
+	SpanKindConsumer    SpanKind = 5
+)
+
+// StatusCode 与OpenTelemetry StatusCode取值一致
+type StatusCode int
+
+const (
+	StatusUnset StatusCode = 0
+	StatusOk    StatusCode = 1
+	StatusError StatusCode = 2
+)
+
+// SpanEvent span事件
+type SpanEvent struct {
+	Name       string
+	Time       time.Time
+	Attributes map[string]string
+}
+
+// Span 一次操作的链路记录
+type Span struct {
+	SpanContext
+	// ParentSpanId 父spanId，根span为空
+	ParentSpanId string
+	Name         string
+	Kind         SpanKind
+	StartTime    time.Time
+	EndTime      time.Time
+	Attributes   map[string]string
+	Events       []SpanEvent
+	Status       StatusCode
+	// StatusMessage 错误信息
+	StatusMessage string
+	ended         bool
+	lock          sync.Mutex
+}
+
+// StartSpan 创建并开始一个span，如果parent有效，则继承其traceId、采样标志和tracestate，否则开始一条新的链路
+func StartSpan(name string, kind SpanKind, parent SpanContext) *Span {
+	span := &Span{
+		Name:       name,
+		Kind:       kind,
+		StartTime:  time.Now(),
+		Attributes: make(map[string]string),
+	}
+	if parent.IsValid() {
+		span.TraceId = parent.TraceId
+		span.Sampled = parent.Sampled
+		span.TraceState = parent.TraceState
+		span.ParentSpanId = parent.SpanId
+	} else {
+		span.TraceId = NewTraceId()
+		span.Sampled = true
+	}
+	span.SpanId = NewSpanId()
+	return span
+}
+
+// Context 获取span上下文，用于传递给下游
+func (s *Span) Context() SpanContext {
+	return s.SpanContext
+}
+
+// SetAttribute 设置属性
+func (s *Span) SetAttribute(key, value string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Attributes[key] = value
+}
+
+// AddEvent 增加事件
+func (s *Span) AddEvent(name string, attributes map[string]string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Events = append(s.Events, SpanEvent{Name: name, Time: time.Now(), Attributes: attributes})
+}
+
+// SetError 设置错误状态，err为nil则忽略
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.Status = StatusError
+	s.StatusMessage = err.Error()
+}
+
+// End 结束span，只有第一次调用生效，返回是否是第一次调用
+func (s *Span) End() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.ended {
+		return false
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	return true
+}
+
+// Ended 是否已经结束
+func (s *Span) Ended() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.ended
+}
+
+// SpanExporter span导出器接口，例如：OtlpHttpExporter
+type SpanExporter interface {
+	// Export 导出已经结束的span列表
+	Export(spans []*Span) error
+}
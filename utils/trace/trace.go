@@ -0,0 +1,156 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package trace provides a lightweight, OpenTelemetry compatible distributed tracing model for RuleGo.
+// It includes W3C Trace Context (traceparent/tracestate) propagation, a span data model
+// and a pluggable span exporter with an OTLP/JSON over HTTP implementation.
+//
+// Key features:
+// - SpanContext: W3C traceparent parsing and formatting
+// - Extract/Inject: Propagate the trace context through headers or message metadata
+// - Span: A finished or in-flight unit of work, see aspect.TracingAspect
+// - SpanExporter: Pluggable exporter interface, see OtlpHttpExporter
+// - Envelope: Carries the trace context in the payload for transports without headers, e.g. MQTT 3.1.1
+package trace
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	// TraceParentKey W3C traceparent header and metadata key
+	TraceParentKey = "traceparent"
+	// TraceStateKey W3C tracestate header and metadata key
+	TraceStateKey = "tracestate"
+)
+
+const (
+	traceParentVersion = "00"
+	flagSampled        = "01"
+	flagNotSampled     = "00"
+	zeroTraceId        = "00000000000000000000000000000000"
+	zeroSpanId         = "0000000000000000"
+)
+
+// SpanContext 跨进程传递的链路上下文
+type SpanContext struct {
+	// TraceId 32位小写十六进制
+	TraceId string
+	// SpanId 16位小写十六进制
+	SpanId string
+	// Sampled 是否采样
+	Sampled bool
+	// TraceState W3C tracestate，原样传递
+	TraceState string
+}
+
+// IsValid 是否是有效的链路上下文
+func (sc SpanContext) IsValid() bool {
+	return isHex(sc.TraceId, 32) && sc.TraceId != zeroTraceId && isHex(sc.SpanId, 16) && sc.SpanId != zeroSpanId
+}
+
+// TraceParent 转换成W3C traceparent格式：{version}-{traceId}-{spanId}-{flags}
+func (sc SpanContext) TraceParent() string {
+	flags := flagNotSampled
+	if sc.Sampled {
+		flags = flagSampled
+	}
+	return traceParentVersion + "-" + sc.TraceId + "-" + sc.SpanId + "-" + flags
+}
+
+// ParseTraceParent 解析W3C traceparent，无效返回false
+func ParseTraceParent(traceParent string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(traceParent), "-")
+	if len(parts) < 4 {
+		return SpanContext{}, false
+	}
+	version := parts[0]
+	// 版本ff无效；00版本必须正好4段，更高版本允许追加字段
+	if !isHex(version, 2) || version == "ff" || (version == traceParentVersion && len(parts) != 4) {
+		return SpanContext{}, false
+	}
+	if !isHex(parts[3], 2) {
+		return SpanContext{}, false
+	}
+	flags, _ := hex.DecodeString(parts[3])
+	sc := SpanContext{
+		TraceId: parts[1],
+		SpanId:  parts[2],
+		Sampled: flags[0]&0x01 == 0x01,
+	}
+	if !sc.IsValid() {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+// Extract 通过getter读取traceparent和tracestate，例如：http.Header.Get 或者 types.Metadata.GetValue
+func Extract(getter func(key string) string) (SpanContext, bool) {
+	if getter == nil {
+		return SpanContext{}, false
+	}
+	sc, ok := ParseTraceParent(getter(TraceParentKey))
+	if ok {
+		sc.TraceState = getter(TraceStateKey)
+	}
+	return sc, ok
+}
+
+// Inject 通过setter写入traceparent和tracestate，例如：http.Header.Set 或者 types.Metadata.PutValue
+func Inject(sc SpanContext, setter func(key, value string)) {
+	if setter == nil || !sc.IsValid() {
+		return
+	}
+	setter(TraceParentKey, sc.TraceParent())
+	if sc.TraceState != "" {
+		setter(TraceStateKey, sc.TraceState)
+	}
+}
+
+// NewTraceId 生成随机traceId
+func NewTraceId() string {
+	return randomHex(16, zeroTraceId)
+}
+
+// NewSpanId 生成随机spanId
+func NewSpanId() string {
+	return randomHex(8, zeroSpanId)
+}
+
+func randomHex(n int, zero string) string {
+	b := make([]byte, n)
+	for {
+		_, _ = rand.Read(b)
+		if v := hex.EncodeToString(b); v != zero {
+			return v
+		}
+	}
+}
+
+// isHex 是否是指定长度的小写十六进制字符串
+func isHex(s string, length int) bool {
+	if len(s) != length {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,155 @@
+/*
+ * Copyright 2024 The RuleGo Authors.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package trace
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rulego/rulego/test/assert"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	sc, ok := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	assert.True(t, ok)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceId)
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanId)
+	assert.True(t, sc.Sampled)
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.TraceParent())
+
+	sc, ok = ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00")
+	assert.True(t, ok)
+	assert.False(t, sc.Sampled)
+	//更高版本允许追加字段
+	_, ok = ParseTraceParent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra")
+	assert.True(t, ok)
+
+	for _, item := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+	} {
+		_, ok = ParseTraceParent(item)
+		if ok {
+			t.Errorf("traceparent %s should be invalid", item)
+		}
+	}
+}
+
+func TestExtractAndInject(t *testing.T) {
+	header := http.Header{}
+	_, ok := Extract(header.Get)
+	assert.False(t, ok)
+
+	span := StartSpan("test", SpanKindServer, SpanContext{})
+	assert.True(t, span.IsValid())
+	assert.True(t, span.Sampled)
+	assert.Equal(t, "", span.ParentSpanId)
+	span.TraceState = "rulego=1"
+	Inject(span.Context(), header.Set)
+	assert.Equal(t, span.TraceParent(), header.Get("Traceparent"))
+
+	metadata := map[string]string{}
+	sc, ok := Extract(header.Get)
+	assert.True(t, ok)
+	Inject(sc, func(key, value string) {
+		metadata[key] = value
+	})
+	assert.Equal(t, span.TraceParent(), metadata[TraceParentKey])
+	assert.Equal(t, "rulego=1", metadata[TraceStateKey])
+
+	child := StartSpan("child", SpanKindInternal, sc)
+	assert.Equal(t, span.TraceId, child.TraceId)
+	assert.Equal(t, span.SpanId, child.ParentSpanId)
+	assert.Equal(t, "rulego=1", child.TraceState)
+	assert.True(t, child.SpanId != span.SpanId)
+
+	child.SetError(errors.New("error"))
+	assert.True(t, child.End())
+	assert.False(t, child.End())
+	assert.Equal(t, StatusError, child.Status)
+}
+
+func TestEnvelope(t *testing.T) {
+	sc, _ := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	sc.TraceState = "k=v"
+	data := WrapEnvelope(sc, []byte{0x00, 0xFF, '{'})
+	unwrapped, payload, ok := UnwrapEnvelope(data)
+	assert.True(t, ok)
+	assert.Equal(t, sc, unwrapped)
+	assert.Equal(t, []byte{0x00, 0xFF, '{'}, payload)
+
+	_, payload, ok = UnwrapEnvelope(WrapEnvelope(sc, nil))
+	assert.True(t, ok)
+	assert.Equal(t, 0, len(payload))
+
+	//无效的链路上下文不封装
+	assert.Equal(t, "abc", string(WrapEnvelope(SpanContext{}, []byte("abc"))))
+	//业务数据不是信封
+	for _, item := range []string{
+		"abc",
+		`{"traceparent":"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01","temperature":41}`,
+		`{"traceparent":"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}`,
+		`{"traceparent":"invalid","payload":"YWJj"}`,
+	} {
+		_, _, ok = UnwrapEnvelope([]byte(item))
+		assert.False(t, ok)
+	}
+}
+
+func TestOtlpHttpExporter(t *testing.T) {
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, _ = io.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	span := StartSpan("test", SpanKindServer, SpanContext{})
+	span.SetAttribute("key", "value")
+	span.AddEvent("event", map[string]string{"a": "b"})
+	span.End()
+
+	exporter := NewOtlpHttpExporter(server.URL)
+	assert.Equal(t, server.URL+"/v1/traces", exporter.Endpoint)
+	assert.NotNil(t, exporter.Export([]*Span{span}))
+
+	exporter.Headers = map[string]string{"Authorization": "token"}
+	assert.Nil(t, exporter.Export([]*Span{span}))
+	spans, err := ParseOtlpRequest(body)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(spans))
+	assert.Equal(t, span.TraceId, spans[0].TraceId)
+	assert.Equal(t, span.SpanId, spans[0].SpanId)
+	assert.Equal(t, int(SpanKindServer), spans[0].Kind)
+	assert.Equal(t, "value", spans[0].Attribute("key"))
+	assert.Equal(t, "event", spans[0].Events[0].Name)
+
+	//指定了路径则不追加
+	assert.Equal(t, "http://127.0.0.1:4318/otlp/v1/traces", NewOtlpHttpExporter("http://127.0.0.1:4318/otlp/v1/traces").Endpoint)
+}